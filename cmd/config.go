@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/appclacks/server/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func buildConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Configuration related commands",
+	}
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Validates the configuration and prints it once resolved, with secrets redacted",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := checkConfig()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(2)
+			}
+		},
+	}
+	configCmd.AddCommand(checkCmd)
+	return configCmd
+}
+
+func checkConfig() error {
+	config, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	err = encoder.Encode(config.Redacted())
+	if err != nil {
+		return fmt.Errorf("fail to serialize the configuration: %w", err)
+	}
+	return encoder.Close()
+}
@@ -3,30 +3,21 @@ package cmd
 import (
 	"log/slog"
 	"os"
+
+	"github.com/appclacks/server/internal/reload"
 )
 
-func buildLogger(level string, format string) *slog.Logger {
+func buildLogger(level string, format string) (*slog.Logger, *slog.LevelVar) {
 	var programLevel = new(slog.LevelVar)
-	switch level {
-	case "debug":
-		programLevel.Set(slog.LevelDebug)
-	case "info":
-		programLevel.Set(slog.LevelInfo)
-	case "warn":
-		programLevel.Set(slog.LevelWarn)
-	case "error":
-		programLevel.Set(slog.LevelError)
-	default:
-		programLevel.Set(slog.LevelInfo)
-	}
+	programLevel.Set(reload.ToLogLevel(level))
 
 	options := &slog.HandlerOptions{Level: programLevel}
 	switch format {
 	case "text":
-		return slog.New(slog.NewTextHandler(os.Stdout, options))
+		return slog.New(slog.NewTextHandler(os.Stdout, options)), programLevel
 	case "json":
-		return slog.New(slog.NewJSONHandler(os.Stdout, options))
+		return slog.New(slog.NewJSONHandler(os.Stdout, options)), programLevel
 	default:
-		return slog.New(slog.NewTextHandler(os.Stdout, options))
+		return slog.New(slog.NewTextHandler(os.Stdout, options)), programLevel
 	}
 }
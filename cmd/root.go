@@ -23,5 +23,6 @@ func Run() error {
 
 	serverCmd := buildServerCmd()
 	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(buildConfigCmd())
 	return rootCmd.Execute()
 }
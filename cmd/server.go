@@ -9,9 +9,13 @@ import (
 	"syscall"
 
 	"github.com/appclacks/server/config"
+	"github.com/appclacks/server/internal/cache"
 	"github.com/appclacks/server/internal/database"
+	"github.com/appclacks/server/internal/filesync"
 	"github.com/appclacks/server/internal/http"
 	"github.com/appclacks/server/internal/http/handlers"
+	"github.com/appclacks/server/internal/reload"
+	"github.com/appclacks/server/internal/statsd"
 	"github.com/appclacks/server/pkg/healthcheck"
 	"github.com/appclacks/server/pkg/pushgateway"
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,7 +25,6 @@ import (
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
-	"gopkg.in/yaml.v3"
 )
 
 func buildServerCmd() *cobra.Command {
@@ -29,8 +32,8 @@ func buildServerCmd() *cobra.Command {
 		Use:   "server",
 		Short: "Runs the HTTP server",
 		Run: func(cmd *cobra.Command, args []string) {
-			logger := buildLogger(logLevel, logFormat)
-			err := runServer(logger)
+			logger, level := buildLogger(logLevel, logFormat)
+			err := runServer(logger, level)
 			if err != nil {
 				logger.Error(err.Error())
 				os.Exit(2)
@@ -41,30 +44,70 @@ func buildServerCmd() *cobra.Command {
 	return serverCmd
 }
 
-func runServer(logger *slog.Logger) error {
-	file, err := os.ReadFile(configFile)
+func runServer(logger *slog.Logger, level *slog.LevelVar) error {
+	config, err := config.Load(configFile)
 	if err != nil {
-		return fmt.Errorf("fail to read configuration file: %w", err)
-	}
-	var config config.Configuration
-	if err := yaml.Unmarshal(file, &config); err != nil {
-		return fmt.Errorf("fail to parse yaml configuration file: %w", err)
+		return err
 	}
+	level.Set(reload.LogLevel(config, reload.ToLogLevel(logLevel)))
 	store, err := database.New(logger, config.Database, config.Healthchecks.Probers)
 	if err != nil {
 		return err
 	}
 	registry := prometheus.DefaultRegisterer.(*prometheus.Registry)
-	healthcheckService := healthcheck.New(logger, store)
-	pushgatewayService, err := pushgateway.New(logger, store, registry)
+	healthcheckService, err := healthcheck.New(logger, store, registry)
+	if err != nil {
+		return err
+	}
+	heartbeatInterval, err := reload.HeartbeatInterval(config)
+	if err != nil {
+		return err
+	}
+	healthcheckService.SetHeartbeatInterval(heartbeatInterval)
+	var pushgatewayStore pushgateway.Store = store
+	var cacheStore *cache.Store
+	if config.Pushgateway.Cache.Enabled {
+		cacheStore, err = cache.New(logger, config.Pushgateway.Cache, store, registry)
+		if err != nil {
+			return err
+		}
+		err = cacheStore.Start(context.Background())
+		if err != nil {
+			return err
+		}
+		pushgatewayStore = cacheStore
+	}
+	pushgatewayService, err := pushgateway.New(logger, pushgatewayStore, registry)
+	if err != nil {
+		return err
+	}
+	cleanupInterval, err := reload.CleanupInterval(config)
 	if err != nil {
 		return err
 	}
-	handlersBuilder := handlers.NewBuilder(healthcheckService, pushgatewayService)
+	pushgatewayService.SetCleanupInterval(cleanupInterval)
+	remoteWriteConfig, err := reload.RemoteWriteConfig(config)
+	if err != nil {
+		return err
+	}
+	pushgatewayService.SetRemoteWriteConfig(remoteWriteConfig)
+	pushgatewayService.SetOTLPConfig(reload.OTLPConfig(config))
+	pushgatewayService.SetInfluxConfig(pushgateway.InfluxConfig{TTL: config.Pushgateway.Influx.TTL})
+	pushgatewayService.SetLimits(reload.Limits(config))
+	pushgatewayService.SetTypeConflictPolicy(config.Pushgateway.TypeConflict)
+	if config.HTTP.Metrics.PushgatewayMode() != http.PushgatewaySeparate {
+		err = registry.Register(pushgateway.NewCollector(pushgatewayService, registry))
+		if err != nil {
+			return err
+		}
+	}
+	reloader := reload.New(logger, configFile, config, level, reload.ToLogLevel(logLevel), store, healthcheckService, pushgatewayService)
+	handlersBuilder := handlers.NewBuilder(healthcheckService, pushgatewayService, reloader)
 	server, err := http.NewServer(logger, config.HTTP, registry, handlersBuilder)
 	if err != nil {
 		return err
 	}
+	reloader.SetServer(server)
 	ctx := context.Background()
 	exp, err := otlptracehttp.New(ctx)
 	if err != nil {
@@ -92,21 +135,62 @@ func runServer(logger *slog.Logger) error {
 	signal.Notify(
 		signals,
 		syscall.SIGINT,
-		syscall.SIGTERM)
+		syscall.SIGTERM,
+		syscall.SIGHUP)
 
+	var fileWatcher *filesync.Watcher
+	if config.Healthchecks.Directory != "" {
+		fileWatcher, err = filesync.New(logger, config.Healthchecks.Directory, healthcheckService)
+		if err != nil {
+			return err
+		}
+	}
+	var statsdServer *statsd.Server
+	if config.StatsD.Enabled() {
+		statsdServer, err = statsd.New(logger, config.StatsD, pushgatewayService, registry)
+		if err != nil {
+			return err
+		}
+	}
 	err = server.Start()
 	if err != nil {
 		return err
 	}
 	pushgatewayService.Start()
+	healthcheckService.Start()
+	if fileWatcher != nil {
+		fileWatcher.Start()
+	}
+	if statsdServer != nil {
+		err = statsdServer.Start()
+		if err != nil {
+			return err
+		}
+	}
 	go func() {
 		for sig := range signals {
 			switch sig {
+			case syscall.SIGHUP:
+				logger.Info(fmt.Sprintf("received signal %s, reloading configuration", sig))
+				_, _, err := reloader.Reload(context.Background())
+				if err != nil {
+					logger.Error(err.Error())
+				}
 			case syscall.SIGINT, syscall.SIGTERM:
 				logger.Info(fmt.Sprintf("received signal %s, starting shutdown", sig))
 				signal.Stop(signals)
+				if statsdServer != nil {
+					statsdServer.Stop()
+				}
+				if fileWatcher != nil {
+					fileWatcher.Stop()
+				}
 				pushgatewayService.Stop()
+				healthcheckService.Stop()
 				err := server.Stop()
+				if cacheStore != nil {
+					cacheStore.Stop()
+				}
 				if err != nil {
 					errChan <- err
 				}
@@ -1,16 +1,169 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/appclacks/server/internal/cache"
 	"github.com/appclacks/server/internal/database"
 	"github.com/appclacks/server/internal/http"
+	"github.com/appclacks/server/internal/statsd"
+	"github.com/appclacks/server/internal/validator"
+	"gopkg.in/yaml.v3"
 )
 
 type Healthchecks struct {
-	Probers uint
+	Probers           uint
+	HeartbeatInterval string `yaml:"heartbeat-interval"`
+	// directory of YAML and JSON files defining healthchecks
+	Directory string
+}
+
+// LabelRule matches series having a label value fully matching the regex
+type LabelRule struct {
+	Label string `validate:"required"`
+	Regex string `validate:"required"`
+}
+
+type RemoteWrite struct {
+	TTL   string      `yaml:"ttl"`
+	Allow []LabelRule `validate:"dive"`
+	Deny  []LabelRule `validate:"dive"`
+}
+
+type OTLP struct {
+	TTL                          string   `yaml:"ttl"`
+	PromoteResourceAttributes    []string `yaml:"promote-resource-attributes"`
+	PromoteAllResourceAttributes bool     `yaml:"promote-all-resource-attributes"`
+	IgnoreResourceAttributes     []string `yaml:"ignore-resource-attributes"`
+}
+
+type Influx struct {
+	TTL string `yaml:"ttl"`
+}
+
+// Limits are the cardinality limits of the pushgateway, 0 disables a limit
+type Limits struct {
+	MaxSeries           uint `yaml:"max-series"`
+	MaxSeriesPerMetric  uint `yaml:"max-series-per-metric"`
+	MaxLabelsPerSeries  uint `yaml:"max-labels-per-series"`
+	MaxLabelValueLength uint `yaml:"max-label-value-length"`
+}
+
+type Pushgateway struct {
+	CleanupInterval string      `yaml:"cleanup-interval"`
+	RemoteWrite     RemoteWrite `yaml:"remote-write"`
+	OTLP            OTLP        `yaml:"otlp"`
+	Influx          Influx      `yaml:"influx"`
+	Limits          Limits      `yaml:"limits"`
+	TypeConflict    string      `yaml:"type-conflict" validate:"omitempty,oneof=reject coerce"`
+	Cache           cache.Configuration
+}
+
+type Logging struct {
+	Level string `validate:"omitempty,oneof=debug info warn error"`
 }
 
 type Configuration struct {
 	HTTP         http.Configuration
 	Database     database.Configuration
 	Healthchecks Healthchecks
+	Pushgateway  Pushgateway
+	StatsD       statsd.Configuration `yaml:"statsd"`
+	Logging      Logging
+}
+
+// Load reads, parses and validates the configuration file.
+// ${VAR} references are replaced by environment variables values, then
+// APPCLACKS_* environment variables override the configuration fields
+// and secrets are read from their files.
+func Load(path string) (*Configuration, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read configuration file: %w", err)
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(file, &document); err != nil {
+		return nil, fmt.Errorf("fail to parse yaml configuration file: %w", err)
+	}
+	if err := interpolateNode(&document); err != nil {
+		return nil, err
+	}
+	var config Configuration
+	if len(document.Content) > 0 {
+		if err := document.Decode(&config); err != nil {
+			return nil, fmt.Errorf("fail to parse yaml configuration file: %w", err)
+		}
+	}
+	if err := applyEnv(envPrefix, reflect.ValueOf(&config).Elem()); err != nil {
+		return nil, err
+	}
+	if err := config.readSecretFiles(); err != nil {
+		return nil, err
+	}
+	if err := validator.Validator.Struct(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if config.Pushgateway.CleanupInterval != "" {
+		interval, err := time.ParseDuration(config.Pushgateway.CleanupInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pushgateway cleanup interval: %w", err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("the pushgateway cleanup interval should be positive")
+		}
+	}
+	if config.Healthchecks.HeartbeatInterval != "" {
+		interval, err := time.ParseDuration(config.Healthchecks.HeartbeatInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthchecks heartbeat interval: %w", err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("the healthchecks heartbeat interval should be positive")
+		}
+	}
+	if config.Pushgateway.RemoteWrite.TTL != "" {
+		ttl, err := time.ParseDuration(config.Pushgateway.RemoteWrite.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pushgateway remote write TTL: %w", err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("the pushgateway remote write TTL should be positive")
+		}
+	}
+	rules := append([]LabelRule{}, config.Pushgateway.RemoteWrite.Allow...)
+	for _, rule := range append(rules, config.Pushgateway.RemoteWrite.Deny...) {
+		if _, err := regexp.Compile(rule.Regex); err != nil {
+			return nil, fmt.Errorf("invalid pushgateway remote write regex for label %s: %w", rule.Label, err)
+		}
+	}
+	otlp := config.Pushgateway.OTLP
+	if otlp.TTL != "" {
+		ttl, err := time.ParseDuration(otlp.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pushgateway OTLP TTL: %w", err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("the pushgateway OTLP TTL should be positive")
+		}
+	}
+	if otlp.PromoteAllResourceAttributes && len(otlp.PromoteResourceAttributes) > 0 {
+		return nil, fmt.Errorf("pushgateway OTLP promote-all-resource-attributes and promote-resource-attributes are mutually exclusive")
+	}
+	if !otlp.PromoteAllResourceAttributes && len(otlp.IgnoreResourceAttributes) > 0 {
+		return nil, fmt.Errorf("pushgateway OTLP ignore-resource-attributes can only be used with promote-all-resource-attributes")
+	}
+	if config.Pushgateway.Influx.TTL != "" {
+		ttl, err := time.ParseDuration(config.Pushgateway.Influx.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pushgateway InfluxDB TTL: %w", err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("the pushgateway InfluxDB TTL should be positive")
+		}
+	}
+	return &config, nil
 }
@@ -0,0 +1,109 @@
+package config_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appclacks/server/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	assert.NoError(t, err)
+	return path
+}
+
+const baseConfig = `
+http:
+  host: 127.0.0.1
+  port: ${TEST_APPCLACKS_PORT}
+  basic-auth:
+    username: ${TEST_APPCLACKS_USER}
+    password: "pa$${NOT_A_VAR}"
+  metrics:
+    basic-auth:
+      password: ${TEST_APPCLACKS_METRICS_PASSWORD}
+database:
+  username: appclacks
+  database: appclacks
+  host: 127.0.0.1
+  port: 5432
+  password-file: %s
+`
+
+func fmtConfig(passwordFile string) string {
+	return fmt.Sprintf(baseConfig, passwordFile)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := writeFile(t, dir, "password", "secret\n")
+	configFile := writeFile(t, dir, "config.yaml", fmtConfig(passwordFile))
+
+	t.Setenv("TEST_APPCLACKS_USER", "user")
+	t.Setenv("TEST_APPCLACKS_PORT", "9000")
+	// the values are not parsed as YAML
+	t.Setenv("TEST_APPCLACKS_METRICS_PASSWORD", "p#ss: \"word\"\nhost: evil")
+	t.Setenv("APPCLACKS_DATABASE_PORT", "5433")
+	t.Setenv("APPCLACKS_HTTP_METRICS_BASIC_AUTH_USERNAME", "metrics")
+	t.Setenv("APPCLACKS_HEALTHCHECKS_PROBERS", "3")
+
+	result, err := config.Load(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", result.HTTP.BasicAuth.Username)
+	assert.Equal(t, "pa${NOT_A_VAR}", result.HTTP.BasicAuth.Password)
+	assert.Equal(t, "metrics", result.HTTP.Metrics.BasicAuth.Username)
+	assert.Equal(t, "p#ss: \"word\"\nhost: evil", result.HTTP.Metrics.BasicAuth.Password)
+	assert.Equal(t, uint32(9000), result.HTTP.Port)
+	assert.Equal(t, "127.0.0.1", result.HTTP.Host)
+	assert.Equal(t, uint(5433), result.Database.Port)
+	assert.Equal(t, "secret", result.Database.Password)
+	assert.Equal(t, uint(3), result.Healthchecks.Probers)
+
+	redacted := result.Redacted()
+	assert.Equal(t, "<redacted>", redacted.Database.Password)
+	assert.Equal(t, "<redacted>", redacted.HTTP.BasicAuth.Password)
+	assert.Equal(t, "<redacted>", redacted.HTTP.Metrics.BasicAuth.Password)
+	assert.Equal(t, "secret", result.Database.Password)
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := writeFile(t, dir, "password", "secret")
+	configFile := writeFile(t, dir, "config.yaml", fmtConfig(passwordFile))
+
+	t.Setenv("TEST_APPCLACKS_PORT", "9000")
+	t.Setenv("TEST_APPCLACKS_METRICS_PASSWORD", "")
+	_, err := config.Load(configFile)
+	assert.ErrorContains(t, err, "TEST_APPCLACKS_USER")
+
+	t.Setenv("TEST_APPCLACKS_USER", "user")
+	t.Setenv("APPCLACKS_DATABASE_PORT", "abc")
+	_, err = config.Load(configFile)
+	assert.ErrorContains(t, err, "APPCLACKS_DATABASE_PORT")
+
+	t.Setenv("APPCLACKS_DATABASE_PORT", "5432")
+	t.Setenv("APPCLACKS_DATABASE_PASSWORD", "secret")
+	_, err = config.Load(configFile)
+	assert.ErrorContains(t, err, "mutually exclusive")
+
+	t.Setenv("APPCLACKS_DATABASE_PASSWORD", "")
+	t.Setenv("APPCLACKS_PUSHGATEWAY_REMOTE_WRITE_TTL", "-1m")
+	_, err = config.Load(configFile)
+	assert.ErrorContains(t, err, "remote write TTL should be positive")
+
+	t.Setenv("APPCLACKS_PUSHGATEWAY_REMOTE_WRITE_TTL", "")
+	t.Setenv("APPCLACKS_HEALTHCHECKS_HEARTBEAT_INTERVAL", "0s")
+	_, err = config.Load(configFile)
+	assert.ErrorContains(t, err, "heartbeat interval should be positive")
+
+	t.Setenv("APPCLACKS_HEALTHCHECKS_HEARTBEAT_INTERVAL", "")
+	t.Setenv("APPCLACKS_PUSHGATEWAY_OTLP_IGNORE_RESOURCE_ATTRIBUTES", "host.name")
+	_, err = config.Load(configFile)
+	assert.ErrorContains(t, err, "can only be used with promote-all-resource-attributes")
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "APPCLACKS"
+
+var interpolationRegex = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateNode replaces the ${VAR} references of the scalar values of a
+// parsed YAML document, so the variables values are never parsed as YAML
+func interpolateNode(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		value, err := interpolate(node.Value)
+		if err != nil {
+			return err
+		}
+		if value != node.Value {
+			node.Value = value
+			// the type of untagged plain values is resolved again, a
+			// variable can be used for a port
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+		return nil
+	}
+	for i, child := range node.Content {
+		// mapping keys are not interpolated
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if err := interpolateNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpolate replaces ${VAR} references by the value of the VAR environment variable.
+// $${VAR} can be used to produce a literal ${VAR}.
+func interpolate(content string) (string, error) {
+	var err error
+	result := interpolationRegex.ReplaceAllStringFunc(content, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		name := match[2 : len(match)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("environment variable %s referenced in the configuration is not set", name)
+			}
+			return match
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// yamlKey returns the key used for a struct field in the YAML configuration
+func yamlKey(field reflect.StructField) string {
+	tag := field.Tag.Get("yaml")
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+func envName(prefix string, key string) string {
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// applyEnv overrides the configuration fields with environment variables.
+// The variable name is built from the YAML path of the field, for example
+// APPCLACKS_DATABASE_PASSWORD or APPCLACKS_HTTP_BASIC_AUTH_PASSWORD_FILE
+func applyEnv(prefix string, value reflect.Value) error {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() || field.Tag.Get("yaml") == "-" {
+			continue
+		}
+		name := envName(prefix, yamlKey(field))
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Struct {
+			if err := applyEnv(name, fieldValue); err != nil {
+				return err
+			}
+			continue
+		}
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(fieldValue, envValue); err != nil {
+			return fmt.Errorf("invalid value for environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(value reflect.Value, envValue string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(envValue)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(envValue)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(envValue, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(envValue, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(envValue, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", value.Type())
+		}
+		items := []string{}
+		for _, item := range strings.Split(envValue, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const redacted = "<redacted>"
+
+// readSecretFile sets value to the content of the file if a file is configured
+func readSecretFile(value *string, path string, name string) error {
+	if path == "" {
+		return nil
+	}
+	if *value != "" {
+		return fmt.Errorf("%s and %s-file are mutually exclusive", name, name)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("fail to read %s file: %w", name, err)
+	}
+	*value = strings.TrimRight(string(content), "\r\n")
+	return nil
+}
+
+func (c *Configuration) readSecretFiles() error {
+	if err := readSecretFile(&c.Database.Password, c.Database.PasswordFile, "database.password"); err != nil {
+		return err
+	}
+	if err := readSecretFile(&c.HTTP.BasicAuth.Password, c.HTTP.BasicAuth.PasswordFile, "http.basic-auth.password"); err != nil {
+		return err
+	}
+	if err := readSecretFile(&c.HTTP.Metrics.BasicAuth.Password, c.HTTP.Metrics.BasicAuth.PasswordFile, "http.metrics.basic-auth.password"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func redact(value reflect.Value) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Struct {
+			redact(fieldValue)
+			continue
+		}
+		if field.Tag.Get("secret") == "true" && fieldValue.Kind() == reflect.String && fieldValue.String() != "" {
+			fieldValue.SetString(redacted)
+		}
+	}
+}
+
+// Redacted returns a copy of the configuration with secrets hidden
+func (c Configuration) Redacted() Configuration {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
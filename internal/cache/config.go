@@ -0,0 +1,14 @@
+package cache
+
+// Configuration of the in-memory pushgateway store.
+// With the async durability, writes are acknowledged once in memory and
+// persisted every flush interval. With the sync durability, writes are
+// persisted before being acknowledged and rolled back if they can't be
+// persisted. MaxPending bounds the number of
+// changes not persisted yet, a write reaching it waits for a flush.
+type Configuration struct {
+	Enabled       bool
+	FlushInterval string `yaml:"flush-interval"`
+	Durability    string `validate:"omitempty,oneof=async sync"`
+	MaxPending    uint   `yaml:"max-pending"`
+}
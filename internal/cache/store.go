@@ -0,0 +1,1139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/appclacks/server/internal/util"
+	"github.com/appclacks/server/internal/validator"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultFlushInterval = time.Second
+	defaultMaxPending    = 10000
+)
+
+// Backend persists the metrics of the cache and notifies it of the
+// changes done by other servers
+type Backend interface {
+	GetMetrics(ctx context.Context, query aggregates.Query) ([]*aggregates.PushgatewayMetric, error)
+	GetGroups(ctx context.Context) ([]*aggregates.PushgatewayGroup, error)
+	WritePushgatewayChanges(ctx context.Context, changes aggregates.PushgatewayChanges) ([]aggregates.BatchResult, error)
+	GetMetricsByIDs(ctx context.Context, ids []string) ([]*aggregates.PushgatewayMetric, error)
+	ListenPushgatewayChanges(fn func(notification aggregates.PushgatewayNotification)) (func() error, error)
+	RegisterMetricFamilies(ctx context.Context, families []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error)
+	GetMetricFamilies(ctx context.Context) ([]*aggregates.MetricFamily, error)
+	UpdateMetricFamily(ctx context.Context, family aggregates.MetricFamily) error
+	DeleteMetricFamily(ctx context.Context, name string) error
+}
+
+// changes are the changes not persisted yet. Metrics and groups are
+// referenced by key, their current state being written.
+type changes struct {
+	deleteAll     bool
+	metrics       map[string]bool
+	deletedIDs    map[string]bool
+	groups        map[string]bool
+	deletedGroups map[string]map[string]string
+}
+
+func newChanges() changes {
+	return changes{
+		metrics:       make(map[string]bool),
+		deletedIDs:    make(map[string]bool),
+		groups:        make(map[string]bool),
+		deletedGroups: make(map[string]map[string]string),
+	}
+}
+
+func (c changes) size() int {
+	result := len(c.metrics) + len(c.deletedIDs) + len(c.groups) + len(c.deletedGroups)
+	if c.deleteAll {
+		result++
+	}
+	return result
+}
+
+// undoLog keeps the state of the series and groups changed by a sync
+// write, to roll it back if it can't be persisted
+type undoLog struct {
+	series map[string]*aggregates.PushgatewayMetric
+	groups map[string]*aggregates.PushgatewayGroup
+	// state before the deletion of all metrics, the changes done after it
+	// are not recorded
+	all *snapshot
+}
+
+type snapshot struct {
+	series map[string]*aggregates.PushgatewayMetric
+	ids    map[string]string
+	groups map[string]*aggregates.PushgatewayGroup
+}
+
+func newUndoLog() *undoLog {
+	return &undoLog{
+		series: make(map[string]*aggregates.PushgatewayMetric),
+		groups: make(map[string]*aggregates.PushgatewayGroup),
+	}
+}
+
+// Store keeps the pushgateway metrics in memory and persists the changes
+// in batches. The store is reloaded when another server changes the
+// database. Increments are applied in memory: concurrent increments of
+// the same metric on several servers are not merged.
+// Metric families are written to the backend directly.
+type Store struct {
+	logger        *slog.Logger
+	backend       Backend
+	origin        string
+	flushInterval time.Duration
+	sync          bool
+	maxPending    int
+
+	lock    sync.RWMutex
+	series  map[string]*aggregates.PushgatewayMetric
+	ids     map[string]string
+	groups  map[string]*aggregates.PushgatewayGroup
+	pending changes
+	// set during sync writes
+	undo *undoLog
+
+	familiesLock sync.RWMutex
+	families     map[string]*aggregates.MetricFamily
+
+	// changes done by other servers, not applied yet
+	notificationsLock sync.Mutex
+	notifications     []aggregates.PushgatewayNotification
+	fullReload        bool
+
+	// serializes flushes and reloads
+	flushLock     sync.Mutex
+	reload        chan bool
+	stop          chan bool
+	wg            sync.WaitGroup
+	stopListening func() error
+
+	pendingGauge  prometheus.Gauge
+	flushCounter  *prometheus.CounterVec
+	reloadCounter *prometheus.CounterVec
+}
+
+func New(logger *slog.Logger, config Configuration, backend Backend, registry *prometheus.Registry) (*Store, error) {
+	err := validator.Validator.Struct(config)
+	if err != nil {
+		return nil, err
+	}
+	flushInterval := defaultFlushInterval
+	if config.FlushInterval != "" {
+		flushInterval, err = time.ParseDuration(config.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pushgateway cache flush interval: %w", err)
+		}
+		if flushInterval <= 0 {
+			return nil, errors.New("the pushgateway cache flush interval should be positive")
+		}
+	}
+	maxPending := defaultMaxPending
+	if config.MaxPending != 0 {
+		maxPending = int(config.MaxPending)
+	}
+	pendingGauge := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pushgateway_cache_pending_changes",
+			Help: "Number of pushgateway changes not persisted yet",
+		})
+	err = registry.Register(pendingGauge)
+	if err != nil {
+		return nil, err
+	}
+	flushCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_cache_flushes_total",
+			Help: "Count the number of flushes of the pushgateway cache",
+		},
+		[]string{"status"})
+	err = registry.Register(flushCounter)
+	if err != nil {
+		return nil, err
+	}
+	reloadCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_cache_reloads_total",
+			Help: "Count the number of reloads of the pushgateway cache",
+		},
+		[]string{"status"})
+	err = registry.Register(reloadCounter)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		logger:        logger,
+		backend:       backend,
+		origin:        util.NewUUID(),
+		flushInterval: flushInterval,
+		sync:          config.Durability == "sync",
+		maxPending:    maxPending,
+		series:        make(map[string]*aggregates.PushgatewayMetric),
+		ids:           make(map[string]string),
+		groups:        make(map[string]*aggregates.PushgatewayGroup),
+		pending:       newChanges(),
+		families:      make(map[string]*aggregates.MetricFamily),
+		reload:        make(chan bool, 1),
+		stop:          make(chan bool),
+		pendingGauge:  pendingGauge,
+		flushCounter:  flushCounter,
+		reloadCounter: reloadCounter,
+	}, nil
+}
+
+func nonNilLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return make(map[string]string)
+	}
+	return labels
+}
+
+// recordSeries keeps the state of a series before its first change by a
+// sync write, the lock should be held
+func (s *Store) recordSeries(key string) {
+	if s.undo == nil || s.undo.all != nil {
+		return
+	}
+	if _, ok := s.undo.series[key]; !ok {
+		s.undo.series[key] = s.series[key]
+	}
+}
+
+// recordGroup keeps the state of a group before its first change by a
+// sync write, the lock should be held
+func (s *Store) recordGroup(key string) {
+	if s.undo == nil || s.undo.all != nil {
+		return
+	}
+	if _, ok := s.undo.groups[key]; !ok {
+		s.undo.groups[key] = s.groups[key]
+	}
+}
+
+// rollback restores the state recorded by a sync write, the lock should
+// be held
+func (s *Store) rollback(undo *undoLog) {
+	if undo.all != nil {
+		s.series = undo.all.series
+		s.ids = undo.all.ids
+		s.groups = undo.all.groups
+	}
+	for key, previous := range undo.series {
+		if current, ok := s.series[key]; ok {
+			delete(s.ids, current.ID)
+		}
+		if previous == nil {
+			delete(s.series, key)
+			continue
+		}
+		s.series[key] = previous
+		s.ids[previous.ID] = key
+	}
+	for key, previous := range undo.groups {
+		if previous == nil {
+			delete(s.groups, key)
+			continue
+		}
+		s.groups[key] = previous
+	}
+}
+
+// put adds or replaces a series, the lock should be held
+func (s *Store) put(metric *aggregates.PushgatewayMetric) {
+	key := pushgateway.SeriesKey(metric.Name, metric.Labels)
+	s.recordSeries(key)
+	s.series[key] = metric
+	s.ids[metric.ID] = key
+	s.pending.metrics[key] = true
+}
+
+// remove deletes a series, the lock should be held
+func (s *Store) remove(key string) {
+	metric, ok := s.series[key]
+	if !ok {
+		return
+	}
+	s.recordSeries(key)
+	delete(s.series, key)
+	delete(s.ids, metric.ID)
+	delete(s.pending.metrics, key)
+	s.pending.deletedIDs[metric.ID] = true
+}
+
+// putGroup adds or replaces a group, the lock should be held
+func (s *Store) putGroup(group *aggregates.PushgatewayGroup) {
+	key := pushgateway.SeriesKey("", group.GroupingKey)
+	s.recordGroup(key)
+	s.groups[key] = group
+	s.pending.groups[key] = true
+	delete(s.pending.deletedGroups, key)
+}
+
+// removeGroup deletes a group, the lock should be held
+func (s *Store) removeGroup(key string, groupingKey map[string]string) {
+	s.recordGroup(key)
+	delete(s.groups, key)
+	delete(s.pending.groups, key)
+	s.pending.deletedGroups[key] = groupingKey
+}
+
+// group returns a copy of a group, a new one if it does not exist
+func (s *Store) group(groupingKey map[string]string) *aggregates.PushgatewayGroup {
+	current, ok := s.groups[pushgateway.SeriesKey("", groupingKey)]
+	if !ok {
+		return &aggregates.PushgatewayGroup{GroupingKey: groupingKey}
+	}
+	result := *current
+	return &result
+}
+
+// write applies a change in memory. Depending on the durability, the
+// change is persisted before returning. A change is not applied if too
+// many changes are pending and they can't be persisted.
+func (s *Store) write(ctx context.Context, fn func() error) error {
+	if s.sync {
+		return s.syncWrite(ctx, fn)
+	}
+	s.lock.RLock()
+	pending := s.pending.size()
+	s.lock.RUnlock()
+	if pending >= s.maxPending {
+		err := s.Flush(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := fn()
+	s.pendingGauge.Set(float64(s.pending.size()))
+	return err
+}
+
+// syncWrite applies a change and persists it. Sync writes are serialized
+// so a change failing to be persisted can be rolled back, a write reported
+// as failed is never persisted later.
+func (s *Store) syncWrite(ctx context.Context, fn func() error) error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	// only the changes of this write should be pending
+	err := s.flush(ctx)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.undo = newUndoLog()
+	err = fn()
+	undo := s.undo
+	s.undo = nil
+	s.lock.Unlock()
+	if err == nil {
+		err = s.flush(ctx)
+	}
+	if err != nil {
+		s.lock.Lock()
+		s.rollback(undo)
+		s.pending = newChanges()
+		s.pendingGauge.Set(0)
+		s.lock.Unlock()
+	}
+	return err
+}
+
+// createOrUpdate writes a metric like the database does, the lock should be held
+func (s *Store) createOrUpdate(metric aggregates.PushgatewayMetric, cumulative bool) (string, bool) {
+	metric.Labels = nonNilLabels(metric.Labels)
+	current, ok := s.series[pushgateway.SeriesKey(metric.Name, metric.Labels)]
+	if !ok {
+		metric.ID = util.NewUUID()
+		metric.GroupingKey = nil
+		s.put(&metric)
+		return metric.ID, true
+	}
+	updated := *current
+	updated.Description = metric.Description
+	updated.TTL = metric.TTL
+	updated.Type = metric.Type
+	updated.UpdatedAt = metric.UpdatedAt
+	updated.ExpiresAt = metric.ExpiresAt
+	updated.Timestamp = metric.Timestamp
+	updated.Histogram = metric.Histogram
+	updated.Summary = metric.Summary
+	updated.Value = metric.Value
+	if cumulative && metric.Histogram == nil && metric.Summary == nil {
+		updated.Value = current.Value + metric.Value
+	}
+	s.put(&updated)
+	return updated.ID, false
+}
+
+func (s *Store) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric, cumulative bool) (string, error) {
+	var id string
+	err := s.write(ctx, func() error {
+		id, _ = s.createOrUpdate(metric, cumulative)
+		return nil
+	})
+	return id, err
+}
+
+func (s *Store) BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error) {
+	results := make([]aggregates.BatchResult, len(metrics))
+	err := s.write(ctx, func() error {
+		for i, metric := range metrics {
+			// like in the database, the metadata are kept if not set
+			if current, ok := s.series[pushgateway.SeriesKey(metric.Name, metric.Labels)]; ok {
+				if metric.Type == nil {
+					metric.Type = current.Type
+				}
+				if metric.Description == nil {
+					metric.Description = current.Description
+				}
+			}
+			id, created := s.createOrUpdate(metric, false)
+			results[i] = aggregates.BatchResult{ID: id, Created: created}
+		}
+		return nil
+	})
+	return results, err
+}
+
+func (s *Store) IncrementPushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error) {
+	var result aggregates.PushgatewayMetric
+	err := s.write(ctx, func() error {
+		metric.Labels = nonNilLabels(metric.Labels)
+		current, ok := s.series[pushgateway.SeriesKey(metric.Name, metric.Labels)]
+		if !ok {
+			result = aggregates.PushgatewayMetric{
+				ID:          util.NewUUID(),
+				Name:        metric.Name,
+				Description: metric.Description,
+				Labels:      metric.Labels,
+				TTL:         metric.TTL,
+				Type:        metric.Type,
+				CreatedAt:   metric.CreatedAt,
+				UpdatedAt:   metric.UpdatedAt,
+				ExpiresAt:   metric.ExpiresAt,
+				Value:       metric.Value,
+			}
+			s.put(&result)
+			return nil
+		}
+		if current.Histogram != nil || current.Summary != nil {
+			return er.Newf("metric %s is a distribution and can't be incremented", er.BadRequest, true, metric.Name)
+		}
+		currentType := "untyped"
+		if current.Type != nil {
+			currentType = *current.Type
+		}
+		if metric.Type == nil || currentType != *metric.Type {
+			return er.Newf("metric %s has the type %s", er.BadRequest, true, metric.Name, currentType)
+		}
+		result = *current
+		result.Value = current.Value + metric.Value
+		result.Description = metric.Description
+		result.TTL = metric.TTL
+		result.ExpiresAt = metric.ExpiresAt
+		result.UpdatedAt = metric.UpdatedAt
+		s.put(&result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the stored metric can't be modified by the caller
+	returned := result
+	return &returned, nil
+}
+
+// GetMetrics returns copies of the stored metrics
+func (s *Store) GetMetrics(ctx context.Context, query aggregates.Query) ([]*aggregates.PushgatewayMetric, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]*aggregates.PushgatewayMetric, 0, len(s.series))
+	filtered := query.MinValue != nil || query.MaxValue != nil
+	for _, metric := range s.series {
+		if filtered && math.IsNaN(metric.Value) {
+			continue
+		}
+		if query.MinValue != nil && metric.Value < *query.MinValue {
+			continue
+		}
+		if query.MaxValue != nil && metric.Value > *query.MaxValue {
+			continue
+		}
+		if !pushgateway.MatchSelectors(query.Selectors, metric.Name, metric.Labels) {
+			continue
+		}
+		m := *metric
+		result = append(result, &m)
+	}
+	return result, nil
+}
+
+func (s *Store) DeleteMetricsByName(ctx context.Context, name string) error {
+	return s.write(ctx, func() error {
+		deleted := false
+		for key, metric := range s.series {
+			if metric.Name == name {
+				s.remove(key)
+				deleted = true
+			}
+		}
+		if !deleted {
+			return er.New("no metric were deleted", er.NotFound, true)
+		}
+		return nil
+	})
+}
+
+func (s *Store) DeleteMetricByID(ctx context.Context, id string) error {
+	return s.write(ctx, func() error {
+		key, ok := s.ids[id]
+		if !ok {
+			return er.New("resource not found", er.NotFound, true)
+		}
+		s.remove(key)
+		return nil
+	})
+}
+
+// DeleteMetricsBySelectors deletes the metrics matching one of the selectors.
+// Groups whose metrics were all deleted are also deleted.
+func (s *Store) DeleteMetricsBySelectors(ctx context.Context, selectors [][]aggregates.LabelMatcher) ([]*aggregates.PushgatewayMetric, error) {
+	result := []*aggregates.PushgatewayMetric{}
+	err := s.write(ctx, func() error {
+		groupingKeys := make(map[string]map[string]string)
+		for key, metric := range s.series {
+			if !pushgateway.MatchSelectors(selectors, metric.Name, metric.Labels) {
+				continue
+			}
+			m := *metric
+			result = append(result, &m)
+			if metric.GroupingKey != nil {
+				groupingKeys[pushgateway.SeriesKey("", metric.GroupingKey)] = metric.GroupingKey
+			}
+			s.remove(key)
+		}
+		for _, metric := range s.series {
+			if metric.GroupingKey != nil {
+				delete(groupingKeys, pushgateway.SeriesKey("", metric.GroupingKey))
+			}
+		}
+		for key, groupingKey := range groupingKeys {
+			if _, ok := s.groups[key]; !ok {
+				continue
+			}
+			s.removeGroup(key, groupingKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Store) CleanPushgatewayMetrics(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := s.write(ctx, func() error {
+		now := time.Now().UTC()
+		for key, metric := range s.series {
+			if metric.ExpiresAt != nil && metric.ExpiresAt.Before(now) {
+				s.remove(key)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (s *Store) DeleteAllPushgatewayMetrics(ctx context.Context) error {
+	return s.write(ctx, func() error {
+		if s.undo != nil && s.undo.all == nil {
+			s.undo.all = &snapshot{series: s.series, ids: s.ids, groups: s.groups}
+		}
+		s.series = make(map[string]*aggregates.PushgatewayMetric)
+		s.ids = make(map[string]string)
+		s.groups = make(map[string]*aggregates.PushgatewayGroup)
+		s.pending = newChanges()
+		s.pending.deleteAll = true
+		return nil
+	})
+}
+
+// removeGroupMetrics deletes the metrics of a group, only the ones with
+// these names if names is not nil. The lock should be held.
+func (s *Store) removeGroupMetrics(groupingKey map[string]string, names map[string]bool) {
+	groupKey := pushgateway.SeriesKey("", groupingKey)
+	for key, metric := range s.series {
+		if metric.GroupingKey == nil || pushgateway.SeriesKey("", metric.GroupingKey) != groupKey {
+			continue
+		}
+		if names == nil || names[metric.Name] {
+			s.remove(key)
+		}
+	}
+}
+
+func (s *Store) PushGroup(ctx context.Context, groupingKey map[string]string, metrics []aggregates.PushgatewayMetric, replace bool, pushTime time.Time) error {
+	return s.write(ctx, func() error {
+		var names map[string]bool
+		if !replace {
+			names = make(map[string]bool)
+			for _, metric := range metrics {
+				names[metric.Name] = true
+			}
+		}
+		// replaced series keep their creation time
+		createdAt := make(map[string]time.Time)
+		for _, metric := range metrics {
+			key := pushgateway.SeriesKey(metric.Name, metric.Labels)
+			if current, ok := s.series[key]; ok {
+				createdAt[key] = current.CreatedAt
+			}
+		}
+		s.removeGroupMetrics(groupingKey, names)
+		for _, metric := range metrics {
+			metric.Labels = nonNilLabels(metric.Labels)
+			key := pushgateway.SeriesKey(metric.Name, metric.Labels)
+			// the pushed metric replaces the series if it already exists,
+			// even if it was created outside of this group
+			s.remove(key)
+			if created, ok := createdAt[key]; ok {
+				metric.CreatedAt = created
+			}
+			metric.ID = util.NewUUID()
+			metric.GroupingKey = groupingKey
+			s.put(&metric)
+		}
+		group := s.group(groupingKey)
+		group.PushTime = &pushTime
+		s.putGroup(group)
+		return nil
+	})
+}
+
+func (s *Store) RecordPushFailure(ctx context.Context, groupingKey map[string]string, failureTime time.Time) error {
+	return s.write(ctx, func() error {
+		group := s.group(groupingKey)
+		group.PushFailureTime = &failureTime
+		s.putGroup(group)
+		return nil
+	})
+}
+
+func (s *Store) DeleteGroup(ctx context.Context, groupingKey map[string]string) error {
+	return s.write(ctx, func() error {
+		s.removeGroupMetrics(groupingKey, nil)
+		s.removeGroup(pushgateway.SeriesKey("", groupingKey), groupingKey)
+		return nil
+	})
+}
+
+func (s *Store) GetGroups(ctx context.Context) ([]*aggregates.PushgatewayGroup, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]*aggregates.PushgatewayGroup, 0, len(s.groups))
+	for _, group := range s.groups {
+		g := *group
+		result = append(result, &g)
+	}
+	return result, nil
+}
+
+func (s *Store) CountSeries(ctx context.Context, names []string) (map[string]int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	filter := make(map[string]bool)
+	for _, name := range names {
+		filter[name] = true
+	}
+	result := make(map[string]int)
+	for _, metric := range s.series {
+		if len(filter) == 0 || filter[metric.Name] {
+			result[metric.Name]++
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) CountAllSeries(ctx context.Context) (int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.series), nil
+}
+
+func (s *Store) SeriesExist(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]bool, len(metrics))
+	for i, metric := range metrics {
+		_, result[i] = s.series[pushgateway.SeriesKey(metric.Name, metric.Labels)]
+	}
+	return result, nil
+}
+
+// restore marks as pending again the changes which failed to be persisted,
+// unless they were overridden since. The lock should be held.
+func (s *Store) restore(failed changes) {
+	if failed.deleteAll {
+		s.pending.deleteAll = true
+	}
+	for key := range failed.metrics {
+		if _, ok := s.series[key]; ok {
+			s.pending.metrics[key] = true
+		}
+	}
+	for id := range failed.deletedIDs {
+		s.pending.deletedIDs[id] = true
+	}
+	for key := range failed.groups {
+		if _, ok := s.groups[key]; ok {
+			s.pending.groups[key] = true
+		}
+	}
+	for key, groupingKey := range failed.deletedGroups {
+		if _, ok := s.groups[key]; !ok {
+			s.pending.deletedGroups[key] = groupingKey
+		}
+	}
+}
+
+// Flush persists the pending changes. Changes failing to be persisted
+// stay pending.
+func (s *Store) Flush(ctx context.Context) error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	return s.flush(ctx)
+}
+
+// flush persists the pending changes, the flush lock should be held
+func (s *Store) flush(ctx context.Context) error {
+	s.lock.Lock()
+	pending := s.pending
+	if pending.size() == 0 {
+		s.lock.Unlock()
+		return nil
+	}
+	s.pending = newChanges()
+	changes := aggregates.PushgatewayChanges{
+		Origin:    s.origin,
+		DeleteAll: pending.deleteAll,
+	}
+	keys := []string{}
+	for key := range pending.metrics {
+		keys = append(keys, key)
+		changes.Metrics = append(changes.Metrics, *s.series[key])
+	}
+	for id := range pending.deletedIDs {
+		changes.DeletedIDs = append(changes.DeletedIDs, id)
+	}
+	for key := range pending.groups {
+		changes.Groups = append(changes.Groups, s.groups[key])
+	}
+	for _, groupingKey := range pending.deletedGroups {
+		changes.DeletedGroups = append(changes.DeletedGroups, groupingKey)
+	}
+	s.lock.Unlock()
+
+	results, err := s.backend.WritePushgatewayChanges(ctx, changes)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.restore(pending)
+		s.pendingGauge.Set(float64(s.pending.size()))
+		s.flushCounter.With(prometheus.Labels{"status": "failure"}).Inc()
+		return fmt.Errorf("fail to persist the pushgateway changes: %w", err)
+	}
+	// existing series keep their ID when they are updated
+	for i, result := range results {
+		key := keys[i]
+		current, ok := s.series[key]
+		if result.ID == "" || !ok || current.ID != changes.Metrics[i].ID || current.ID == result.ID {
+			continue
+		}
+		updated := *current
+		updated.ID = result.ID
+		delete(s.ids, current.ID)
+		s.ids[updated.ID] = key
+		s.series[key] = &updated
+	}
+	s.pendingGauge.Set(float64(s.pending.size()))
+	s.flushCounter.With(prometheus.Labels{"status": "success"}).Inc()
+	s.logger.Debug(fmt.Sprintf("%d pushgateway changes persisted", pending.size()))
+	return nil
+}
+
+// Reload loads the metrics from the backend, then applies the pending
+// changes on top of them
+func (s *Store) Reload(ctx context.Context) error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	metrics, err := s.backend.GetMetrics(ctx, aggregates.Query{})
+	if err != nil {
+		return err
+	}
+	groups, err := s.backend.GetGroups(ctx)
+	if err != nil {
+		return err
+	}
+	families, err := s.backend.GetMetricFamilies(ctx)
+	if err != nil {
+		return err
+	}
+	s.setFamilies(families)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	series := make(map[string]*aggregates.PushgatewayMetric)
+	ids := make(map[string]string)
+	loadedGroups := make(map[string]*aggregates.PushgatewayGroup)
+	// a pending deletion of all metrics is not persisted yet
+	if !s.pending.deleteAll {
+		for _, metric := range metrics {
+			if s.pending.deletedIDs[metric.ID] {
+				continue
+			}
+			metric.Labels = nonNilLabels(metric.Labels)
+			key := pushgateway.SeriesKey(metric.Name, metric.Labels)
+			series[key] = metric
+			ids[metric.ID] = key
+		}
+		for _, group := range groups {
+			key := pushgateway.SeriesKey("", group.GroupingKey)
+			if _, ok := s.pending.deletedGroups[key]; ok {
+				continue
+			}
+			loadedGroups[key] = group
+		}
+	}
+	for key := range s.pending.metrics {
+		metric := *s.series[key]
+		if existing, ok := series[key]; ok {
+			// the series was created by another server
+			metric.ID = existing.ID
+		}
+		series[key] = &metric
+		ids[metric.ID] = key
+	}
+	for key := range s.pending.groups {
+		loadedGroups[key] = s.groups[key]
+	}
+	s.series = series
+	s.ids = ids
+	s.groups = loadedGroups
+	return nil
+}
+
+func (s *Store) setFamilies(families []*aggregates.MetricFamily) {
+	s.familiesLock.Lock()
+	defer s.familiesLock.Unlock()
+	s.families = make(map[string]*aggregates.MetricFamily)
+	for _, family := range families {
+		s.families[family.Name] = family
+	}
+}
+
+// RegisterMetricFamilies only calls the backend for the families which
+// are unknown or whose type or help should be defined
+func (s *Store) RegisterMetricFamilies(ctx context.Context, families []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error) {
+	s.familiesLock.Lock()
+	defer s.familiesLock.Unlock()
+	missing := []aggregates.MetricFamily{}
+	for _, family := range families {
+		existing, ok := s.families[family.Name]
+		if !ok || (existing.Type == nil && family.Type != nil) || (existing.Help == nil && family.Help != nil) {
+			missing = append(missing, family)
+		}
+	}
+	if len(missing) > 0 {
+		registered, err := s.backend.RegisterMetricFamilies(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, family := range registered {
+			s.families[family.Name] = family
+		}
+	}
+	result := make([]*aggregates.MetricFamily, 0, len(families))
+	for _, family := range families {
+		if existing, ok := s.families[family.Name]; ok {
+			f := *existing
+			result = append(result, &f)
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) GetMetricFamilies(ctx context.Context) ([]*aggregates.MetricFamily, error) {
+	s.familiesLock.RLock()
+	defer s.familiesLock.RUnlock()
+	result := make([]*aggregates.MetricFamily, 0, len(s.families))
+	for _, family := range s.families {
+		f := *family
+		result = append(result, &f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (s *Store) GetMetricFamily(ctx context.Context, name string) (*aggregates.MetricFamily, error) {
+	s.familiesLock.RLock()
+	defer s.familiesLock.RUnlock()
+	family, ok := s.families[name]
+	if !ok {
+		return nil, er.New("metric family not found", er.NotFound, true)
+	}
+	result := *family
+	return &result, nil
+}
+
+func (s *Store) UpdateMetricFamily(ctx context.Context, family aggregates.MetricFamily) error {
+	s.familiesLock.Lock()
+	defer s.familiesLock.Unlock()
+	err := s.backend.UpdateMetricFamily(ctx, family)
+	if err != nil {
+		return err
+	}
+	if existing, ok := s.families[family.Name]; ok {
+		family.CreatedAt = existing.CreatedAt
+	}
+	s.families[family.Name] = &family
+	return nil
+}
+
+func (s *Store) DeleteMetricFamily(ctx context.Context, name string) error {
+	s.familiesLock.Lock()
+	defer s.familiesLock.Unlock()
+	err := s.backend.DeleteMetricFamily(ctx, name)
+	if err != nil {
+		return err
+	}
+	delete(s.families, name)
+	return nil
+}
+
+// applyChanges applies the changes done by other servers, in the order
+// of the notifications. The pending changes take precedence like during a
+// reload.
+func (s *Store) applyChanges(ctx context.Context, notifications []aggregates.PushgatewayNotification) error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	metricIDs := make(map[string]bool)
+	deletedIDs := make(map[string]bool)
+	// nil for deleted groups
+	groups := make(map[string]*aggregates.PushgatewayGroup)
+	for _, notification := range notifications {
+		for _, id := range notification.DeletedIDs {
+			delete(metricIDs, id)
+			deletedIDs[id] = true
+		}
+		for _, groupingKey := range notification.DeletedGroups {
+			groups[pushgateway.SeriesKey("", groupingKey)] = nil
+		}
+		for _, id := range notification.MetricIDs {
+			delete(deletedIDs, id)
+			metricIDs[id] = true
+		}
+		for _, group := range notification.Groups {
+			groups[pushgateway.SeriesKey("", group.GroupingKey)] = group
+		}
+	}
+	metrics := []*aggregates.PushgatewayMetric{}
+	if len(metricIDs) > 0 {
+		ids := make([]string, 0, len(metricIDs))
+		for id := range metricIDs {
+			ids = append(ids, id)
+		}
+		var err error
+		metrics, err = s.backend.GetMetricsByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+	}
+	s.lock.Lock()
+	if !s.pending.deleteAll {
+		for id := range deletedIDs {
+			key, ok := s.ids[id]
+			if !ok || s.pending.metrics[key] {
+				continue
+			}
+			delete(s.series, key)
+			delete(s.ids, id)
+		}
+		for _, metric := range metrics {
+			if s.pending.deletedIDs[metric.ID] {
+				continue
+			}
+			metric.Labels = nonNilLabels(metric.Labels)
+			key := pushgateway.SeriesKey(metric.Name, metric.Labels)
+			current, ok := s.series[key]
+			if ok {
+				delete(s.ids, current.ID)
+			}
+			if ok && s.pending.metrics[key] {
+				// the series was created by another server
+				updated := *current
+				updated.ID = metric.ID
+				metric = &updated
+			}
+			s.series[key] = metric
+			s.ids[metric.ID] = key
+		}
+		for key, group := range groups {
+			if _, ok := s.pending.deletedGroups[key]; ok || s.pending.groups[key] {
+				continue
+			}
+			if group == nil {
+				delete(s.groups, key)
+				continue
+			}
+			s.groups[key] = group
+		}
+	}
+	s.lock.Unlock()
+	// the families of new metrics were registered by the other server
+	s.familiesLock.RLock()
+	unknownFamily := false
+	for _, metric := range metrics {
+		if _, ok := s.families[metric.Name]; !ok {
+			unknownFamily = true
+			break
+		}
+	}
+	s.familiesLock.RUnlock()
+	if unknownFamily {
+		families, err := s.backend.GetMetricFamilies(ctx)
+		if err != nil {
+			return err
+		}
+		s.setFamilies(families)
+	}
+	return nil
+}
+
+// applyNotifications applies the changes notified since the last call.
+// Notifications are applied in batches, the store is only reloaded if
+// the changes are unknown.
+func (s *Store) applyNotifications(ctx context.Context) error {
+	s.notificationsLock.Lock()
+	fullReload := s.fullReload
+	notifications := s.notifications
+	s.fullReload = false
+	s.notifications = nil
+	s.notificationsLock.Unlock()
+	if fullReload {
+		return s.Reload(ctx)
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return s.applyChanges(ctx, notifications)
+}
+
+// notify is called on each change of the backend
+func (s *Store) notify(notification aggregates.PushgatewayNotification) {
+	if notification.Origin == s.origin {
+		return
+	}
+	s.notificationsLock.Lock()
+	if notification.Full || notification.Origin == "" {
+		s.fullReload = true
+		s.notifications = nil
+	} else if !s.fullReload {
+		s.notifications = append(s.notifications, notification)
+	}
+	s.notificationsLock.Unlock()
+	select {
+	case s.reload <- true:
+	default:
+	}
+}
+
+// Start loads the metrics then starts persisting the changes and
+// listening to the changes done by other servers
+func (s *Store) Start(ctx context.Context) error {
+	stopListening, err := s.backend.ListenPushgatewayChanges(s.notify)
+	if err != nil {
+		return err
+	}
+	s.stopListening = stopListening
+	err = s.Reload(ctx)
+	if err != nil {
+		stopListening()
+		return fmt.Errorf("fail to load the pushgateway metrics: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("pushgateway cache loaded with %d metrics", len(s.series)))
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+		// failed reloads are retried on the next tick
+		retryReload := false
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-s.reload:
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				err := s.applyNotifications(ctx)
+				cancel()
+				if err != nil {
+					s.logger.Error(fmt.Sprintf("fail to reload the pushgateway cache: %s", err.Error()))
+					s.reloadCounter.With(prometheus.Labels{"status": "failure"}).Inc()
+					retryReload = true
+				} else {
+					s.reloadCounter.With(prometheus.Labels{"status": "success"}).Inc()
+				}
+			case <-ticker.C:
+				if retryReload {
+					retryReload = false
+					s.notify(aggregates.PushgatewayNotification{Full: true})
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), s.flushInterval+10*time.Second)
+				err := s.Flush(ctx)
+				cancel()
+				if err != nil {
+					s.logger.Error(err.Error())
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops listening to changes then persists the pending changes
+func (s *Store) Stop() {
+	s.logger.Info("stopping the pushgateway cache")
+	s.stop <- true
+	s.wg.Wait()
+	err := s.stopListening()
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("fail to stop listening to pushgateway changes: %s", err.Error()))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = s.Flush(ctx)
+	if err != nil {
+		s.logger.Error(err.Error())
+	}
+	s.logger.Info("pushgateway cache stopped")
+}
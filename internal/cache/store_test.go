@@ -0,0 +1,446 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/internal/cache"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBackend struct {
+	lock     sync.Mutex
+	metrics  []*aggregates.PushgatewayMetric
+	groups   []*aggregates.PushgatewayGroup
+	changes  []aggregates.PushgatewayChanges
+	err      error
+	loads    int
+	notify   func(notification aggregates.PushgatewayNotification)
+	families map[string]*aggregates.MetricFamily
+	// number of RegisterMetricFamilies calls
+	registers int
+	// number of GetMetricsByIDs calls
+	fetches int
+}
+
+func (f *fakeBackend) GetMetrics(ctx context.Context, query aggregates.Query) ([]*aggregates.PushgatewayMetric, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.loads++
+	result := []*aggregates.PushgatewayMetric{}
+	for _, metric := range f.metrics {
+		m := *metric
+		result = append(result, &m)
+	}
+	return result, nil
+}
+
+func (f *fakeBackend) GetGroups(ctx context.Context) ([]*aggregates.PushgatewayGroup, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.groups, nil
+}
+
+func (f *fakeBackend) WritePushgatewayChanges(ctx context.Context, changes aggregates.PushgatewayChanges) ([]aggregates.BatchResult, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.changes = append(f.changes, changes)
+	results := []aggregates.BatchResult{}
+	for _, metric := range changes.Metrics {
+		id := metric.ID
+		// the series was created by another server
+		if metric.Name == "shared" {
+			id = "shared-id"
+		}
+		results = append(results, aggregates.BatchResult{ID: id})
+	}
+	return results, nil
+}
+
+func (f *fakeBackend) GetMetricsByIDs(ctx context.Context, ids []string) ([]*aggregates.PushgatewayMetric, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.fetches++
+	result := []*aggregates.PushgatewayMetric{}
+	for _, metric := range f.metrics {
+		if slices.Contains(ids, metric.ID) {
+			m := *metric
+			result = append(result, &m)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeBackend) fetchCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.fetches
+}
+
+func (f *fakeBackend) ListenPushgatewayChanges(fn func(notification aggregates.PushgatewayNotification)) (func() error, error) {
+	f.notify = fn
+	return func() error { return nil }, nil
+}
+
+func (f *fakeBackend) RegisterMetricFamilies(ctx context.Context, families []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.registers++
+	if f.families == nil {
+		f.families = make(map[string]*aggregates.MetricFamily)
+	}
+	result := []*aggregates.MetricFamily{}
+	for _, family := range families {
+		existing, ok := f.families[family.Name]
+		if !ok {
+			existing = &aggregates.MetricFamily{Name: family.Name}
+			f.families[family.Name] = existing
+		}
+		if existing.Type == nil {
+			existing.Type = family.Type
+		}
+		if existing.Help == nil {
+			existing.Help = family.Help
+		}
+		registered := *existing
+		result = append(result, &registered)
+	}
+	return result, nil
+}
+
+func (f *fakeBackend) GetMetricFamilies(ctx context.Context) ([]*aggregates.MetricFamily, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := []*aggregates.MetricFamily{}
+	for _, family := range f.families {
+		registered := *family
+		result = append(result, &registered)
+	}
+	return result, nil
+}
+
+func (f *fakeBackend) UpdateMetricFamily(ctx context.Context, family aggregates.MetricFamily) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.families == nil {
+		f.families = make(map[string]*aggregates.MetricFamily)
+	}
+	f.families[family.Name] = &family
+	return nil
+}
+
+func (f *fakeBackend) DeleteMetricFamily(ctx context.Context, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.families, name)
+	return nil
+}
+
+func (f *fakeBackend) loadCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.loads
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeBackend{
+		metrics: []*aggregates.PushgatewayMetric{
+			{ID: "1", Name: "existing", Labels: map[string]string{"env": "prod"}, Value: 1},
+		},
+	}
+	store, err := cache.New(slog.Default(), cache.Configuration{FlushInterval: "1h"}, backend, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Start(ctx))
+
+	counter := "counter"
+	id, err := store.CreateOrUpdatePushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "existing", Labels: map[string]string{"env": "prod"}, Value: 2}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+	_, err = store.IncrementPushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "shared", Type: &counter, Value: 3})
+	assert.NoError(t, err)
+	_, err = store.CreateOrUpdatePushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "deleted", Value: 1}, false)
+	assert.NoError(t, err)
+	assert.NoError(t, store.DeleteMetricsByName(ctx, "deleted"))
+
+	metrics, err := store.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	count, err := store.CountAllSeries(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// nothing is persisted before the flush
+	assert.Len(t, backend.changes, 0)
+	backend.err = errors.New("database unavailable")
+	assert.Error(t, store.Flush(ctx))
+	backend.err = nil
+	assert.NoError(t, store.Flush(ctx))
+	assert.Len(t, backend.changes, 1)
+	assert.Len(t, backend.changes[0].Metrics, 2)
+	assert.Len(t, backend.changes[0].DeletedIDs, 1)
+	// no pending changes
+	assert.NoError(t, store.Flush(ctx))
+	assert.Len(t, backend.changes, 1)
+
+	// the ID of the series persisted by another server is used
+	assert.NoError(t, store.DeleteMetricByID(ctx, "shared-id"))
+
+	// changes done by this server don't reload the store
+	loads := backend.loadCount()
+	backend.notify(aggregates.PushgatewayNotification{Origin: backend.changes[0].Origin, Full: true})
+	backend.lock.Lock()
+	backend.metrics = append(backend.metrics, &aggregates.PushgatewayMetric{ID: "2", Name: "other"})
+	backend.lock.Unlock()
+	backend.notify(aggregates.PushgatewayNotification{Full: true})
+	assert.Eventually(t, func() bool {
+		return backend.loadCount() == loads+1
+	}, 5*time.Second, 10*time.Millisecond)
+	store.Stop()
+
+	metrics, err = store.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	names := []string{}
+	for _, metric := range metrics {
+		names = append(names, metric.Name)
+	}
+	// the pending deletion of the shared series is applied on the reloaded metrics
+	assert.ElementsMatch(t, []string{"existing", "other"}, names)
+	assert.Equal(t, []string{"shared-id"}, backend.changes[1].DeletedIDs)
+}
+
+func TestStoreNotifications(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeBackend{
+		metrics: []*aggregates.PushgatewayMetric{
+			{ID: "1", Name: "updated", Value: 1},
+			{ID: "2", Name: "deleted", Value: 1},
+		},
+	}
+	store, err := cache.New(slog.Default(), cache.Configuration{FlushInterval: "1h"}, backend, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Start(ctx))
+	defer store.Stop()
+	_, err = store.CreateOrUpdatePushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "local", Value: 1}, false)
+	assert.NoError(t, err)
+
+	// the changes done by another server are applied without reloading
+	// the store
+	loads := backend.loadCount()
+	now := time.Now().UTC()
+	groupingKey := map[string]string{"job": "backup"}
+	backend.lock.Lock()
+	backend.metrics = []*aggregates.PushgatewayMetric{
+		{ID: "1", Name: "updated", Value: 2},
+		{ID: "3", Name: "created", Value: 1, GroupingKey: groupingKey},
+	}
+	backend.lock.Unlock()
+	backend.notify(aggregates.PushgatewayNotification{Origin: "other", DeletedIDs: []string{"2"}})
+	backend.notify(aggregates.PushgatewayNotification{
+		Origin:    "other",
+		MetricIDs: []string{"1", "3"},
+		Groups:    []*aggregates.PushgatewayGroup{{GroupingKey: groupingKey, PushTime: &now}},
+	})
+	values := func() map[string]float64 {
+		metrics, err := store.GetMetrics(ctx, aggregates.Query{})
+		assert.NoError(t, err)
+		result := make(map[string]float64)
+		for _, metric := range metrics {
+			result[metric.Name] = metric.Value
+		}
+		return result
+	}
+	expected := map[string]float64{"updated": 2, "created": 1, "local": 1}
+	assert.Eventually(t, func() bool {
+		return reflect.DeepEqual(expected, values())
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, loads, backend.loadCount())
+	assert.GreaterOrEqual(t, backend.fetchCount(), 1)
+	groups, err := store.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+	assert.Equal(t, groupingKey, groups[0].GroupingKey)
+	assert.NoError(t, store.DeleteMetricByID(ctx, "3"))
+}
+
+func TestStoreSyncDurability(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeBackend{}
+	store, err := cache.New(slog.Default(), cache.Configuration{Durability: "sync"}, backend, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	groupingKey := map[string]string{"job": "backup"}
+	err = store.PushGroup(ctx, groupingKey, []aggregates.PushgatewayMetric{{Name: "b", Value: 1}}, true, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, backend.changes, 1)
+
+	// failed writes are rolled back
+	backend.err = errors.New("database unavailable")
+	_, err = store.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{{Name: "a"}, {Name: "b", Value: 2}})
+	assert.Error(t, err)
+	err = store.DeleteGroup(ctx, groupingKey)
+	assert.Error(t, err)
+	err = store.DeleteAllPushgatewayMetrics(ctx)
+	assert.Error(t, err)
+	metrics, err := store.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "b", metrics[0].Name)
+	assert.Equal(t, 1.0, metrics[0].Value)
+	assert.Equal(t, groupingKey, metrics[0].GroupingKey)
+	groups, err := store.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+
+	// and not persisted with the next write
+	backend.err = nil
+	_, err = store.CreateOrUpdatePushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "c"}, false)
+	assert.NoError(t, err)
+	assert.Len(t, backend.changes, 2)
+	assert.Len(t, backend.changes[1].Metrics, 1)
+	assert.Equal(t, "c", backend.changes[1].Metrics[0].Name)
+	assert.False(t, backend.changes[1].DeleteAll)
+	assert.Empty(t, backend.changes[1].DeletedGroups)
+	err = store.DeleteMetricByID(ctx, metrics[0].ID)
+	assert.NoError(t, err)
+}
+
+func TestStorePushGroupCreationTime(t *testing.T) {
+	ctx := context.Background()
+	store, err := cache.New(slog.Default(), cache.Configuration{FlushInterval: "1h"}, &fakeBackend{}, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	groupingKey := map[string]string{"job": "backup"}
+	createdAt := time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)
+	err = store.PushGroup(ctx, groupingKey, []aggregates.PushgatewayMetric{
+		{Name: "runs_total", Value: 1, CreatedAt: createdAt},
+	}, true, time.Now())
+	assert.NoError(t, err)
+	// a new push replaces the series but not its creation time
+	err = store.PushGroup(ctx, groupingKey, []aggregates.PushgatewayMetric{
+		{Name: "runs_total", Value: 2, CreatedAt: time.Now().UTC()},
+		{Name: "failures_total", Value: 1, CreatedAt: createdAt.Add(time.Hour)},
+	}, true, time.Now())
+	assert.NoError(t, err)
+	metrics, err := store.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	expected := map[string]time.Time{
+		"runs_total":     createdAt,
+		"failures_total": createdAt.Add(time.Hour),
+	}
+	for _, metric := range metrics {
+		assert.Equal(t, expected[metric.Name], metric.CreatedAt)
+	}
+}
+
+func TestStoreBatchMetadata(t *testing.T) {
+	ctx := context.Background()
+	store, err := cache.New(slog.Default(), cache.Configuration{FlushInterval: "1h"}, &fakeBackend{}, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	counter := "counter"
+	description := "number of runs"
+	_, err = store.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{
+		{Name: "runs_total", Type: &counter, Description: &description, Value: 1},
+	})
+	assert.NoError(t, err)
+	// the metadata are kept if not set
+	_, err = store.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{{Name: "runs_total", Value: 2}})
+	assert.NoError(t, err)
+	metrics, err := store.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, float64(2), metrics[0].Value)
+	assert.Equal(t, counter, *metrics[0].Type)
+	assert.Equal(t, description, *metrics[0].Description)
+}
+
+func TestStoreDeleteMetricsBySelectors(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeBackend{}
+	store, err := cache.New(slog.Default(), cache.Configuration{FlushInterval: "1h"}, backend, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	groupingKey := map[string]string{"job": "backup"}
+	err = store.PushGroup(ctx, groupingKey, []aggregates.PushgatewayMetric{
+		{Name: "duration_seconds", Labels: map[string]string{"job": "backup", "step": "export"}},
+		{Name: "duration_seconds", Labels: map[string]string{"job": "backup", "step": "import"}},
+	}, true, time.Now())
+	assert.NoError(t, err)
+	_, err = store.CreateOrUpdatePushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "duration_seconds", Labels: map[string]string{"job": "other"}}, false)
+	assert.NoError(t, err)
+
+	selector, err := pushgateway.ParseSelector(`duration_seconds{job="backup"}`)
+	assert.NoError(t, err)
+	deleted, err := store.DeleteMetricsBySelectors(ctx, [][]aggregates.LabelMatcher{selector})
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	metrics, err := store.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "other", metrics[0].Labels["job"])
+	// the group has no metric anymore
+	groups, err := store.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 0)
+
+	assert.NoError(t, store.Flush(ctx))
+	assert.Len(t, backend.changes, 1)
+	assert.Equal(t, []map[string]string{groupingKey}, backend.changes[0].DeletedGroups)
+}
+
+func TestStoreMetricFamilies(t *testing.T) {
+	ctx := context.Background()
+	counter := "counter"
+	gauge := "gauge"
+	help := "help"
+	backend := &fakeBackend{
+		families: map[string]*aggregates.MetricFamily{
+			"existing": {Name: "existing", Type: &gauge},
+		},
+	}
+	store, err := cache.New(slog.Default(), cache.Configuration{FlushInterval: "1h"}, backend, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Start(ctx))
+	defer store.Stop()
+
+	families, err := store.RegisterMetricFamilies(ctx, []aggregates.MetricFamily{
+		{Name: "existing", Type: &counter},
+		{Name: "new", Type: &counter},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, families, 2)
+	assert.Equal(t, "gauge", *families[0].Type)
+	assert.Equal(t, "counter", *families[1].Type)
+	assert.Equal(t, 1, backend.registers)
+
+	// known families are not registered again
+	_, err = store.RegisterMetricFamilies(ctx, []aggregates.MetricFamily{{Name: "new", Type: &gauge}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, backend.registers)
+	// the help is not defined yet
+	_, err = store.RegisterMetricFamilies(ctx, []aggregates.MetricFamily{{Name: "new", Help: &help}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, backend.registers)
+
+	assert.NoError(t, store.UpdateMetricFamily(ctx, aggregates.MetricFamily{Name: "new", Type: &gauge}))
+	family, err := store.GetMetricFamily(ctx, "new")
+	assert.NoError(t, err)
+	assert.Equal(t, "gauge", *family.Type)
+	assert.Nil(t, family.Help)
+	assert.NoError(t, store.DeleteMetricFamily(ctx, "new"))
+	_, err = store.GetMetricFamily(ctx, "new")
+	assert.Error(t, err)
+	families, err = store.GetMetricFamilies(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, families, 1)
+}
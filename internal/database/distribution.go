@@ -0,0 +1,145 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+)
+
+// floats are stored as strings because JSON doesn't support +Inf and NaN
+
+type dbBucket struct {
+	UpperBound string `json:"le"`
+	Count      uint64 `json:"count"`
+}
+
+type dbHistogram struct {
+	Buckets []dbBucket `json:"buckets"`
+	Sum     string     `json:"sum"`
+	Count   uint64     `json:"count"`
+}
+
+type dbQuantile struct {
+	Quantile string `json:"quantile"`
+	Value    string `json:"value"`
+}
+
+type dbSummary struct {
+	Quantiles []dbQuantile `json:"quantiles"`
+	Sum       string       `json:"sum"`
+	Count     uint64       `json:"count"`
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func histogramToString(histogram *aggregates.Histogram) (*string, error) {
+	if histogram == nil {
+		return nil, nil
+	}
+	value := dbHistogram{
+		Buckets: []dbBucket{},
+		Sum:     formatFloat(histogram.Sum),
+		Count:   histogram.Count,
+	}
+	for _, bucket := range histogram.Buckets {
+		value.Buckets = append(value.Buckets, dbBucket{
+			UpperBound: formatFloat(bucket.UpperBound),
+			Count:      bucket.Count,
+		})
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("fail to serialize histogram: %w", err)
+	}
+	result := string(b)
+	return &result, nil
+}
+
+func stringToHistogram(histogram *string) (*aggregates.Histogram, error) {
+	if histogram == nil {
+		return nil, nil
+	}
+	var value dbHistogram
+	if err := json.Unmarshal([]byte(*histogram), &value); err != nil {
+		return nil, fmt.Errorf("fail to deserialize histogram %s: %w", *histogram, err)
+	}
+	sum, err := strconv.ParseFloat(value.Sum, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid histogram sum %s: %w", value.Sum, err)
+	}
+	result := &aggregates.Histogram{
+		Sum:   sum,
+		Count: value.Count,
+	}
+	for _, bucket := range value.Buckets {
+		upperBound, err := strconv.ParseFloat(bucket.UpperBound, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram bucket %s: %w", bucket.UpperBound, err)
+		}
+		result.Buckets = append(result.Buckets, aggregates.Bucket{
+			UpperBound: upperBound,
+			Count:      bucket.Count,
+		})
+	}
+	return result, nil
+}
+
+func summaryToString(summary *aggregates.Summary) (*string, error) {
+	if summary == nil {
+		return nil, nil
+	}
+	value := dbSummary{
+		Quantiles: []dbQuantile{},
+		Sum:       formatFloat(summary.Sum),
+		Count:     summary.Count,
+	}
+	for _, quantile := range summary.Quantiles {
+		value.Quantiles = append(value.Quantiles, dbQuantile{
+			Quantile: formatFloat(quantile.Quantile),
+			Value:    formatFloat(quantile.Value),
+		})
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("fail to serialize summary: %w", err)
+	}
+	result := string(b)
+	return &result, nil
+}
+
+func stringToSummary(summary *string) (*aggregates.Summary, error) {
+	if summary == nil {
+		return nil, nil
+	}
+	var value dbSummary
+	if err := json.Unmarshal([]byte(*summary), &value); err != nil {
+		return nil, fmt.Errorf("fail to deserialize summary %s: %w", *summary, err)
+	}
+	sum, err := strconv.ParseFloat(value.Sum, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary sum %s: %w", value.Sum, err)
+	}
+	result := &aggregates.Summary{
+		Sum:   sum,
+		Count: value.Count,
+	}
+	for _, quantile := range value.Quantiles {
+		q, err := strconv.ParseFloat(quantile.Quantile, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid summary quantile %s: %w", quantile.Quantile, err)
+		}
+		v, err := strconv.ParseFloat(quantile.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid summary quantile value %s: %w", quantile.Value, err)
+		}
+		result.Quantiles = append(result.Quantiles, aggregates.Quantile{
+			Quantile: q,
+			Value:    v,
+		})
+	}
+	return result, nil
+}
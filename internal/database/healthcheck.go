@@ -22,6 +22,7 @@ type dbHealthcheck struct {
 	Timeout     string
 	Enabled     bool
 	Definition  string
+	Source      *string
 }
 
 func toHealthcheck(healthcheck *dbHealthcheck) (*aggregates.Healthcheck, error) {
@@ -45,6 +46,7 @@ func toHealthcheck(healthcheck *dbHealthcheck) (*aggregates.Healthcheck, error)
 		Enabled:     healthcheck.Enabled,
 		Type:        healthcheck.Type,
 		RandomID:    healthcheck.RandomID,
+		Source:      healthcheck.Source,
 	}, nil
 }
 
@@ -92,8 +94,9 @@ func (c *Database) CreateHealthcheck(ctx context.Context, healthcheck *aggregate
 		Enabled:     healthcheck.Enabled,
 		RandomID:    healthcheck.RandomID,
 		Definition:  def,
+		Source:      healthcheck.Source,
 	}
-	result, err := tx.NamedExecContext(ctx, "INSERT INTO healthcheck (id, name, description, labels, created_at, definition, type, interval, random_id, enabled, timeout) VALUES (:id, :name, :description, :labels, :created_at, :definition, :type, :interval, :random_id, :enabled, :timeout)", dbHealthcheck)
+	result, err := tx.NamedExecContext(ctx, "INSERT INTO healthcheck (id, name, description, labels, created_at, definition, type, interval, random_id, enabled, timeout, source) VALUES (:id, :name, :description, :labels, :created_at, :definition, :type, :interval, :random_id, :enabled, :timeout, :source)", dbHealthcheck)
 	if err != nil {
 		return fmt.Errorf("fail to create healthcheck %s: %w", healthcheck.Name, err)
 	}
@@ -111,7 +114,7 @@ func (c *Database) CreateHealthcheck(ctx context.Context, healthcheck *aggregate
 
 func (c *Database) GetHealthcheck(ctx context.Context, id string) (*aggregates.Healthcheck, error) {
 	healthcheck := dbHealthcheck{}
-	err := c.db.GetContext(ctx, &healthcheck, "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout FROM healthcheck WHERE id=$1", id)
+	err := c.db.GetContext(ctx, &healthcheck, "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout, healthcheck.source FROM healthcheck WHERE id=$1", id)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return nil, fmt.Errorf("fail to get healthcheck %s: %w", id, err)
@@ -128,7 +131,7 @@ func (c *Database) GetHealthcheck(ctx context.Context, id string) (*aggregates.H
 
 func (c *Database) GetHealthcheckByName(ctx context.Context, name string) (*aggregates.Healthcheck, error) {
 	healthcheck := dbHealthcheck{}
-	err := c.db.GetContext(ctx, &healthcheck, "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout FROM healthcheck WHERE name=$1", name)
+	err := c.db.GetContext(ctx, &healthcheck, "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout, healthcheck.source FROM healthcheck WHERE name=$1", name)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return nil, fmt.Errorf("fail to get healthcheck %s: %w", name, err)
@@ -157,7 +160,7 @@ func (c *Database) DeleteHealthcheck(ctx context.Context, id string) error {
 
 func (c *Database) ListHealthchecks(ctx context.Context, enabled *bool) ([]*aggregates.Healthcheck, error) {
 	healthchecks := []dbHealthcheck{}
-	baseQuery := "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout FROM healthcheck"
+	baseQuery := "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout, healthcheck.source FROM healthcheck"
 	if enabled != nil {
 		baseQuery = fmt.Sprintf("%s WHERE enabled is %t", baseQuery, *enabled)
 	}
@@ -180,7 +183,7 @@ func (c *Database) ListHealthchecks(ctx context.Context, enabled *bool) ([]*aggr
 
 func (c *Database) ListHealthchecksForProber(ctx context.Context, prober int) ([]*aggregates.Healthcheck, error) {
 	healthchecks := []dbHealthcheck{}
-	err := c.db.SelectContext(ctx, &healthchecks, "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout FROM healthcheck WHERE healthcheck.random_id%$1=$2 AND healthcheck.enabled=true", c.probers, prober)
+	err := c.db.SelectContext(ctx, &healthchecks, "SELECT healthcheck.id, healthcheck.name, healthcheck.description, healthcheck.labels, healthcheck.created_at, healthcheck.definition, healthcheck.type, healthcheck.interval, healthcheck.random_id, healthcheck.enabled, healthcheck.timeout, healthcheck.source FROM healthcheck WHERE healthcheck.random_id%$1=$2 AND healthcheck.enabled=true", c.probers.Load(), prober)
 	if err != nil {
 		return nil, fmt.Errorf("fail to list healthchecks: %w", err)
 	}
@@ -42,6 +42,8 @@ func TestHealthcheckCRUD(t *testing.T) {
 		t.Fatalf("Invalid healcheck returned by CreateHealthcheck\n%+v", checkGet)
 	}
 
+	assert.Nil(t, checkGet.Source)
+
 	checkGetByName, err := TestComponent.GetHealthcheckByName(context.Background(), healthcheck.Name)
 	assert.NoError(t, err)
 	if checkGetByName.ID == "" || checkGetByName.Name != healthcheck.Name || checkGetByName.Description != healthcheck.Description || !reflect.DeepEqual(checkGetByName.Labels, healthcheck.Labels) || checkGetByName.CreatedAt.IsZero() {
@@ -83,6 +85,26 @@ func TestHealthcheckCRUD(t *testing.T) {
 	err = TestComponent.UpdateHealthcheck(context.Background(), &healthcheckUpdate)
 	assert.NoError(t, err)
 
+	source := "checks.yaml"
+	fileCheck := aggregates.Healthcheck{
+		ID:         util.NewUUID(),
+		CreatedAt:  time.Now(),
+		Name:       "file-check",
+		Type:       "dns",
+		Timeout:    "3s",
+		Definition: def1,
+		Interval:   "60s",
+		Enabled:    true,
+		Source:     &source,
+	}
+	err = TestComponent.CreateHealthcheck(context.Background(), &fileCheck)
+	assert.NoError(t, err)
+	checkGet, err = TestComponent.GetHealthcheck(context.Background(), fileCheck.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &source, checkGet.Source)
+	err = TestComponent.DeleteHealthcheck(context.Background(), fileCheck.ID)
+	assert.NoError(t, err)
+
 	err = TestComponent.DeleteHealthcheck(context.Background(), healthcheck.ID)
 	assert.NoError(t, err)
 
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+)
+
+const heartbeatColumns = "healthcheck_id, status, message, last_ping_at, last_start_at, last_failure_at, last_duration, updated_at"
+
+type heartbeat struct {
+	HealthcheckID string     `db:"healthcheck_id"`
+	Status        string     `db:"status"`
+	Message       *string    `db:"message"`
+	LastPingAt    *time.Time `db:"last_ping_at"`
+	LastStartAt   *time.Time `db:"last_start_at"`
+	LastFailureAt *time.Time `db:"last_failure_at"`
+	LastDuration  *float64   `db:"last_duration"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	result := t.UTC()
+	return &result
+}
+
+func toHeartbeatState(state *heartbeat) *aggregates.HeartbeatState {
+	return &aggregates.HeartbeatState{
+		HealthcheckID: state.HealthcheckID,
+		Status:        state.Status,
+		Message:       state.Message,
+		LastPingAt:    utcTime(state.LastPingAt),
+		LastStartAt:   utcTime(state.LastStartAt),
+		LastFailureAt: utcTime(state.LastFailureAt),
+		LastDuration:  state.LastDuration,
+		UpdatedAt:     state.UpdatedAt.UTC(),
+	}
+}
+
+// RecordHeartbeatPing updates the state of a heartbeat check.
+// A start ping only records the start time, the next success or failure
+// ping computes the duration of the job.
+func (c *Database) RecordHeartbeatPing(ctx context.Context, ping aggregates.HeartbeatPing) (*aggregates.HeartbeatState, error) {
+	result := heartbeat{}
+	var err error
+	switch ping.Kind {
+	case aggregates.HeartbeatPingStart:
+		err = c.db.GetContext(ctx, &result, "INSERT INTO heartbeat (healthcheck_id, status, last_start_at, updated_at) VALUES ($1, $2, $3, $3) ON CONFLICT (healthcheck_id) DO UPDATE SET last_start_at = EXCLUDED.last_start_at, updated_at = EXCLUDED.updated_at RETURNING "+heartbeatColumns, ping.HealthcheckID, aggregates.HeartbeatStatusNew, ping.At)
+	case aggregates.HeartbeatPingSuccess, aggregates.HeartbeatPingFail:
+		status := aggregates.HeartbeatStatusUp
+		var failureAt *time.Time
+		if ping.Kind == aggregates.HeartbeatPingFail {
+			status = aggregates.HeartbeatStatusDown
+			failureAt = &ping.At
+		}
+		err = c.db.GetContext(ctx, &result, "INSERT INTO heartbeat (healthcheck_id, status, message, last_ping_at, last_failure_at, updated_at) VALUES ($1, $2, $3, $4, $5, $4) ON CONFLICT (healthcheck_id) DO UPDATE SET status = EXCLUDED.status, message = EXCLUDED.message, last_ping_at = EXCLUDED.last_ping_at, last_failure_at = COALESCE(EXCLUDED.last_failure_at, heartbeat.last_failure_at), last_duration = CASE WHEN heartbeat.last_start_at IS NULL THEN heartbeat.last_duration ELSE EXTRACT(EPOCH FROM (EXCLUDED.last_ping_at - heartbeat.last_start_at))::double precision END, last_start_at = NULL, updated_at = EXCLUDED.updated_at RETURNING "+heartbeatColumns, ping.HealthcheckID, status, ping.Message, ping.At, failureAt)
+	default:
+		return nil, fmt.Errorf("unknown heartbeat ping %s", ping.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fail to record heartbeat ping for healthcheck %s: %w", ping.HealthcheckID, err)
+	}
+	return toHeartbeatState(&result), nil
+}
+
+// GetHeartbeatState returns the state of a heartbeat check, a check never
+// pinged is new
+func (c *Database) GetHeartbeatState(ctx context.Context, id string) (*aggregates.HeartbeatState, error) {
+	result := heartbeat{}
+	err := c.db.GetContext(ctx, &result, "SELECT "+heartbeatColumns+" FROM heartbeat WHERE healthcheck_id=$1", id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("fail to get heartbeat state %s: %w", id, err)
+		}
+		return &aggregates.HeartbeatState{
+			HealthcheckID: id,
+			Status:        aggregates.HeartbeatStatusNew,
+		}, nil
+	}
+	return toHeartbeatState(&result), nil
+}
+
+func (c *Database) ListHeartbeatStates(ctx context.Context) ([]*aggregates.HeartbeatState, error) {
+	states := []heartbeat{}
+	err := c.db.SelectContext(ctx, &states, "SELECT "+heartbeatColumns+" FROM heartbeat")
+	if err != nil {
+		return nil, fmt.Errorf("fail to list heartbeat states: %w", err)
+	}
+	result := make([]*aggregates.HeartbeatState, 0, len(states))
+	for i := range states {
+		result = append(result, toHeartbeatState(&states[i]))
+	}
+	return result, nil
+}
+
+// MarkHeartbeatDown marks a heartbeat check as failing, unless it was
+// pinged since the given state was read. It returns true if the state
+// was updated.
+func (c *Database) MarkHeartbeatDown(ctx context.Context, state aggregates.HeartbeatState, message string, at time.Time) (bool, error) {
+	result, err := c.db.ExecContext(ctx, "INSERT INTO heartbeat (healthcheck_id, status, message, updated_at) VALUES ($1, $2, $3, $4) ON CONFLICT (healthcheck_id) DO UPDATE SET status = EXCLUDED.status, message = EXCLUDED.message, updated_at = EXCLUDED.updated_at WHERE heartbeat.last_ping_at IS NOT DISTINCT FROM $5 AND heartbeat.last_start_at IS NOT DISTINCT FROM $6", state.HealthcheckID, aggregates.HeartbeatStatusDown, message, at, state.LastPingAt, state.LastStartAt)
+	if err != nil {
+		return false, fmt.Errorf("fail to update heartbeat state %s: %w", state.HealthcheckID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
@@ -0,0 +1,86 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/baidubce/bce-sdk-go/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeatState(t *testing.T) {
+	ctx := context.Background()
+	healthcheck := aggregates.Healthcheck{
+		ID:        util.NewUUID(),
+		CreatedAt: time.Now(),
+		Name:      "heartbeat-state",
+		Type:      "heartbeat",
+		Enabled:   true,
+		Definition: &aggregates.HealthcheckHeartbeatDefinition{
+			Period: "1h",
+		},
+	}
+	err := TestComponent.CreateHealthcheck(ctx, &healthcheck)
+	assert.NoError(t, err)
+	defer func() {
+		err := TestComponent.DeleteHealthcheck(ctx, healthcheck.ID)
+		assert.NoError(t, err)
+	}()
+
+	state, err := TestComponent.GetHeartbeatState(ctx, healthcheck.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, aggregates.HeartbeatStatusNew, state.Status)
+
+	start := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	state, err = TestComponent.RecordHeartbeatPing(ctx, aggregates.HeartbeatPing{
+		HealthcheckID: healthcheck.ID,
+		Kind:          aggregates.HeartbeatPingStart,
+		At:            start,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, aggregates.HeartbeatStatusNew, state.Status)
+	assert.Equal(t, start, *state.LastStartAt)
+
+	// the duration is computed from the start ping
+	state, err = TestComponent.RecordHeartbeatPing(ctx, aggregates.HeartbeatPing{
+		HealthcheckID: healthcheck.ID,
+		Kind:          aggregates.HeartbeatPingSuccess,
+		At:            start.Add(90 * time.Second),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, aggregates.HeartbeatStatusUp, state.Status)
+	assert.Nil(t, state.LastStartAt)
+	assert.Equal(t, 90.0, *state.LastDuration)
+	assert.Equal(t, start.Add(90*time.Second), *state.LastPingAt)
+
+	// the check is not marked as down if it was pinged in the meantime
+	stale := aggregates.HeartbeatState{HealthcheckID: healthcheck.ID}
+	updated, err := TestComponent.MarkHeartbeatDown(ctx, stale, "missing ping", start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, updated)
+	updated, err = TestComponent.MarkHeartbeatDown(ctx, *state, "missing ping", start.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	state, err = TestComponent.GetHeartbeatState(ctx, healthcheck.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, aggregates.HeartbeatStatusDown, state.Status)
+	assert.Equal(t, "missing ping", *state.Message)
+
+	message := "exit code 1"
+	state, err = TestComponent.RecordHeartbeatPing(ctx, aggregates.HeartbeatPing{
+		HealthcheckID: healthcheck.ID,
+		Kind:          aggregates.HeartbeatPingFail,
+		Message:       &message,
+		At:            start.Add(3 * time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, aggregates.HeartbeatStatusDown, state.Status)
+	assert.Equal(t, message, *state.Message)
+	assert.Equal(t, start.Add(3*time.Hour), *state.LastFailureAt)
+
+	states, err := TestComponent.ListHeartbeatStates(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+)
+
+const metricFamilyColumns = "name, type, help, unit, created_at, updated_at"
+
+type metricFamily struct {
+	Name      string
+	Type      *string
+	Help      *string
+	Unit      *string
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func toMetricFamily(family *metricFamily) *aggregates.MetricFamily {
+	return &aggregates.MetricFamily{
+		Name:      family.Name,
+		Type:      family.Type,
+		Help:      family.Help,
+		Unit:      family.Unit,
+		CreatedAt: family.CreatedAt,
+		UpdatedAt: family.UpdatedAt,
+	}
+}
+
+func toMetricFamilies(families []metricFamily) []*aggregates.MetricFamily {
+	result := make([]*aggregates.MetricFamily, 0, len(families))
+	for i := range families {
+		result = append(result, toMetricFamily(&families[i]))
+	}
+	return result
+}
+
+type batchFamily struct {
+	Name string  `json:"name"`
+	Type *string `json:"type"`
+	Help *string `json:"help"`
+}
+
+// RegisterMetricFamilies creates the missing families and defines the
+// type and help of the existing ones if they were not set. The registered
+// families are returned.
+func (c *Database) RegisterMetricFamilies(ctx context.Context, families []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error) {
+	input := make([]batchFamily, 0, len(families))
+	for _, family := range families {
+		input = append(input, batchFamily{
+			Name: family.Name,
+			Type: family.Type,
+			Help: family.Help,
+		})
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("fail to serialize metric families: %w", err)
+	}
+	now := time.Now().UTC()
+	// the conflicting rows are always updated so they are returned
+	result := []metricFamily{}
+	err = c.db.SelectContext(ctx, &result, "INSERT INTO metric_family(name, type, help, created_at, updated_at) SELECT name, type, help, $2, $2 FROM jsonb_to_recordset($1::jsonb) AS x(name varchar(255), type varchar(255), help varchar(255)) ORDER BY name ON CONFLICT (name) DO UPDATE SET type = COALESCE(metric_family.type, EXCLUDED.type), help = COALESCE(metric_family.help, EXCLUDED.help), updated_at = CASE WHEN (metric_family.type IS NULL AND EXCLUDED.type IS NOT NULL) OR (metric_family.help IS NULL AND EXCLUDED.help IS NOT NULL) THEN EXCLUDED.updated_at ELSE metric_family.updated_at END RETURNING "+metricFamilyColumns, string(payload), now)
+	if err != nil {
+		return nil, fmt.Errorf("fail to register metric families: %w", err)
+	}
+	return toMetricFamilies(result), nil
+}
+
+func (c *Database) GetMetricFamilies(ctx context.Context) ([]*aggregates.MetricFamily, error) {
+	result := []metricFamily{}
+	err := c.db.SelectContext(ctx, &result, "SELECT "+metricFamilyColumns+" FROM metric_family ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("fail to get metric families: %w", err)
+	}
+	return toMetricFamilies(result), nil
+}
+
+func (c *Database) GetMetricFamily(ctx context.Context, name string) (*aggregates.MetricFamily, error) {
+	family := metricFamily{}
+	err := c.db.GetContext(ctx, &family, "SELECT "+metricFamilyColumns+" FROM metric_family WHERE name=$1", name)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("fail to get metric family %s: %w", name, err)
+		}
+		return nil, er.New("metric family not found", er.NotFound, true)
+	}
+	return toMetricFamily(&family), nil
+}
+
+// UpdateMetricFamily creates or replaces the metadata of a family
+func (c *Database) UpdateMetricFamily(ctx context.Context, family aggregates.MetricFamily) error {
+	_, err := c.db.ExecContext(ctx, "INSERT INTO metric_family(name, type, help, unit, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6) ON CONFLICT (name) DO UPDATE SET type = EXCLUDED.type, help = EXCLUDED.help, unit = EXCLUDED.unit, updated_at = EXCLUDED.updated_at", family.Name, family.Type, family.Help, family.Unit, family.CreatedAt, family.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("fail to update metric family %s: %w", family.Name, err)
+	}
+	return nil
+}
+
+func (c *Database) DeleteMetricFamily(ctx context.Context, name string) error {
+	result, err := c.db.ExecContext(ctx, "DELETE FROM metric_family WHERE name=$1", name)
+	if err != nil {
+		return fmt.Errorf("fail to delete metric family %s: %w", name, err)
+	}
+	return checkResult(result, 1)
+}
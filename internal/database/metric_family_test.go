@@ -0,0 +1,60 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricFamilies(t *testing.T) {
+	ctx := context.Background()
+	counter := "counter"
+	gauge := "gauge"
+	help := "Number of requests"
+	unit := "seconds"
+
+	families, err := TestComponent.RegisterMetricFamilies(ctx, []aggregates.MetricFamily{
+		{Name: "requests_total", Type: &counter},
+		{Name: "latency_seconds"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, families, 2)
+
+	// the type is kept, the help is defined
+	families, err = TestComponent.RegisterMetricFamilies(ctx, []aggregates.MetricFamily{
+		{Name: "requests_total", Type: &gauge, Help: &help},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, families, 1)
+	assert.Equal(t, "counter", *families[0].Type)
+	assert.Equal(t, help, *families[0].Help)
+
+	now := time.Now().UTC()
+	err = TestComponent.UpdateMetricFamily(ctx, aggregates.MetricFamily{Name: "latency_seconds", Type: &gauge, Unit: &unit, CreatedAt: now, UpdatedAt: now})
+	assert.NoError(t, err)
+	family, err := TestComponent.GetMetricFamily(ctx, "latency_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, "gauge", *family.Type)
+	assert.Equal(t, "seconds", *family.Unit)
+	assert.Nil(t, family.Help)
+
+	families, err = TestComponent.GetMetricFamilies(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, families, 2)
+	assert.Equal(t, "latency_seconds", families[0].Name)
+
+	err = TestComponent.DeleteMetricFamily(ctx, "latency_seconds")
+	assert.NoError(t, err)
+	_, err = TestComponent.GetMetricFamily(ctx, "latency_seconds")
+	var notFound *er.Error
+	assert.ErrorAs(t, err, &notFound)
+	assert.Equal(t, er.NotFound, notFound.Type)
+	err = TestComponent.DeleteMetricFamily(ctx, "latency_seconds")
+	assert.Error(t, err)
+	err = TestComponent.DeleteMetricFamily(ctx, "requests_total")
+	assert.NoError(t, err)
+}
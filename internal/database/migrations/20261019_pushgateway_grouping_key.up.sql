@@ -0,0 +1,6 @@
+ALTER TABLE pushgateway_metric ADD COLUMN IF NOT EXISTS grouping_key jsonb;
+--;;
+CREATE INDEX IF NOT EXISTS idx_pushgateway_grouping_key ON pushgateway_metric USING GIN (grouping_key);
+--;;
+CREATE INDEX IF NOT EXISTS idx_pushgateway_labels ON pushgateway_metric USING GIN (labels);
+--;;
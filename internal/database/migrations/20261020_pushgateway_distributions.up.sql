@@ -0,0 +1,4 @@
+ALTER TABLE pushgateway_metric ADD COLUMN IF NOT EXISTS histogram jsonb;
+--;;
+ALTER TABLE pushgateway_metric ADD COLUMN IF NOT EXISTS summary jsonb;
+--;;
@@ -0,0 +1,21 @@
+-- values accepted by the Go parser but not by PostgreSQL, like hex floats
+-- (0x1p-2) or underscores (1_000), can't be converted: the metrics are
+-- deleted and logged
+DO $$
+DECLARE
+  metric RECORD;
+BEGIN
+  FOR metric IN SELECT id, name, value FROM pushgateway_metric WHERE value <> '' LOOP
+    BEGIN
+      PERFORM metric.value::double precision;
+    EXCEPTION WHEN invalid_text_representation OR numeric_value_out_of_range THEN
+      RAISE WARNING 'deleting pushgateway metric % (%): value % can''t be converted to double precision', metric.name, metric.id, metric.value;
+      DELETE FROM pushgateway_metric WHERE id = metric.id;
+    END;
+  END LOOP;
+END $$;
+--;;
+ALTER TABLE pushgateway_metric ALTER COLUMN value TYPE double precision USING NULLIF(value, '')::double precision;
+--;;
+CREATE INDEX IF NOT EXISTS idx_pushgateway_value ON pushgateway_metric(value);
+--;;
@@ -0,0 +1,14 @@
+ALTER TABLE pushgateway_metric ADD COLUMN IF NOT EXISTS updated_at timestamp;
+--;;
+UPDATE pushgateway_metric SET updated_at = created_at WHERE updated_at IS NULL;
+--;;
+ALTER TABLE pushgateway_metric ALTER COLUMN updated_at SET NOT NULL;
+--;;
+ALTER TABLE pushgateway_metric ADD COLUMN IF NOT EXISTS sample_timestamp timestamp;
+--;;
+create table if not exists pushgateway_group (
+  grouping_key jsonb not null primary key,
+  push_time timestamp,
+  push_failure_time timestamp
+);
+--;;
@@ -0,0 +1,15 @@
+CREATE OR REPLACE FUNCTION pushgateway_notify() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('pushgateway_changes', COALESCE(current_setting('appclacks.origin', true), ''));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+--;;
+DROP TRIGGER IF EXISTS pushgateway_metric_notify ON pushgateway_metric;
+--;;
+CREATE TRIGGER pushgateway_metric_notify AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON pushgateway_metric FOR EACH STATEMENT EXECUTE FUNCTION pushgateway_notify();
+--;;
+DROP TRIGGER IF EXISTS pushgateway_group_notify ON pushgateway_group;
+--;;
+CREATE TRIGGER pushgateway_group_notify AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON pushgateway_group FOR EACH STATEMENT EXECUTE FUNCTION pushgateway_notify();
+--;;
@@ -0,0 +1,20 @@
+create table if not exists metric_family (
+  name varchar(255) not null primary key,
+  type varchar(255),
+  help varchar(255),
+  unit varchar(255),
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+--;;
+INSERT INTO metric_family(name, type, help, created_at, updated_at)
+SELECT name,
+  (array_agg(type ORDER BY created_at) FILTER (WHERE type IS NOT NULL))[1],
+  (array_agg(description ORDER BY created_at) FILTER (WHERE description IS NOT NULL))[1],
+  now() at time zone 'utc',
+  now() at time zone 'utc'
+FROM pushgateway_metric
+GROUP BY name
+HAVING count(type) > 0 OR count(description) > 0
+ON CONFLICT (name) DO NOTHING;
+--;;
@@ -0,0 +1,11 @@
+create table if not exists heartbeat (
+  healthcheck_id uuid not null primary key references healthcheck(id) on delete cascade,
+  status varchar(255) not null,
+  message text,
+  last_ping_at timestamp,
+  last_start_at timestamp,
+  last_failure_at timestamp,
+  last_duration double precision,
+  updated_at timestamp not null
+);
+--;;
@@ -0,0 +1,2 @@
+ALTER TABLE healthcheck ADD COLUMN IF NOT EXISTS source varchar(255);
+--;;
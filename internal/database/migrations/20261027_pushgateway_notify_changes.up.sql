@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION pushgateway_notify() RETURNS trigger AS $$
+BEGIN
+  -- the changes written by the pushgateway cache are notified with their content
+  IF COALESCE(current_setting('appclacks.origin', true), '') = '' THEN
+    PERFORM pg_notify('pushgateway_changes', '');
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+--;;
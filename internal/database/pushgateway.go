@@ -3,12 +3,19 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"strconv"
+	"regexp/syntax"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/appclacks/server/internal/util"
+	"github.com/appclacks/server/pkg/pushgateway"
 	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	er "github.com/mcorbin/corbierror"
 )
 
@@ -20,8 +27,13 @@ type pushgatewayMetric struct {
 	TTL         *string
 	Type        *string
 	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at"`
 	ExpiresAt   *time.Time `db:"expires_at"`
-	Value       string
+	Timestamp   *time.Time `db:"sample_timestamp"`
+	Value       *float64
+	GroupingKey *string `db:"grouping_key"`
+	Histogram   *string
+	Summary     *string
 }
 
 func toPushGatewayMetric(metric *pushgatewayMetric) (*aggregates.PushgatewayMetric, error) {
@@ -29,6 +41,18 @@ func toPushGatewayMetric(metric *pushgatewayMetric) (*aggregates.PushgatewayMetr
 	if err != nil {
 		return nil, err
 	}
+	groupingKey, err := stringToLabels(metric.GroupingKey)
+	if err != nil {
+		return nil, err
+	}
+	histogram, err := stringToHistogram(metric.Histogram)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := stringToSummary(metric.Summary)
+	if err != nil {
+		return nil, err
+	}
 
 	result := &aggregates.PushgatewayMetric{
 		ID:          metric.ID,
@@ -38,15 +62,33 @@ func toPushGatewayMetric(metric *pushgatewayMetric) (*aggregates.PushgatewayMetr
 		TTL:         metric.TTL,
 		Type:        metric.Type,
 		CreatedAt:   metric.CreatedAt.UTC(),
-		Value:       metric.Value,
+		UpdatedAt:   metric.UpdatedAt.UTC(),
+		Histogram:   histogram,
+		Summary:     summary,
+		GroupingKey: groupingKey,
+	}
+	if metric.Value != nil {
+		result.Value = *metric.Value
 	}
 	if metric.ExpiresAt != nil {
 		expiresAt := metric.ExpiresAt.UTC()
 		result.ExpiresAt = &expiresAt
 	}
+	if metric.Timestamp != nil {
+		timestamp := metric.Timestamp.UTC()
+		result.Timestamp = &timestamp
+	}
 	return result, nil
 }
 
+// metricValue returns the value to store, histograms and summaries have no value
+func metricValue(metric aggregates.PushgatewayMetric) *float64 {
+	if metric.Histogram != nil || metric.Summary != nil {
+		return nil
+	}
+	return &metric.Value
+}
+
 func (c *Database) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric, cumulative bool) (string, error) {
 	metricID := ""
 	tx := c.db.MustBegin()
@@ -73,12 +115,20 @@ func (c *Database) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric a
 		}
 		labelCondition = *labelString
 	}
-	err = c.db.GetContext(ctx, &currentMetric, "SELECT id, name, value FROM pushgateway_metric WHERE name=$1 AND labels @> $2 AND $2 <@ labels", metric.Name, labelCondition)
+	err = tx.GetContext(ctx, &currentMetric, "SELECT id FROM pushgateway_metric WHERE name=$1 AND labels = $2::jsonb", metric.Name, labelCondition)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return "", err
 		}
 	}
+	histogram, err := histogramToString(metric.Histogram)
+	if err != nil {
+		return "", err
+	}
+	summary, err := summaryToString(metric.Summary)
+	if err != nil {
+		return "", err
+	}
 	if currentMetric.ID == "" {
 		metricID = util.NewUUID()
 		newMetric := pushgatewayMetric{
@@ -89,11 +139,15 @@ func (c *Database) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric a
 			TTL:         metric.TTL,
 			Type:        metric.Type,
 			CreatedAt:   metric.CreatedAt,
+			UpdatedAt:   metric.UpdatedAt,
 			ExpiresAt:   metric.ExpiresAt,
-			Value:       metric.Value,
+			Timestamp:   metric.Timestamp,
+			Value:       metricValue(metric),
+			Histogram:   histogram,
+			Summary:     summary,
 		}
 		c.Logger.Debug(fmt.Sprintf("creating metric %s", metric.Name))
-		result, err := tx.NamedExecContext(ctx, "INSERT INTO pushgateway_metric(id, name, description, ttl, labels, value, type, created_at, expires_at) VALUES (:id, :name, :description, :ttl, :labels, :value, :type, :created_at, :expires_at)", newMetric)
+		result, err := tx.NamedExecContext(ctx, "INSERT INTO pushgateway_metric(id, name, description, ttl, labels, value, type, created_at, updated_at, expires_at, sample_timestamp, histogram, summary) VALUES (:id, :name, :description, :ttl, :labels, :value, :type, :created_at, :updated_at, :expires_at, :sample_timestamp, :histogram, :summary)", newMetric)
 		if err != nil {
 			return "", err
 		}
@@ -103,29 +157,25 @@ func (c *Database) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric a
 		}
 	} else {
 		metricID = currentMetric.ID
-		metricValue := metric.Value
-		if cumulative {
-			current, err := strconv.ParseFloat(currentMetric.Value, 64)
-			if err != nil {
-				return "", err
-			}
-			new, err := strconv.ParseFloat(metricValue, 64)
-			if err != nil {
-				return "", err
-			}
-			metricValue = fmt.Sprintf("%f", current+new)
-		}
 		updatedMetric := pushgatewayMetric{
 			ID:          currentMetric.ID,
 			Description: metric.Description,
 			TTL:         metric.TTL,
 			Type:        metric.Type,
 			CreatedAt:   metric.CreatedAt,
+			UpdatedAt:   metric.UpdatedAt,
 			ExpiresAt:   metric.ExpiresAt,
-			Value:       metricValue,
+			Timestamp:   metric.Timestamp,
+			Value:       metricValue(metric),
+			Histogram:   histogram,
+			Summary:     summary,
+		}
+		valueUpdate := ":value"
+		if cumulative && metric.Histogram == nil && metric.Summary == nil {
+			valueUpdate = "value + :value"
 		}
 		c.Logger.Debug(fmt.Sprintf("updating metric %s", metric.Name))
-		result, err := c.db.NamedExecContext(ctx, "UPDATE pushgateway_metric SET description=:description, ttl=:ttl, type=:type, created_at=:created_at, expires_at=:expires_at, value=:value where id=:id", updatedMetric)
+		result, err := tx.NamedExecContext(ctx, "UPDATE pushgateway_metric SET description=:description, ttl=:ttl, type=:type, updated_at=:updated_at, expires_at=:expires_at, sample_timestamp=:sample_timestamp, value="+valueUpdate+", histogram=:histogram, summary=:summary where id=:id", updatedMetric)
 		if err != nil {
 			return "", err
 		}
@@ -142,9 +192,37 @@ func (c *Database) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric a
 	return metricID, nil
 }
 
-func (c *Database) GetMetrics(ctx context.Context) ([]*aggregates.PushgatewayMetric, error) {
+func (c *Database) GetMetrics(ctx context.Context, query aggregates.Query) ([]*aggregates.PushgatewayMetric, error) {
 	metrics := []pushgatewayMetric{}
-	err := c.db.SelectContext(ctx, &metrics, "SELECT id, name, description, ttl, labels, value, type, created_at, expires_at FROM pushgateway_metric")
+	baseQuery := "SELECT " + pushgatewayMetricColumns + " FROM pushgateway_metric"
+	conditions := []string{}
+	args := []any{}
+	if query.MinValue != nil {
+		args = append(args, *query.MinValue)
+		conditions = append(conditions, fmt.Sprintf("value >= $%d", len(args)))
+	}
+	if query.MaxValue != nil {
+		args = append(args, *query.MaxValue)
+		conditions = append(conditions, fmt.Sprintf("value <= $%d", len(args)))
+	}
+	if len(conditions) > 0 {
+		// NaN is greater than all numbers in PostgreSQL
+		conditions = append(conditions, "value <> 'NaN'::double precision")
+	}
+	filter := false
+	if len(query.Selectors) > 0 {
+		var condition string
+		var err error
+		condition, args, filter, err = selectorsCondition(query.Selectors, args)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) > 0 {
+		baseQuery = fmt.Sprintf("%s WHERE %s", baseQuery, strings.Join(conditions, " AND "))
+	}
+	err := c.db.SelectContext(ctx, &metrics, baseQuery, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -155,11 +233,234 @@ func (c *Database) GetMetrics(ctx context.Context) ([]*aggregates.PushgatewayMet
 		if err != nil {
 			return nil, err
 		}
+		if filter && !pushgateway.MatchSelectors(query.Selectors, metric.Name, metric.Labels) {
+			continue
+		}
 		result = append(result, metric)
 	}
 	return result, nil
 }
 
+// selectorsCondition returns the SQL condition matching one of the selectors.
+// Regexes are only pushed down as a prefilter because PostgreSQL and Go do
+// not support the same syntax, the result should be filtered with
+// pushgateway.MatchSelectors when filter is true.
+func selectorsCondition(selectors [][]aggregates.LabelMatcher, args []any) (string, []any, bool, error) {
+	conditions := []string{}
+	filter := false
+	for _, selector := range selectors {
+		matchers := []string{}
+		for _, matcher := range selector {
+			var condition string
+			var err error
+			if matcher.Type == aggregates.MatchRegexp || matcher.Type == aggregates.MatchNotRegexp {
+				filter = true
+				condition, args, err = regexCondition(matcher, args)
+			} else {
+				condition, args, err = matcherCondition(matcher, args)
+			}
+			if err != nil {
+				return "", nil, false, err
+			}
+			if condition != "" {
+				matchers = append(matchers, condition)
+			}
+		}
+		if len(matchers) == 0 {
+			matchers = append(matchers, "TRUE")
+		}
+		conditions = append(conditions, "("+strings.Join(matchers, " AND ")+")")
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args, filter, nil
+}
+
+// matcherCondition returns the SQL condition of an equality label matcher.
+// A missing label has an empty value, the __name__ label is the metric name.
+func matcherCondition(matcher aggregates.LabelMatcher, args []any) (string, []any, error) {
+	column := "name"
+	if matcher.Name != "__name__" {
+		if matcher.Type == aggregates.MatchEqual && matcher.Value != "" {
+			// containment can use the labels index
+			labels, err := labelsToString(map[string]string{matcher.Name: matcher.Value})
+			if err != nil {
+				return "", nil, err
+			}
+			args = append(args, *labels)
+			return fmt.Sprintf("labels @> $%d::jsonb", len(args)), args, nil
+		}
+		args = append(args, matcher.Name)
+		column = fmt.Sprintf("COALESCE(labels->>$%d::text, '')", len(args))
+	}
+	operators := map[string]string{
+		aggregates.MatchEqual:    "=",
+		aggregates.MatchNotEqual: "<>",
+	}
+	operator, ok := operators[matcher.Type]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown label matcher type %s", matcher.Type)
+	}
+	args = append(args, matcher.Value)
+	return fmt.Sprintf("%s %s $%d", column, operator, len(args)), args, nil
+}
+
+// regexCondition returns a SQL condition matching at least the rows
+// matched by a regex label matcher, or an empty condition if the regex
+// can't be converted. A regex matching a small set of strings is converted
+// to equalities, a regex with a literal prefix to a LIKE, and a regex
+// which doesn't match the empty string requires the label to exist.
+func regexCondition(matcher aggregates.LabelMatcher, args []any) (string, []any, error) {
+	if matcher.Regex == nil {
+		return "", args, nil
+	}
+	negate := matcher.Type == aggregates.MatchNotRegexp
+	values, finite := regexValues(matcher.Value)
+	if finite {
+		var condition string
+		var err error
+		condition, args, err = valuesCondition(matcher.Name, values, args)
+		if err != nil {
+			return "", nil, err
+		}
+		if negate {
+			// the labels column is nullable
+			condition = "NOT COALESCE(" + condition + ", FALSE)"
+		}
+		return condition, args, nil
+	}
+	if negate {
+		// the label should exist if the regex matches the empty string
+		if matcher.Name != "__name__" && matcher.Regex.MatchString("") {
+			args = append(args, matcher.Name)
+			return fmt.Sprintf("labels ? $%d::text", len(args)), args, nil
+		}
+		return "", args, nil
+	}
+	prefix, _ := matcher.Regex.LiteralPrefix()
+	if matcher.Name == "__name__" {
+		if prefix == "" {
+			return "", args, nil
+		}
+		args = append(args, likePrefix(prefix))
+		return fmt.Sprintf("name LIKE $%d", len(args)), args, nil
+	}
+	if matcher.Regex.MatchString("") {
+		return "", args, nil
+	}
+	args = append(args, matcher.Name)
+	condition := fmt.Sprintf("labels ? $%d::text", len(args))
+	if prefix != "" {
+		args = append(args, likePrefix(prefix))
+		condition = fmt.Sprintf("%s AND labels->>$%d::text LIKE $%d", condition, len(args)-1, len(args))
+	}
+	return condition, args, nil
+}
+
+// valuesCondition returns the SQL condition matching the rows where the
+// label has one of the values. A missing label has an empty value.
+func valuesCondition(name string, values []string, args []any) (string, []any, error) {
+	if name == "__name__" {
+		args = append(args, pq.Array(values))
+		return fmt.Sprintf("name = ANY($%d::text[])", len(args)), args, nil
+	}
+	conditions := []string{}
+	for _, value := range values {
+		if value == "" {
+			args = append(args, name)
+			conditions = append(conditions, fmt.Sprintf("COALESCE(labels->>$%d::text, '') = ''", len(args)))
+			continue
+		}
+		// containment can use the labels index
+		labels, err := labelsToString(map[string]string{name: value})
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, *labels)
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d::jsonb", len(args)))
+	}
+	if len(conditions) == 0 {
+		return "FALSE", args, nil
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args, nil
+}
+
+// maxRegexValues is the maximum number of strings a regex can match to be
+// converted to equalities
+const maxRegexValues = 32
+
+// regexValues returns the strings fully matched by the regex if it only
+// matches a small set of them, for example prod|staging
+func regexValues(expr string) ([]string, bool) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, false
+	}
+	return finiteValues(re.Simplify())
+}
+
+func finiteValues(re *syntax.Regexp) ([]string, bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []string{""}, true
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil, false
+		}
+		return []string{string(re.Rune)}, true
+	case syntax.OpCharClass:
+		values := []string{}
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if int(re.Rune[i+1]-re.Rune[i])+1 > maxRegexValues-len(values) {
+				return nil, false
+			}
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				values = append(values, string(r))
+			}
+		}
+		return values, true
+	case syntax.OpCapture:
+		return finiteValues(re.Sub[0])
+	case syntax.OpQuest:
+		values, ok := finiteValues(re.Sub[0])
+		if !ok || len(values) >= maxRegexValues {
+			return nil, false
+		}
+		return append(values, ""), true
+	case syntax.OpAlternate:
+		values := []string{}
+		for _, sub := range re.Sub {
+			subValues, ok := finiteValues(sub)
+			if !ok || len(values)+len(subValues) > maxRegexValues {
+				return nil, false
+			}
+			values = append(values, subValues...)
+		}
+		return values, true
+	case syntax.OpConcat:
+		values := []string{""}
+		for _, sub := range re.Sub {
+			subValues, ok := finiteValues(sub)
+			if !ok || len(values)*len(subValues) > maxRegexValues {
+				return nil, false
+			}
+			product := make([]string, 0, len(values)*len(subValues))
+			for _, value := range values {
+				for _, subValue := range subValues {
+					product = append(product, value+subValue)
+				}
+			}
+			values = product
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// likePrefix returns the LIKE pattern matching the strings starting with prefix
+func likePrefix(prefix string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(prefix) + "%"
+}
+
 func (c *Database) DeleteMetricsByName(ctx context.Context, name string) error {
 	result, err := c.db.ExecContext(ctx, "DELETE FROM pushgateway_metric WHERE name=$1", name)
 	if err != nil {
@@ -175,6 +476,81 @@ func (c *Database) DeleteMetricsByName(ctx context.Context, name string) error {
 	return nil
 }
 
+// DeleteMetricsBySelectors deletes the metrics matching one of the selectors
+// and returns them. Groups whose metrics were all deleted are also deleted.
+func (c *Database) DeleteMetricsBySelectors(ctx context.Context, selectors [][]aggregates.LabelMatcher) ([]*aggregates.PushgatewayMetric, error) {
+	if len(selectors) == 0 {
+		return nil, er.New("at least one selector is required to delete metrics", er.BadRequest, true)
+	}
+	condition, args, filter, err := selectorsCondition(selectors, []any{})
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fail to start transaction: %w", err)
+	}
+	shouldRollback := true
+	defer func() {
+		if shouldRollback {
+			err := tx.Rollback()
+			if err != nil {
+				c.Logger.Error(err.Error())
+			}
+		}
+	}()
+	if filter {
+		// the regexes are matched on the locked candidates, the SQL prefilter
+		// avoids locking the rows which can't match
+		candidates := []pushgatewayMetric{}
+		err = tx.SelectContext(ctx, &candidates, "SELECT id, name, labels FROM pushgateway_metric WHERE "+condition+" FOR UPDATE", args...)
+		if err != nil {
+			return nil, fmt.Errorf("fail to get metrics: %w", err)
+		}
+		ids := []string{}
+		for i := range candidates {
+			labels, err := stringToLabels(candidates[i].Labels)
+			if err != nil {
+				return nil, err
+			}
+			if pushgateway.MatchSelectors(selectors, candidates[i].Name, labels) {
+				ids = append(ids, candidates[i].ID)
+			}
+		}
+		condition = "id = ANY($1::uuid[])"
+		args = []any{pq.Array(ids)}
+	}
+	metrics := []pushgatewayMetric{}
+	err = tx.SelectContext(ctx, &metrics, "DELETE FROM pushgateway_metric WHERE "+condition+" RETURNING "+pushgatewayMetricColumns, args...)
+	if err != nil {
+		return nil, fmt.Errorf("fail to delete metrics: %w", err)
+	}
+	result := []*aggregates.PushgatewayMetric{}
+	groupingKeys := []string{}
+	for i := range metrics {
+		metric, err := toPushGatewayMetric(&metrics[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, metric)
+		if metrics[i].GroupingKey != nil {
+			groupingKeys = append(groupingKeys, *metrics[i].GroupingKey)
+		}
+	}
+	if len(groupingKeys) > 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_group g WHERE g.grouping_key = ANY($1::jsonb[]) AND NOT EXISTS (SELECT 1 FROM pushgateway_metric m WHERE m.grouping_key = g.grouping_key)", pq.Array(groupingKeys))
+		if err != nil {
+			return nil, fmt.Errorf("fail to delete pushgateway groups: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("fail to commit transaction: %w", err)
+	}
+	shouldRollback = false
+	return result, nil
+}
+
 func (c *Database) DeleteMetricByID(ctx context.Context, id string) error {
 	result, err := c.db.ExecContext(ctx, "DELETE FROM pushgateway_metric WHERE id=$1", id)
 	if err != nil {
@@ -196,7 +572,7 @@ func (c *Database) CleanPushgatewayMetrics(ctx context.Context) (int64, error) {
 }
 
 func (c *Database) DeleteAllPushgatewayMetrics(ctx context.Context) error {
-	result, err := c.db.ExecContext(ctx, "TRUNCATE pushgateway_metric")
+	result, err := c.db.ExecContext(ctx, "TRUNCATE pushgateway_metric, pushgateway_group")
 	if err != nil {
 		return fmt.Errorf("fail to clean all pushgateway metrics: %w", err)
 	}
@@ -206,3 +582,542 @@ func (c *Database) DeleteAllPushgatewayMetrics(ctx context.Context) error {
 	}
 	return nil
 }
+
+// lockPushgatewayGroup takes the locks required to modify a group and
+// the metrics pushed in it. Locks are acquired in order to avoid deadlocks.
+func lockPushgatewayGroup(ctx context.Context, tx *sqlx.Tx, groupingKey string, metrics []aggregates.PushgatewayMetric) error {
+	names := []string{}
+	for _, metric := range metrics {
+		if !slices.Contains(names, metric.Name) {
+			names = append(names, metric.Name)
+		}
+	}
+	sort.Strings(names)
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "pushgateway-group:"+groupingKey)
+	if err != nil {
+		return fmt.Errorf("fail to lock pushgateway group: %w", err)
+	}
+	for _, name := range names {
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", name)
+		if err != nil {
+			return fmt.Errorf("fail to lock metric %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// seriesCreationTimes returns the creation time of the existing series of
+// the metrics by series key, so replaced series keep it
+func seriesCreationTimes(ctx context.Context, tx *sqlx.Tx, metrics []aggregates.PushgatewayMetric) (map[string]time.Time, error) {
+	names := []string{}
+	for _, metric := range metrics {
+		if !slices.Contains(names, metric.Name) {
+			names = append(names, metric.Name)
+		}
+	}
+	existing := []pushgatewayMetric{}
+	err := tx.SelectContext(ctx, &existing, "SELECT name, labels, created_at FROM pushgateway_metric WHERE name = ANY($1)", pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("fail to get the existing metrics: %w", err)
+	}
+	result := make(map[string]time.Time)
+	for i := range existing {
+		labels, err := stringToLabels(existing[i].Labels)
+		if err != nil {
+			return nil, err
+		}
+		result[pushgateway.SeriesKey(existing[i].Name, labels)] = existing[i].CreatedAt
+	}
+	return result, nil
+}
+
+func (c *Database) PushGroup(ctx context.Context, groupingKey map[string]string, metrics []aggregates.PushgatewayMetric, replace bool, pushTime time.Time) error {
+	groupingKeyString, err := labelsToString(groupingKey)
+	if err != nil {
+		return err
+	}
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("fail to start transaction: %w", err)
+	}
+	shouldRollback := true
+	defer func() {
+		if shouldRollback {
+			err := tx.Rollback()
+			if err != nil {
+				c.Logger.Error(err.Error())
+			}
+		}
+	}()
+	err = lockPushgatewayGroup(ctx, tx, *groupingKeyString, metrics)
+	if err != nil {
+		return err
+	}
+	createdAt, err := seriesCreationTimes(ctx, tx, metrics)
+	if err != nil {
+		return err
+	}
+	if replace {
+		_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_metric WHERE grouping_key = $1::jsonb", *groupingKeyString)
+	} else {
+		names := []string{}
+		for _, metric := range metrics {
+			names = append(names, metric.Name)
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_metric WHERE grouping_key = $1::jsonb AND name = ANY($2)", *groupingKeyString, pq.Array(names))
+	}
+	if err != nil {
+		return fmt.Errorf("fail to delete metrics from the pushgateway group: %w", err)
+	}
+	for _, metric := range metrics {
+		labels, err := labelsToString(metric.Labels)
+		if err != nil {
+			return err
+		}
+		if labels == nil {
+			empty := "{}"
+			labels = &empty
+		}
+		histogram, err := histogramToString(metric.Histogram)
+		if err != nil {
+			return err
+		}
+		summary, err := summaryToString(metric.Summary)
+		if err != nil {
+			return err
+		}
+		// the pushed metric replaces the series if it already exists,
+		// even if it was created outside of this group
+		_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_metric WHERE name=$1 AND labels = $2::jsonb", metric.Name, *labels)
+		if err != nil {
+			return fmt.Errorf("fail to delete metric %s: %w", metric.Name, err)
+		}
+		newMetric := pushgatewayMetric{
+			ID:          util.NewUUID(),
+			Name:        metric.Name,
+			Description: metric.Description,
+			Labels:      labels,
+			TTL:         metric.TTL,
+			Type:        metric.Type,
+			CreatedAt:   metric.CreatedAt,
+			UpdatedAt:   metric.UpdatedAt,
+			ExpiresAt:   metric.ExpiresAt,
+			Timestamp:   metric.Timestamp,
+			Value:       metricValue(metric),
+			Histogram:   histogram,
+			Summary:     summary,
+			GroupingKey: groupingKeyString,
+		}
+		if created, ok := createdAt[pushgateway.SeriesKey(metric.Name, metric.Labels)]; ok {
+			newMetric.CreatedAt = created
+		}
+		_, err = tx.NamedExecContext(ctx, "INSERT INTO pushgateway_metric(id, name, description, ttl, labels, value, type, created_at, updated_at, expires_at, sample_timestamp, grouping_key, histogram, summary) VALUES (:id, :name, :description, :ttl, :labels, :value, :type, :created_at, :updated_at, :expires_at, :sample_timestamp, :grouping_key, :histogram, :summary)", newMetric)
+		if err != nil {
+			return fmt.Errorf("fail to create metric %s: %w", metric.Name, err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO pushgateway_group(grouping_key, push_time) VALUES ($1::jsonb, $2) ON CONFLICT (grouping_key) DO UPDATE SET push_time = EXCLUDED.push_time", *groupingKeyString, pushTime)
+	if err != nil {
+		return fmt.Errorf("fail to update the pushgateway group push time: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("fail to commit transaction: %w", err)
+	}
+	shouldRollback = false
+	return nil
+}
+
+func (c *Database) RecordPushFailure(ctx context.Context, groupingKey map[string]string, failureTime time.Time) error {
+	groupingKeyString, err := labelsToString(groupingKey)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.ExecContext(ctx, "INSERT INTO pushgateway_group(grouping_key, push_failure_time) VALUES ($1::jsonb, $2) ON CONFLICT (grouping_key) DO UPDATE SET push_failure_time = EXCLUDED.push_failure_time", *groupingKeyString, failureTime)
+	if err != nil {
+		return fmt.Errorf("fail to update the pushgateway group push failure time: %w", err)
+	}
+	return nil
+}
+
+func (c *Database) DeleteGroup(ctx context.Context, groupingKey map[string]string) error {
+	groupingKeyString, err := labelsToString(groupingKey)
+	if err != nil {
+		return err
+	}
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("fail to start transaction: %w", err)
+	}
+	shouldRollback := true
+	defer func() {
+		if shouldRollback {
+			err := tx.Rollback()
+			if err != nil {
+				c.Logger.Error(err.Error())
+			}
+		}
+	}()
+	_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_metric WHERE grouping_key = $1::jsonb", *groupingKeyString)
+	if err != nil {
+		return fmt.Errorf("fail to delete pushgateway group: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_group WHERE grouping_key = $1::jsonb", *groupingKeyString)
+	if err != nil {
+		return fmt.Errorf("fail to delete pushgateway group: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("fail to commit transaction: %w", err)
+	}
+	shouldRollback = false
+	return nil
+}
+
+type pushgatewayGroup struct {
+	GroupingKey     *string    `db:"grouping_key"`
+	PushTime        *time.Time `db:"push_time"`
+	PushFailureTime *time.Time `db:"push_failure_time"`
+}
+
+func (c *Database) GetGroups(ctx context.Context) ([]*aggregates.PushgatewayGroup, error) {
+	groups := []pushgatewayGroup{}
+	err := c.db.SelectContext(ctx, &groups, "SELECT grouping_key, push_time, push_failure_time FROM pushgateway_group")
+	if err != nil {
+		return nil, fmt.Errorf("fail to list pushgateway groups: %w", err)
+	}
+	result := []*aggregates.PushgatewayGroup{}
+	for _, group := range groups {
+		groupingKey, err := stringToLabels(group.GroupingKey)
+		if err != nil {
+			return nil, err
+		}
+		pushgatewayGroup := &aggregates.PushgatewayGroup{
+			GroupingKey: groupingKey,
+		}
+		if group.PushTime != nil {
+			pushTime := group.PushTime.UTC()
+			pushgatewayGroup.PushTime = &pushTime
+		}
+		if group.PushFailureTime != nil {
+			pushFailureTime := group.PushFailureTime.UTC()
+			pushgatewayGroup.PushFailureTime = &pushFailureTime
+		}
+		result = append(result, pushgatewayGroup)
+	}
+	return result, nil
+}
+
+const pushgatewayMetricColumns = "id, name, description, ttl, labels, value, type, created_at, updated_at, expires_at, sample_timestamp, grouping_key, histogram, summary"
+
+// IncrementPushgatewayMetric adds the metric value to the stored one in a
+// single statement, or creates the metric if it does not exist
+func (c *Database) IncrementPushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error) {
+	labels := "{}"
+	if metric.Labels != nil {
+		labelString, err := labelsToString(metric.Labels)
+		if err != nil {
+			return nil, err
+		}
+		labels = *labelString
+	}
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fail to start transaction: %w", err)
+	}
+	shouldRollback := true
+	defer func() {
+		if shouldRollback {
+			err := tx.Rollback()
+			if err != nil {
+				c.Logger.Error(err.Error())
+			}
+		}
+	}()
+	// prevents concurrent creations of the same metric
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", metric.Name)
+	if err != nil {
+		return nil, fmt.Errorf("fail to lock metric %s: %w", metric.Name, err)
+	}
+	currentMetric := pushgatewayMetric{}
+	err = tx.GetContext(ctx, &currentMetric, "SELECT id, type, histogram, summary FROM pushgateway_metric WHERE name=$1 AND labels = $2::jsonb", metric.Name, labels)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("fail to get metric %s: %w", metric.Name, err)
+	}
+	result := pushgatewayMetric{}
+	if currentMetric.ID == "" {
+		newMetric := pushgatewayMetric{
+			ID:          util.NewUUID(),
+			Name:        metric.Name,
+			Description: metric.Description,
+			Labels:      &labels,
+			TTL:         metric.TTL,
+			Type:        metric.Type,
+			CreatedAt:   metric.CreatedAt,
+			UpdatedAt:   metric.UpdatedAt,
+			ExpiresAt:   metric.ExpiresAt,
+			Timestamp:   metric.Timestamp,
+			Value:       &metric.Value,
+		}
+		c.Logger.Debug(fmt.Sprintf("creating metric %s", metric.Name))
+		query, args, err := tx.BindNamed("INSERT INTO pushgateway_metric(id, name, description, ttl, labels, value, type, created_at, updated_at, expires_at) VALUES (:id, :name, :description, :ttl, :labels, :value, :type, :created_at, :updated_at, :expires_at) RETURNING "+pushgatewayMetricColumns, newMetric)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.GetContext(ctx, &result, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("fail to create metric %s: %w", metric.Name, err)
+		}
+	} else {
+		if currentMetric.Histogram != nil || currentMetric.Summary != nil {
+			return nil, er.Newf("metric %s is a distribution and can't be incremented", er.BadRequest, true, metric.Name)
+		}
+		currentType := "untyped"
+		if currentMetric.Type != nil {
+			currentType = *currentMetric.Type
+		}
+		if metric.Type == nil || currentType != *metric.Type {
+			return nil, er.Newf("metric %s has the type %s", er.BadRequest, true, metric.Name, currentType)
+		}
+		c.Logger.Debug(fmt.Sprintf("incrementing metric %s", metric.Name))
+		err = tx.GetContext(ctx, &result, "UPDATE pushgateway_metric SET value=value + $1, description=$2, ttl=$3, expires_at=$4, updated_at=$5 WHERE id=$6 RETURNING "+pushgatewayMetricColumns, metric.Value, metric.Description, metric.TTL, metric.ExpiresAt, metric.UpdatedAt, currentMetric.ID)
+		if err != nil {
+			return nil, fmt.Errorf("fail to increment metric %s: %w", metric.Name, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("fail to commit transaction: %w", err)
+	}
+	shouldRollback = false
+	return toPushGatewayMetric(&result)
+}
+
+// batchMetric is a metric sent to PostgreSQL as JSON. The value is a string
+// because JSON doesn't support +Inf and NaN.
+type batchMetric struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description *string         `json:"description"`
+	Labels      json.RawMessage `json:"labels"`
+	TTL         *string         `json:"ttl"`
+	Type        *string         `json:"type"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	ExpiresAt   *time.Time      `json:"expires_at"`
+	Timestamp   *time.Time      `json:"sample_timestamp"`
+	Value       *string         `json:"value"`
+	GroupingKey json.RawMessage `json:"grouping_key"`
+	Histogram   json.RawMessage `json:"histogram"`
+	Summary     json.RawMessage `json:"summary"`
+}
+
+const batchInput = `WITH input AS (SELECT * FROM jsonb_to_recordset($1::jsonb) AS x(id uuid, name varchar, description varchar, labels jsonb, ttl varchar, type varchar, created_at timestamp, updated_at timestamp, expires_at timestamp, sample_timestamp timestamp, value varchar, grouping_key jsonb, histogram jsonb, summary jsonb))`
+
+func rawJSON(value *string) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	return json.RawMessage(*value)
+}
+
+// BatchCreateOrUpdatePushgatewayMetrics updates the existing metrics and
+// creates the others in a single transaction
+func (c *Database) BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error) {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fail to start transaction: %w", err)
+	}
+	shouldRollback := true
+	defer func() {
+		if shouldRollback {
+			err := tx.Rollback()
+			if err != nil {
+				c.Logger.Error(err.Error())
+			}
+		}
+	}()
+	results, err := writeBatch(ctx, tx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("fail to commit transaction: %w", err)
+	}
+	shouldRollback = false
+	c.Logger.Debug(fmt.Sprintf("%d metrics written", len(metrics)))
+	return results, nil
+}
+
+// writeBatch updates the existing metrics and creates the others. Metrics
+// are created with their ID, or a random one if empty. The type, the
+// description and the grouping key of existing metrics are only updated
+// if the new ones are set.
+func writeBatch(ctx context.Context, tx *sqlx.Tx, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error) {
+	input := []batchMetric{}
+	for _, metric := range metrics {
+		labels := "{}"
+		if metric.Labels != nil {
+			labelString, err := labelsToString(metric.Labels)
+			if err != nil {
+				return nil, err
+			}
+			labels = *labelString
+		}
+		groupingKey, err := labelsToString(metric.GroupingKey)
+		if err != nil {
+			return nil, err
+		}
+		histogram, err := histogramToString(metric.Histogram)
+		if err != nil {
+			return nil, err
+		}
+		summary, err := summaryToString(metric.Summary)
+		if err != nil {
+			return nil, err
+		}
+		var value *string
+		if v := metricValue(metric); v != nil {
+			formatted := formatFloat(*v)
+			value = &formatted
+		}
+		id := metric.ID
+		if id == "" {
+			id = util.NewUUID()
+		}
+		input = append(input, batchMetric{
+			ID:          id,
+			Name:        metric.Name,
+			Description: metric.Description,
+			Labels:      json.RawMessage(labels),
+			TTL:         metric.TTL,
+			Type:        metric.Type,
+			CreatedAt:   metric.CreatedAt,
+			UpdatedAt:   metric.UpdatedAt,
+			ExpiresAt:   metric.ExpiresAt,
+			Timestamp:   metric.Timestamp,
+			Value:       value,
+			GroupingKey: rawJSON(groupingKey),
+			Histogram:   rawJSON(histogram),
+			Summary:     rawJSON(summary),
+		})
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("fail to serialize metrics: %w", err)
+	}
+	names := []string{}
+	for _, metric := range metrics {
+		if !slices.Contains(names, metric.Name) {
+			names = append(names, metric.Name)
+		}
+	}
+	// locks are acquired in order to avoid deadlocks
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", name)
+		if err != nil {
+			return nil, fmt.Errorf("fail to lock metric %s: %w", name, err)
+		}
+	}
+	indexes := make(map[string]int)
+	for i, metric := range input {
+		indexes[metric.ID] = i
+	}
+	results := make([]aggregates.BatchResult, len(metrics))
+	updated := []struct {
+		InputID string `db:"input_id"`
+		ID      string
+	}{}
+	err = tx.SelectContext(ctx, &updated, batchInput+" UPDATE pushgateway_metric m SET description=COALESCE(i.description, m.description), ttl=i.ttl, type=COALESCE(i.type, m.type), updated_at=i.updated_at, expires_at=i.expires_at, sample_timestamp=i.sample_timestamp, value=i.value::double precision, histogram=i.histogram, summary=i.summary, grouping_key=COALESCE(i.grouping_key, m.grouping_key) FROM input i WHERE m.name=i.name AND m.labels=i.labels RETURNING i.id AS input_id, m.id", string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("fail to update metrics: %w", err)
+	}
+	for _, row := range updated {
+		results[indexes[row.InputID]] = aggregates.BatchResult{ID: row.ID}
+	}
+	created := []string{}
+	err = tx.SelectContext(ctx, &created, batchInput+" INSERT INTO pushgateway_metric(id, name, description, ttl, labels, value, type, created_at, updated_at, expires_at, sample_timestamp, grouping_key, histogram, summary) SELECT i.id, i.name, i.description, i.ttl, i.labels, i.value::double precision, i.type, i.created_at, i.updated_at, i.expires_at, i.sample_timestamp, i.grouping_key, i.histogram, i.summary FROM input i WHERE NOT EXISTS (SELECT 1 FROM pushgateway_metric m WHERE m.name=i.name AND m.labels=i.labels) RETURNING id", string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("fail to create metrics: %w", err)
+	}
+	for _, id := range created {
+		results[indexes[id]] = aggregates.BatchResult{ID: id, Created: true}
+	}
+	return results, nil
+}
+
+// CountSeries returns the number of series of each metric name, all names
+// are returned if names is empty
+func (c *Database) CountSeries(ctx context.Context, names []string) (map[string]int, error) {
+	rows := []struct {
+		Name  string
+		Count int
+	}{}
+	query := "SELECT name, count(*) AS count FROM pushgateway_metric"
+	args := []any{}
+	if len(names) > 0 {
+		query += " WHERE name = ANY($1)"
+		args = append(args, pq.Array(names))
+	}
+	err := c.db.SelectContext(ctx, &rows, query+" GROUP BY name", args...)
+	if err != nil {
+		return nil, fmt.Errorf("fail to count series: %w", err)
+	}
+	result := make(map[string]int)
+	for _, row := range rows {
+		result[row.Name] = row.Count
+	}
+	return result, nil
+}
+
+// CountAllSeries returns the total number of series
+func (c *Database) CountAllSeries(ctx context.Context) (int, error) {
+	var result int
+	err := c.db.GetContext(ctx, &result, "SELECT count(*) FROM pushgateway_metric")
+	if err != nil {
+		return 0, fmt.Errorf("fail to count series: %w", err)
+	}
+	return result, nil
+}
+
+// SeriesExist returns for each metric if a series with the same name and
+// labels is already stored
+func (c *Database) SeriesExist(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]bool, error) {
+	type seriesInput struct {
+		Index  int             `json:"idx"`
+		Name   string          `json:"name"`
+		Labels json.RawMessage `json:"labels"`
+	}
+	input := []seriesInput{}
+	for i, metric := range metrics {
+		labels := "{}"
+		if metric.Labels != nil {
+			labelString, err := labelsToString(metric.Labels)
+			if err != nil {
+				return nil, err
+			}
+			labels = *labelString
+		}
+		input = append(input, seriesInput{
+			Index:  i,
+			Name:   metric.Name,
+			Labels: json.RawMessage(labels),
+		})
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("fail to serialize series: %w", err)
+	}
+	existing := []int{}
+	err = c.db.SelectContext(ctx, &existing, "SELECT i.idx FROM jsonb_to_recordset($1::jsonb) AS i(idx int, name varchar, labels jsonb) WHERE EXISTS (SELECT 1 FROM pushgateway_metric m WHERE m.name=i.name AND m.labels=i.labels)", string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("fail to check existing series: %w", err)
+	}
+	result := make([]bool, len(metrics))
+	for _, i := range existing {
+		result[i] = true
+	}
+	return result, nil
+}
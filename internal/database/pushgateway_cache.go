@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/lib/pq"
+)
+
+// pushgatewayChannel is notified with the changes written by
+// WritePushgatewayChanges. Triggers notify it with an empty payload for
+// the other changes of the pushgateway tables.
+const pushgatewayChannel = "pushgateway_changes"
+
+// maxNotificationSize is below the 8000 bytes limit of PostgreSQL
+// notifications payloads
+const maxNotificationSize = 7500
+
+type notificationPayload struct {
+	Origin        string              `json:"origin"`
+	Full          bool                `json:"full,omitempty"`
+	MetricIDs     []string            `json:"metric_ids,omitempty"`
+	DeletedIDs    []string            `json:"deleted_ids,omitempty"`
+	Groups        []batchGroup        `json:"groups,omitempty"`
+	DeletedGroups []map[string]string `json:"deleted_groups,omitempty"`
+}
+
+type batchGroup struct {
+	GroupingKey     map[string]string `json:"grouping_key"`
+	PushTime        *time.Time        `json:"push_time"`
+	PushFailureTime *time.Time        `json:"push_failure_time"`
+}
+
+// notificationPayloads splits the description of the changes in payloads
+// small enough to be sent as notifications
+func notificationPayloads(changes aggregates.PushgatewayChanges, results []aggregates.BatchResult) ([]string, error) {
+	payloads := []string{}
+	current := notificationPayload{Origin: changes.Origin}
+	size := 0
+	// the fields names and the origin are also in the payload
+	limit := maxNotificationSize - 100 - len(changes.Origin)
+	full := changes.DeleteAll
+	add := func(item any, fn func()) error {
+		serialized, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("fail to serialize the changes notification: %w", err)
+		}
+		itemSize := len(serialized) + 1
+		if itemSize > limit {
+			full = true
+			return nil
+		}
+		if size+itemSize > limit {
+			payload, err := json.Marshal(current)
+			if err != nil {
+				return fmt.Errorf("fail to serialize the changes notification: %w", err)
+			}
+			payloads = append(payloads, string(payload))
+			current = notificationPayload{Origin: changes.Origin}
+			size = 0
+		}
+		size += itemSize
+		fn()
+		return nil
+	}
+	for _, id := range changes.DeletedIDs {
+		err := add(id, func() { current.DeletedIDs = append(current.DeletedIDs, id) })
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, groupingKey := range changes.DeletedGroups {
+		err := add(groupingKey, func() { current.DeletedGroups = append(current.DeletedGroups, groupingKey) })
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, result := range results {
+		err := add(result.ID, func() { current.MetricIDs = append(current.MetricIDs, result.ID) })
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, group := range changes.Groups {
+		input := batchGroup{
+			GroupingKey:     group.GroupingKey,
+			PushTime:        group.PushTime,
+			PushFailureTime: group.PushFailureTime,
+		}
+		err := add(input, func() { current.Groups = append(current.Groups, input) })
+		if err != nil {
+			return nil, err
+		}
+	}
+	if full {
+		// the other servers reload everything
+		payloads = []string{}
+		current = notificationPayload{Origin: changes.Origin, Full: true}
+	}
+	payload, err := json.Marshal(current)
+	if err != nil {
+		return nil, fmt.Errorf("fail to serialize the changes notification: %w", err)
+	}
+	return append(payloads, string(payload)), nil
+}
+
+// WritePushgatewayChanges applies the changes in a single transaction.
+// The results of the metrics writes are in the order of changes.Metrics.
+func (c *Database) WritePushgatewayChanges(ctx context.Context, changes aggregates.PushgatewayChanges) ([]aggregates.BatchResult, error) {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fail to start transaction: %w", err)
+	}
+	shouldRollback := true
+	defer func() {
+		if shouldRollback {
+			err := tx.Rollback()
+			if err != nil {
+				c.Logger.Error(err.Error())
+			}
+		}
+	}()
+	// used by the triggers as notification payload
+	_, err = tx.ExecContext(ctx, "SELECT set_config('appclacks.origin', $1, true)", changes.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("fail to set the changes origin: %w", err)
+	}
+	if changes.DeleteAll {
+		_, err = tx.ExecContext(ctx, "TRUNCATE pushgateway_metric, pushgateway_group")
+		if err != nil {
+			return nil, fmt.Errorf("fail to clean all pushgateway metrics: %w", err)
+		}
+	}
+	if len(changes.DeletedIDs) > 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_metric WHERE id = ANY($1::uuid[])", pq.Array(changes.DeletedIDs))
+		if err != nil {
+			return nil, fmt.Errorf("fail to delete metrics: %w", err)
+		}
+	}
+	if len(changes.DeletedGroups) > 0 {
+		payload, err := json.Marshal(changes.DeletedGroups)
+		if err != nil {
+			return nil, fmt.Errorf("fail to serialize groups: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM pushgateway_group WHERE grouping_key IN (SELECT jsonb_array_elements($1::jsonb))", string(payload))
+		if err != nil {
+			return nil, fmt.Errorf("fail to delete pushgateway groups: %w", err)
+		}
+	}
+	results := []aggregates.BatchResult{}
+	if len(changes.Metrics) > 0 {
+		results, err = writeBatch(ctx, tx, changes.Metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(changes.Groups) > 0 {
+		input := []batchGroup{}
+		for _, group := range changes.Groups {
+			input = append(input, batchGroup{
+				GroupingKey:     group.GroupingKey,
+				PushTime:        group.PushTime,
+				PushFailureTime: group.PushFailureTime,
+			})
+		}
+		payload, err := json.Marshal(input)
+		if err != nil {
+			return nil, fmt.Errorf("fail to serialize groups: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO pushgateway_group(grouping_key, push_time, push_failure_time) SELECT grouping_key, push_time, push_failure_time FROM jsonb_to_recordset($1::jsonb) AS x(grouping_key jsonb, push_time timestamp, push_failure_time timestamp) ON CONFLICT (grouping_key) DO UPDATE SET push_time = EXCLUDED.push_time, push_failure_time = EXCLUDED.push_failure_time", string(payload))
+		if err != nil {
+			return nil, fmt.Errorf("fail to update pushgateway groups: %w", err)
+		}
+	}
+	payloads, err := notificationPayloads(changes, results)
+	if err != nil {
+		return nil, err
+	}
+	// notifications are sent on commit
+	for _, payload := range payloads {
+		_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", pushgatewayChannel, payload)
+		if err != nil {
+			return nil, fmt.Errorf("fail to notify the pushgateway changes: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("fail to commit transaction: %w", err)
+	}
+	shouldRollback = false
+	return results, nil
+}
+
+// GetMetricsByIDs returns the existing metrics having these IDs
+func (c *Database) GetMetricsByIDs(ctx context.Context, ids []string) ([]*aggregates.PushgatewayMetric, error) {
+	metrics := []pushgatewayMetric{}
+	err := c.db.SelectContext(ctx, &metrics, "SELECT "+pushgatewayMetricColumns+" FROM pushgateway_metric WHERE id = ANY($1::uuid[])", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("fail to get metrics: %w", err)
+	}
+	result := []*aggregates.PushgatewayMetric{}
+	for i := range metrics {
+		metric, err := toPushGatewayMetric(&metrics[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, metric)
+	}
+	return result, nil
+}
+
+// toNotification parses a notification payload, an empty or invalid
+// payload requires a full reload
+func toNotification(payload string) aggregates.PushgatewayNotification {
+	var input notificationPayload
+	if payload == "" || json.Unmarshal([]byte(payload), &input) != nil {
+		return aggregates.PushgatewayNotification{Full: true}
+	}
+	result := aggregates.PushgatewayNotification{
+		Origin:        input.Origin,
+		Full:          input.Full,
+		MetricIDs:     input.MetricIDs,
+		DeletedIDs:    input.DeletedIDs,
+		DeletedGroups: input.DeletedGroups,
+	}
+	for _, group := range input.Groups {
+		result.Groups = append(result.Groups, &aggregates.PushgatewayGroup{
+			GroupingKey:     group.GroupingKey,
+			PushTime:        utcTime(group.PushTime),
+			PushFailureTime: utcTime(group.PushFailureTime),
+		})
+	}
+	return result
+}
+
+// ListenPushgatewayChanges calls fn with the description of each change of
+// the pushgateway tables. A full reload is required if the change was done
+// outside of WritePushgatewayChanges, or if the connection was lost as
+// notifications may have been missed. The returned function stops listening.
+func (c *Database) ListenPushgatewayChanges(fn func(notification aggregates.PushgatewayNotification)) (func() error, error) {
+	listener := pq.NewListener(c.connectionString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			c.Logger.Error(fmt.Sprintf("pushgateway changes listener: %s", err.Error()))
+		}
+	})
+	err := listener.Listen(pushgatewayChannel)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("fail to listen to pushgateway changes: %w", err)
+	}
+	go func() {
+		// the channel is closed when the listener is closed
+		for notification := range listener.Notify {
+			if notification == nil {
+				fn(aggregates.PushgatewayNotification{Full: true})
+				continue
+			}
+			fn(toNotification(notification.Extra))
+		}
+	}()
+	return listener.Close, nil
+}
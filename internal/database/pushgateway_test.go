@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/appclacks/server/pkg/pushgateway"
 	"github.com/appclacks/server/pkg/pushgateway/aggregates"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,12 +26,13 @@ func TestPushgatewayCRUD(t *testing.T) {
 		},
 		TTL:       &ttl1,
 		CreatedAt: now1,
+		UpdatedAt: now1,
 		ExpiresAt: &expired1,
-		Value:     "1000",
+		Value:     1000,
 	}
 	id1, err := TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), def1, false)
 	assert.NoError(t, err)
-	metric, err := TestComponent.GetMetrics(context.Background())
+	metric, err := TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 1)
 
@@ -44,6 +46,7 @@ func TestPushgatewayCRUD(t *testing.T) {
 	assert.Equal(t, m1.Value, def1.Value)
 	assert.Equal(t, def1.ExpiresAt, m1.ExpiresAt)
 	assert.Equal(t, def1.CreatedAt, m1.CreatedAt)
+	assert.Equal(t, def1.UpdatedAt, m1.UpdatedAt)
 
 	// update
 	desc2 := "desc2"
@@ -60,13 +63,14 @@ func TestPushgatewayCRUD(t *testing.T) {
 		},
 		TTL:       &ttl2,
 		CreatedAt: now2,
+		UpdatedAt: now2,
 		ExpiresAt: &expired2,
-		Value:     "4000",
+		Value:     4000,
 	}
 
 	id2, err := TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), update1, false)
 	assert.NoError(t, err)
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 1)
 
@@ -80,16 +84,31 @@ func TestPushgatewayCRUD(t *testing.T) {
 	assert.Equal(t, *m2.TTL, *update1.TTL)
 	assert.Equal(t, m2.Value, update1.Value)
 	assert.Equal(t, update1.ExpiresAt, m2.ExpiresAt)
-	assert.Equal(t, update1.CreatedAt, m2.CreatedAt)
+	// the creation date is kept on updates
+	assert.Equal(t, def1.CreatedAt, m2.CreatedAt)
+	assert.Equal(t, update1.UpdatedAt, m2.UpdatedAt)
 
 	// cumulative test
 	id3, err := TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), update1, true)
 	assert.NoError(t, err)
 	assert.Equal(t, id3, m1.ID)
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 1)
-	assert.Equal(t, metric[0].Value, "8000.000000")
+	assert.Equal(t, metric[0].Value, float64(8000))
+
+	// values are not truncated
+	first := 12345.0000001
+	second := 0.0000002
+	update1.Value = first
+	_, err = TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), update1, false)
+	assert.NoError(t, err)
+	update1.Value = second
+	_, err = TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), update1, true)
+	assert.NoError(t, err)
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, first+second, metric[0].Value)
 
 	// new metric by name
 	desc3 := "description"
@@ -105,13 +124,14 @@ func TestPushgatewayCRUD(t *testing.T) {
 		},
 		TTL:       &ttl3,
 		CreatedAt: now3,
+		UpdatedAt: now3,
 		ExpiresAt: &expired3,
-		Value:     "1000",
+		Value:     1000,
 	}
 
 	_, err = TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), def3, false)
 	assert.NoError(t, err)
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 2)
 
@@ -129,21 +149,84 @@ func TestPushgatewayCRUD(t *testing.T) {
 		},
 		TTL:       &ttl4,
 		CreatedAt: now4,
+		UpdatedAt: now4,
 		ExpiresAt: &expired4,
-		Value:     "1000",
+		Value:     1000,
 	}
 
 	_, err = TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), def4, false)
 	assert.NoError(t, err)
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 3)
 
+	// filter by value
+	minValue := float64(1000)
+	maxValue := float64(1000)
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{MinValue: &minValue})
+	assert.NoError(t, err)
+	assert.Len(t, metric, 3)
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{MaxValue: &maxValue})
+	assert.NoError(t, err)
+	assert.Len(t, metric, 2)
+	minValue = 1001
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{MinValue: &minValue})
+	assert.NoError(t, err)
+	assert.Len(t, metric, 1)
+	assert.Equal(t, "test1", metric[0].Name)
+
+	// filter by selectors
+	selector, err := pushgateway.ParseSelector(`{__name__=~"test[34]", foo="bar", new!~"lab.*"}`)
+	assert.NoError(t, err)
+	otherSelector, err := pushgateway.ParseSelector(`test1{missing=""}`)
+	assert.NoError(t, err)
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{Selectors: [][]aggregates.LabelMatcher{selector, otherSelector}})
+	assert.NoError(t, err)
+	names := []string{}
+	for _, m := range metric {
+		names = append(names, m.Name)
+	}
+	assert.ElementsMatch(t, []string{"test1", "test3"}, names)
+	// the regexes use the Go syntax
+	selector, err = pushgateway.ParseSelector(`{__name__=~"TEST(?i)3", foo=~"\\pL+"}`)
+	assert.NoError(t, err)
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{Selectors: [][]aggregates.LabelMatcher{selector}})
+	assert.NoError(t, err)
+	assert.Len(t, metric, 0)
+	selector, err = pushgateway.ParseSelector(`{__name__=~"t(?i)EST3", foo=~"\\pL+"}`)
+	assert.NoError(t, err)
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{Selectors: [][]aggregates.LabelMatcher{selector}})
+	assert.NoError(t, err)
+	assert.Len(t, metric, 1)
+	assert.Equal(t, "test3", metric[0].Name)
+	// regex only selectors
+	regexSelectors := map[string][]string{
+		`{new=~"lab.*"}`:                  {"test4"},
+		`{new=~"label|other"}`:            {"test4"},
+		`{foo="bar", new!~"label|other"}`: {"test1", "test3"},
+		`{foo="bar", new=~"|lab.*"}`:      {"test1", "test3", "test4"},
+		`{new!~"x*"}`:                     {"test4"},
+		`{__name__=~"test1|test4"}`:       {"test1", "test4"},
+		`{__name__=~"te_t.*"}`:            {},
+		`{__name__=~"test[13]", a=~"b"}`:  {"test1", "test3"},
+	}
+	for query, expected := range regexSelectors {
+		selector, err := pushgateway.ParseSelector(query)
+		assert.NoError(t, err)
+		metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{Selectors: [][]aggregates.LabelMatcher{selector}})
+		assert.NoError(t, err)
+		names := []string{}
+		for _, m := range metric {
+			names = append(names, m.Name)
+		}
+		assert.ElementsMatch(t, expected, names, query)
+	}
+
 	// delete by ID
 
 	err = TestComponent.DeleteMetricByID(context.Background(), m1.ID)
 	assert.NoError(t, err)
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 2)
 
@@ -152,7 +235,7 @@ func TestPushgatewayCRUD(t *testing.T) {
 
 	err = TestComponent.DeleteMetricsByName(context.Background(), "test4")
 	assert.NoError(t, err)
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 1)
 	err = TestComponent.DeleteMetricsByName(context.Background(), "test4")
@@ -170,8 +253,9 @@ func TestPushgatewayCRUD(t *testing.T) {
 			Name:      fmt.Sprintf("test%d", i),
 			TTL:       &ttl1,
 			CreatedAt: now1,
+			UpdatedAt: now1,
 			ExpiresAt: &expiresAt,
-			Value:     "1000",
+			Value:     1000,
 		}
 		_, err := TestComponent.CreateOrUpdatePushgatewayMetric(context.Background(), def1, false)
 		assert.NoError(t, err)
@@ -180,14 +264,194 @@ func TestPushgatewayCRUD(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(5), deleteCount)
 
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 5)
 
+	counts, err := TestComponent.CountSeries(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Len(t, counts, 5)
+	assert.Equal(t, 1, counts["test5"])
+	counts, err = TestComponent.CountSeries(context.Background(), []string{"test5", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"test5": 1}, counts)
+	total, err := TestComponent.CountAllSeries(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, total)
+	exist, err := TestComponent.SeriesExist(context.Background(), []aggregates.PushgatewayMetric{
+		{Name: "test5"},
+		{Name: "test5", Labels: map[string]string{"a": "b"}},
+		{Name: "test1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, false}, exist)
+
 	err = TestComponent.DeleteAllPushgatewayMetrics(context.Background())
 	assert.NoError(t, err)
 
-	metric, err = TestComponent.GetMetrics(context.Background())
+	metric, err = TestComponent.GetMetrics(context.Background(), aggregates.Query{})
 	assert.NoError(t, err)
 	assert.Len(t, metric, 0)
 }
+
+func TestWritePushgatewayChanges(t *testing.T) {
+	ctx := context.Background()
+	err := TestComponent.DeleteAllPushgatewayMetrics(ctx)
+	assert.NoError(t, err)
+	now := time.Now().UTC().Round(time.Second)
+	id, err := TestComponent.CreateOrUpdatePushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "deleted", CreatedAt: now, UpdatedAt: now}, false)
+	assert.NoError(t, err)
+
+	notifications := make(chan aggregates.PushgatewayNotification, 10)
+	stop, err := TestComponent.ListenPushgatewayChanges(func(notification aggregates.PushgatewayNotification) {
+		notifications <- notification
+	})
+	assert.NoError(t, err)
+	defer stop()
+
+	groupingKey := map[string]string{"job": "backup"}
+	results, err := TestComponent.WritePushgatewayChanges(ctx, aggregates.PushgatewayChanges{
+		Origin:     "server-1",
+		DeletedIDs: []string{id},
+		Metrics: []aggregates.PushgatewayMetric{
+			{ID: "4e7b8a0a-35ba-4bd6-9a5e-8d3f3c9c7a11", Name: "created", GroupingKey: groupingKey, CreatedAt: now, UpdatedAt: now, Value: 2},
+		},
+		Groups: []*aggregates.PushgatewayGroup{
+			{GroupingKey: groupingKey, PushTime: &now},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []aggregates.BatchResult{{ID: "4e7b8a0a-35ba-4bd6-9a5e-8d3f3c9c7a11", Created: true}}, results)
+	select {
+	case notification := <-notifications:
+		assert.Equal(t, "server-1", notification.Origin)
+		assert.False(t, notification.Full)
+		assert.Equal(t, []string{"4e7b8a0a-35ba-4bd6-9a5e-8d3f3c9c7a11"}, notification.MetricIDs)
+		assert.Equal(t, []string{id}, notification.DeletedIDs)
+		assert.Len(t, notification.Groups, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+	}
+
+	metrics, err := TestComponent.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "created", metrics[0].Name)
+	assert.Equal(t, groupingKey, metrics[0].GroupingKey)
+	groups, err := TestComponent.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+
+	_, err = TestComponent.WritePushgatewayChanges(ctx, aggregates.PushgatewayChanges{
+		Origin:        "server-1",
+		DeletedGroups: []map[string]string{groupingKey},
+	})
+	assert.NoError(t, err)
+	groups, err = TestComponent.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 0)
+	err = TestComponent.DeleteAllPushgatewayMetrics(ctx)
+	assert.NoError(t, err)
+}
+
+func TestDeleteMetricsBySelectors(t *testing.T) {
+	ctx := context.Background()
+	err := TestComponent.DeleteAllPushgatewayMetrics(ctx)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	backup := map[string]string{"job": "backup"}
+	cleanup := map[string]string{"job": "cleanup"}
+	err = TestComponent.PushGroup(ctx, backup, []aggregates.PushgatewayMetric{
+		{Name: "duration_seconds", Labels: map[string]string{"job": "backup", "step": "export"}, CreatedAt: now, UpdatedAt: now},
+		{Name: "duration_seconds", Labels: map[string]string{"job": "backup", "step": "import"}, CreatedAt: now, UpdatedAt: now},
+	}, true, now)
+	assert.NoError(t, err)
+	err = TestComponent.PushGroup(ctx, cleanup, []aggregates.PushgatewayMetric{
+		{Name: "duration_seconds", Labels: map[string]string{"job": "cleanup"}, CreatedAt: now, UpdatedAt: now},
+	}, true, now)
+	assert.NoError(t, err)
+
+	selector, err := pushgateway.ParseSelector(`{job="backup", step="export"}`)
+	assert.NoError(t, err)
+	deleted, err := TestComponent.DeleteMetricsBySelectors(ctx, [][]aggregates.LabelMatcher{selector})
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 1)
+	assert.Equal(t, "export", deleted[0].Labels["step"])
+	// the group still has a metric
+	groups, err := TestComponent.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	selector, err = pushgateway.ParseSelector(`duration_seconds{job=~"backup|cleanup"}`)
+	assert.NoError(t, err)
+	deleted, err = TestComponent.DeleteMetricsBySelectors(ctx, [][]aggregates.LabelMatcher{selector})
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	groups, err = TestComponent.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 0)
+	metrics, err := TestComponent.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 0)
+}
+
+func TestPushGroupCreationTime(t *testing.T) {
+	ctx := context.Background()
+	err := TestComponent.DeleteAllPushgatewayMetrics(ctx)
+	assert.NoError(t, err)
+	createdAt := time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)
+	now := time.Now().UTC().Round(time.Second)
+	groupingKey := map[string]string{"job": "backup"}
+	labels := map[string]string{"job": "backup", "step": "export"}
+	err = TestComponent.PushGroup(ctx, groupingKey, []aggregates.PushgatewayMetric{
+		{Name: "runs_total", Labels: labels, CreatedAt: createdAt, UpdatedAt: createdAt, Value: 1},
+	}, true, createdAt)
+	assert.NoError(t, err)
+	// a new push replaces the series but not its creation time
+	err = TestComponent.PushGroup(ctx, groupingKey, []aggregates.PushgatewayMetric{
+		{Name: "runs_total", Labels: labels, CreatedAt: now, UpdatedAt: now, Value: 2},
+		{Name: "failures_total", Labels: labels, CreatedAt: now, UpdatedAt: now, Value: 1},
+	}, true, now)
+	assert.NoError(t, err)
+	metrics, err := TestComponent.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	expected := map[string]time.Time{
+		"runs_total":     createdAt,
+		"failures_total": now,
+	}
+	for _, metric := range metrics {
+		assert.Equal(t, expected[metric.Name], metric.CreatedAt)
+	}
+	err = TestComponent.DeleteAllPushgatewayMetrics(ctx)
+	assert.NoError(t, err)
+}
+
+func TestBatchCreateOrUpdatePushgatewayMetrics(t *testing.T) {
+	ctx := context.Background()
+	err := TestComponent.DeleteAllPushgatewayMetrics(ctx)
+	assert.NoError(t, err)
+	now := time.Now().UTC().Round(time.Second)
+	counter := "counter"
+	description := "number of runs"
+	labels := map[string]string{"job": "backup"}
+	results, err := TestComponent.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{
+		{Name: "runs_total", Labels: labels, Type: &counter, Description: &description, CreatedAt: now, UpdatedAt: now, Value: 1},
+	})
+	assert.NoError(t, err)
+	assert.True(t, results[0].Created)
+	// the metadata are kept if not set
+	results, err = TestComponent.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{
+		{Name: "runs_total", Labels: labels, CreatedAt: now, UpdatedAt: now, Value: 2},
+	})
+	assert.NoError(t, err)
+	assert.False(t, results[0].Created)
+	metrics, err := TestComponent.GetMetrics(ctx, aggregates.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, float64(2), metrics[0].Value)
+	assert.Equal(t, counter, *metrics[0].Type)
+	assert.Equal(t, description, *metrics[0].Description)
+	err = TestComponent.DeleteAllPushgatewayMetrics(ctx)
+	assert.NoError(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	otelsql "github.com/XSAM/otelsql"
@@ -25,14 +26,16 @@ import (
 var migrationsFS embed.FS
 
 type Database struct {
-	db      *sqlx.DB
-	Logger  *slog.Logger
-	probers uint
+	db               *sqlx.DB
+	Logger           *slog.Logger
+	probers          atomic.Uint64
+	connectionString string
 }
 
 var CleanupQueries = []string{
 	"TRUNCATE healthcheck CASCADE",
 	"TRUNCATE pushgateway_metric CASCADE",
+	"TRUNCATE metric_family CASCADE",
 	"TRUNCATE schema_migrations CASCADE",
 }
 
@@ -101,11 +104,17 @@ func New(logger *slog.Logger, config Configuration, probers uint) (*Database, er
 		return nil, fmt.Errorf("fail to apply migrations: %w", err)
 	}
 	logger.Info("Migrations applied")
-	return &Database{
-		db:      db,
-		Logger:  logger,
-		probers: probers,
-	}, nil
+	database := &Database{
+		db:               db,
+		Logger:           logger,
+		connectionString: connectionString,
+	}
+	database.SetProbers(probers)
+	return database, nil
+}
+
+func (d *Database) SetProbers(probers uint) {
+	d.probers.Store(uint64(probers))
 }
 
 func checkResult(result sql.Result, expected int64) error {
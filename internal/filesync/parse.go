@@ -0,0 +1,131 @@
+package filesync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/appclacks/go-client"
+	"github.com/appclacks/server/internal/validator"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"gopkg.in/yaml.v3"
+)
+
+// fileHealthcheck is a healthcheck defined in a file, the definition uses
+// the same fields as the API
+type fileHealthcheck struct {
+	Name        string            `yaml:"name" validate:"required,max=255,min=1"`
+	Description string            `yaml:"description" validate:"max=255"`
+	Type        string            `yaml:"type" validate:"required,oneof=dns tcp tls http command heartbeat"`
+	Labels      map[string]string `yaml:"labels" validate:"dive,keys,max=255,min=1,endkeys,max=255,min=1"`
+	Interval    string            `yaml:"interval"`
+	Timeout     string            `yaml:"timeout"`
+	Enabled     *bool             `yaml:"enabled"`
+	Definition  map[string]any    `yaml:"definition"`
+}
+
+// definitionInput returns the structure validating the definition of a
+// healthcheck type
+func definitionInput(healthcheckType string) any {
+	switch healthcheckType {
+	case "dns":
+		return &client.HealthcheckDNSDefinition{}
+	case "tcp":
+		return &client.HealthcheckTCPDefinition{}
+	case "tls":
+		return &client.HealthcheckTLSDefinition{}
+	case "http":
+		return &client.HealthcheckHTTPDefinition{}
+	case "command":
+		return &client.HealthcheckCommandDefinition{}
+	}
+	// heartbeat definitions are checked by the healthcheck service
+	return &aggregates.HealthcheckHeartbeatDefinition{}
+}
+
+func toHealthcheck(check fileHealthcheck) (*aggregates.Healthcheck, error) {
+	err := validator.Validator.Struct(check)
+	if err != nil {
+		return nil, err
+	}
+	definition, err := json.Marshal(check.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid definition: %w", err)
+	}
+	input := definitionInput(check.Type)
+	decoder := json.NewDecoder(bytes.NewReader(definition))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid definition: %w", err)
+	}
+	err = validator.Validator.Struct(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid definition: %w", err)
+	}
+	result, err := aggregates.ToHealthcheckDefinition(check.Type, string(definition))
+	if err != nil {
+		return nil, err
+	}
+	healthcheck := &aggregates.Healthcheck{
+		Name:       check.Name,
+		Type:       check.Type,
+		Labels:     check.Labels,
+		Interval:   check.Interval,
+		Timeout:    check.Timeout,
+		Enabled:    true,
+		Definition: result,
+	}
+	if check.Description != "" {
+		healthcheck.Description = &check.Description
+	}
+	if check.Enabled != nil {
+		healthcheck.Enabled = *check.Enabled
+	}
+	return healthcheck, nil
+}
+
+// Parse reads the healthchecks of a YAML or JSON file, containing either a
+// list of healthchecks or a single one
+func Parse(content []byte) ([]*aggregates.Healthcheck, error) {
+	var node yaml.Node
+	err := yaml.Unmarshal(content, &node)
+	if err != nil {
+		return nil, err
+	}
+	result := []*aggregates.Healthcheck{}
+	if len(node.Content) == 0 {
+		return result, nil
+	}
+	var checks []fileHealthcheck
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	switch node.Content[0].Kind {
+	case yaml.SequenceNode:
+		err = decoder.Decode(&checks)
+	case yaml.MappingNode:
+		var check fileHealthcheck
+		err = decoder.Decode(&check)
+		checks = append(checks, check)
+	default:
+		return nil, errors.New("the file should contain a healthcheck or a list of healthchecks")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i, check := range checks {
+		healthcheck, err := toHealthcheck(check)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck %d (%s): %w", i, check.Name, err)
+		}
+		if names[healthcheck.Name] {
+			return nil, fmt.Errorf("the healthcheck %s is defined several times", healthcheck.Name)
+		}
+		names[healthcheck.Name] = true
+		result = append(result, healthcheck)
+	}
+	return result, nil
+}
@@ -0,0 +1,129 @@
+package filesync_test
+
+import (
+	"testing"
+
+	"github.com/appclacks/server/internal/filesync"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		names   []string
+		err     string
+	}{
+		{
+			name: "list",
+			content: `
+- name: website
+  type: http
+  interval: 30s
+  timeout: 5s
+  labels:
+    env: prod
+  definition:
+    target: appclacks.com
+    port: 443
+    protocol: https
+    method: GET
+    valid-status: [200]
+- name: backup
+  type: heartbeat
+  enabled: false
+  definition:
+    schedule: "0 3 * * *"
+    grace: 30m
+`,
+			names: []string{"website", "backup"},
+		},
+		{
+			name:    "single json healthcheck",
+			content: `{"name": "dns", "type": "dns", "interval": "30s", "timeout": "5s", "definition": {"domain": "appclacks.com"}}`,
+			names:   []string{"dns"},
+		},
+		{
+			name:    "empty file",
+			content: "",
+			names:   []string{},
+		},
+		{
+			name:    "scalar",
+			content: "foo",
+			err:     "the file should contain a healthcheck or a list of healthchecks",
+		},
+		{
+			name:    "unknown field",
+			content: "name: dns\ntype: dns\nintervall: 30s",
+			err:     "field intervall not found",
+		},
+		{
+			name:    "unknown type",
+			content: "name: foo\ntype: ping",
+			err:     "invalid healthcheck 0 (foo)",
+		},
+		{
+			name:    "unknown definition field",
+			content: "name: tcp\ntype: tcp\ndefinition:\n  target: appclacks.com\n  port: 443\n  should_fail: true",
+			err:     "unknown field \"should_fail\"",
+		},
+		{
+			name:    "invalid definition",
+			content: "name: tcp\ntype: tcp\ndefinition:\n  target: appclacks.com",
+			err:     "invalid definition",
+		},
+		{
+			name:    "duplicated name",
+			content: "- {name: dns, type: dns, definition: {domain: a.com}}\n- {name: dns, type: dns, definition: {domain: b.com}}",
+			err:     "the healthcheck dns is defined several times",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checks, err := filesync.Parse([]byte(c.content))
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			names := []string{}
+			for _, check := range checks {
+				names = append(names, check.Name)
+			}
+			assert.Equal(t, c.names, names)
+		})
+	}
+}
+
+func TestParseHealthcheck(t *testing.T) {
+	checks, err := filesync.Parse([]byte(`
+name: website
+description: main website
+type: tcp
+interval: 30s
+timeout: 5s
+enabled: false
+labels:
+  env: prod
+definition:
+  target: appclacks.com
+  port: 443
+`))
+	assert.NoError(t, err)
+	assert.Len(t, checks, 1)
+	description := "main website"
+	assert.Equal(t, &aggregates.Healthcheck{
+		Name:        "website",
+		Description: &description,
+		Type:        "tcp",
+		Interval:    "30s",
+		Timeout:     "5s",
+		Labels:      map[string]string{"env": "prod"},
+		Definition: &aggregates.HealthcheckTCPDefinition{
+			Target: "appclacks.com",
+			Port:   443,
+		},
+	}, checks[0])
+}
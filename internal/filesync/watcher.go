@@ -0,0 +1,165 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// editors write files in several steps, the directory is synchronized
+	// once the events stop
+	syncDelay = 500 * time.Millisecond
+	// full synchronization catching the events missed by the watcher and
+	// the changes done through the database
+	resyncInterval = time.Minute
+)
+
+type Service interface {
+	SyncFile(ctx context.Context, source string, healthchecks []*aggregates.Healthcheck) error
+	RecordFileError(source string, err error)
+	RemoveStaleFiles(ctx context.Context, sources []string) error
+}
+
+// Watcher synchronizes the healthchecks defined in the YAML and JSON files
+// of a directory
+type Watcher struct {
+	logger    *slog.Logger
+	directory string
+	service   Service
+	watcher   *fsnotify.Watcher
+	wg        sync.WaitGroup
+	stop      chan bool
+}
+
+func New(logger *slog.Logger, directory string, service Service) (*Watcher, error) {
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read the healthchecks directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", directory)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("fail to create the healthchecks directory watcher: %w", err)
+	}
+	err = watcher.Add(directory)
+	if err != nil {
+		closeErr := watcher.Close()
+		return nil, errors.Join(fmt.Errorf("fail to watch the healthchecks directory: %w", err), closeErr)
+	}
+	return &Watcher{
+		logger:    logger,
+		directory: directory,
+		service:   service,
+		watcher:   watcher,
+		stop:      make(chan bool),
+	}, nil
+}
+
+func isHealthcheckFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// Sync synchronizes all the files of the directory. The healthchecks of a
+// file which can't be parsed are kept until the file is fixed or removed.
+func (w *Watcher) Sync(ctx context.Context) error {
+	entries, err := os.ReadDir(w.directory)
+	if err != nil {
+		return fmt.Errorf("fail to read the healthchecks directory: %w", err)
+	}
+	sources := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isHealthcheckFile(entry.Name()) {
+			continue
+		}
+		source := entry.Name()
+		sources = append(sources, source)
+		content, err := os.ReadFile(filepath.Join(w.directory, source))
+		if err == nil {
+			var healthchecks []*aggregates.Healthcheck
+			healthchecks, err = Parse(content)
+			if err == nil {
+				err = w.service.SyncFile(ctx, source, healthchecks)
+				if err != nil {
+					w.logger.Error(fmt.Sprintf("fail to synchronize the healthchecks file %s: %s", source, err.Error()))
+				}
+				continue
+			}
+		}
+		w.logger.Error(fmt.Sprintf("fail to read the healthchecks file %s: %s", source, err.Error()))
+		w.service.RecordFileError(source, err)
+	}
+	return w.service.RemoveStaleFiles(ctx, sources)
+}
+
+func (w *Watcher) sync() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := w.Sync(ctx)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("fail to synchronize the healthchecks directory: %s", err.Error()))
+	}
+}
+
+func (w *Watcher) Start() {
+	w.logger.Info(fmt.Sprintf("synchronizing healthchecks from the directory %s", w.directory))
+	w.sync()
+	delay := time.NewTimer(syncDelay)
+	delay.Stop()
+	ticker := time.NewTicker(resyncInterval)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer ticker.Stop()
+		defer delay.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case event, ok := <-w.watcher.Events:
+				if !ok {
+					return
+				}
+				if isHealthcheckFile(filepath.Base(event.Name)) {
+					delay.Reset(syncDelay)
+				}
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					return
+				}
+				w.logger.Error(fmt.Sprintf("healthchecks directory watcher error: %s", err.Error()))
+			case <-delay.C:
+				w.sync()
+			case <-ticker.C:
+				w.sync()
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() {
+	w.stop <- true
+	w.wg.Wait()
+	err := w.watcher.Close()
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("fail to close the healthchecks directory watcher: %s", err.Error()))
+	}
+}
@@ -0,0 +1,119 @@
+package filesync_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/internal/filesync"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeService struct {
+	lock   sync.Mutex
+	files  map[string][]string
+	errors map[string]string
+}
+
+func (f *fakeService) SyncFile(ctx context.Context, source string, healthchecks []*aggregates.Healthcheck) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	names := []string{}
+	for _, healthcheck := range healthchecks {
+		names = append(names, healthcheck.Name)
+	}
+	f.files[source] = names
+	delete(f.errors, source)
+	return nil
+}
+
+func (f *fakeService) RecordFileError(source string, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.errors[source] = err.Error()
+}
+
+func (f *fakeService) RemoveStaleFiles(ctx context.Context, sources []string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	present := make(map[string]bool)
+	for _, source := range sources {
+		present[source] = true
+	}
+	for source := range f.files {
+		if !present[source] {
+			delete(f.files, source)
+		}
+	}
+	return nil
+}
+
+func (f *fakeService) sources() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := []string{}
+	for source := range f.files {
+		result = append(result, source)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (f *fakeService) error(source string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.errors[source]
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0600)
+	assert.NoError(t, err)
+}
+
+func TestWatcher(t *testing.T) {
+	directory := t.TempDir()
+	writeFile(t, filepath.Join(directory, "dns.yaml"), "name: dns\ntype: dns\ndefinition:\n  domain: appclacks.com")
+	writeFile(t, filepath.Join(directory, "notes.txt"), "not a healthcheck")
+	writeFile(t, filepath.Join(directory, ".dns.yaml.swp"), "not a healthcheck")
+	service := &fakeService{
+		files:  make(map[string][]string),
+		errors: make(map[string]string),
+	}
+	watcher, err := filesync.New(slog.Default(), directory, service)
+	assert.NoError(t, err)
+	watcher.Start()
+	defer watcher.Stop()
+	assert.Equal(t, []string{"dns.yaml"}, service.sources())
+
+	writeFile(t, filepath.Join(directory, "tcp.json"), `[{"name": "tcp", "type": "tcp", "definition": {"target": "appclacks.com", "port": 443}}]`)
+	assert.Eventually(t, func() bool {
+		return len(service.sources()) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, []string{"dns.yaml", "tcp.json"}, service.sources())
+
+	writeFile(t, filepath.Join(directory, "tcp.json"), `[{"name": "tcp"`)
+	assert.Eventually(t, func() bool {
+		return service.error("tcp.json") != ""
+	}, 5*time.Second, 50*time.Millisecond)
+	// the healthchecks of an invalid file are kept
+	assert.Equal(t, []string{"dns.yaml", "tcp.json"}, service.sources())
+
+	err = os.Remove(filepath.Join(directory, "dns.yaml"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(service.sources()) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, []string{"tcp.json"}, service.sources())
+}
+
+func TestWatcherMissingDirectory(t *testing.T) {
+	_, err := filesync.New(slog.Default(), filepath.Join(t.TempDir(), "missing"), &fakeService{})
+	assert.ErrorContains(t, err, "fail to read the healthchecks directory")
+}
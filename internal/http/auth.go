@@ -0,0 +1,66 @@
+package http
+
+import (
+	"crypto/subtle"
+	"sync"
+
+	"github.com/appclacks/server/internal/http/middlewares"
+	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+	er "github.com/mcorbin/corbierror"
+)
+
+// credentials holds basic auth credentials which can be replaced
+// while the server is running
+type credentials struct {
+	lock     sync.RWMutex
+	username string
+	password string
+}
+
+func (c *credentials) set(basicAuth BasicAuth) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.username = basicAuth.Username
+	c.password = basicAuth.Password
+}
+
+func (c *credentials) get() (string, string) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.username, c.password
+}
+
+// middleware returns a basic auth middleware using the current credentials.
+// Authentication is skipped when no username is configured.
+func (c *credentials) middleware() echo.MiddlewareFunc {
+	return echomw.BasicAuthWithConfig(echomw.BasicAuthConfig{
+		Skipper: func(ec echo.Context) bool {
+			username, _ := c.get()
+			return username == ""
+		},
+		Validator: func(username, password string, ec echo.Context) (bool, error) {
+			expectedUsername, expectedPassword := c.get()
+			if subtle.ConstantTimeCompare([]byte(username), []byte(expectedUsername)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(password), []byte(expectedPassword)) == 1 {
+				ec.Set(middlewares.PrincipalContextKey, username)
+				return true, nil
+			}
+			return false, nil
+		},
+	})
+}
+
+// required returns a middleware rejecting the requests when no username is
+// configured, for the routes which should never be open
+func (c *credentials) required() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ec echo.Context) error {
+			username, _ := c.get()
+			if username == "" {
+				return er.New("this route requires basic auth to be configured", er.Forbidden, true)
+			}
+			return next(ec)
+		}
+	}
+}
@@ -1,12 +1,46 @@
 package http
 
 type BasicAuth struct {
-	Username string
-	Password string
+	Username     string
+	Password     string `secret:"true"`
+	PasswordFile string `yaml:"password-file"`
 }
 
+// Exposition modes of the pushgateway metrics
+const (
+	// PushgatewaySeparate serves them on /pushgateway/metrics
+	PushgatewaySeparate = "separate"
+	// PushgatewayMerged serves them with the server metrics on /metrics
+	PushgatewayMerged = "merged"
+	// PushgatewayBoth serves them on both endpoints
+	PushgatewayBoth = "both"
+)
+
 type Metrics struct {
-	BasicAuth BasicAuth `yaml:"basic-auth"`
+	BasicAuth   BasicAuth `yaml:"basic-auth"`
+	Pushgateway string    `validate:"omitempty,oneof=separate merged both"`
+}
+
+// PushgatewayMode returns the exposition mode of the pushgateway metrics,
+// separate by default
+func (m Metrics) PushgatewayMode() string {
+	if m.Pushgateway == "" {
+		return PushgatewaySeparate
+	}
+	return m.Pushgateway
+}
+
+// RateLimit is a token bucket configuration. Rate limiting is disabled
+// if the rate is 0.
+type RateLimit struct {
+	Rate  float64 `validate:"gte=0"`
+	Burst int     `validate:"gte=0"`
+}
+
+type RateLimits struct {
+	Pushgateway RateLimit
+	Healthcheck RateLimit
+	Discovery   RateLimit
 }
 
 type Configuration struct {
@@ -19,4 +53,8 @@ type Configuration struct {
 	ServerName string    `yaml:"server-name"`
 	BasicAuth  BasicAuth `yaml:"basic-auth"`
 	Metrics    Metrics
+	RateLimit  RateLimits `yaml:"rate-limit"`
+	// CIDRs of the reverse proxies allowed to set the client IP in the
+	// X-Forwarded-For header
+	TrustedProxies []string `yaml:"trusted-proxies" validate:"dive,cidr"`
 }
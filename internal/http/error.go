@@ -2,11 +2,13 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/appclacks/server/internal/http/handlers"
 	"github.com/labstack/echo/v4"
 	er "github.com/mcorbin/corbierror"
 )
@@ -17,6 +19,16 @@ func errorHandler(logger *slog.Logger) func(err error, c echo.Context) {
 		// with nil passed, like for the rate limiter
 		if err != nil {
 			errLoggedMsg := err.Error() + " on " + c.Request().Method + " " + c.Request().URL.Path
+			var encodedError *handlers.EncodedError
+			if errors.As(err, &encodedError) {
+				logger.Error(errLoggedMsg)
+				err := c.Blob(encodedError.Status, encodedError.ContentType, encodedError.Body)
+				if err != nil {
+					logger.Error(err.Error())
+					c.Response().Status = http.StatusInternalServerError
+				}
+				return
+			}
 			corbiError, ok := err.(*er.Error)
 			if ok {
 				if corbiError.Type == er.Forbidden {
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	er "github.com/mcorbin/corbierror"
+)
+
+type ReloadConfigurationOutput struct {
+	Applied []string `json:"applied"`
+	Ignored []string `json:"ignored"`
+}
+
+func (b *Builder) ReloadConfiguration(ec echo.Context) error {
+	if b.reloader == nil {
+		return er.New("configuration reload is not available", er.BadRequest, true)
+	}
+	applied, ignored, err := b.reloader.Reload(ec.Request().Context())
+	if err != nil {
+		return err
+	}
+	return ec.JSON(http.StatusOK, ReloadConfigurationOutput{
+		Applied: applied,
+		Ignored: ignored,
+	})
+}
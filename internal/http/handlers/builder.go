@@ -2,9 +2,16 @@ package handlers
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/appclacks/server/pkg/pushgateway"
 	pgaggregates "github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 )
 
 type HealthcheckService interface {
@@ -15,25 +22,53 @@ type HealthcheckService interface {
 	DeleteHealthcheck(ctx context.Context, id string) error
 	ListHealthchecks(ctx context.Context, query aggregates.Query) ([]*aggregates.Healthcheck, error)
 	CountHealthchecks(ctx context.Context) (int, error)
+	Heartbeat(ctx context.Context, identifier string, kind string, message *string) (*aggregates.HeartbeatState, error)
+	GetHeartbeatState(ctx context.Context, identifier string) (*aggregates.Healthcheck, *aggregates.HeartbeatState, error)
+	PrometheusTargetGroups(ctx context.Context, labels map[string]string, types []string) ([]aggregates.TargetGroup, error)
+	Probe(ctx context.Context, target string, module string, timeout time.Duration, registry *prometheus.Registry) error
+	FileSyncStatus() []aggregates.FileSyncStatus
 }
 
 type PushgatewayService interface {
 	CreateOrUpdatePushgatewayMetric(ctx context.Context, metric pgaggregates.PushgatewayMetric, cumulative bool) (string, error)
-	GetMetrics(ctx context.Context) ([]*pgaggregates.PushgatewayMetric, error)
+	GetMetrics(ctx context.Context, query pgaggregates.Query) ([]*pgaggregates.PushgatewayMetric, error)
 	DeleteMetricsByName(ctx context.Context, name string) error
 	DeleteMetricByID(ctx context.Context, id string) error
-	PrometheusMetrics(ctx context.Context) (string, error)
+	DeleteMetricsBySelectors(ctx context.Context, selectors [][]pgaggregates.LabelMatcher, dryRun bool) ([]*pgaggregates.PushgatewayMetric, error)
+	BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []pgaggregates.PushgatewayMetric) ([]pgaggregates.BatchResult, error)
+	IncrementPushgatewayMetric(ctx context.Context, metric pgaggregates.PushgatewayMetric) (*pgaggregates.PushgatewayMetric, error)
+	PrometheusMetrics(ctx context.Context, w io.Writer, format expfmt.Format, selectors [][]pgaggregates.LabelMatcher) error
 	DeleteAllPushgatewayMetrics(ctx context.Context) error
+	PushMetrics(ctx context.Context, groupingKey map[string]string, families []*dto.MetricFamily, replace bool) error
+	RemoteWrite(ctx context.Context, data []byte) (int, error)
+	InfluxWrite(ctx context.Context, data string, precision string) (int, error)
+	OTLPMetrics(ctx context.Context, request *colmetricspb.ExportMetricsServiceRequest) (*pgaggregates.OTLPResult, error)
+	RecordPushFailure(ctx context.Context, groupingKey map[string]string)
+	DeleteGroup(ctx context.Context, groupingKey map[string]string) error
+	Usage(ctx context.Context) (*pgaggregates.Usage, error)
+	Limits() pushgateway.Limits
+	GetMetricFamilies(ctx context.Context) ([]*pgaggregates.MetricFamily, error)
+	GetMetricFamily(ctx context.Context, name string) (*pgaggregates.MetricFamily, error)
+	UpdateMetricFamily(ctx context.Context, family pgaggregates.MetricFamily) error
+	DeleteMetricFamily(ctx context.Context, name string) error
+}
+
+// ConfigurationReloader reloads the server configuration and returns
+// the settings which were applied and the ones requiring a restart
+type ConfigurationReloader interface {
+	Reload(ctx context.Context) ([]string, []string, error)
 }
 
 type Builder struct {
 	healthcheck HealthcheckService
 	pushgateway PushgatewayService
+	reloader    ConfigurationReloader
 }
 
-func NewBuilder(healthcheck HealthcheckService, pushgateway PushgatewayService) *Builder {
+func NewBuilder(healthcheck HealthcheckService, pushgateway PushgatewayService, reloader ConfigurationReloader) *Builder {
 	return &Builder{
 		healthcheck: healthcheck,
 		pushgateway: pushgateway,
+		reloader:    reloader,
 	}
 }
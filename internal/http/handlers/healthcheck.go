@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
-	"strings"
 
 	"github.com/appclacks/go-client"
 	"github.com/appclacks/server/pkg/healthcheck"
@@ -128,19 +127,9 @@ func (b *Builder) CabourotteDiscovery(ec echo.Context) error {
 		return err
 	}
 
-	// foo=bar,a=b
-	// TODO move this in service
-	unformattedTags := payload.Labels
-	labels := make(map[string]string)
-	if unformattedTags != "" {
-		splittedTags := strings.Split(unformattedTags, ",")
-		for _, tag := range splittedTags {
-			kvSplitted := strings.Split(tag, "=")
-			if len(kvSplitted) != 2 {
-				return er.New("Invalid labels parameter", er.BadRequest, true)
-			}
-			labels[kvSplitted[0]] = kvSplitted[1]
-		}
+	labels, err := healthcheck.ParseLabels(payload.Labels)
+	if err != nil {
+		return err
 	}
 	t := true
 	query := aggregates.Query{Enabled: &t}
@@ -163,6 +152,9 @@ func (b *Builder) CabourotteDiscovery(ec echo.Context) error {
 				result.TLSChecks = append(result.TLSChecks, toHealthcheck(*hc))
 			case "command":
 				result.CommandChecks = append(result.CommandChecks, toHealthcheck(*hc))
+			case "heartbeat":
+				// passive checks are evaluated by the server
+				continue
 			default:
 				return fmt.Errorf("healthcheck type %s unknown for healthcheck %s", hc.Type, hc.ID)
 			}
@@ -172,3 +164,39 @@ func (b *Builder) CabourotteDiscovery(ec echo.Context) error {
 
 	return ec.JSON(http.StatusOK, result)
 }
+
+type PrometheusHTTPSDInput struct {
+	Labels string   `query:"labels" description:"Labels of the healthchecks, in the foo=bar,a=b format"`
+	Types  []string `query:"type" description:"Types of the healthchecks, DNS healthchecks are not exposed" validate:"dive,oneof=tcp tls http"`
+}
+
+type PrometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (b *Builder) PrometheusHTTPSD(ec echo.Context) error {
+	var payload PrometheusHTTPSDInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	labels, err := healthcheck.ParseLabels(payload.Labels)
+	if err != nil {
+		return err
+	}
+	groups, err := b.healthcheck.PrometheusTargetGroups(ec.Request().Context(), labels, payload.Types)
+	if err != nil {
+		return err
+	}
+	result := make([]PrometheusTargetGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, PrometheusTargetGroup{
+			Targets: group.Targets,
+			Labels:  group.Labels,
+		})
+	}
+	return ec.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HealthcheckFileStatus struct {
+	Source       string    `json:"source" description:"File name in the healthchecks directory"`
+	Healthchecks []string  `json:"healthchecks" description:"Healthchecks synchronized from the file"`
+	SyncedAt     time.Time `json:"synced-at"`
+	Error        string    `json:"error,omitempty" description:"Last synchronization error"`
+}
+
+type ListHealthcheckFilesOutput struct {
+	Result []HealthcheckFileStatus `json:"result"`
+}
+
+func (b *Builder) ListHealthcheckFiles(ec echo.Context) error {
+	output := ListHealthcheckFilesOutput{
+		Result: []HealthcheckFileStatus{},
+	}
+	for _, status := range b.healthcheck.FileSyncStatus() {
+		file := HealthcheckFileStatus{
+			Source:       status.Source,
+			Healthchecks: status.Healthchecks,
+			SyncedAt:     status.SyncedAt,
+		}
+		if file.Healthchecks == nil {
+			file.Healthchecks = []string{}
+		}
+		if status.Error != nil {
+			file.Error = *status.Error
+		}
+		output.Result = append(output.Result, file)
+	}
+	return ec.JSON(http.StatusOK, output)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/labstack/echo/v4"
+)
+
+type HealthcheckHeartbeatDefinition struct {
+	Period   string `json:"period,omitempty" description:"Expected period between two pings"`
+	Schedule string `json:"schedule,omitempty" description:"Cron schedule of the job, replaces the period" validate:"max=255"`
+	Timezone string `json:"timezone,omitempty" description:"Timezone of the cron schedule, UTC by default" validate:"max=255"`
+	Grace    string `json:"grace,omitempty" description:"Delay before a missing ping marks the check as failing, and maximum duration of a started job (until its next run by default)"`
+}
+
+type CreateHeartbeatHealthcheckInput struct {
+	Name        string            `json:"name" description:"Healthcheck name" validate:"required,max=255,min=1"`
+	Description string            `json:"description" description:"Healthcheck description" validate:"max=255"`
+	Labels      map[string]string `json:"labels" description:"Healthcheck labels" validate:"dive,keys,max=255,min=1,endkeys,max=255,min=1"`
+	Enabled     bool              `json:"enabled" description:"Enable the healthcheck"`
+	HealthcheckHeartbeatDefinition
+}
+
+type UpdateHeartbeatHealthcheckInput struct {
+	ID          string            `json:"-" param:"id" description:"Healthcheck ID" validate:"required,uuid"`
+	Name        string            `json:"name" description:"Healthcheck name" validate:"required,max=255,min=1"`
+	Description string            `json:"description" description:"Healthcheck description" validate:"max=255"`
+	Labels      map[string]string `json:"labels" description:"Healthcheck labels" validate:"dive,keys,max=255,min=1,endkeys,max=255,min=1"`
+	Enabled     bool              `json:"enabled" description:"Enable the healthcheck"`
+	HealthcheckHeartbeatDefinition
+}
+
+type HeartbeatInput struct {
+	Identifier string `json:"-" param:"id" description:"Heartbeat check name or ID" validate:"required"`
+	Message    string `json:"message" description:"Message reported with a failure" validate:"max=1024"`
+}
+
+type GetHeartbeatInput struct {
+	Identifier string `param:"id" description:"Heartbeat check name or ID" validate:"required"`
+}
+
+type HeartbeatState struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	Message       string     `json:"message,omitempty"`
+	LastPingAt    *time.Time `json:"last-ping-at,omitempty"`
+	LastStartAt   *time.Time `json:"last-start-at,omitempty"`
+	LastFailureAt *time.Time `json:"last-failure-at,omitempty"`
+	LastDuration  *float64   `json:"last-duration,omitempty" description:"Duration of the last job in seconds"`
+	Deadline      *time.Time `json:"deadline,omitempty" description:"Time after which a missing ping marks the check as failing"`
+}
+
+func toHeartbeatState(check *aggregates.Healthcheck, state *aggregates.HeartbeatState) HeartbeatState {
+	result := HeartbeatState{
+		ID:            check.ID,
+		Name:          check.Name,
+		Status:        state.Status,
+		LastPingAt:    state.LastPingAt,
+		LastStartAt:   state.LastStartAt,
+		LastFailureAt: state.LastFailureAt,
+		LastDuration:  state.LastDuration,
+	}
+	if state.Message != nil {
+		result.Message = *state.Message
+	}
+	if check.Enabled {
+		deadline, err := healthcheck.HeartbeatDeadline(check, state)
+		if err == nil {
+			result.Deadline = &deadline
+		}
+	}
+	return result
+}
+
+func (b *Builder) CreateHeartbeatHealthcheck(ec echo.Context) error {
+	var payload CreateHeartbeatHealthcheckInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	definition := payload.HealthcheckHeartbeatDefinition
+	check := &aggregates.Healthcheck{
+		Name:    payload.Name,
+		Labels:  payload.Labels,
+		Enabled: payload.Enabled,
+		Definition: &aggregates.HealthcheckHeartbeatDefinition{
+			Period:   definition.Period,
+			Schedule: definition.Schedule,
+			Timezone: definition.Timezone,
+			Grace:    definition.Grace,
+		},
+	}
+	if payload.Description != "" {
+		check.Description = &payload.Description
+	}
+	healthcheck.InitHeartbeatHealthcheck(check)
+	err := b.healthcheck.CreateHealthcheck(ec.Request().Context(), check)
+	if err != nil {
+		return err
+	}
+	result := toHealthcheck(*check)
+	return ec.JSON(http.StatusOK, &result)
+}
+
+func (b *Builder) UpdateHeartbeatHealthcheck(ec echo.Context) error {
+	var payload UpdateHeartbeatHealthcheckInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	definition := payload.HealthcheckHeartbeatDefinition
+	check := &aggregates.Healthcheck{
+		ID:      payload.ID,
+		Name:    payload.Name,
+		Labels:  payload.Labels,
+		Enabled: payload.Enabled,
+		Type:    "heartbeat",
+		Definition: &aggregates.HealthcheckHeartbeatDefinition{
+			Period:   definition.Period,
+			Schedule: definition.Schedule,
+			Timezone: definition.Timezone,
+			Grace:    definition.Grace,
+		},
+	}
+	if payload.Description != "" {
+		check.Description = &payload.Description
+	}
+	err := b.healthcheck.UpdateHealthcheck(ec.Request().Context(), check)
+	if err != nil {
+		return err
+	}
+	healthcheckResult, err := b.healthcheck.GetHealthcheck(ec.Request().Context(), payload.ID)
+	if err != nil {
+		return err
+	}
+	result := toHealthcheck(*healthcheckResult)
+	return ec.JSON(http.StatusOK, &result)
+}
+
+func (b *Builder) heartbeat(ec echo.Context, kind string) error {
+	var payload HeartbeatInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	var message *string
+	if payload.Message != "" {
+		message = &payload.Message
+	}
+	_, err := b.healthcheck.Heartbeat(ec.Request().Context(), payload.Identifier, kind, message)
+	if err != nil {
+		return err
+	}
+	return ec.JSON(http.StatusOK, NewResponse("Heartbeat recorded"))
+}
+
+func (b *Builder) HeartbeatSuccess(ec echo.Context) error {
+	return b.heartbeat(ec, aggregates.HeartbeatPingSuccess)
+}
+
+func (b *Builder) HeartbeatFail(ec echo.Context) error {
+	return b.heartbeat(ec, aggregates.HeartbeatPingFail)
+}
+
+func (b *Builder) HeartbeatStart(ec echo.Context) error {
+	return b.heartbeat(ec, aggregates.HeartbeatPingStart)
+}
+
+func (b *Builder) GetHeartbeat(ec echo.Context) error {
+	var payload GetHeartbeatInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	check, state, err := b.healthcheck.GetHeartbeatState(ec.Request().Context(), payload.Identifier)
+	if err != nil {
+		return err
+	}
+	return ec.JSON(http.StatusOK, toHeartbeatState(check, state))
+}
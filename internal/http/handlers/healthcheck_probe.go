@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// the probe should complete before Prometheus gives up on the scrape
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+type ProbeInput struct {
+	Target string `query:"target" description:"Healthcheck name or ID" validate:"required"`
+	Module string `query:"module" description:"Healthcheck type, checked if defined" validate:"omitempty,oneof=dns tcp tls http"`
+}
+
+// Probe executes a healthcheck like the blackbox exporter /probe endpoint
+func (b *Builder) Probe(ec echo.Context) error {
+	var payload ProbeInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	var timeout time.Duration
+	if header := ec.Request().Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); header != "" {
+		seconds, err := strconv.ParseFloat(header, 64)
+		if err != nil {
+			return er.Newf("invalid X-Prometheus-Scrape-Timeout-Seconds header %s", er.BadRequest, true, header)
+		}
+		timeout = time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+		if timeout <= 0 {
+			return er.New("the scrape timeout is too short", er.BadRequest, true)
+		}
+	}
+	registry := prometheus.NewRegistry()
+	err := b.healthcheck.Probe(ec.Request().Context(), payload.Target, payload.Module, timeout, registry)
+	if err != nil {
+		return err
+	}
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(ec.Response(), ec.Request())
+	return nil
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/appclacks/go-client"
@@ -10,21 +12,265 @@ import (
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/common/expfmt"
 )
 
+// float values are passed as strings to support +Inf and NaN
+
+type PushgatewayHistogramBucket struct {
+	UpperBound string `json:"le" description:"Bucket upper bound, the last bucket should be +Inf" validate:"required"`
+	Count      uint64 `json:"count" description:"Cumulative number of observations in the bucket"`
+}
+
+type PushgatewayHistogram struct {
+	Buckets []PushgatewayHistogramBucket `json:"buckets" validate:"required,min=1,dive"`
+	Sum     string                       `json:"sum" validate:"required"`
+	Count   uint64                       `json:"count"`
+}
+
+type PushgatewaySummaryQuantile struct {
+	Quantile float64 `json:"quantile" validate:"gte=0,lte=1"`
+	Value    string  `json:"value" validate:"required"`
+}
+
+type PushgatewaySummary struct {
+	Quantiles []PushgatewaySummaryQuantile `json:"quantiles" validate:"dive"`
+	Sum       string                       `json:"sum" validate:"required"`
+	Count     uint64                       `json:"count"`
+}
+
+type CreateOrUpdatePushgatewayMetricInput struct {
+	Name        string                `json:"name" validate:"required,max=255,min=1"`
+	Description string                `json:"description,omitempty"`
+	Labels      map[string]string     `json:"labels" description:"Metric labels" validate:"dive,keys,max=255,min=1,endkeys,max=255,min=1"`
+	TTL         string                `json:"ttl"`
+	Type        string                `json:"type" validate:"omitempty,oneof=counter gauge histogram summary"`
+	Value       string                `json:"value" description:"Metric value, not used for histograms and summaries" validate:"required_unless=Type histogram Type summary"`
+	Histogram   *PushgatewayHistogram `json:"histogram,omitempty" validate:"required_if=Type histogram,omitempty"`
+	Summary     *PushgatewaySummary   `json:"summary,omitempty" validate:"required_if=Type summary,omitempty"`
+	Timestamp   *time.Time            `json:"timestamp,omitempty" description:"Optional timestamp of the sample"`
+}
+
+type BatchPushgatewayMetric struct {
+	Name        string                `json:"name" validate:"required,max=255,min=1"`
+	Description string                `json:"description,omitempty"`
+	Labels      map[string]string     `json:"labels" description:"Metric labels, merged with the batch labels" validate:"dive,keys,max=255,min=1,endkeys,max=255,min=1"`
+	TTL         string                `json:"ttl" description:"Metric TTL, the batch TTL by default"`
+	Type        string                `json:"type" description:"Metric type, the batch type by default" validate:"omitempty,oneof=counter gauge histogram summary"`
+	Value       string                `json:"value" description:"Metric value, not used for histograms and summaries"`
+	Histogram   *PushgatewayHistogram `json:"histogram,omitempty" validate:"omitempty"`
+	Summary     *PushgatewaySummary   `json:"summary,omitempty" validate:"omitempty"`
+	Timestamp   *time.Time            `json:"timestamp,omitempty" description:"Optional timestamp of the sample"`
+}
+
+type BatchPushgatewayMetricsInput struct {
+	Labels  map[string]string        `json:"labels" description:"Labels added to all metrics" validate:"dive,keys,max=255,min=1,endkeys,max=255,min=1"`
+	TTL     string                   `json:"ttl" description:"Default TTL of the metrics"`
+	Type    string                   `json:"type" description:"Default type of the metrics" validate:"omitempty,oneof=counter gauge histogram summary"`
+	Metrics []BatchPushgatewayMetric `json:"metrics" validate:"required,min=1,max=1000,dive"`
+}
+
+type BatchPushgatewayMetricResult struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Created bool              `json:"created" description:"True if the metric was created, false if it was updated"`
+}
+
+type BatchPushgatewayMetricsOutput struct {
+	Result []BatchPushgatewayMetricResult `json:"result"`
+}
+
+type IncrementPushgatewayMetricInput struct {
+	Name        string            `json:"name" validate:"required,max=255,min=1"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels" description:"Metric labels" validate:"dive,keys,max=255,min=1,endkeys,max=255,min=1"`
+	TTL         string            `json:"ttl"`
+	Type        string            `json:"type" description:"Metric type, counter by default" validate:"omitempty,oneof=counter gauge"`
+	Value       string            `json:"value" description:"Value added to the metric, can be negative for gauges" validate:"required"`
+}
+
+type PushgatewayMetric struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Labels      map[string]string     `json:"labels,omitempty"`
+	TTL         string                `json:"ttl"`
+	Type        string                `json:"type"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+	ExpiresAt   *time.Time            `json:"expires_at,omitempty"`
+	Timestamp   *time.Time            `json:"timestamp,omitempty"`
+	Value       string                `json:"value"`
+	Histogram   *PushgatewayHistogram `json:"histogram,omitempty"`
+	Summary     *PushgatewaySummary   `json:"summary,omitempty"`
+}
+
+type ListPushgatewayMetricsInput struct {
+	MinValue string   `query:"min-value" description:"Returns metrics whose values are greater than or equal to this value"`
+	MaxValue string   `query:"max-value" description:"Returns metrics whose values are lower than or equal to this value"`
+	Match    []string `query:"match[]" description:"Series selectors like {job=\"backup\"}, returns metrics matching one of them"`
+}
+
+type ListPushgatewayMetricsOutput struct {
+	Result []PushgatewayMetric `json:"result"`
+}
+
+type DeletePushgatewayMetricsInput struct {
+	Match   []string `query:"match[]" description:"Series selectors like {job=\"backup\"}, deletes metrics matching one of them. All metrics are deleted if not set."`
+	DryRun  bool     `query:"dry-run" description:"Returns the metrics which would be deleted without deleting them"`
+	Confirm bool     `query:"confirm" description:"Should be true to delete metrics, except for dry runs"`
+}
+
+type DeletePushgatewayMetricsOutput struct {
+	DryRun bool                `json:"dry_run"`
+	Count  int                 `json:"count"`
+	Result []PushgatewayMetric `json:"result"`
+}
+
+// parseSelectors parses the match[] parameters
+func parseSelectors(values []string) ([][]aggregates.LabelMatcher, error) {
+	result := [][]aggregates.LabelMatcher{}
+	for _, value := range values {
+		selector, err := pushgateway.ParseSelector(value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, selector)
+	}
+	return result, nil
+}
+
+func parseFloat(name string, value string) (float64, error) {
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, er.Newf("invalid %s %s: not a valid number", er.BadRequest, true, name, value)
+	}
+	return result, nil
+}
+
+func toHistogram(input *PushgatewayHistogram) (*aggregates.Histogram, error) {
+	if input == nil {
+		return nil, nil
+	}
+	sum, err := parseFloat("histogram sum", input.Sum)
+	if err != nil {
+		return nil, err
+	}
+	result := &aggregates.Histogram{
+		Sum:   sum,
+		Count: input.Count,
+	}
+	for _, bucket := range input.Buckets {
+		upperBound, err := parseFloat("bucket upper bound", bucket.UpperBound)
+		if err != nil {
+			return nil, err
+		}
+		result.Buckets = append(result.Buckets, aggregates.Bucket{
+			UpperBound: upperBound,
+			Count:      bucket.Count,
+		})
+	}
+	return result, nil
+}
+
+func toSummary(input *PushgatewaySummary) (*aggregates.Summary, error) {
+	if input == nil {
+		return nil, nil
+	}
+	sum, err := parseFloat("summary sum", input.Sum)
+	if err != nil {
+		return nil, err
+	}
+	result := &aggregates.Summary{
+		Sum:   sum,
+		Count: input.Count,
+	}
+	for _, quantile := range input.Quantiles {
+		value, err := parseFloat("quantile value", quantile.Value)
+		if err != nil {
+			return nil, err
+		}
+		result.Quantiles = append(result.Quantiles, aggregates.Quantile{
+			Quantile: quantile.Quantile,
+			Value:    value,
+		})
+	}
+	return result, nil
+}
+
+func fromHistogram(histogram *aggregates.Histogram) *PushgatewayHistogram {
+	if histogram == nil {
+		return nil
+	}
+	result := &PushgatewayHistogram{
+		Buckets: []PushgatewayHistogramBucket{},
+		Sum:     pushgateway.FormatValue(histogram.Sum),
+		Count:   histogram.Count,
+	}
+	for _, bucket := range histogram.Buckets {
+		result.Buckets = append(result.Buckets, PushgatewayHistogramBucket{
+			UpperBound: pushgateway.FormatValue(bucket.UpperBound),
+			Count:      bucket.Count,
+		})
+	}
+	return result
+}
+
+func fromSummary(summary *aggregates.Summary) *PushgatewaySummary {
+	if summary == nil {
+		return nil
+	}
+	result := &PushgatewaySummary{
+		Quantiles: []PushgatewaySummaryQuantile{},
+		Sum:       pushgateway.FormatValue(summary.Sum),
+		Count:     summary.Count,
+	}
+	for _, quantile := range summary.Quantiles {
+		result.Quantiles = append(result.Quantiles, PushgatewaySummaryQuantile{
+			Quantile: quantile.Quantile,
+			Value:    pushgateway.FormatValue(quantile.Value),
+		})
+	}
+	return result
+}
+
+// parseValue parses the value of a metric, histograms and summaries have no value
+func parseValue(metricType string, value string) (float64, error) {
+	if metricType == "histogram" || metricType == "summary" {
+		return 0, nil
+	}
+	return parseFloat("value", value)
+}
+
 func (b *Builder) CreateOrUpdatePushgatewayMetric(ec echo.Context) error {
-	var payload client.CreateOrUpdatePushgatewayMetricInput
+	var payload CreateOrUpdatePushgatewayMetricInput
 	if err := ec.Bind(&payload); err != nil {
 		return err
 	}
 	if err := ec.Validate(payload); err != nil {
 		return err
 	}
+	histogram, err := toHistogram(payload.Histogram)
+	if err != nil {
+		return err
+	}
+	summary, err := toSummary(payload.Summary)
+	if err != nil {
+		return err
+	}
+	value, err := parseValue(payload.Type, payload.Value)
+	if err != nil {
+		return err
+	}
 
 	metric := &aggregates.PushgatewayMetric{
-		Name:   payload.Name,
-		Labels: payload.Labels,
-		Value:  payload.Value,
+		Name:      payload.Name,
+		Labels:    payload.Labels,
+		Value:     value,
+		Histogram: histogram,
+		Summary:   summary,
+		Timestamp: payload.Timestamp,
 	}
 	pushgateway.InitPushgatewayMetric(metric)
 	if payload.Description != "" {
@@ -50,12 +296,182 @@ func (b *Builder) CreateOrUpdatePushgatewayMetric(ec echo.Context) error {
 	return ec.JSON(http.StatusOK, NewResponse("metric created", id))
 }
 
+// toBatchMetric builds a metric from the batch payload, the metric fields
+// overriding the batch defaults
+func toBatchMetric(payload BatchPushgatewayMetricsInput, input BatchPushgatewayMetric) (*aggregates.PushgatewayMetric, error) {
+	histogram, err := toHistogram(input.Histogram)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := toSummary(input.Summary)
+	if err != nil {
+		return nil, err
+	}
+	var labels map[string]string
+	if len(payload.Labels) != 0 || len(input.Labels) != 0 {
+		labels = make(map[string]string)
+		for k, v := range payload.Labels {
+			labels[k] = v
+		}
+		for k, v := range input.Labels {
+			labels[k] = v
+		}
+	}
+	metricType := payload.Type
+	if input.Type != "" {
+		metricType = input.Type
+	}
+	value, err := parseValue(metricType, input.Value)
+	if err != nil {
+		return nil, err
+	}
+	metric := &aggregates.PushgatewayMetric{
+		Name:      input.Name,
+		Labels:    labels,
+		Value:     value,
+		Histogram: histogram,
+		Summary:   summary,
+		Timestamp: input.Timestamp,
+	}
+	pushgateway.InitPushgatewayMetric(metric)
+	if input.Description != "" {
+		metric.Description = &input.Description
+	}
+	ttl := payload.TTL
+	if input.TTL != "" {
+		ttl = input.TTL
+	}
+	if ttl != "" {
+		metric.TTL = &ttl
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, er.Newf("Invalid TTL: %s", er.BadRequest, true, err.Error())
+		}
+		expiresAt := metric.CreatedAt.Add(duration)
+		metric.ExpiresAt = &expiresAt
+	}
+	if metricType != "" {
+		metric.Type = &metricType
+	}
+	return metric, nil
+}
+
+func (b *Builder) BatchPushgatewayMetrics(ec echo.Context) error {
+	var payload BatchPushgatewayMetricsInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	metrics := []aggregates.PushgatewayMetric{}
+	messages := []string{}
+	for i, input := range payload.Metrics {
+		metric, err := toBatchMetric(payload, input)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("metric %d (%s): %s", i, input.Name, err.Error()))
+			continue
+		}
+		metrics = append(metrics, *metric)
+	}
+	if len(messages) > 0 {
+		return &er.Error{
+			Messages:  messages,
+			Type:      er.BadRequest,
+			Exposable: true,
+		}
+	}
+	results, err := b.pushgateway.BatchCreateOrUpdatePushgatewayMetrics(ec.Request().Context(), metrics)
+	if err != nil {
+		return err
+	}
+	output := BatchPushgatewayMetricsOutput{
+		Result: []BatchPushgatewayMetricResult{},
+	}
+	for i, result := range results {
+		output.Result = append(output.Result, BatchPushgatewayMetricResult{
+			ID:      result.ID,
+			Name:    metrics[i].Name,
+			Labels:  metrics[i].Labels,
+			Created: result.Created,
+		})
+	}
+	return ec.JSON(http.StatusOK, output)
+}
+
+func (b *Builder) IncrementPushgatewayMetric(ec echo.Context) error {
+	var payload IncrementPushgatewayMetricInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	value, err := parseFloat("value", payload.Value)
+	if err != nil {
+		return err
+	}
+	metric := &aggregates.PushgatewayMetric{
+		Name:   payload.Name,
+		Labels: payload.Labels,
+		Value:  value,
+	}
+	pushgateway.InitPushgatewayMetric(metric)
+	if payload.Description != "" {
+		metric.Description = &payload.Description
+	}
+	if payload.TTL != "" {
+		metric.TTL = &payload.TTL
+		ttl, err := time.ParseDuration(*metric.TTL)
+		if err != nil {
+			return er.Newf("Invalid TTL: %s", er.BadRequest, true, err.Error())
+		}
+		expiresAt := metric.CreatedAt.Add(ttl)
+		metric.ExpiresAt = &expiresAt
+	}
+	metricType := "counter"
+	if payload.Type != "" {
+		metricType = payload.Type
+	}
+	metric.Type = &metricType
+	result, err := b.pushgateway.IncrementPushgatewayMetric(ec.Request().Context(), *metric)
+	if err != nil {
+		return err
+	}
+	return ec.JSON(http.StatusOK, toPushgatewayMetricOutput(result))
+}
+
 func (b *Builder) PushgatewayMetrics(ec echo.Context) error {
-	metricString, err := b.pushgateway.PrometheusMetrics(ec.Request().Context())
+	selectors, err := parseSelectors(ec.QueryParams()["match[]"])
+	if err != nil {
+		return err
+	}
+	format := expfmt.NegotiateIncludingOpenMetrics(ec.Request().Header)
+	writer := &expositionWriter{response: ec.Response(), format: format}
+	err = b.pushgateway.PrometheusMetrics(ec.Request().Context(), writer, format, selectors)
 	if err != nil {
 		return err
 	}
-	return ec.String(200, metricString)
+	if !ec.Response().Committed {
+		// nothing was written
+		ec.Response().Header().Set(echo.HeaderContentType, string(format))
+		ec.Response().WriteHeader(http.StatusOK)
+	}
+	return nil
+}
+
+// expositionWriter sets the content type of the response when the metrics
+// encoding starts, errors returned before are written as JSON
+type expositionWriter struct {
+	response *echo.Response
+	format   expfmt.Format
+}
+
+func (w *expositionWriter) Write(b []byte) (int, error) {
+	if !w.response.Committed {
+		w.response.Header().Set(echo.HeaderContentType, string(w.format))
+	}
+	return w.response.Write(b)
 }
 
 func (b *Builder) DeleteMetric(ec echo.Context) error {
@@ -85,44 +501,120 @@ func (b *Builder) DeleteMetric(ec echo.Context) error {
 	return ec.JSON(http.StatusOK, NewResponse("metrics deleted"))
 }
 
-func (b *Builder) DeleteAllPushgatewayMetrics(ec echo.Context) error {
-
-	err := b.pushgateway.DeleteAllPushgatewayMetrics(ec.Request().Context())
-	if err != nil {
+// DeletePushgatewayMetrics deletes the metrics matching the match[] selectors.
+// Deleting metrics requires the confirm parameter, except for dry runs.
+func (b *Builder) DeletePushgatewayMetrics(ec echo.Context) error {
+	var payload DeletePushgatewayMetricsInput
+	if err := ec.Bind(&payload); err != nil {
 		return err
 	}
-	return ec.JSON(http.StatusOK, NewResponse("metrics deleted"))
-}
-
-func (b *Builder) ListPushgatewayMetrics(ec echo.Context) error {
-	metrics, err := b.pushgateway.GetMetrics(ec.Request().Context())
+	selectors, err := parseSelectors(payload.Match)
 	if err != nil {
 		return err
 	}
-	result := []client.PushgatewayMetric{}
-	for _, metric := range metrics {
-		m := client.PushgatewayMetric{
-			ID:        metric.ID,
-			Name:      metric.Name,
-			Labels:    metric.Labels,
-			CreatedAt: metric.CreatedAt,
-			Value:     metric.Value,
+	if !payload.DryRun && !payload.Confirm {
+		return er.New("deleting metrics requires the confirm parameter, use dry-run to list the metrics which would be deleted", er.BadRequest, true)
+	}
+	ctx := ec.Request().Context()
+	var metrics []*aggregates.PushgatewayMetric
+	output := DeletePushgatewayMetricsOutput{
+		DryRun: payload.DryRun,
+		Result: []PushgatewayMetric{},
+	}
+	switch {
+	case len(selectors) > 0:
+		metrics, err = b.pushgateway.DeleteMetricsBySelectors(ctx, selectors, payload.DryRun)
+		if err != nil {
+			return err
 		}
-		if metric.Description != nil {
-			m.Description = *metric.Description
+	case payload.DryRun:
+		metrics, err = b.pushgateway.GetMetrics(ctx, aggregates.Query{})
+		if err != nil {
+			return err
 		}
-		if metric.TTL != nil {
-			m.TTL = *metric.TTL
+	default:
+		// series pushed concurrently can be deleted without being counted
+		usage, err := b.pushgateway.Usage(ctx)
+		if err != nil {
+			return err
 		}
-		if metric.Type != nil {
-			m.Type = *metric.Type
+		err = b.pushgateway.DeleteAllPushgatewayMetrics(ctx)
+		if err != nil {
+			return err
 		}
-		if metric.ExpiresAt != nil {
-			m.ExpiresAt = metric.ExpiresAt
+		output.Count = usage.Series
+		return ec.JSON(http.StatusOK, output)
+	}
+	for _, metric := range metrics {
+		output.Result = append(output.Result, toPushgatewayMetricOutput(metric))
+	}
+	output.Count = len(output.Result)
+	return ec.JSON(http.StatusOK, output)
+}
+
+func toPushgatewayMetricOutput(metric *aggregates.PushgatewayMetric) PushgatewayMetric {
+	m := PushgatewayMetric{
+		ID:        metric.ID,
+		Name:      metric.Name,
+		Labels:    metric.Labels,
+		CreatedAt: metric.CreatedAt,
+		UpdatedAt: metric.UpdatedAt,
+		Timestamp: metric.Timestamp,
+		Histogram: fromHistogram(metric.Histogram),
+		Summary:   fromSummary(metric.Summary),
+	}
+	if metric.Histogram == nil && metric.Summary == nil {
+		m.Value = pushgateway.FormatValue(metric.Value)
+	}
+	if metric.Description != nil {
+		m.Description = *metric.Description
+	}
+	if metric.TTL != nil {
+		m.TTL = *metric.TTL
+	}
+	if metric.Type != nil {
+		m.Type = *metric.Type
+	}
+	if metric.ExpiresAt != nil {
+		m.ExpiresAt = metric.ExpiresAt
+	}
+	return m
+}
+
+func (b *Builder) ListPushgatewayMetrics(ec echo.Context) error {
+	var payload ListPushgatewayMetricsInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	query := aggregates.Query{}
+	if payload.MinValue != "" {
+		value, err := parseFloat("min-value", payload.MinValue)
+		if err != nil {
+			return err
 		}
-		result = append(result, m)
+		query.MinValue = &value
+	}
+	if payload.MaxValue != "" {
+		value, err := parseFloat("max-value", payload.MaxValue)
+		if err != nil {
+			return err
+		}
+		query.MaxValue = &value
+	}
+	selectors, err := parseSelectors(payload.Match)
+	if err != nil {
+		return err
+	}
+	query.Selectors = selectors
+	metrics, err := b.pushgateway.GetMetrics(ec.Request().Context(), query)
+	if err != nil {
+		return err
+	}
+	result := []PushgatewayMetric{}
+	for _, metric := range metrics {
+		result = append(result, toPushgatewayMetricOutput(metric))
 	}
-	return ec.JSON(http.StatusOK, client.ListPushgatewayMetricsOutput{
+	return ec.JSON(http.StatusOK, ListPushgatewayMetricsOutput{
 		Result: result,
 	})
 }
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/labstack/echo/v4"
+)
+
+type MetricFamily struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type,omitempty"`
+	Help      string    `json:"help,omitempty"`
+	Unit      string    `json:"unit,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ListMetricFamiliesOutput struct {
+	Result []MetricFamily `json:"result"`
+}
+
+type GetMetricFamilyInput struct {
+	Name string `param:"name" validate:"required"`
+}
+
+type UpdateMetricFamilyInput struct {
+	Name string `param:"name" validate:"required,max=255,min=1"`
+	Type string `json:"type" description:"Type of the family, the type of the first metric written by default" validate:"omitempty,oneof=counter gauge histogram summary"`
+	Help string `json:"help" validate:"max=255"`
+	Unit string `json:"unit" description:"Unit of the family, only exposed if the name ends with it" validate:"max=255"`
+}
+
+type DeleteMetricFamilyInput struct {
+	Name string `param:"name" validate:"required"`
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func toMetricFamilyOutput(family *aggregates.MetricFamily) MetricFamily {
+	result := MetricFamily{
+		Name:      family.Name,
+		CreatedAt: family.CreatedAt,
+		UpdatedAt: family.UpdatedAt,
+	}
+	if family.Type != nil {
+		result.Type = *family.Type
+	}
+	if family.Help != nil {
+		result.Help = *family.Help
+	}
+	if family.Unit != nil {
+		result.Unit = *family.Unit
+	}
+	return result
+}
+
+func (b *Builder) ListMetricFamilies(ec echo.Context) error {
+	families, err := b.pushgateway.GetMetricFamilies(ec.Request().Context())
+	if err != nil {
+		return err
+	}
+	output := ListMetricFamiliesOutput{
+		Result: []MetricFamily{},
+	}
+	for _, family := range families {
+		output.Result = append(output.Result, toMetricFamilyOutput(family))
+	}
+	return ec.JSON(http.StatusOK, output)
+}
+
+func (b *Builder) GetMetricFamily(ec echo.Context) error {
+	var payload GetMetricFamilyInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	family, err := b.pushgateway.GetMetricFamily(ec.Request().Context(), payload.Name)
+	if err != nil {
+		return err
+	}
+	return ec.JSON(http.StatusOK, toMetricFamilyOutput(family))
+}
+
+func (b *Builder) UpdateMetricFamily(ec echo.Context) error {
+	var payload UpdateMetricFamilyInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	family := aggregates.MetricFamily{
+		Name: payload.Name,
+		Type: optionalString(payload.Type),
+		Help: optionalString(payload.Help),
+		Unit: optionalString(payload.Unit),
+	}
+	err := b.pushgateway.UpdateMetricFamily(ec.Request().Context(), family)
+	if err != nil {
+		return err
+	}
+	return ec.JSON(http.StatusOK, NewResponse("metric family updated"))
+}
+
+func (b *Builder) DeleteMetricFamily(ec echo.Context) error {
+	var payload DeleteMetricFamilyInput
+	if err := ec.Bind(&payload); err != nil {
+		return err
+	}
+	if err := ec.Validate(payload); err != nil {
+		return err
+	}
+	err := b.pushgateway.DeleteMetricFamily(ec.Request().Context(), payload.Name)
+	if err != nil {
+		return err
+	}
+	return ec.JSON(http.StatusOK, NewResponse("metric family deleted"))
+}
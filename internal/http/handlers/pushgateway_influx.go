@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// InfluxWrite receives metrics in the InfluxDB line protocol, using the
+// InfluxDB v1 (/write) or v2 (/api/v2/write) API. The precision query
+// parameter sets the timestamps precision, nanoseconds by default.
+func (b *Builder) InfluxWrite(ec echo.Context) error {
+	body, err := readMetricsBody(ec.Request(), "InfluxDB")
+	if err != nil {
+		return err
+	}
+	_, err = b.pushgateway.InfluxWrite(ec.Request().Context(), string(body), ec.QueryParam("precision"))
+	if err != nil {
+		return err
+	}
+	return ec.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	er "github.com/mcorbin/corbierror"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	protobufContentType = "application/x-protobuf"
+	jsonContentType     = "application/json"
+)
+
+// readMetricsBody reads the body of a metrics ingestion request, which can
+// be compressed with gzip
+func readMetricsBody(request *http.Request, protocol string) ([]byte, error) {
+	var reader io.Reader = request.Body
+	switch encoding := request.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(request.Body)
+		if err != nil {
+			return nil, er.Newf("fail to decompress %s request: %s", er.BadRequest, true, protocol, err.Error())
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	default:
+		return nil, er.Newf("unsupported content encoding %s, only gzip is supported", er.BadRequest, true, encoding)
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, maxMetricsRequestSize+1))
+	if err != nil {
+		return nil, er.Newf("fail to read %s request: %s", er.BadRequest, true, protocol, err.Error())
+	}
+	if len(body) > maxMetricsRequestSize {
+		return nil, er.Newf("%s request is too large", er.BadRequest, true, protocol)
+	}
+	return body, nil
+}
+
+// OTLPMetrics receives metrics exported using OTLP/HTTP, encoded in protobuf or JSON.
+// The response, including errors, uses the encoding of the request.
+func (b *Builder) OTLPMetrics(ec echo.Context) error {
+	request := ec.Request()
+	contentType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || (contentType != protobufContentType && contentType != jsonContentType) {
+		// protobuf is the default OTLP encoding
+		return otlpError(protobufContentType, er.Newf("unsupported content type %s, use %s or %s", er.BadRequest, true, request.Header.Get("Content-Type"), protobufContentType, jsonContentType))
+	}
+	response, err := b.otlpMetrics(ec, contentType)
+	if err != nil {
+		return otlpError(contentType, err)
+	}
+	data, err := encodeOTLP(contentType, response)
+	if err != nil {
+		return otlpError(contentType, fmt.Errorf("fail to encode OTLP response: %w", err))
+	}
+	return ec.Blob(http.StatusOK, contentType, data)
+}
+
+func (b *Builder) otlpMetrics(ec echo.Context, contentType string) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	request := ec.Request()
+	body, err := readMetricsBody(request, "OTLP")
+	if err != nil {
+		return nil, err
+	}
+	export := &colmetricspb.ExportMetricsServiceRequest{}
+	if contentType == protobufContentType {
+		err = proto.Unmarshal(body, export)
+	} else {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, export)
+	}
+	if err != nil {
+		return nil, er.Newf("fail to decode OTLP request: %s", er.BadRequest, true, err.Error())
+	}
+	result, err := b.pushgateway.OTLPMetrics(request.Context(), export)
+	if err != nil {
+		return nil, err
+	}
+	response := &colmetricspb.ExportMetricsServiceResponse{}
+	if result.Rejected > 0 {
+		response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: result.Rejected,
+			ErrorMessage:       strings.Join(result.Messages, "; "),
+		}
+	}
+	return response, nil
+}
+
+func encodeOTLP(contentType string, message proto.Message) ([]byte, error) {
+	if contentType == protobufContentType {
+		return proto.Marshal(message)
+	}
+	return protojson.Marshal(message)
+}
+
+// grpcCodes converts the HTTP status of the errors to gRPC codes
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// otlpError returns the error with a google.rpc.Status response body, as
+// required by OTLP/HTTP
+func otlpError(contentType string, err error) error {
+	status := http.StatusInternalServerError
+	message := "Internal error"
+	var corbiError *er.Error
+	var echoError *echo.HTTPError
+	if errors.As(err, &corbiError) {
+		var exposed er.Error
+		exposed, status = er.HTTPError(*corbiError)
+		message = strings.Join(exposed.Messages, "; ")
+	} else if errors.As(err, &echoError) {
+		status = echoError.Code
+		message = fmt.Sprintf("%v", echoError.Message)
+	}
+	code, ok := grpcCodes[status]
+	if !ok {
+		code = codes.Unknown
+	}
+	body, encodingErr := encodeOTLP(contentType, &statuspb.Status{Code: int32(code), Message: message})
+	if encodingErr != nil {
+		return fmt.Errorf("fail to encode OTLP error %s: %w", err.Error(), encodingErr)
+	}
+	return &EncodedError{
+		Err:         err,
+		Status:      status,
+		ContentType: contentType,
+		Body:        body,
+	}
+}
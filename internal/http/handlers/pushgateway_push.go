@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	er "github.com/mcorbin/corbierror"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	pushPathPrefix = "/metrics/"
+	base64Suffix   = "@base64"
+)
+
+// groupingKeyFromPath extracts the grouping key from a Pushgateway path
+// (/metrics/job/<job>{/<label>/<value>}). Label names suffixed by @base64 have
+// their value encoded in URL-safe base64.
+func groupingKeyFromPath(path string) (map[string]string, error) {
+	if !strings.HasPrefix(path, pushPathPrefix) {
+		return nil, er.Newf("invalid path %s", er.BadRequest, true, path)
+	}
+	segments := strings.Split(strings.TrimSuffix(strings.TrimPrefix(path, pushPathPrefix), "/"), "/")
+	if len(segments)%2 != 0 {
+		return nil, er.Newf("invalid path %s: labels should be passed as /<label>/<value> pairs", er.BadRequest, true, path)
+	}
+	result := make(map[string]string)
+	for i := 0; i < len(segments); i += 2 {
+		name, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return nil, er.Newf("invalid label name %s: %s", er.BadRequest, true, segments[i], err.Error())
+		}
+		value, err := url.PathUnescape(segments[i+1])
+		if err != nil {
+			return nil, er.Newf("invalid value for label %s: %s", er.BadRequest, true, name, err.Error())
+		}
+		if strings.HasSuffix(name, base64Suffix) {
+			name = strings.TrimSuffix(name, base64Suffix)
+			decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+			if err != nil {
+				return nil, er.Newf("invalid base64 value for label %s: %s", er.BadRequest, true, name, err.Error())
+			}
+			value = string(decoded)
+		}
+		if i == 0 && name != "job" {
+			return nil, er.New("the first label of the path should be job", er.BadRequest, true)
+		}
+		if _, ok := result[name]; ok {
+			return nil, er.Newf("label %s is defined multiple times in the path", er.BadRequest, true, name)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+// decodeMetricFamilies reads metrics in the text or the protobuf delimited format
+func decodeMetricFamilies(request *http.Request) ([]*dto.MetricFamily, error) {
+	decoder := expfmt.NewDecoder(request.Body, expfmt.ResponseFormat(request.Header))
+	result := []*dto.MetricFamily{}
+	for {
+		family := &dto.MetricFamily{}
+		err := decoder.Decode(family)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, er.Newf("fail to parse pushed metrics: %s", er.BadRequest, true, err.Error())
+		}
+		result = append(result, family)
+	}
+	return result, nil
+}
+
+func (b *Builder) push(ec echo.Context, replace bool) error {
+	groupingKey, err := groupingKeyFromPath(ec.Request().URL.EscapedPath())
+	if err != nil {
+		return err
+	}
+	families, err := decodeMetricFamilies(ec.Request())
+	if err != nil {
+		b.pushgateway.RecordPushFailure(ec.Request().Context(), groupingKey)
+		return err
+	}
+	err = b.pushgateway.PushMetrics(ec.Request().Context(), groupingKey, families, replace)
+	if err != nil {
+		return err
+	}
+	return ec.NoContent(http.StatusOK)
+}
+
+// PushReplaceGroup replaces all the metrics of a group (Pushgateway PUT)
+func (b *Builder) PushReplaceGroup(ec echo.Context) error {
+	return b.push(ec, true)
+}
+
+// PushMergeGroup replaces the metrics of a group with the same names as the pushed ones (Pushgateway POST)
+func (b *Builder) PushMergeGroup(ec echo.Context) error {
+	return b.push(ec, false)
+}
+
+// PushDeleteGroup deletes all the metrics of a group (Pushgateway DELETE)
+func (b *Builder) PushDeleteGroup(ec echo.Context) error {
+	groupingKey, err := groupingKeyFromPath(ec.Request().URL.EscapedPath())
+	if err != nil {
+		return err
+	}
+	err = b.pushgateway.DeleteGroup(ec.Request().Context(), groupingKey)
+	if err != nil {
+		return err
+	}
+	return ec.NoContent(http.StatusAccepted)
+}
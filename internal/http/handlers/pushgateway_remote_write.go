@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/golang/snappy"
+	"github.com/labstack/echo/v4"
+	er "github.com/mcorbin/corbierror"
+)
+
+// maxMetricsRequestSize is the maximum size of a decompressed metrics ingestion request
+const maxMetricsRequestSize = 32 * 1024 * 1024
+
+// RemoteWrite receives series using the Prometheus remote write 1.0 protocol
+// (snappy compressed protobuf)
+func (b *Builder) RemoteWrite(ec echo.Context) error {
+	request := ec.Request()
+	if encoding := request.Header.Get("Content-Encoding"); encoding != "" && encoding != "snappy" {
+		return er.Newf("unsupported content encoding %s, only snappy is supported", er.BadRequest, true, encoding)
+	}
+	compressed, err := io.ReadAll(io.LimitReader(request.Body, maxMetricsRequestSize))
+	if err != nil {
+		return fmt.Errorf("fail to read remote write request: %w", err)
+	}
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return er.Newf("fail to decompress remote write request: %s", er.BadRequest, true, err.Error())
+	}
+	if size > maxMetricsRequestSize {
+		return er.Newf("remote write request is too large (%d bytes)", er.BadRequest, true, size)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return er.Newf("fail to decompress remote write request: %s", er.BadRequest, true, err.Error())
+	}
+	_, err = b.pushgateway.RemoteWrite(request.Context(), data)
+	if err != nil {
+		return err
+	}
+	return ec.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PushgatewayLimits struct {
+	MaxSeries           uint `json:"max_series" description:"Maximum number of series, 0 if unlimited"`
+	MaxSeriesPerMetric  uint `json:"max_series_per_metric" description:"Maximum number of series per metric name, 0 if unlimited"`
+	MaxLabelsPerSeries  uint `json:"max_labels_per_series" description:"Maximum number of labels per series, 0 if unlimited"`
+	MaxLabelValueLength uint `json:"max_label_value_length" description:"Maximum length of label values, 0 if unlimited"`
+}
+
+type PushgatewayMetricUsage struct {
+	Name   string `json:"name"`
+	Series int    `json:"series"`
+}
+
+type PushgatewayUsageOutput struct {
+	Series  int                      `json:"series" description:"Total number of series"`
+	Limits  PushgatewayLimits        `json:"limits"`
+	Metrics []PushgatewayMetricUsage `json:"metrics" description:"Number of series per metric name, the largest first"`
+}
+
+func (b *Builder) PushgatewayUsage(ec echo.Context) error {
+	usage, err := b.pushgateway.Usage(ec.Request().Context())
+	if err != nil {
+		return err
+	}
+	limits := b.pushgateway.Limits()
+	output := PushgatewayUsageOutput{
+		Series: usage.Series,
+		Limits: PushgatewayLimits{
+			MaxSeries:           limits.MaxSeries,
+			MaxSeriesPerMetric:  limits.MaxSeriesPerMetric,
+			MaxLabelsPerSeries:  limits.MaxLabelsPerSeries,
+			MaxLabelValueLength: limits.MaxLabelValueLength,
+		},
+		Metrics: []PushgatewayMetricUsage{},
+	}
+	for name, series := range usage.Metrics {
+		output.Metrics = append(output.Metrics, PushgatewayMetricUsage{
+			Name:   name,
+			Series: series,
+		})
+	}
+	sort.Slice(output.Metrics, func(i, j int) bool {
+		if output.Metrics[i].Series != output.Metrics[j].Series {
+			return output.Metrics[i].Series > output.Metrics[j].Series
+		}
+		return output.Metrics[i].Name < output.Metrics[j].Name
+	})
+	return ec.JSON(http.StatusOK, output)
+}
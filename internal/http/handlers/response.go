@@ -7,3 +7,20 @@ func NewResponse(messages ...string) client.Response {
 		Messages: messages,
 	}
 }
+
+// EncodedError is an error whose response body is already encoded, for
+// the protocols defining their own error format
+type EncodedError struct {
+	Err         error
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+func (e *EncodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EncodedError) Unwrap() error {
+	return e.Err
+}
@@ -2,13 +2,18 @@ package http_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,10 +24,17 @@ import (
 	"github.com/appclacks/server/internal/database"
 	apihttp "github.com/appclacks/server/internal/http"
 	"github.com/appclacks/server/internal/http/handlers"
+	"github.com/appclacks/server/internal/reload"
 	"github.com/appclacks/server/pkg/healthcheck"
 	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/golang/snappy"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 func toJson(t *testing.T, s any) []byte {
@@ -56,6 +68,7 @@ type testCase struct {
 	payload        any
 	headers        map[string]string
 	form           map[string]string
+	rawBody        string
 	body           string
 }
 
@@ -79,6 +92,9 @@ func testHTTP(t *testing.T, c testCase, result any) {
 		}
 		reqBody = strings.NewReader(form.Encode())
 	}
+	if c.rawBody != "" {
+		reqBody = strings.NewReader(c.rawBody)
+	}
 	request, err := http.NewRequest(
 		c.method,
 		fmt.Sprintf("%s%s", baseURL, c.url),
@@ -105,6 +121,35 @@ func testHTTP(t *testing.T, c testCase, result any) {
 	}
 }
 
+// writeReloadConfig writes the configuration of the integration test
+func writeReloadConfig(t *testing.T, path string, password string, level string) {
+	t.Helper()
+	content := fmt.Sprintf(`
+http:
+  host: 127.0.0.1
+  port: 10000
+  basic-auth:
+    username: testuser
+    password: %s
+  metrics:
+    basic-auth:
+      username: metricsuser
+      password: metricsPassword
+database:
+  username: appclacks
+  password: appclacks
+  database: appclacks
+  host: 127.0.0.1
+  port: 5432
+  ssl-mode: disable
+healthchecks:
+  probers: 1
+logging:
+  level: %s
+`, password, level)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
 func TestIntegration(t *testing.T) {
 	testUser := "testuser"
 	testPassword := "testPassword"
@@ -142,12 +187,18 @@ func TestIntegration(t *testing.T) {
 	logger := slog.Default()
 	store, err := database.New(logger, config.Database, config.Healthchecks.Probers)
 	assert.NoError(t, err)
-	healthcheckService := healthcheck.New(logger, store)
+	healthcheckService, err := healthcheck.New(logger, store, reg)
+	assert.NoError(t, err)
 	pushgatewayService, err := pushgateway.New(logger, store, reg)
 	assert.NoError(t, err)
-	handlersBuilder := handlers.NewBuilder(healthcheckService, pushgatewayService)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloadConfig(t, configPath, testPassword, "info")
+	level := new(slog.LevelVar)
+	reloader := reload.New(logger, configPath, &config, level, slog.LevelInfo, store, healthcheckService, pushgatewayService)
+	handlersBuilder := handlers.NewBuilder(healthcheckService, pushgatewayService, reloader)
 	server, err := apihttp.NewServer(logger, config.HTTP, reg, handlersBuilder)
 	assert.NoError(t, err)
+	reloader.SetServer(server)
 	_, err = store.Exec("truncate healthcheck cascade;")
 	assert.NoError(t, err)
 
@@ -389,6 +440,50 @@ func TestIntegration(t *testing.T) {
 	assert.Equal(t, true, tcpResult.Enabled)
 	assert.NotEqual(t, "", tcpResult.ID)
 
+	// prometheus http service discovery
+	httpSDCase := testCase{
+		url:            fmt.Sprintf("/api/v1/prometheus/http-sd?type=tcp&labels=%s", url.QueryEscape("foo=bar")),
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	targetGroups := []handlers.PrometheusTargetGroup{}
+	testHTTP(t, httpSDCase, &targetGroups)
+	assert.Equal(t, []handlers.PrometheusTargetGroup{
+		{
+			Targets: []string{"mcorbin.fr:443"},
+			Labels: map[string]string{
+				"__meta_appclacks_id":        tcpResult.ID,
+				"__meta_appclacks_name":      "tcp3",
+				"__meta_appclacks_type":      "tcp",
+				"__meta_appclacks_interval":  "100s",
+				"__meta_appclacks_timeout":   "3s",
+				"__meta_appclacks_label_foo": "bar",
+			},
+		},
+	}, targetGroups)
+	httpSDCase.expectedStatus = 400
+	httpSDCase.url = "/api/v1/prometheus/http-sd?type=unknown"
+	testHTTP(t, httpSDCase, nil)
+	// DNS healthchecks can't be probed by the blackbox exporter
+	httpSDCase.url = "/api/v1/prometheus/http-sd?type=dns"
+	testHTTP(t, httpSDCase, nil)
+
+	// no healthchecks directory configured
+	filesCase := testCase{
+		url:            "/api/v1/healthcheck/files",
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	files := handlers.ListHealthcheckFilesOutput{}
+	testHTTP(t, filesCase, &files)
+	assert.Empty(t, files.Result)
+
 	tcpUpdateInput := client.UpdateTCPHealthcheckInput{
 		ID:          tcpResult.ID,
 		Timeout:     "3s",
@@ -615,6 +710,148 @@ func TestIntegration(t *testing.T) {
 	assert.Equal(t, false, commandUpdateResult.Enabled)
 	assert.NotEqual(t, "", commandUpdateResult.ID)
 
+	// heartbeat
+
+	heartbeatInput := handlers.CreateHeartbeatHealthcheckInput{
+		Name:    "backup",
+		Enabled: true,
+		HealthcheckHeartbeatDefinition: handlers.HealthcheckHeartbeatDefinition{
+			Schedule: "0 2 * * *",
+			Timezone: "Europe/Paris",
+			Grace:    "30m",
+		},
+	}
+	createHeartbeatCase := testCase{
+		url:            "/api/v1/healthcheck/heartbeat",
+		expectedStatus: 200,
+		payload:        heartbeatInput,
+		method:         "POST",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	heartbeatResult := client.Healthcheck{}
+	testHTTP(t, createHeartbeatCase, &heartbeatResult)
+	assert.Equal(t, "heartbeat", heartbeatResult.Type)
+	assert.NotEqual(t, "", heartbeatResult.ID)
+
+	createHeartbeatCase.payload = handlers.CreateHeartbeatHealthcheckInput{
+		Name: "invalid-heartbeat",
+		HealthcheckHeartbeatDefinition: handlers.HealthcheckHeartbeatDefinition{
+			Period: "10s",
+		},
+	}
+	createHeartbeatCase.expectedStatus = 400
+	createHeartbeatCase.body = "the minimum heartbeat period is 1 minute"
+	testHTTP(t, createHeartbeatCase, nil)
+
+	heartbeatCase := testCase{
+		url:            "/api/v1/heartbeat/backup/start",
+		expectedStatus: 200,
+		method:         "POST",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	testHTTP(t, heartbeatCase, nil)
+	heartbeatCase.url = fmt.Sprintf("/api/v1/heartbeat/%s", heartbeatResult.ID)
+	testHTTP(t, heartbeatCase, nil)
+
+	getHeartbeatCase := testCase{
+		url:            "/api/v1/heartbeat/backup",
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	heartbeatState := handlers.HeartbeatState{}
+	testHTTP(t, getHeartbeatCase, &heartbeatState)
+	assert.Equal(t, "up", heartbeatState.Status)
+	assert.NotNil(t, heartbeatState.LastPingAt)
+	assert.NotNil(t, heartbeatState.LastDuration)
+	assert.NotNil(t, heartbeatState.Deadline)
+
+	heartbeatCase.url = "/api/v1/heartbeat/backup/fail"
+	heartbeatCase.payload = handlers.HeartbeatInput{Message: "disk full"}
+	testHTTP(t, heartbeatCase, nil)
+	heartbeatState = handlers.HeartbeatState{}
+	testHTTP(t, getHeartbeatCase, &heartbeatState)
+	assert.Equal(t, "down", heartbeatState.Status)
+	assert.Equal(t, "disk full", heartbeatState.Message)
+
+	// only heartbeat checks can be pinged
+	heartbeatCase.url = fmt.Sprintf("/api/v1/heartbeat/%s", commandResult.ID)
+	heartbeatCase.payload = nil
+	heartbeatCase.expectedStatus = 400
+	testHTTP(t, heartbeatCase, nil)
+
+	updateHeartbeatCase := testCase{
+		url:            fmt.Sprintf("/api/v1/healthcheck/heartbeat/%s", heartbeatResult.ID),
+		expectedStatus: 200,
+		payload: handlers.UpdateHeartbeatHealthcheckInput{
+			Name:    "backup",
+			Enabled: true,
+			HealthcheckHeartbeatDefinition: handlers.HealthcheckHeartbeatDefinition{
+				Period: "1h",
+			},
+		},
+		method: "PUT",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	testHTTP(t, updateHeartbeatCase, nil)
+	updateHeartbeatCase.url = fmt.Sprintf("/api/v1/healthcheck/heartbeat/%s", commandResult.ID)
+	updateHeartbeatCase.expectedStatus = 400
+	testHTTP(t, updateHeartbeatCase, nil)
+
+	// probe
+
+	createProbeCheckCase := testCase{
+		url:            "/api/v1/healthcheck/http",
+		expectedStatus: 200,
+		payload: client.CreateHTTPHealthcheckInput{
+			Name:     "probe-self",
+			Enabled:  true,
+			Interval: "60s",
+			Timeout:  "5s",
+			HealthcheckHTTPDefinition: client.HealthcheckHTTPDefinition{
+				ValidStatus: []uint{200},
+				Target:      "127.0.0.1",
+				Method:      "GET",
+				Port:        10000,
+				Protocol:    "http",
+				Path:        "/healthz",
+			},
+		},
+		method: "POST",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	testHTTP(t, createProbeCheckCase, nil)
+	probeCase := testCase{
+		url:            "/probe?module=http&target=probe-self",
+		expectedStatus: 200,
+		method:         "GET",
+		body:           "probe_success 1",
+		headers: map[string]string{
+			"Authorization": basicAuth(metricsUser, metricsPassword),
+		},
+	}
+	testHTTP(t, probeCase, nil)
+	probeCase.body = "probe_http_status_code 200"
+	testHTTP(t, probeCase, nil)
+	probeCase.url = "/probe?target=backup"
+	probeCase.expectedStatus = 400
+	probeCase.body = "heartbeat healthchecks can't be probed"
+	testHTTP(t, probeCase, nil)
+	probeCase.url = "/probe?target=unknown"
+	probeCase.expectedStatus = 404
+	probeCase.body = ""
+	testHTTP(t, probeCase, nil)
+
 	// metrics
 
 	getHealthcheckCase = testCase{
@@ -794,6 +1031,598 @@ func TestIntegration(t *testing.T) {
 	}, &listMetricsResult)
 	assert.Len(t, listMetricsResult.Result, 0)
 
+	// push metrics using the Prometheus pushgateway protocol
+
+	testHTTP(t, testCase{
+		url:            "/metrics/job/backup/instance@base64/aG9zdC8x",
+		expectedStatus: 200,
+		method:         "PUT",
+		rawBody: `# HELP backup_duration_seconds Backup duration
+# TYPE backup_duration_seconds gauge
+backup_duration_seconds{db="users"} 12.5
+backup_duration_seconds{db="orders"} 20
+# TYPE backup_success counter
+backup_success{job="ignored"} 3
+`,
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 3)
+	for _, metric := range listMetricsResult.Result {
+		assert.Equal(t, "backup", metric.Labels["job"])
+		assert.Equal(t, "host/1", metric.Labels["instance"])
+	}
+
+	// POST only replaces metrics with the same name
+	testHTTP(t, testCase{
+		url:            "/metrics/job/backup/instance@base64/aG9zdC8x",
+		expectedStatus: 200,
+		method:         "POST",
+		rawBody:        "backup_success 4\n",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 3)
+
+	// PUT replaces the whole group
+	testHTTP(t, testCase{
+		url:            "/metrics/job/backup/instance@base64/aG9zdC8x",
+		expectedStatus: 200,
+		method:         "PUT",
+		rawBody:        "backup_success 5\n",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 1)
+	assert.Equal(t, "5", listMetricsResult.Result[0].Value)
+
+	// failed pushes are recorded in the group push times
+	testHTTP(t, testCase{
+		url:            "/metrics/job/backup/instance@base64/aG9zdC8x",
+		expectedStatus: 400,
+		method:         "PUT",
+		rawBody:        "backup_success{ 5\n",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/pushgateway/metrics",
+		expectedStatus: 200,
+		method:         "GET",
+		body:           `push_time_seconds{instance="host/1",job="backup"}`,
+		headers: map[string]string{
+			"Authorization": basicAuth(metricsUser, metricsPassword),
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/pushgateway/metrics",
+		expectedStatus: 200,
+		method:         "GET",
+		body:           `push_failure_time_seconds{instance="host/1",job="backup"} 1.`,
+		headers: map[string]string{
+			"Authorization": basicAuth(metricsUser, metricsPassword),
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/pushgateway/metrics?match[]=" + url.QueryEscape(`push_time_seconds{job="backup"}`),
+		expectedStatus: 200,
+		method:         "GET",
+		body:           `push_time_seconds{instance="host/1",job="backup"}`,
+		headers: map[string]string{
+			"Authorization": basicAuth(metricsUser, metricsPassword),
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/pushgateway/metrics?match[]=" + url.QueryEscape(`{job=~"("}`),
+		expectedStatus: 400,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(metricsUser, metricsPassword),
+		},
+	}, nil)
+
+	testHTTP(t, testCase{
+		url:            "/metrics/job/backup/instance",
+		expectedStatus: 400,
+		method:         "PUT",
+		rawBody:        "backup_success 5\n",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/metrics/job/backup/instance@base64/aG9zdC8x",
+		expectedStatus: 401,
+		method:         "DELETE",
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/metrics/job/backup/instance@base64/aG9zdC8x",
+		expectedStatus: 202,
+		method:         "DELETE",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 0)
+
+	// prometheus remote write
+
+	deleteAllMetricsCase := testCase{
+		url:            "/api/v1/pushgateway?confirm=true",
+		expectedStatus: 200,
+		method:         "DELETE",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+
+	label := func(name string, value string) []byte {
+		b := protowire.AppendTag(nil, 1, protowire.BytesType)
+		b = protowire.AppendString(b, name)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		return protowire.AppendString(b, value)
+	}
+	sample := protowire.AppendTag(nil, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(20.5))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(time.Now().UnixMilli()))
+	series := protowire.AppendTag(nil, 1, protowire.BytesType)
+	series = protowire.AppendBytes(series, label("__name__", "edge_temperature"))
+	series = protowire.AppendTag(series, 1, protowire.BytesType)
+	series = protowire.AppendBytes(series, label("site", "paris"))
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+	writeRequest := protowire.AppendTag(nil, 1, protowire.BytesType)
+	writeRequest = protowire.AppendBytes(writeRequest, series)
+	testHTTP(t, testCase{
+		url:            "/api/v1/write",
+		expectedStatus: 204,
+		method:         "POST",
+		rawBody:        string(snappy.Encode(nil, writeRequest)),
+		headers: map[string]string{
+			"Authorization":    basicAuth(testUser, testPassword),
+			"Content-Encoding": "snappy",
+			"Content-Type":     "application/x-protobuf",
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/api/v1/write",
+		expectedStatus: 400,
+		method:         "POST",
+		rawBody:        "not snappy",
+		headers: map[string]string{
+			"Authorization":    basicAuth(testUser, testPassword),
+			"Content-Encoding": "snappy",
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 1)
+	assert.Equal(t, "edge_temperature", listMetricsResult.Result[0].Name)
+	assert.Equal(t, "20.5", listMetricsResult.Result[0].Value)
+	assert.Equal(t, map[string]string{"site": "paris"}, listMetricsResult.Result[0].Labels)
+	testHTTP(t, deleteAllMetricsCase, nil)
+
+	// opentelemetry metrics
+
+	testHTTP(t, testCase{
+		url:            "/v1/metrics",
+		expectedStatus: 200,
+		method:         "POST",
+		rawBody:        `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"batch"}}]},"scopeMetrics":[{"metrics":[{"name":"jobs.processed","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asInt":"42"}]}},{"name":"jobs.errors","sum":{"aggregationTemporality":1,"isMonotonic":true,"dataPoints":[{"asInt":"1"}]}}]}]}]}`,
+		body:           "rejectedDataPoints",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+			"Content-Type":  "application/json",
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/v1/metrics",
+		expectedStatus: 400,
+		method:         "POST",
+		rawBody:        `{"resourceMetrics":`,
+		// the errors are google.rpc.Status messages
+		body: "fail to decode OTLP request",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+			"Content-Type":  "application/json",
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 1)
+	assert.Equal(t, "jobs_processed_total", listMetricsResult.Result[0].Name)
+	assert.Equal(t, "42", listMetricsResult.Result[0].Value)
+	assert.Equal(t, map[string]string{"job": "batch"}, listMetricsResult.Result[0].Labels)
+	testHTTP(t, deleteAllMetricsCase, nil)
+
+	// influxdb line protocol
+
+	testHTTP(t, testCase{
+		url:            "/api/v2/write?precision=s",
+		expectedStatus: 204,
+		method:         "POST",
+		rawBody:        "sensor,room=kitchen temperature=21.5,humidity=40i 1700000000\n",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/write",
+		expectedStatus: 400,
+		method:         "POST",
+		rawBody:        "sensor,room=kitchen temperature=21.5\nsensor temperature=abc\n",
+		body:           "line 2: field temperature: invalid float abc",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 2)
+	for _, metric := range listMetricsResult.Result {
+		assert.Equal(t, map[string]string{"room": "kitchen"}, metric.Labels)
+	}
+	testHTTP(t, deleteAllMetricsCase, nil)
+
+	// cardinality limits
+
+	pushgatewayService.SetLimits(pushgateway.Limits{MaxSeriesPerMetric: 2})
+	for i, status := range []int{200, 200, 400} {
+		testHTTP(t, testCase{
+			url:            "/api/v1/pushgateway",
+			expectedStatus: status,
+			method:         "POST",
+			payload: handlers.CreateOrUpdatePushgatewayMetricInput{
+				Name:   "requests_total",
+				Labels: map[string]string{"request_id": fmt.Sprintf("%d", i)},
+				Value:  "1",
+			},
+			headers: map[string]string{
+				"Authorization": basicAuth(testUser, testPassword),
+			},
+		}, nil)
+	}
+	usageResult := handlers.PushgatewayUsageOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/usage",
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &usageResult)
+	assert.Equal(t, 2, usageResult.Series)
+	assert.Equal(t, uint(2), usageResult.Limits.MaxSeriesPerMetric)
+	assert.Equal(t, []handlers.PushgatewayMetricUsage{{Name: "requests_total", Series: 2}}, usageResult.Metrics)
+	pushgatewayService.SetLimits(pushgateway.Limits{})
+	testHTTP(t, deleteAllMetricsCase, nil)
+
+	// increment counters and gauges
+
+	incrementInput := handlers.IncrementPushgatewayMetricInput{
+		Name:   "records_processed_total",
+		Labels: map[string]string{"worker": "shared"},
+		Value:  "2",
+	}
+	incrementResult := handlers.PushgatewayMetric{}
+	for i := 0; i < 2; i++ {
+		incrementResult = handlers.PushgatewayMetric{}
+		testHTTP(t, testCase{
+			url:            "/api/v1/pushgateway/increment",
+			expectedStatus: 200,
+			method:         "POST",
+			payload:        incrementInput,
+			headers: map[string]string{
+				"Authorization": basicAuth(testUser, testPassword),
+			},
+		}, &incrementResult)
+	}
+	assert.Equal(t, "4", incrementResult.Value)
+	assert.Equal(t, "counter", incrementResult.Type)
+
+	incrementInput.Value = "-1"
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/increment",
+		expectedStatus: 400,
+		method:         "POST",
+		payload:        incrementInput,
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	// the metric is a counter
+	incrementInput.Type = "gauge"
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/increment",
+		expectedStatus: 400,
+		method:         "POST",
+		payload:        incrementInput,
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+
+	incrementInput.Name = "queue_size"
+	incrementResult = handlers.PushgatewayMetric{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/increment",
+		expectedStatus: 200,
+		method:         "POST",
+		payload:        incrementInput,
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &incrementResult)
+	assert.Equal(t, "-1", incrementResult.Value)
+	assert.Equal(t, "gauge", incrementResult.Type)
+
+	// metric families
+
+	familyResult := handlers.MetricFamily{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/families/records_processed_total",
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &familyResult)
+	assert.Equal(t, "counter", familyResult.Type)
+	queueSizeCase := testCase{
+		url:            "/api/v1/pushgateway",
+		expectedStatus: 400,
+		method:         "POST",
+		body:           "metric queue_size has type counter but its family is registered as gauge",
+		payload: handlers.CreateOrUpdatePushgatewayMetricInput{
+			Name:  "queue_size",
+			Type:  "counter",
+			Value: "1",
+		},
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	testHTTP(t, queueSizeCase, nil)
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/families/queue_size",
+		expectedStatus: 200,
+		method:         "PUT",
+		payload: handlers.UpdateMetricFamilyInput{
+			Type: "counter",
+			Help: "Number of queued jobs",
+		},
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	queueSizeCase.expectedStatus = 200
+	queueSizeCase.body = ""
+	testHTTP(t, queueSizeCase, nil)
+	familiesResult := handlers.ListMetricFamiliesOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/families",
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &familiesResult)
+	help := ""
+	for _, family := range familiesResult.Result {
+		if family.Name == "queue_size" {
+			help = family.Help
+		}
+	}
+	assert.Equal(t, "Number of queued jobs", help)
+	deleteFamilyCase := testCase{
+		url:            "/api/v1/pushgateway/families/queue_size",
+		expectedStatus: 200,
+		method:         "DELETE",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}
+	testHTTP(t, deleteFamilyCase, nil)
+	deleteFamilyCase.expectedStatus = 404
+	testHTTP(t, deleteFamilyCase, nil)
+
+	testHTTP(t, deleteAllMetricsCase, nil)
+
+	// batch
+
+	batchInput := handlers.BatchPushgatewayMetricsInput{
+		Labels: map[string]string{"job": "reporter"},
+		TTL:    "1h",
+		Type:   "gauge",
+		Metrics: []handlers.BatchPushgatewayMetric{
+			{Name: "records_total", Type: "counter", Value: "200"},
+			{Name: "duration_seconds", Value: "12.5", Labels: map[string]string{"step": "export"}},
+			{Name: "duration_seconds", Value: "3", Labels: map[string]string{"step": "import"}},
+		},
+	}
+	batchResult := handlers.BatchPushgatewayMetricsOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/batch",
+		expectedStatus: 200,
+		method:         "POST",
+		payload:        batchInput,
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &batchResult)
+	assert.Len(t, batchResult.Result, 3)
+	for _, result := range batchResult.Result {
+		assert.True(t, result.Created)
+		assert.Equal(t, "reporter", result.Labels["job"])
+	}
+
+	batchInput.Metrics[0].Value = "250"
+	batchResult = handlers.BatchPushgatewayMetricsOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/batch",
+		expectedStatus: 200,
+		method:         "POST",
+		payload:        batchInput,
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &batchResult)
+	assert.Len(t, batchResult.Result, 3)
+	assert.False(t, batchResult.Result[0].Created)
+
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 3)
+
+	// filter by value
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?min-value=10&max-value=250",
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 2)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?match[]=" + url.QueryEscape(`duration_seconds{step=~"exp.*"}`) + "&match[]=" + url.QueryEscape(`{__name__="records_total"}`),
+		expectedStatus: 200,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 2)
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?match[]=" + url.QueryEscape(`{step=""}`),
+		expectedStatus: 400,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?min-value=abc",
+		expectedStatus: 400,
+		method:         "GET",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+
+	// nothing is written if a metric is invalid
+	batchInput.Metrics = append(batchInput.Metrics, handlers.BatchPushgatewayMetric{Name: "invalid", Value: "abc"})
+	batchInput.Metrics[0].Name = "new_metric"
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway/batch",
+		expectedStatus: 400,
+		method:         "POST",
+		payload:        batchInput,
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 3)
+
+	// delete by selectors
+	deleteResult := handlers.DeletePushgatewayMetricsOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?dry-run=true&match[]=duration_seconds",
+		expectedStatus: 200,
+		method:         "DELETE",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &deleteResult)
+	assert.True(t, deleteResult.DryRun)
+	assert.Equal(t, 2, deleteResult.Count)
+	assert.Len(t, deleteResult.Result, 2)
+	// selectors can match all metrics
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?match[]=" + url.QueryEscape(`{__name__=~".+"}`),
+		expectedStatus: 400,
+		body:           "requires the confirm parameter",
+		method:         "DELETE",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, nil)
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 3)
+	deleteResult = handlers.DeletePushgatewayMetricsOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?confirm=true&match[]=" + url.QueryEscape(`duration_seconds{step="import"}`),
+		expectedStatus: 200,
+		method:         "DELETE",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &deleteResult)
+	assert.False(t, deleteResult.DryRun)
+	assert.Equal(t, 1, deleteResult.Count)
+	assert.Equal(t, "import", deleteResult.Result[0].Labels["step"])
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 2)
+	// a regex only selector doesn't block the pushes of other label sets
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			testHTTP(t, testCase{
+				url:            "/api/v1/pushgateway/batch",
+				expectedStatus: 200,
+				method:         "POST",
+				payload: handlers.BatchPushgatewayMetricsInput{
+					Labels: map[string]string{"job": "reporter"},
+					Metrics: []handlers.BatchPushgatewayMetric{
+						{Name: "queued_total", Value: "1", Labels: map[string]string{"queue": fmt.Sprintf("q%d", i)}},
+					},
+				},
+				headers: map[string]string{
+					"Authorization": basicAuth(testUser, testPassword),
+				},
+			}, nil)
+		}(i)
+	}
+	deleteResult = handlers.DeletePushgatewayMetricsOutput{}
+	testHTTP(t, testCase{
+		url:            "/api/v1/pushgateway?confirm=true&match[]=" + url.QueryEscape(`{step=~"exp.*"}`),
+		expectedStatus: 200,
+		method:         "DELETE",
+		headers: map[string]string{
+			"Authorization": basicAuth(testUser, testPassword),
+		},
+	}, &deleteResult)
+	wg.Wait()
+	assert.Equal(t, 1, deleteResult.Count)
+	assert.Equal(t, "export", deleteResult.Result[0].Labels["step"])
+	listMetricsResult = client.ListPushgatewayMetricsOutput{}
+	testHTTP(t, listMetricsCase, &listMetricsResult)
+	assert.Len(t, listMetricsResult.Result, 6)
+
+	testHTTP(t, deleteAllMetricsCase, nil)
+
 	cases := []testCase{
 		{
 			url:            "/healthz",
@@ -870,8 +1699,17 @@ func TestIntegration(t *testing.T) {
 		},
 		{
 			url:            "/api/v1/pushgateway",
+			expectedStatus: 400,
+			body:           "requires the confirm parameter",
+			method:         "DELETE",
+			headers: map[string]string{
+				"Authorization": basicAuth(testUser, testPassword),
+			},
+		},
+		{
+			url:            "/api/v1/pushgateway?confirm=true",
 			expectedStatus: 200,
-			body:           "metrics deleted",
+			body:           `"dry_run":false`,
 			method:         "DELETE",
 			headers: map[string]string{
 				"Authorization": basicAuth(testUser, testPassword),
@@ -882,4 +1720,109 @@ func TestIntegration(t *testing.T) {
 		testHTTP(t, c, nil)
 	}
 
+	// configuration reload
+
+	reloadCase := func(password string, status int, body string) testCase {
+		return testCase{
+			url:            "/api/v1/admin/reload",
+			expectedStatus: status,
+			body:           body,
+			method:         "POST",
+			headers: map[string]string{
+				"Authorization": basicAuth(testUser, password),
+			},
+		}
+	}
+	// an invalid configuration is not applied at all
+	writeReloadConfig(t, configPath, "newPassword", "trace")
+	testHTTP(t, reloadCase(testPassword, 400, "fail to reload the configuration"), nil)
+	assert.Equal(t, slog.LevelInfo, level.Level())
+	writeReloadConfig(t, configPath, "newPassword", "debug")
+	reloadResult := handlers.ReloadConfigurationOutput{}
+	testHTTP(t, reloadCase(testPassword, 200, ""), &reloadResult)
+	assert.Equal(t, []string{"logging.level", "http.basic-auth"}, reloadResult.Applied)
+	assert.Empty(t, reloadResult.Ignored)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+	testHTTP(t, reloadCase(testPassword, 401, ""), nil)
+	testHTTP(t, reloadCase("newPassword", 200, `"applied":[]`), nil)
+}
+
+// fakeReloader is a reloader which doesn't apply anything
+type fakeReloader struct{}
+
+func (f *fakeReloader) Reload(ctx context.Context) ([]string, []string, error) {
+	return []string{}, []string{}, nil
+}
+
+func TestReloadWithoutBasicAuth(t *testing.T) {
+	config := apihttp.Configuration{
+		Host: "127.0.0.1",
+		Port: 10001,
+	}
+	handlersBuilder := handlers.NewBuilder(nil, nil, &fakeReloader{})
+	server, err := apihttp.NewServer(slog.Default(), config, prometheus.NewRegistry(), handlersBuilder)
+	assert.NoError(t, err)
+	err = server.Start()
+	assert.NoError(t, err)
+	defer server.Stop() //nolint
+	time.Sleep(1 * time.Second)
+
+	reload := func(headers map[string]string) int {
+		request, err := http.NewRequest("POST", "http://127.0.0.1:10001/api/v1/admin/reload", nil)
+		assert.NoError(t, err)
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		response, err := httpClient.Do(request)
+		assert.NoError(t, err)
+		readBody(t, response.Body)
+		return response.StatusCode
+	}
+	// the configuration can't be reloaded by anyone when the API is open
+	assert.Equal(t, 403, reload(nil))
+
+	// the credentials can be defined by a reload from the configuration file
+	server.UpdateCredentials(apihttp.BasicAuth{Username: "admin", Password: "secret"}, apihttp.BasicAuth{})
+	assert.Equal(t, 401, reload(nil))
+	assert.Equal(t, 200, reload(map[string]string{"Authorization": basicAuth("admin", "secret")}))
+}
+
+func TestOTLPErrors(t *testing.T) {
+	config := apihttp.Configuration{
+		Host: "127.0.0.1",
+		Port: 10002,
+	}
+	handlersBuilder := handlers.NewBuilder(nil, nil, &fakeReloader{})
+	server, err := apihttp.NewServer(slog.Default(), config, prometheus.NewRegistry(), handlersBuilder)
+	assert.NoError(t, err)
+	err = server.Start()
+	assert.NoError(t, err)
+	defer server.Stop() //nolint
+	time.Sleep(1 * time.Second)
+
+	export := func(contentType string, body string) (*statuspb.Status, string) {
+		response, err := httpClient.Post("http://127.0.0.1:10002/v1/metrics", contentType, strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, 400, response.StatusCode)
+		data := readBody(t, response.Body)
+		status := &statuspb.Status{}
+		if response.Header.Get("Content-Type") == "application/json" {
+			assert.NoError(t, protojson.Unmarshal(data, status))
+		} else {
+			assert.NoError(t, proto.Unmarshal(data, status))
+		}
+		return status, response.Header.Get("Content-Type")
+	}
+	// the errors use the encoding of the request
+	status, contentType := export("application/json", `{"resourceMetrics":`)
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, int32(codes.InvalidArgument), status.Code)
+	assert.Contains(t, status.Message, "fail to decode OTLP request")
+	status, contentType = export("application/x-protobuf", "invalid")
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assert.Equal(t, int32(codes.InvalidArgument), status.Code)
+	assert.Contains(t, status.Message, "fail to decode OTLP request")
+	status, contentType = export("text/plain", "")
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assert.Contains(t, status.Message, "unsupported content type")
 }
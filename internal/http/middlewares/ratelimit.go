@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// PrincipalContextKey is the echo context key containing the
+// authenticated user, if any
+const PrincipalContextKey = "principal"
+
+const visitorExpiration = 3 * time.Minute
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter limits requests using a token bucket per authenticated
+// principal, or per client IP for anonymous requests
+type RateLimiter struct {
+	bucket      string
+	limit       rate.Limit
+	burst       int
+	lock        sync.Mutex
+	visitors    map[string]*visitor
+	lastCleanup time.Time
+	counter     *prometheus.CounterVec
+}
+
+func NewRateLimiter(bucket string, requestsPerSecond float64, burst int, counter *prometheus.CounterVec) *RateLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(requestsPerSecond)))
+	}
+	return &RateLimiter{
+		bucket:      bucket,
+		limit:       rate.Limit(requestsPerSecond),
+		burst:       burst,
+		visitors:    make(map[string]*visitor),
+		lastCleanup: time.Now(),
+		counter:     counter,
+	}
+}
+
+// IPExtractor returns the client IP extractor. The X-Forwarded-For header
+// is only used for requests coming from the trusted proxies, otherwise any
+// client could choose its rate limiting bucket.
+func IPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range trustedProxies {
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+func requestKey(context echo.Context) string {
+	principal, ok := context.Get(PrincipalContextKey).(string)
+	if ok && principal != "" {
+		return "principal:" + principal
+	}
+	return "ip:" + context.RealIP()
+}
+
+// reserve returns how long the caller should wait before its request is allowed
+func (r *RateLimiter) reserve(key string, now time.Time) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if now.Sub(r.lastCleanup) > visitorExpiration {
+		for k, v := range r.visitors {
+			if now.Sub(v.lastSeen) > visitorExpiration {
+				delete(r.visitors, k)
+			}
+		}
+		r.lastCleanup = now
+	}
+	v, ok := r.visitors[key]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(r.limit, r.burst)}
+		r.visitors[key] = v
+	}
+	v.lastSeen = now
+	reservation := v.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		// the request is rejected, give the token back
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+func (r *RateLimiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			delay := r.reserve(requestKey(context), time.Now())
+			if delay <= 0 {
+				return next(context)
+			}
+			r.counter.With(prometheus.Labels{"bucket": r.bucket}).Inc()
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			context.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+			// the response is written here so throttled requests
+			// are not logged by the error handler
+			return context.JSON(http.StatusTooManyRequests, er.Error{
+				Messages: []string{fmt.Sprintf("too many requests, retry in %d seconds", retryAfter)},
+			})
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appclacks/server/internal/http/middlewares"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "test_rate_limited_total",
+		},
+		[]string{"bucket"})
+	limiter := middlewares.NewRateLimiter("pushgateway", 0.1, 2, counter)
+	e := echo.New()
+	handler := limiter.Middleware()(func(ec echo.Context) error {
+		return ec.String(http.StatusOK, "ok")
+	})
+
+	call := func(ip string, principal string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/pushgateway", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		ec := e.NewContext(req, rec)
+		if principal != "" {
+			ec.Set(middlewares.PrincipalContextKey, principal)
+		}
+		err := handler(ec)
+		assert.NoError(t, err)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, call("10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusOK, call("10.0.0.1", "").Code)
+	rec := call("10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	// other clients have their own bucket
+	assert.Equal(t, http.StatusOK, call("10.0.0.2", "").Code)
+	assert.Equal(t, http.StatusOK, call("10.0.0.1", "user").Code)
+
+	metric := &dto.Metric{}
+	err := counter.WithLabelValues("pushgateway").Write(metric)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), metric.GetCounter().GetValue())
+}
+
+func TestRateLimiterForwardedFor(t *testing.T) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "test_rate_limited_total",
+		},
+		[]string{"bucket"})
+	limiter := middlewares.NewRateLimiter("pushgateway", 0.1, 1, counter)
+	handler := limiter.Middleware()(func(ec echo.Context) error {
+		return ec.String(http.StatusOK, "ok")
+	})
+
+	call := func(e *echo.Echo, ip string, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/pushgateway", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+		rec := httptest.NewRecorder()
+		err := handler(e.NewContext(req, rec))
+		assert.NoError(t, err)
+		return rec.Code
+	}
+
+	// spoofed headers share the bucket of the client
+	e := echo.New()
+	extractor, err := middlewares.IPExtractor(nil)
+	assert.NoError(t, err)
+	e.IPExtractor = extractor
+	assert.Equal(t, http.StatusOK, call(e, "10.0.0.1", "1.1.1.1"))
+	assert.Equal(t, http.StatusTooManyRequests, call(e, "10.0.0.1", "2.2.2.2"))
+
+	// the header is used for requests coming from a trusted proxy
+	extractor, err = middlewares.IPExtractor([]string{"10.0.1.0/24"})
+	assert.NoError(t, err)
+	e.IPExtractor = extractor
+	assert.Equal(t, http.StatusOK, call(e, "10.0.1.1", "3.3.3.3"))
+	assert.Equal(t, http.StatusOK, call(e, "10.0.1.1", "4.4.4.4"))
+	assert.Equal(t, http.StatusTooManyRequests, call(e, "10.0.1.2", "4.4.4.4"))
+	// but not for the other clients
+	assert.Equal(t, http.StatusOK, call(e, "10.0.0.2", "5.5.5.5"))
+	assert.Equal(t, http.StatusTooManyRequests, call(e, "10.0.0.2", "6.6.6.6"))
+
+	_, err = middlewares.IPExtractor([]string{"foo"})
+	assert.ErrorContains(t, err, "invalid trusted proxy foo")
+}
@@ -0,0 +1,258 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/appclacks/go-client"
+	"github.com/appclacks/server/internal/http/handlers"
+	"github.com/appclacks/server/internal/http/openapi"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tagHealthcheck = "healthcheck"
+	tagPushgateway = "pushgateway"
+	tagAdmin       = "admin"
+)
+
+// routes documents the API routes, indexed by "METHOD path"
+var routes = map[string]openapi.Route{
+	"POST /api/v1/healthcheck/dns": {
+		Summary: "Create a DNS healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.CreateDNSHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"PUT /api/v1/healthcheck/dns/:id": {
+		Summary: "Update a DNS healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.UpdateDNSHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"POST /api/v1/healthcheck/tcp": {
+		Summary: "Create a TCP healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.CreateTCPHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"PUT /api/v1/healthcheck/tcp/:id": {
+		Summary: "Update a TCP healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.UpdateTCPHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"POST /api/v1/healthcheck/http": {
+		Summary: "Create an HTTP healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.CreateHTTPHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"PUT /api/v1/healthcheck/http/:id": {
+		Summary: "Update an HTTP healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.UpdateHTTPHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"POST /api/v1/healthcheck/tls": {
+		Summary: "Create a TLS healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.CreateTLSHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"PUT /api/v1/healthcheck/tls/:id": {
+		Summary: "Update a TLS healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.UpdateTLSHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"POST /api/v1/healthcheck/command": {
+		Summary: "Create a command healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.CreateCommandHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"PUT /api/v1/healthcheck/command/:id": {
+		Summary: "Update a command healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.UpdateCommandHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"POST /api/v1/healthcheck/heartbeat": {
+		Summary: "Create a heartbeat healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   handlers.CreateHeartbeatHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"PUT /api/v1/healthcheck/heartbeat/:id": {
+		Summary: "Update a heartbeat healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   handlers.UpdateHeartbeatHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"POST /api/v1/heartbeat/:id": {
+		Summary: "Report a successful run of a job monitored by a heartbeat check",
+		Tag:     tagHealthcheck,
+		Input:   handlers.HeartbeatInput{},
+		Output:  client.Response{},
+	},
+	"POST /api/v1/heartbeat/:id/fail": {
+		Summary: "Report a failed run of a job monitored by a heartbeat check",
+		Tag:     tagHealthcheck,
+		Input:   handlers.HeartbeatInput{},
+		Output:  client.Response{},
+	},
+	"POST /api/v1/heartbeat/:id/start": {
+		Summary: "Report the start of a job monitored by a heartbeat check",
+		Tag:     tagHealthcheck,
+		Input:   handlers.HeartbeatInput{},
+		Output:  client.Response{},
+	},
+	"GET /api/v1/heartbeat/:id": {
+		Summary: "Get the state of a heartbeat check",
+		Tag:     tagHealthcheck,
+		Input:   handlers.GetHeartbeatInput{},
+		Output:  handlers.HeartbeatState{},
+	},
+	"DELETE /api/v1/healthcheck/:id": {
+		Summary: "Delete a healthcheck",
+		Tag:     tagHealthcheck,
+		Input:   client.DeleteHealthcheckInput{},
+		Output:  client.Response{},
+	},
+	"GET /api/v1/healthcheck/files": {
+		Summary: "Synchronization status of the healthchecks files",
+		Tag:     tagHealthcheck,
+		Output:  handlers.ListHealthcheckFilesOutput{},
+	},
+	"GET /api/v1/healthcheck/:identifier": {
+		Summary: "Get a healthcheck by ID or name",
+		Tag:     tagHealthcheck,
+		Input:   client.GetHealthcheckInput{},
+		Output:  client.Healthcheck{},
+	},
+	"GET /api/v1/healthcheck": {
+		Summary: "List healthchecks",
+		Tag:     tagHealthcheck,
+		Input:   client.ListHealthchecksInput{},
+		Output:  client.ListHealthchecksOutput{},
+	},
+	"GET /api/v1/cabourotte/discovery": {
+		Summary: "Healthchecks in the Cabourotte discovery format",
+		Tag:     tagHealthcheck,
+		Input:   client.CabourotteDiscoveryInput{},
+		Output:  client.CabourotteDiscoveryOutput{},
+	},
+	"GET /api/v1/prometheus/http-sd": {
+		Summary: "Enabled healthchecks in the Prometheus HTTP service discovery format, for the blackbox exporter",
+		Tag:     tagHealthcheck,
+		Input:   handlers.PrometheusHTTPSDInput{},
+		Output:  []handlers.PrometheusTargetGroup{},
+	},
+	"POST /api/v1/pushgateway": {
+		Summary: "Create or update a pushgateway metric",
+		Tag:     tagPushgateway,
+		Input:   handlers.CreateOrUpdatePushgatewayMetricInput{},
+		Output:  client.Response{},
+	},
+	"POST /api/v1/pushgateway/batch": {
+		Summary: "Create or update pushgateway metrics in a single transaction",
+		Tag:     tagPushgateway,
+		Input:   handlers.BatchPushgatewayMetricsInput{},
+		Output:  handlers.BatchPushgatewayMetricsOutput{},
+	},
+	"POST /api/v1/pushgateway/increment": {
+		Summary: "Increment a pushgateway counter or gauge",
+		Tag:     tagPushgateway,
+		Input:   handlers.IncrementPushgatewayMetricInput{},
+		Output:  handlers.PushgatewayMetric{},
+	},
+	"POST /api/v1/write": {
+		Summary: "Store the latest samples of Prometheus remote write series (snappy compressed protobuf)",
+		Tag:     tagPushgateway,
+	},
+	"DELETE /api/v1/pushgateway": {
+		Summary: "Delete pushgateway metrics matching series selectors, or all metrics",
+		Tag:     tagPushgateway,
+		Input:   handlers.DeletePushgatewayMetricsInput{},
+		Output:  handlers.DeletePushgatewayMetricsOutput{},
+	},
+	"DELETE /api/v1/pushgateway/:identifier": {
+		Summary: "Delete pushgateway metrics by ID or name",
+		Tag:     tagPushgateway,
+		Input:   client.DeletePushgatewayMetricInput{},
+		Output:  client.Response{},
+	},
+	"GET /api/v1/pushgateway": {
+		Summary: "List pushgateway metrics",
+		Tag:     tagPushgateway,
+		Input:   handlers.ListPushgatewayMetricsInput{},
+		Output:  handlers.ListPushgatewayMetricsOutput{},
+	},
+	"GET /api/v1/pushgateway/usage": {
+		Summary: "Number of pushgateway series per metric name and cardinality limits",
+		Tag:     tagPushgateway,
+		Output:  handlers.PushgatewayUsageOutput{},
+	},
+	"GET /api/v1/pushgateway/families": {
+		Summary: "List the metric families and their metadata",
+		Tag:     tagPushgateway,
+		Output:  handlers.ListMetricFamiliesOutput{},
+	},
+	"GET /api/v1/pushgateway/families/:name": {
+		Summary: "Get the metadata of a metric family",
+		Tag:     tagPushgateway,
+		Input:   handlers.GetMetricFamilyInput{},
+		Output:  handlers.MetricFamily{},
+	},
+	"PUT /api/v1/pushgateway/families/:name": {
+		Summary: "Create or replace the metadata of a metric family",
+		Tag:     tagPushgateway,
+		Input:   handlers.UpdateMetricFamilyInput{},
+		Output:  client.Response{},
+	},
+	"DELETE /api/v1/pushgateway/families/:name": {
+		Summary: "Delete the metadata of a metric family",
+		Tag:     tagPushgateway,
+		Input:   handlers.DeleteMetricFamilyInput{},
+		Output:  client.Response{},
+	},
+	"POST /api/v1/admin/reload": {
+		Summary: "Reload the server configuration, only allowed when basic auth is configured",
+		Tag:     tagAdmin,
+		Output:  handlers.ReloadConfigurationOutput{},
+	},
+}
+
+// buildSpecification generates the OpenAPI specification of the API routes
+func buildSpecification(e *echo.Echo) (*openapi.Document, error) {
+	generator := openapi.NewGenerator()
+	generator.RegisterPolymorphic(client.Healthcheck{}, openapi.Polymorphic{
+		Discriminator: "type",
+		Variants: map[string]any{
+			"dns":       client.HealthcheckDNSDefinition{},
+			"tcp":       client.HealthcheckTCPDefinition{},
+			"http":      client.HealthcheckHTTPDefinition{},
+			"tls":       client.HealthcheckTLSDefinition{},
+			"command":   client.HealthcheckCommandDefinition{},
+			"heartbeat": handlers.HealthcheckHeartbeatDefinition{},
+		},
+	})
+	return generator.Build(openapi.Info{
+		Title:   "Appclacks API",
+		Version: "v1",
+	}, "/api/v1", e.Routes(), routes)
+}
+
+func specificationHandler(e *echo.Echo) (echo.HandlerFunc, error) {
+	spec, err := buildSpecification(e)
+	if err != nil {
+		return nil, err
+	}
+	return func(ec echo.Context) error {
+		return ec.JSON(http.StatusOK, spec)
+	}, nil
+}
+
+func explorerHandler(ec echo.Context) error {
+	return ec.HTMLBlob(http.StatusOK, openapi.Explorer)
+}
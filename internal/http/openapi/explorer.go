@@ -0,0 +1,11 @@
+package openapi
+
+import (
+	_ "embed"
+)
+
+// Explorer is a standalone HTML page to browse and call the API
+// described by the specification served next to it
+//
+//go:embed explorer.html
+var Explorer []byte
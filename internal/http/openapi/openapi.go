@@ -0,0 +1,273 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	er "github.com/mcorbin/corbierror"
+)
+
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+	Head   *Operation `json:"head,omitempty"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Route documents an API route. Input is a struct whose json, param and query
+// tags describe the request, Output is the struct returned on success.
+type Route struct {
+	Summary     string
+	Tag         string
+	Input       any
+	Output      any
+	ContentType string
+}
+
+var pathParamRegex = regexp.MustCompile(`:([A-Za-z0-9_-]+)`)
+
+// wildcardParam is the name of the path parameter matching an echo wildcard
+const wildcardParam = "path"
+
+// toOpenAPIPath converts an echo path (/healthcheck/:id) to an OpenAPI one (/healthcheck/{id})
+func toOpenAPIPath(path string) string {
+	path = pathParamRegex.ReplaceAllString(path, "{$1}")
+	if strings.HasSuffix(path, "*") {
+		path = strings.TrimSuffix(path, "*") + "{" + wildcardParam + "}"
+	}
+	return path
+}
+
+// pathParams returns the name of the path parameters of an echo path
+func pathParams(path string) []string {
+	result := []string{}
+	for _, match := range pathParamRegex.FindAllStringSubmatch(path, -1) {
+		result = append(result, match[1])
+	}
+	if strings.HasSuffix(path, "*") {
+		result = append(result, wildcardParam)
+	}
+	return result
+}
+
+func operationID(method string, path string) string {
+	parts := []string{strings.ToLower(method)}
+	for _, part := range strings.Split(path, "/") {
+		part = strings.TrimPrefix(part, ":")
+		part = strings.NewReplacer("-", "_", ".", "_", "*", wildcardParam).Replace(part)
+		if part != "" && part != "api" && part != "v1" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+func renameParams(operation *Operation, names []string, newNames []string) {
+	for _, parameter := range operation.Parameters {
+		if parameter.In != "path" {
+			continue
+		}
+		for i, name := range names {
+			if parameter.Name == name && i < len(newNames) {
+				parameter.Name = newNames[i]
+				break
+			}
+		}
+	}
+}
+
+func (p *PathItem) set(method string, operation *Operation) bool {
+	switch method {
+	case http.MethodGet:
+		p.Get = operation
+	case http.MethodPut:
+		p.Put = operation
+	case http.MethodPost:
+		p.Post = operation
+	case http.MethodDelete:
+		p.Delete = operation
+	case http.MethodPatch:
+		p.Patch = operation
+	case http.MethodHead:
+		p.Head = operation
+	default:
+		return false
+	}
+	return true
+}
+
+// Build generates the OpenAPI document for the echo routes matching the prefix.
+// routes contains the documentation of the routes, indexed by "METHOD path".
+func (g *Generator) Build(info Info, prefix string, echoRoutes []*echo.Route, routes map[string]Route) (*Document, error) {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"basicAuth": {Type: "http", Scheme: "basic"},
+			},
+		},
+		Security: []map[string][]string{{"basicAuth": {}}},
+	}
+	errorSchema, err := g.Schema(er.Error{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(echoRoutes, func(i, j int) bool {
+		if echoRoutes[i].Path == echoRoutes[j].Path {
+			return echoRoutes[i].Method < echoRoutes[j].Method
+		}
+		return echoRoutes[i].Path < echoRoutes[j].Path
+	})
+	shapes := make(map[string]string)
+	for _, echoRoute := range echoRoutes {
+		if !strings.HasPrefix(echoRoute.Path, prefix) {
+			continue
+		}
+		route := routes[fmt.Sprintf("%s %s", echoRoute.Method, echoRoute.Path)]
+		operation := &Operation{
+			OperationID: operationID(echoRoute.Method, echoRoute.Path),
+			Summary:     route.Summary,
+			Responses: map[string]*Response{
+				"default": {
+					Description: "Error",
+					Content: map[string]*MediaType{
+						"application/json": {Schema: errorSchema},
+					},
+				},
+			},
+		}
+		if route.Tag != "" {
+			operation.Tags = []string{route.Tag}
+		}
+		if route.Input != nil {
+			parameters, body, err := g.request(route.Input)
+			if err != nil {
+				return nil, err
+			}
+			operation.Parameters = parameters
+			if body != nil && echoRoute.Method != http.MethodGet && echoRoute.Method != http.MethodDelete {
+				operation.RequestBody = &RequestBody{
+					Required: true,
+					Content: map[string]*MediaType{
+						"application/json": {Schema: body},
+					},
+				}
+			}
+		}
+		// path parameters should always be documented
+		for _, name := range pathParams(echoRoute.Path) {
+			found := false
+			for _, parameter := range operation.Parameters {
+				if parameter.In == "path" && parameter.Name == name {
+					found = true
+				}
+			}
+			if !found {
+				operation.Parameters = append(operation.Parameters, &Parameter{
+					Name:     name,
+					In:       "path",
+					Required: true,
+					Schema:   &Schema{Type: "string"},
+				})
+			}
+		}
+		success := &Response{Description: "Success"}
+		if route.Output != nil {
+			schema, err := g.Schema(route.Output)
+			if err != nil {
+				return nil, err
+			}
+			contentType := route.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			success.Content = map[string]*MediaType{
+				contentType: {Schema: schema},
+			}
+		}
+		operation.Responses["200"] = success
+		// echo allows different parameter names for the same path depending
+		// on the method, which is forbidden by OpenAPI: the names of the
+		// first path registered are reused
+		shape := pathParamRegex.ReplaceAllString(echoRoute.Path, ":")
+		echoPath, ok := shapes[shape]
+		if ok {
+			renameParams(operation, pathParams(echoRoute.Path), pathParams(echoPath))
+		} else {
+			shapes[shape] = echoRoute.Path
+			echoPath = echoRoute.Path
+		}
+		path := toOpenAPIPath(echoPath)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+		}
+		if item.set(echoRoute.Method, operation) {
+			doc.Paths[path] = item
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,111 @@
+package openapi_test
+
+import (
+	"testing"
+
+	"github.com/appclacks/server/internal/http/openapi"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type definitionA struct {
+	Target string `json:"target" validate:"required,max=255"`
+}
+
+type definitionB struct {
+	Port uint `json:"port" validate:"required,min=1,max=65535"`
+}
+
+type item struct {
+	Type       string `json:"type"`
+	Definition any    `json:",inline"`
+}
+
+type updateInput struct {
+	ID     string            `json:"-" param:"id" description:"Item ID" validate:"required,uuid"`
+	Name   string            `json:"name" description:"Item name" validate:"required,min=1"`
+	Mode   string            `json:"mode" validate:"omitempty,oneof=fast slow"`
+	Labels map[string]string `json:"labels" validate:"dive,keys,max=255,min=1,endkeys,max=10"`
+	Status []uint            `json:"status" validate:"max=20,dive,max=1000"`
+	definitionA
+}
+
+type getInput struct {
+	Identifier string `param:"identifier"`
+	Pattern    string `query:"pattern" description:"Name pattern"`
+}
+
+func TestBuild(t *testing.T) {
+	e := echo.New()
+	handler := func(ec echo.Context) error { return nil }
+	group := e.Group("/api/v1")
+	group.Use(func(next echo.HandlerFunc) echo.HandlerFunc { return next })
+	group.PUT("/item/:id", handler)
+	group.GET("/item/:identifier", handler)
+	e.GET("/healthz", handler)
+
+	generator := openapi.NewGenerator()
+	generator.RegisterPolymorphic(item{}, openapi.Polymorphic{
+		Discriminator: "type",
+		Variants: map[string]any{
+			"a": definitionA{},
+			"b": definitionB{},
+		},
+	})
+	doc, err := generator.Build(openapi.Info{Title: "test", Version: "v1"}, "/api/v1", e.Routes(), map[string]openapi.Route{
+		"PUT /api/v1/item/:id": {
+			Summary: "Update an item",
+			Input:   updateInput{},
+			Output:  item{},
+		},
+		"GET /api/v1/item/:identifier": {
+			Input:  getInput{},
+			Output: item{},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, doc.Paths, 1)
+	path, ok := doc.Paths["/api/v1/item/{id}"]
+	assert.True(t, ok)
+
+	put := path.Put
+	assert.Equal(t, "put_item_id", put.OperationID)
+	assert.Equal(t, "Update an item", put.Summary)
+	assert.Len(t, put.Parameters, 1)
+	assert.Equal(t, "id", put.Parameters[0].Name)
+	assert.Equal(t, "path", put.Parameters[0].In)
+	assert.Equal(t, "Item ID", put.Parameters[0].Description)
+	assert.Equal(t, "uuid", put.Parameters[0].Schema.Format)
+	assert.Equal(t, "#/components/schemas/updateInput", put.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/item", put.Responses["200"].Content["application/json"].Schema.Ref)
+
+	// the parameter is renamed to match the path
+	get := path.Get
+	assert.Len(t, get.Parameters, 2)
+	assert.Equal(t, "id", get.Parameters[0].Name)
+	assert.Equal(t, "pattern", get.Parameters[1].Name)
+	assert.Equal(t, "query", get.Parameters[1].In)
+	assert.False(t, get.Parameters[1].Required)
+	assert.Nil(t, get.RequestBody)
+
+	input := doc.Components.Schemas["updateInput"]
+	assert.Equal(t, []string{"name", "target"}, input.Required)
+	assert.NotContains(t, input.Properties, "id")
+	assert.Equal(t, "Item name", input.Properties["name"].Description)
+	assert.Equal(t, uint64(1), *input.Properties["name"].MinLength)
+	assert.Equal(t, []any{"fast", "slow"}, input.Properties["mode"].Enum)
+	assert.Equal(t, uint64(10), *input.Properties["labels"].AdditionalProperties.MaxLength)
+	assert.Equal(t, uint64(20), *input.Properties["status"].MaxItems)
+	assert.Equal(t, float64(1000), *input.Properties["status"].Items.Maximum)
+	assert.Equal(t, uint64(255), *input.Properties["target"].MaxLength)
+
+	polymorphic := doc.Components.Schemas["item"]
+	assert.Equal(t, "type", polymorphic.Discriminator.PropertyName)
+	assert.Len(t, polymorphic.OneOf, 2)
+	assert.Equal(t, "#/components/schemas/itemA", polymorphic.Discriminator.Mapping["a"])
+	variant := doc.Components.Schemas["itemB"]
+	assert.Equal(t, "#/components/schemas/itemBase", variant.AllOf[0].Ref)
+	assert.Equal(t, "#/components/schemas/definitionB", variant.AllOf[1].Ref)
+	assert.Equal(t, []any{"b"}, variant.AllOf[2].Properties["type"].Enum)
+	assert.NotContains(t, doc.Components.Schemas["itemBase"].Properties, "Definition")
+}
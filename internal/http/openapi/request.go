@@ -0,0 +1,77 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// request returns the parameters and the body schema of an input struct.
+// Fields tagged with param or query are parameters, the other ones are
+// part of the body.
+func (g *Generator) request(input any) ([]*Parameter, *Schema, error) {
+	t := reflect.TypeOf(input)
+	if t.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("the input %s is not a struct", t)
+	}
+	parameters, hasBody, err := g.parameters(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasBody {
+		return parameters, nil, nil
+	}
+	body, err := g.typeSchema(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parameters, body, nil
+}
+
+func (g *Generator) parameters(t reflect.Type) ([]*Parameter, bool, error) {
+	parameters := []*Parameter{}
+	hasBody := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			embedded, body, err := g.parameters(field.Type)
+			if err != nil {
+				return nil, false, err
+			}
+			parameters = append(parameters, embedded...)
+			hasBody = hasBody || body
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if _, ok := jsonName(field); ok {
+			hasBody = true
+		}
+		in := ""
+		name := ""
+		if param, ok := field.Tag.Lookup("param"); ok {
+			in = "path"
+			name = param
+		} else if query, ok := field.Tag.Lookup("query"); ok {
+			in = "query"
+			name = query
+		} else {
+			continue
+		}
+		schema, required, err := g.fieldSchema(field)
+		if err != nil {
+			return nil, false, fmt.Errorf("fail to generate schema for parameter %s of %s: %w", field.Name, t, err)
+		}
+		description := schema.Description
+		schema.Description = ""
+		parameters = append(parameters, &Parameter{
+			Name:        name,
+			In:          in,
+			Description: description,
+			// path parameters are always required
+			Required: required || in == "path",
+			Schema:   schema,
+		})
+	}
+	return parameters, hasBody, nil
+}
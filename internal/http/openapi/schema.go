@@ -0,0 +1,422 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *uint64            `json:"minLength,omitempty"`
+	MaxLength            *uint64            `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty"`
+	MinItems             *uint64            `json:"minItems,omitempty"`
+	MaxItems             *uint64            `json:"maxItems,omitempty"`
+	MinProperties        *uint64            `json:"minProperties,omitempty"`
+	MaxProperties        *uint64            `json:"maxProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Discriminator        *Discriminator     `json:"discriminator,omitempty"`
+}
+
+type Discriminator struct {
+	PropertyName string            `json:"propertyName"`
+	Mapping      map[string]string `json:"mapping,omitempty"`
+}
+
+// Polymorphic describes a type whose payload depends on a discriminator field,
+// like healthchecks whose definition depends on their type
+type Polymorphic struct {
+	Discriminator string
+	// Variants contains the definition of each variant, indexed by the
+	// discriminator value
+	Variants map[string]any
+}
+
+// Generator builds OpenAPI schemas from Go types. Named structs are
+// stored as components and referenced.
+type Generator struct {
+	schemas     map[string]*Schema
+	types       map[string]reflect.Type
+	polymorphic map[reflect.Type]Polymorphic
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		schemas:     make(map[string]*Schema),
+		types:       make(map[string]reflect.Type),
+		polymorphic: make(map[reflect.Type]Polymorphic),
+	}
+}
+
+// RegisterPolymorphic registers a type whose fields are completed by a
+// variant selected by the discriminator field
+func (g *Generator) RegisterPolymorphic(value any, polymorphic Polymorphic) {
+	g.polymorphic[reflect.TypeOf(value)] = polymorphic
+}
+
+// Schema returns the schema of a value
+func (g *Generator) Schema(value any) (*Schema, error) {
+	return g.typeSchema(reflect.TypeOf(value))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *Generator) typeSchema(t reflect.Type) (*Schema, error) {
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema, nil
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}, nil
+		}
+		if t.Name() == "" {
+			return g.objectSchema(t)
+		}
+		return g.component(t)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}, nil
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := float64(0)
+		return &Schema{Type: "integer", Format: "int64", Minimum: &minimum}, nil
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}, nil
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// componentName returns the name of the component for a type, the package
+// name is used as prefix if two types have the same name
+func (g *Generator) componentName(t reflect.Type) string {
+	name := t.Name()
+	existing, ok := g.types[name]
+	if !ok || existing == t {
+		return name
+	}
+	parts := strings.Split(t.PkgPath(), "/")
+	return capitalize(parts[len(parts)-1]) + name
+}
+
+func capitalize(value string) string {
+	if value == "" {
+		return value
+	}
+	return strings.ToUpper(value[:1]) + value[1:]
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *Generator) component(t reflect.Type) (*Schema, error) {
+	name := g.componentName(t)
+	if _, ok := g.types[name]; ok {
+		return ref(name), nil
+	}
+	// registered before being built to support recursive types
+	g.types[name] = t
+	g.schemas[name] = &Schema{}
+	var schema *Schema
+	var err error
+	if polymorphic, ok := g.polymorphic[t]; ok {
+		schema, err = g.polymorphicSchema(name, t, polymorphic)
+	} else {
+		schema, err = g.objectSchema(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.schemas[name] = schema
+	return ref(name), nil
+}
+
+func (g *Generator) polymorphicSchema(name string, t reflect.Type, polymorphic Polymorphic) (*Schema, error) {
+	base, err := g.objectSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	baseName := name + "Base"
+	g.schemas[baseName] = base
+	schema := &Schema{
+		Discriminator: &Discriminator{
+			PropertyName: polymorphic.Discriminator,
+			Mapping:      make(map[string]string),
+		},
+	}
+	for _, value := range sortedKeys(polymorphic.Variants) {
+		definition, err := g.Schema(polymorphic.Variants[value])
+		if err != nil {
+			return nil, err
+		}
+		variantName := name + capitalize(value)
+		g.schemas[variantName] = &Schema{
+			AllOf: []*Schema{
+				ref(baseName),
+				definition,
+				{
+					Type: "object",
+					Properties: map[string]*Schema{
+						polymorphic.Discriminator: {Type: "string", Enum: []any{value}},
+					},
+				},
+			},
+		}
+		variantRef := ref(variantName)
+		schema.OneOf = append(schema.OneOf, variantRef)
+		schema.Discriminator.Mapping[value] = variantRef.Ref
+	}
+	return schema, nil
+}
+
+// jsonName returns the JSON name of a field, and if the field is part of the body
+func jsonName(field reflect.StructField) (string, bool) {
+	tag, hasTag := field.Tag.Lookup("json")
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "-" && options == "" {
+		return "", false
+	}
+	if !hasTag {
+		// parameters are not part of the body
+		if _, ok := field.Tag.Lookup("param"); ok {
+			return "", false
+		}
+		if _, ok := field.Tag.Lookup("query"); ok {
+			return "", false
+		}
+	}
+	if strings.Contains(options, "inline") {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+func (g *Generator) objectSchema(t reflect.Type) (*Schema, error) {
+	schema := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+	err := g.addFields(schema, t)
+	if err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (g *Generator) addFields(schema *Schema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if _, ok := field.Tag.Lookup("json"); !ok {
+				err := g.addFields(schema, field.Type)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		property, required, err := g.fieldSchema(field)
+		if err != nil {
+			return fmt.Errorf("fail to generate schema for field %s of %s: %w", field.Name, t, err)
+		}
+		schema.Properties[name] = property
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+// fieldSchema returns the schema of a struct field, using the description and validate tags
+func (g *Generator) fieldSchema(field reflect.StructField) (*Schema, bool, error) {
+	schema, err := g.typeSchema(field.Type)
+	if err != nil {
+		return nil, false, err
+	}
+	required := false
+	if validate := field.Tag.Get("validate"); validate != "" {
+		required = applyValidation(schema, validate)
+	}
+	if schema.Ref == "" {
+		schema.Description = field.Tag.Get("description")
+	}
+	return schema, required, nil
+}
+
+func toUint(value string) *uint64 {
+	result, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &result
+}
+
+func toFloat(value string) *float64 {
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &result
+}
+
+// applyValidation converts validator rules to schema constraints.
+// It returns true if the field is required.
+func applyValidation(schema *Schema, validate string) bool {
+	required := false
+	rules := strings.Split(validate, ",")
+	for i := 0; i < len(rules); i++ {
+		rule, value, _ := strings.Cut(rules[i], "=")
+		// constraints on references are not supported by OpenAPI 3.0
+		if schema == nil || schema.Ref != "" {
+			return required
+		}
+		switch rule {
+		case "required":
+			required = true
+		case "dive":
+			if schema.Type == "object" {
+				schema = schema.AdditionalProperties
+			} else {
+				schema = schema.Items
+			}
+		case "keys":
+			// key constraints can't be expressed in OpenAPI 3.0
+			for i < len(rules) && rules[i] != "endkeys" {
+				i++
+			}
+		case "min", "max", "len", "gte", "lte", "gt", "lt":
+			setBound(schema, rule, value)
+		case "oneof":
+			for _, option := range strings.Fields(value) {
+				if schema.Type == "integer" || schema.Type == "number" {
+					if number := toFloat(option); number != nil {
+						schema.Enum = append(schema.Enum, *number)
+					}
+				} else {
+					schema.Enum = append(schema.Enum, option)
+				}
+			}
+		case "uuid", "uuid4":
+			schema.Format = "uuid"
+		case "email":
+			schema.Format = "email"
+		case "url", "uri", "http_url":
+			schema.Format = "uri"
+		case "ip", "ip_addr":
+			schema.Format = "ip"
+		case "ipv4", "ip4_addr":
+			schema.Format = "ipv4"
+		case "ipv6", "ip6_addr":
+			schema.Format = "ipv6"
+		case "hostname", "hostname_rfc1123":
+			schema.Format = "hostname"
+		}
+	}
+	return required
+}
+
+func setBound(schema *Schema, rule string, value string) {
+	lower := rule == "min" || rule == "gte" || rule == "gt" || rule == "len"
+	upper := rule == "max" || rule == "lte" || rule == "lt" || rule == "len"
+	switch schema.Type {
+	case "string":
+		if lower {
+			schema.MinLength = toUint(value)
+		}
+		if upper {
+			schema.MaxLength = toUint(value)
+		}
+	case "array":
+		if lower {
+			schema.MinItems = toUint(value)
+		}
+		if upper {
+			schema.MaxItems = toUint(value)
+		}
+	case "object":
+		if lower {
+			schema.MinProperties = toUint(value)
+		}
+		if upper {
+			schema.MaxProperties = toUint(value)
+		}
+	case "integer", "number":
+		if lower {
+			schema.Minimum = toFloat(value)
+			schema.ExclusiveMinimum = rule == "gt"
+		}
+		if upper {
+			schema.Maximum = toFloat(value)
+			schema.ExclusiveMaximum = rule == "lt"
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/appclacks/server/internal/http/handlers"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	server, err := NewServer(slog.Default(), Configuration{Host: "127.0.0.1", Port: 10003}, prometheus.NewRegistry(), handlers.NewBuilder(nil, nil, nil))
+	assert.NoError(t, err)
+	// the specification routes are not part of the specification
+	ignored := map[string]bool{
+		"GET /api/v1/openapi.json": true,
+		"GET /api/v1/explorer":     true,
+	}
+	for _, route := range server.server.Routes() {
+		// the groups register a not found route
+		if !strings.HasPrefix(route.Path, "/api/v1/") || route.Method == echo.RouteNotFound {
+			continue
+		}
+		key := fmt.Sprintf("%s %s", route.Method, route.Path)
+		if ignored[key] {
+			continue
+		}
+		_, ok := routes[key]
+		assert.True(t, ok, "route %s is not documented", key)
+	}
+}
@@ -2,7 +2,7 @@ package http
 
 import (
 	"context"
-	"crypto/subtle"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -14,7 +14,6 @@ import (
 	"github.com/appclacks/server/internal/http/middlewares"
 	"github.com/appclacks/server/internal/validator"
 	"github.com/labstack/echo/v4"
-	echomw "github.com/labstack/echo/v4/middleware"
 	er "github.com/mcorbin/corbierror"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,10 +21,13 @@ import (
 )
 
 type Server struct {
-	config *Configuration
-	server *echo.Echo
-	wg     sync.WaitGroup
-	logger *slog.Logger
+	config             *Configuration
+	server             *echo.Echo
+	wg                 sync.WaitGroup
+	logger             *slog.Logger
+	credentials        *credentials
+	metricsCredentials *credentials
+	certificate        *certificate
 }
 
 type CustomValidator struct {
@@ -47,6 +49,10 @@ func NewServer(logger *slog.Logger, config Configuration, registry *prometheus.R
 	e.HideBanner = true
 	e.HidePort = true
 	e.Validator = &CustomValidator{}
+	e.IPExtractor, err = middlewares.IPExtractor(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
 	respCounter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_responses_total",
@@ -76,6 +82,21 @@ func NewServer(logger *slog.Logger, config Configuration, registry *prometheus.R
 		return nil, err
 	}
 
+	rateLimitedCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_rate_limited_requests_total",
+			Help: "Count the number of HTTP requests rejected by the rate limiter",
+		},
+		[]string{"bucket"})
+
+	err = registry.Register(rateLimitedCounter)
+	if err != nil {
+		return nil, err
+	}
+	pushgatewayLimit := rateLimit("pushgateway", config.RateLimit.Pushgateway, rateLimitedCounter)
+	healthcheckLimit := rateLimit("healthcheck", config.RateLimit.Healthcheck, rateLimitedCounter)
+	discoveryLimit := rateLimit("discovery", config.RateLimit.Discovery, rateLimitedCounter)
+
 	e.HTTPErrorHandler = errorHandler(logger)
 	e.Use(otelecho.Middleware("appclacks-server"))
 	e.Use(middlewares.MetricsMiddleware(reqHistogram, respCounter, logger))
@@ -83,60 +104,97 @@ func NewServer(logger *slog.Logger, config Configuration, registry *prometheus.R
 		return ec.JSON(http.StatusOK, "ok")
 	})
 
-	if config.Metrics.BasicAuth.Username != "" {
-		basicAuth := echomw.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
-			if subtle.ConstantTimeCompare([]byte(username), []byte(config.Metrics.BasicAuth.Username)) == 1 &&
-				subtle.ConstantTimeCompare([]byte(password), []byte(config.Metrics.BasicAuth.Password)) == 1 {
-				return true, nil
-			}
-			return false, nil
-		})
-		e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})), basicAuth)
-		e.GET("/pushgateway/metrics", builder.PushgatewayMetrics, basicAuth)
-	} else {
-		e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
-		e.GET("/pushgateway/metrics", builder.PushgatewayMetrics)
+	metricsCredentials := &credentials{}
+	metricsCredentials.set(config.Metrics.BasicAuth)
+	metricsAuth := metricsCredentials.middleware()
+	// an invalid pushed metric should not hide the other metrics
+	metricsHandler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+	e.GET("/metrics", echo.WrapHandler(metricsHandler), metricsAuth)
+	e.GET("/probe", builder.Probe, metricsAuth)
+	if config.Metrics.PushgatewayMode() != PushgatewayMerged {
+		e.GET("/pushgateway/metrics", builder.PushgatewayMetrics, metricsAuth)
 	}
 
+	apiCredentials := &credentials{}
+	apiCredentials.set(config.BasicAuth)
+	apiAuth := apiCredentials.middleware()
 	apiGroup := e.Group("/api/v1")
-	if config.BasicAuth.Username != "" {
-		basicAuth := echomw.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
-			if subtle.ConstantTimeCompare([]byte(username), []byte(config.BasicAuth.Username)) == 1 &&
-				subtle.ConstantTimeCompare([]byte(password), []byte(config.BasicAuth.Password)) == 1 {
-				return true, nil
-			}
-			return false, nil
-		})
-		apiGroup.Use(basicAuth)
-	}
+	apiGroup.Use(apiAuth)
 
-	apiGroup.POST("/healthcheck/dns", builder.CreateDNSHealthcheck)
-	apiGroup.PUT("/healthcheck/dns/:id", builder.UpdateDNSHealthcheck)
-	apiGroup.POST("/healthcheck/tcp", builder.CreateTCPHealthcheck)
-	apiGroup.PUT("/healthcheck/tcp/:id", builder.UpdateTCPHealthcheck)
-	apiGroup.POST("/healthcheck/http", builder.CreateHTTPHealthcheck)
-	apiGroup.PUT("/healthcheck/http/:id", builder.UpdateHTTPHealthcheck)
-	apiGroup.POST("/healthcheck/tls", builder.CreateTLSHealthcheck)
-	apiGroup.PUT("/healthcheck/tls/:id", builder.UpdateTLSHealthcheck)
-	apiGroup.POST("/healthcheck/command", builder.CreateCommandHealthcheck)
-	apiGroup.PUT("/healthcheck/command/:id", builder.UpdateCommandHealthcheck)
-	apiGroup.DELETE("/healthcheck/:id", builder.DeleteHealthcheck)
+	// Prometheus Pushgateway compatible routes
+	pushMiddlewares := append([]echo.MiddlewareFunc{apiAuth}, pushgatewayLimit...)
+	e.PUT("/metrics/*", builder.PushReplaceGroup, pushMiddlewares...)
+	e.POST("/metrics/*", builder.PushMergeGroup, pushMiddlewares...)
+	e.DELETE("/metrics/*", builder.PushDeleteGroup, pushMiddlewares...)
+	e.POST("/v1/metrics", builder.OTLPMetrics, pushMiddlewares...)
+	e.POST("/write", builder.InfluxWrite, pushMiddlewares...)
+	e.POST("/api/v2/write", builder.InfluxWrite, pushMiddlewares...)
+
+	apiGroup.POST("/healthcheck/dns", builder.CreateDNSHealthcheck, healthcheckLimit...)
+	apiGroup.PUT("/healthcheck/dns/:id", builder.UpdateDNSHealthcheck, healthcheckLimit...)
+	apiGroup.POST("/healthcheck/tcp", builder.CreateTCPHealthcheck, healthcheckLimit...)
+	apiGroup.PUT("/healthcheck/tcp/:id", builder.UpdateTCPHealthcheck, healthcheckLimit...)
+	apiGroup.POST("/healthcheck/http", builder.CreateHTTPHealthcheck, healthcheckLimit...)
+	apiGroup.PUT("/healthcheck/http/:id", builder.UpdateHTTPHealthcheck, healthcheckLimit...)
+	apiGroup.POST("/healthcheck/tls", builder.CreateTLSHealthcheck, healthcheckLimit...)
+	apiGroup.PUT("/healthcheck/tls/:id", builder.UpdateTLSHealthcheck, healthcheckLimit...)
+	apiGroup.POST("/healthcheck/command", builder.CreateCommandHealthcheck, healthcheckLimit...)
+	apiGroup.PUT("/healthcheck/command/:id", builder.UpdateCommandHealthcheck, healthcheckLimit...)
+	apiGroup.POST("/healthcheck/heartbeat", builder.CreateHeartbeatHealthcheck, healthcheckLimit...)
+	apiGroup.PUT("/healthcheck/heartbeat/:id", builder.UpdateHeartbeatHealthcheck, healthcheckLimit...)
+	apiGroup.DELETE("/healthcheck/:id", builder.DeleteHealthcheck, healthcheckLimit...)
+	apiGroup.GET("/healthcheck/files", builder.ListHealthcheckFiles)
 	apiGroup.GET("/healthcheck/:identifier", builder.GetHealthcheck)
 	apiGroup.GET("/healthcheck", builder.ListHealthchecks)
-	apiGroup.GET("/cabourotte/discovery", builder.CabourotteDiscovery)
-	apiGroup.POST("/pushgateway", builder.CreateOrUpdatePushgatewayMetric)
-	apiGroup.DELETE("/pushgateway", builder.DeleteAllPushgatewayMetrics)
-	apiGroup.DELETE("/pushgateway/:identifier", builder.DeleteMetric)
+	apiGroup.POST("/heartbeat/:id", builder.HeartbeatSuccess)
+	apiGroup.POST("/heartbeat/:id/fail", builder.HeartbeatFail)
+	apiGroup.POST("/heartbeat/:id/start", builder.HeartbeatStart)
+	apiGroup.GET("/heartbeat/:id", builder.GetHeartbeat)
+	apiGroup.GET("/cabourotte/discovery", builder.CabourotteDiscovery, discoveryLimit...)
+	apiGroup.GET("/prometheus/http-sd", builder.PrometheusHTTPSD, discoveryLimit...)
+	apiGroup.POST("/pushgateway", builder.CreateOrUpdatePushgatewayMetric, pushgatewayLimit...)
+	apiGroup.POST("/pushgateway/batch", builder.BatchPushgatewayMetrics, pushgatewayLimit...)
+	apiGroup.POST("/pushgateway/increment", builder.IncrementPushgatewayMetric, pushgatewayLimit...)
+	apiGroup.POST("/write", builder.RemoteWrite, pushgatewayLimit...)
+	apiGroup.DELETE("/pushgateway", builder.DeletePushgatewayMetrics, pushgatewayLimit...)
+	apiGroup.DELETE("/pushgateway/:identifier", builder.DeleteMetric, pushgatewayLimit...)
 	apiGroup.GET("/pushgateway", builder.ListPushgatewayMetrics)
+	apiGroup.GET("/pushgateway/usage", builder.PushgatewayUsage)
+	apiGroup.GET("/pushgateway/families", builder.ListMetricFamilies)
+	apiGroup.GET("/pushgateway/families/:name", builder.GetMetricFamily)
+	apiGroup.PUT("/pushgateway/families/:name", builder.UpdateMetricFamily, pushgatewayLimit...)
+	apiGroup.DELETE("/pushgateway/families/:name", builder.DeleteMetricFamily, pushgatewayLimit...)
+	// the configuration can't be reloaded by anyone if the API is open
+	apiGroup.POST("/admin/reload", builder.ReloadConfiguration, apiCredentials.required())
+
+	// the specification is generated from the routes registered above
+	specification, err := specificationHandler(e)
+	if err != nil {
+		return nil, fmt.Errorf("fail to generate the OpenAPI specification: %w", err)
+	}
+	apiGroup.GET("/openapi.json", specification)
+	apiGroup.GET("/explorer", explorerHandler)
 
 	return &Server{
-		server: e,
-		config: &config,
-		logger: logger,
+		server:             e,
+		config:             &config,
+		logger:             logger,
+		credentials:        apiCredentials,
+		metricsCredentials: metricsCredentials,
+		certificate:        &certificate{},
 	}, nil
 
 }
 
+// rateLimit returns the rate limiting middleware for a bucket, if enabled
+func rateLimit(bucket string, config RateLimit, counter *prometheus.CounterVec) []echo.MiddlewareFunc {
+	if config.Rate == 0 {
+		return nil
+	}
+	limiter := middlewares.NewRateLimiter(bucket, config.Rate, config.Burst, counter)
+	return []echo.MiddlewareFunc{limiter.Middleware()}
+}
+
 func (s *Server) Start() error {
 	address := fmt.Sprintf("[%s]:%d", s.config.Host, s.config.Port)
 	s.logger.Info(fmt.Sprintf("http server starting on %s", address))
@@ -147,6 +205,13 @@ func (s *Server) Start() error {
 			return err
 		}
 
+		// the certificate is served through GetCertificate so it
+		// can be replaced on configuration reload
+		if len(tlsConfig.Certificates) > 0 {
+			s.certificate.set(&tlsConfig.Certificates[0])
+			tlsConfig.Certificates = nil
+			tlsConfig.GetCertificate = s.certificate.getCertificate
+		}
 		s.server.TLSServer.TLSConfig = tlsConfig
 		tlsServer := s.server.TLSServer
 		tlsServer.Addr = address
@@ -174,6 +239,28 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// TLSEnabled returns true if the server was started with TLS
+func (s *Server) TLSEnabled() bool {
+	return s.config.Cert != ""
+}
+
+// UpdateCredentials replaces the API and metrics basic auth credentials
+func (s *Server) UpdateCredentials(basicAuth BasicAuth, metricsBasicAuth BasicAuth) {
+	s.credentials.set(basicAuth)
+	s.metricsCredentials.set(metricsBasicAuth)
+}
+
+// Certificate returns the certificate served by the TLS server
+func (s *Server) Certificate() *tls.Certificate {
+	cert, _ := s.certificate.getCertificate(nil)
+	return cert
+}
+
+// UpdateCertificate replaces the certificate served by the TLS server
+func (s *Server) UpdateCertificate(cert *tls.Certificate) {
+	s.certificate.set(cert)
+}
+
 func (s *Server) Stop() error {
 	s.logger.Info("stopping the http server")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"os"
+	"sync"
 )
 
 func getTLSConfig(keyPath string, certPath string, cacertPath string, serverName string, insecure bool) (*tls.Config, error) {
@@ -35,3 +36,22 @@ func getTLSConfig(keyPath string, certPath string, cacertPath string, serverName
 	tlsConfig.InsecureSkipVerify = insecure
 	return tlsConfig, nil
 }
+
+// certificate holds the server certificate which can be replaced
+// while the server is running
+type certificate struct {
+	lock sync.RWMutex
+	cert *tls.Certificate
+}
+
+func (c *certificate) set(cert *tls.Certificate) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cert = cert
+}
+
+func (c *certificate) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cert, nil
+}
@@ -0,0 +1,248 @@
+package reload
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appclacks/server/config"
+	"github.com/appclacks/server/internal/http"
+	"github.com/appclacks/server/pkg/pushgateway"
+	er "github.com/mcorbin/corbierror"
+)
+
+type Server interface {
+	TLSEnabled() bool
+	Certificate() *tls.Certificate
+	UpdateCertificate(cert *tls.Certificate)
+	UpdateCredentials(basicAuth http.BasicAuth, metricsBasicAuth http.BasicAuth)
+}
+
+type Store interface {
+	SetProbers(probers uint)
+}
+
+type HealthcheckService interface {
+	SetHeartbeatInterval(interval time.Duration)
+}
+
+type PushgatewayService interface {
+	SetCleanupInterval(interval time.Duration)
+	SetRemoteWriteConfig(config pushgateway.RemoteWriteConfig)
+	SetOTLPConfig(config pushgateway.OTLPConfig)
+	SetInfluxConfig(config pushgateway.InfluxConfig)
+	SetLimits(limits pushgateway.Limits)
+	SetTypeConflictPolicy(policy string)
+}
+
+// Reloader applies the settings which can be changed without
+// restarting the server
+type Reloader struct {
+	lock         sync.Mutex
+	path         string
+	current      *config.Configuration
+	logger       *slog.Logger
+	logLevel     *slog.LevelVar
+	defaultLevel slog.Level
+	store        Store
+	healthcheck  HealthcheckService
+	pushgateway  PushgatewayService
+	server       Server
+}
+
+// New creates a reloader of the configuration file, current is the
+// configuration the server was started with. The log level is
+// defaultLevel if not configured.
+func New(logger *slog.Logger, path string, current *config.Configuration, logLevel *slog.LevelVar, defaultLevel slog.Level, store Store, healthcheck HealthcheckService, pushgateway PushgatewayService) *Reloader {
+	return &Reloader{
+		path:         path,
+		current:      current,
+		logger:       logger,
+		logLevel:     logLevel,
+		defaultLevel: defaultLevel,
+		store:        store,
+		healthcheck:  healthcheck,
+		pushgateway:  pushgateway,
+	}
+}
+
+// SetServer sets the HTTP server, which is created after the reloader
+func (r *Reloader) SetServer(server Server) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.server = server
+}
+
+// certificateChanged returns true if the certificate differs from the
+// served one
+func (r *Reloader) certificateChanged(cert *tls.Certificate) bool {
+	served := r.server.Certificate()
+	if served == nil {
+		return true
+	}
+	return !slices.EqualFunc(cert.Certificate, served.Certificate, slices.Equal)
+}
+
+// Reload reads the configuration file again and applies it.
+// Nothing is applied if the new configuration is invalid.
+func (r *Reloader) Reload(ctx context.Context) ([]string, []string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.logger.Info(fmt.Sprintf("reloading configuration file %s", r.path))
+	newConfig, err := config.Load(r.path)
+	if err != nil {
+		return nil, nil, er.Newf("fail to reload the configuration: %s", er.BadRequest, true, err.Error())
+	}
+	current := r.current
+
+	// everything which can fail should be done before applying the new configuration
+	var cert *tls.Certificate
+	if r.server.TLSEnabled() && newConfig.HTTP.Cert != "" && newConfig.HTTP.Key != "" {
+		newCert, err := tls.LoadX509KeyPair(newConfig.HTTP.Cert, newConfig.HTTP.Key)
+		if err != nil {
+			return nil, nil, er.Newf("fail to reload the configuration: fail to load certificates: %s", er.BadRequest, true, err.Error())
+		}
+		if r.certificateChanged(&newCert) {
+			cert = &newCert
+		}
+	}
+	currentCleanupInterval, err := CleanupInterval(current)
+	if err != nil {
+		return nil, nil, err
+	}
+	newCleanupInterval, err := CleanupInterval(newConfig)
+	if err != nil {
+		return nil, nil, er.Newf("fail to reload the configuration: %s", er.BadRequest, true, err.Error())
+	}
+	currentHeartbeatInterval, err := HeartbeatInterval(current)
+	if err != nil {
+		return nil, nil, err
+	}
+	newHeartbeatInterval, err := HeartbeatInterval(newConfig)
+	if err != nil {
+		return nil, nil, er.Newf("fail to reload the configuration: %s", er.BadRequest, true, err.Error())
+	}
+	remoteWriteConfig, err := RemoteWriteConfig(newConfig)
+	if err != nil {
+		return nil, nil, er.Newf("fail to reload the configuration: %s", er.BadRequest, true, err.Error())
+	}
+
+	applied := []string{}
+	ignored := []string{}
+
+	newLevel := LogLevel(newConfig, r.defaultLevel)
+	if newLevel != r.logLevel.Level() {
+		r.logLevel.Set(newLevel)
+		applied = append(applied, "logging.level")
+	}
+	if newConfig.HTTP.BasicAuth != current.HTTP.BasicAuth || newConfig.HTTP.Metrics.BasicAuth != current.HTTP.Metrics.BasicAuth {
+		r.server.UpdateCredentials(newConfig.HTTP.BasicAuth, newConfig.HTTP.Metrics.BasicAuth)
+		if newConfig.HTTP.BasicAuth != current.HTTP.BasicAuth {
+			applied = append(applied, "http.basic-auth")
+		}
+		if newConfig.HTTP.Metrics.BasicAuth != current.HTTP.Metrics.BasicAuth {
+			applied = append(applied, "http.metrics.basic-auth")
+		}
+	}
+	if cert != nil {
+		r.server.UpdateCertificate(cert)
+		applied = append(applied, "http.cert")
+	}
+	if newCleanupInterval != currentCleanupInterval {
+		r.pushgateway.SetCleanupInterval(newCleanupInterval)
+		applied = append(applied, "pushgateway.cleanup-interval")
+	}
+	if !reflect.DeepEqual(newConfig.Pushgateway.RemoteWrite, current.Pushgateway.RemoteWrite) {
+		r.pushgateway.SetRemoteWriteConfig(remoteWriteConfig)
+		applied = append(applied, "pushgateway.remote-write")
+	}
+	if !reflect.DeepEqual(newConfig.Pushgateway.OTLP, current.Pushgateway.OTLP) {
+		r.pushgateway.SetOTLPConfig(OTLPConfig(newConfig))
+		applied = append(applied, "pushgateway.otlp")
+	}
+	if newConfig.Pushgateway.Influx != current.Pushgateway.Influx {
+		r.pushgateway.SetInfluxConfig(pushgateway.InfluxConfig{TTL: newConfig.Pushgateway.Influx.TTL})
+		applied = append(applied, "pushgateway.influx")
+	}
+	if newConfig.Pushgateway.Limits != current.Pushgateway.Limits {
+		r.pushgateway.SetLimits(Limits(newConfig))
+		applied = append(applied, "pushgateway.limits")
+	}
+	if newConfig.Pushgateway.TypeConflict != current.Pushgateway.TypeConflict {
+		r.pushgateway.SetTypeConflictPolicy(newConfig.Pushgateway.TypeConflict)
+		applied = append(applied, "pushgateway.type-conflict")
+	}
+	if newConfig.Healthchecks.Probers != current.Healthchecks.Probers {
+		r.store.SetProbers(newConfig.Healthchecks.Probers)
+		applied = append(applied, "healthchecks.probers")
+	}
+	if newHeartbeatInterval != currentHeartbeatInterval {
+		r.healthcheck.SetHeartbeatInterval(newHeartbeatInterval)
+		applied = append(applied, "healthchecks.heartbeat-interval")
+	}
+
+	// these settings require a restart
+	if newConfig.HTTP.Host != current.HTTP.Host {
+		ignored = append(ignored, "http.host")
+	}
+	if newConfig.HTTP.Port != current.HTTP.Port {
+		ignored = append(ignored, "http.port")
+	}
+	if (newConfig.HTTP.Cert != "") != r.server.TLSEnabled() {
+		ignored = append(ignored, "http.cert")
+	}
+	if newConfig.HTTP.Cacert != current.HTTP.Cacert {
+		ignored = append(ignored, "http.cacert")
+	}
+	if newConfig.HTTP.Insecure != current.HTTP.Insecure {
+		ignored = append(ignored, "http.insecure")
+	}
+	if newConfig.HTTP.ServerName != current.HTTP.ServerName {
+		ignored = append(ignored, "http.server-name")
+	}
+	if newConfig.HTTP.Metrics.PushgatewayMode() != current.HTTP.Metrics.PushgatewayMode() {
+		ignored = append(ignored, "http.metrics.pushgateway")
+	}
+	if newConfig.HTTP.RateLimit != current.HTTP.RateLimit {
+		ignored = append(ignored, "http.rate-limit")
+	}
+	if !reflect.DeepEqual(newConfig.HTTP.TrustedProxies, current.HTTP.TrustedProxies) {
+		ignored = append(ignored, "http.trusted-proxies")
+	}
+	if newConfig.Healthchecks.Directory != current.Healthchecks.Directory {
+		ignored = append(ignored, "healthchecks.directory")
+	}
+	if newConfig.Database != current.Database {
+		ignored = append(ignored, "database")
+	}
+	if newConfig.Pushgateway.Cache != current.Pushgateway.Cache {
+		ignored = append(ignored, "pushgateway.cache")
+	}
+	if !reflect.DeepEqual(newConfig.StatsD, current.StatsD) {
+		ignored = append(ignored, "statsd")
+	}
+
+	// the settings requiring a restart keep their running values, so they
+	// are reported again by the next reloads
+	running := *current
+	running.Logging = newConfig.Logging
+	running.HTTP.BasicAuth = newConfig.HTTP.BasicAuth
+	running.HTTP.Metrics.BasicAuth = newConfig.HTTP.Metrics.BasicAuth
+	running.Pushgateway.CleanupInterval = newConfig.Pushgateway.CleanupInterval
+	running.Pushgateway.RemoteWrite = newConfig.Pushgateway.RemoteWrite
+	running.Pushgateway.OTLP = newConfig.Pushgateway.OTLP
+	running.Pushgateway.Influx = newConfig.Pushgateway.Influx
+	running.Pushgateway.Limits = newConfig.Pushgateway.Limits
+	running.Pushgateway.TypeConflict = newConfig.Pushgateway.TypeConflict
+	running.Healthchecks.Probers = newConfig.Healthchecks.Probers
+	running.Healthchecks.HeartbeatInterval = newConfig.Healthchecks.HeartbeatInterval
+	r.current = &running
+	r.logger.Info(fmt.Sprintf("configuration reloaded, applied: [%s], ignored: [%s]", strings.Join(applied, ", "), strings.Join(ignored, ", ")))
+	return applied, ignored, nil
+}
@@ -0,0 +1,232 @@
+package reload_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/config"
+	"github.com/appclacks/server/internal/http"
+	"github.com/appclacks/server/internal/reload"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServices records the settings applied by the reloader
+type fakeServices struct {
+	applied []string
+	tls     bool
+	cert    *tls.Certificate
+}
+
+func (f *fakeServices) TLSEnabled() bool {
+	return f.tls
+}
+
+func (f *fakeServices) Certificate() *tls.Certificate {
+	return f.cert
+}
+
+func (f *fakeServices) UpdateCertificate(cert *tls.Certificate) {
+	f.cert = cert
+	f.applied = append(f.applied, "certificate")
+}
+
+func (f *fakeServices) UpdateCredentials(basicAuth http.BasicAuth, metricsBasicAuth http.BasicAuth) {
+	f.applied = append(f.applied, "credentials")
+}
+
+func (f *fakeServices) SetProbers(probers uint) {
+	f.applied = append(f.applied, "probers")
+}
+
+func (f *fakeServices) SetHeartbeatInterval(interval time.Duration) {
+	f.applied = append(f.applied, "heartbeat-interval")
+}
+
+func (f *fakeServices) SetCleanupInterval(interval time.Duration) {
+	f.applied = append(f.applied, "cleanup-interval")
+}
+
+func (f *fakeServices) SetRemoteWriteConfig(config pushgateway.RemoteWriteConfig) {
+	f.applied = append(f.applied, "remote-write")
+}
+
+func (f *fakeServices) SetOTLPConfig(config pushgateway.OTLPConfig) {
+	f.applied = append(f.applied, "otlp")
+}
+
+func (f *fakeServices) SetInfluxConfig(config pushgateway.InfluxConfig) {
+	f.applied = append(f.applied, "influx")
+}
+
+func (f *fakeServices) SetLimits(limits pushgateway.Limits) {
+	f.applied = append(f.applied, "limits")
+}
+
+func (f *fakeServices) SetTypeConflictPolicy(policy string) {
+	f.applied = append(f.applied, "type-conflict")
+}
+
+const baseConfig = `
+http:
+  host: %s
+  port: 9000
+  cert: %s
+  key: %s
+database:
+  username: appclacks
+  password: appclacks
+  database: appclacks
+  host: 127.0.0.1
+  port: 5432
+logging:
+  level: %s
+pushgateway:
+  limits:
+    max-series: %d
+`
+
+func writeConfig(t *testing.T, path string, host string, certDir string, level string, maxSeries int) {
+	t.Helper()
+	cert := ""
+	key := ""
+	if certDir != "" {
+		cert = filepath.Join(certDir, "cert.pem")
+		key = filepath.Join(certDir, "key.pem")
+	}
+	content := fmt.Sprintf(baseConfig, host, cert, key, level, maxSeries)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+// writeCertificate writes a new self-signed certificate in the directory
+func writeCertificate(t *testing.T, dir string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600))
+}
+
+func newReloader(t *testing.T, path string, services *fakeServices) (*reload.Reloader, *slog.LevelVar) {
+	t.Helper()
+	current, err := config.Load(path)
+	assert.NoError(t, err)
+	level := new(slog.LevelVar)
+	level.Set(reload.LogLevel(current, slog.LevelInfo))
+	reloader := reload.New(slog.Default(), path, current, level, slog.LevelInfo, services, services, services)
+	reloader.SetServer(services)
+	return reloader, level
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "127.0.0.1", "", "info", 100)
+	services := &fakeServices{}
+	reloader, level := newReloader(t, path, services)
+
+	writeConfig(t, path, "0.0.0.0", "", "debug", 200)
+	applied, ignored, err := reloader.Reload(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"logging.level", "pushgateway.limits"}, applied)
+	assert.Equal(t, []string{"http.host"}, ignored)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+	assert.Equal(t, []string{"limits"}, services.applied)
+
+	// the settings requiring a restart are still not applied
+	applied, ignored, err = reloader.Reload(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Equal(t, []string{"http.host"}, ignored)
+	assert.Equal(t, []string{"limits"}, services.applied)
+}
+
+func TestReloadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeCertificate(t, dir)
+	writeConfig(t, path, "127.0.0.1", dir, "info", 100)
+	services := &fakeServices{tls: true}
+	reloader, level := newReloader(t, path, services)
+
+	// invalid configuration file
+	writeConfig(t, path, "127.0.0.1", dir, "trace", 200)
+	_, _, err := reloader.Reload(context.Background())
+	assert.ErrorContains(t, err, "fail to reload the configuration")
+
+	// valid file with certificates which can't be loaded
+	assert.NoError(t, os.Remove(filepath.Join(dir, "key.pem")))
+	writeConfig(t, path, "127.0.0.1", dir, "debug", 200)
+	_, _, err = reloader.Reload(context.Background())
+	assert.ErrorContains(t, err, "fail to load certificates")
+
+	assert.Equal(t, slog.LevelInfo, level.Level())
+	assert.Empty(t, services.applied)
+}
+
+func TestReloadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeCertificate(t, dir)
+	writeConfig(t, path, "127.0.0.1", dir, "info", 100)
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	assert.NoError(t, err)
+	services := &fakeServices{tls: true, cert: &cert}
+	reloader, _ := newReloader(t, path, services)
+
+	// the served certificate is not replaced by the same one
+	applied, _, err := reloader.Reload(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Empty(t, services.applied)
+
+	writeCertificate(t, dir)
+	applied, _, err = reloader.Reload(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http.cert"}, applied)
+	assert.Equal(t, []string{"certificate"}, services.applied)
+	assert.NotEqual(t, cert.Certificate, services.cert.Certificate)
+}
+
+func TestReloadHeartbeatInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "127.0.0.1", "", "info", 100)
+	services := &fakeServices{}
+	reloader, level := newReloader(t, path, services)
+
+	// the ticker of the heartbeat checks requires a positive interval
+	content := fmt.Sprintf(baseConfig, "127.0.0.1", "", "", "debug", 200) + "healthchecks:\n  heartbeat-interval: 0s\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	_, _, err := reloader.Reload(context.Background())
+	assert.ErrorContains(t, err, "heartbeat interval should be positive")
+	assert.Equal(t, slog.LevelInfo, level.Level())
+	assert.Empty(t, services.applied)
+
+	// the interval is also checked for configurations not read from a file
+	_, err = reload.HeartbeatInterval(&config.Configuration{Healthchecks: config.Healthchecks{HeartbeatInterval: "-1s"}})
+	assert.ErrorContains(t, err, "should be positive")
+}
@@ -0,0 +1,95 @@
+package reload
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/appclacks/server/config"
+	"github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/pushgateway"
+)
+
+// ToLogLevel converts a configured log level, info by default
+func ToLogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "info":
+		return slog.LevelInfo
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// LogLevel returns the configured log level, defaultLevel if not set
+func LogLevel(config *config.Configuration, defaultLevel slog.Level) slog.Level {
+	if config.Logging.Level != "" {
+		return ToLogLevel(config.Logging.Level)
+	}
+	return defaultLevel
+}
+
+func CleanupInterval(config *config.Configuration) (time.Duration, error) {
+	if config.Pushgateway.CleanupInterval == "" {
+		return pushgateway.DefaultCleanupInterval, nil
+	}
+	return time.ParseDuration(config.Pushgateway.CleanupInterval)
+}
+
+func HeartbeatInterval(config *config.Configuration) (time.Duration, error) {
+	if config.Healthchecks.HeartbeatInterval == "" {
+		return healthcheck.DefaultHeartbeatInterval, nil
+	}
+	interval, err := time.ParseDuration(config.Healthchecks.HeartbeatInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval <= 0 {
+		return 0, errors.New("the healthchecks heartbeat interval should be positive")
+	}
+	return interval, nil
+}
+
+func RemoteWriteConfig(config *config.Configuration) (pushgateway.RemoteWriteConfig, error) {
+	result := pushgateway.RemoteWriteConfig{
+		TTL: config.Pushgateway.RemoteWrite.TTL,
+	}
+	for _, rule := range config.Pushgateway.RemoteWrite.Allow {
+		labelRule, err := pushgateway.NewLabelRule(rule.Label, rule.Regex)
+		if err != nil {
+			return result, err
+		}
+		result.Allow = append(result.Allow, labelRule)
+	}
+	for _, rule := range config.Pushgateway.RemoteWrite.Deny {
+		labelRule, err := pushgateway.NewLabelRule(rule.Label, rule.Regex)
+		if err != nil {
+			return result, err
+		}
+		result.Deny = append(result.Deny, labelRule)
+	}
+	return result, nil
+}
+
+func Limits(config *config.Configuration) pushgateway.Limits {
+	return pushgateway.Limits{
+		MaxSeries:           config.Pushgateway.Limits.MaxSeries,
+		MaxSeriesPerMetric:  config.Pushgateway.Limits.MaxSeriesPerMetric,
+		MaxLabelsPerSeries:  config.Pushgateway.Limits.MaxLabelsPerSeries,
+		MaxLabelValueLength: config.Pushgateway.Limits.MaxLabelValueLength,
+	}
+}
+
+func OTLPConfig(config *config.Configuration) pushgateway.OTLPConfig {
+	return pushgateway.OTLPConfig{
+		TTL:                          config.Pushgateway.OTLP.TTL,
+		PromoteResourceAttributes:    config.Pushgateway.OTLP.PromoteResourceAttributes,
+		PromoteAllResourceAttributes: config.Pushgateway.OTLP.PromoteAllResourceAttributes,
+		IgnoreResourceAttributes:     config.Pushgateway.OTLP.IgnoreResourceAttributes,
+	}
+}
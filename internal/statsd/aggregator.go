@@ -0,0 +1,271 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+)
+
+type series struct {
+	name   string
+	labels map[string]string
+}
+
+func (s series) key() string {
+	return pushgateway.SeriesKey(s.name, s.labels)
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value      float64
+	updated    bool
+	lastUpdate time.Time
+}
+
+type set struct {
+	series
+	values map[string]bool
+}
+
+// timer observations are cumulative, the quantiles are computed on the
+// observations of the last flush interval
+type timer struct {
+	series
+	count      float64
+	sum        float64
+	buckets    []float64
+	samples    []float64
+	quantiles  []aggregates.Quantile
+	updated    bool
+	lastUpdate time.Time
+}
+
+// aggregator aggregates StatsD samples between two flushes. Counters and
+// sets are reset on each flush, gauges and timers are kept in memory
+// but only flushed if they were updated. They are evicted if they are not
+// updated for one TTL.
+type aggregator struct {
+	lock      sync.Mutex
+	ttl       time.Duration
+	histogram bool
+	buckets   []float64
+	quantiles []float64
+	counters  map[string]*counter
+	gauges    map[string]*gauge
+	sets      map[string]*set
+	timers    map[string]*timer
+}
+
+func newAggregator(ttl time.Duration, histogram bool, buckets []float64, quantiles []float64) *aggregator {
+	return &aggregator{
+		ttl:       ttl,
+		histogram: histogram,
+		buckets:   buckets,
+		quantiles: quantiles,
+		counters:  make(map[string]*counter),
+		gauges:    make(map[string]*gauge),
+		sets:      make(map[string]*set),
+		timers:    make(map[string]*timer),
+	}
+}
+
+func (a *aggregator) add(s series, sample sample) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	key := s.key()
+	switch sample.kind {
+	case counterType:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counter{series: s}
+			a.counters[key] = c
+		}
+		c.value += sample.value / sample.rate
+	case gaugeType:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gauge{series: s}
+			a.gauges[key] = g
+		}
+		if sample.relative {
+			g.value += sample.value
+		} else {
+			g.value = sample.value
+		}
+		g.updated = true
+		g.lastUpdate = time.Now()
+	case setType:
+		st, ok := a.sets[key]
+		if !ok {
+			st = &set{series: s, values: make(map[string]bool)}
+			a.sets[key] = st
+		}
+		st.values[sample.setValue] = true
+	case timerType, histogramType, distributionType:
+		value := sample.value
+		// timers are in milliseconds
+		if sample.kind == timerType {
+			value = value / 1000
+		}
+		t, ok := a.timers[key]
+		if !ok {
+			t = &timer{series: s, buckets: make([]float64, len(a.buckets))}
+			a.timers[key] = t
+		}
+		weight := 1 / sample.rate
+		t.count += weight
+		t.sum += value * weight
+		for i, bound := range a.buckets {
+			if value <= bound {
+				t.buckets[i] += weight
+			}
+		}
+		t.samples = append(t.samples, value)
+		t.updated = true
+		t.lastUpdate = time.Now()
+	}
+}
+
+// quantile returns the nearest rank quantile of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func (a *aggregator) timerMetric(t *timer) aggregates.PushgatewayMetric {
+	count := uint64(math.Round(t.count))
+	if a.histogram {
+		histogramType := "histogram"
+		histogram := &aggregates.Histogram{
+			Sum:   t.sum,
+			Count: count,
+		}
+		for i, bound := range a.buckets {
+			histogram.Buckets = append(histogram.Buckets, aggregates.Bucket{
+				UpperBound: bound,
+				Count:      uint64(math.Round(t.buckets[i])),
+			})
+		}
+		histogram.Buckets = append(histogram.Buckets, aggregates.Bucket{
+			UpperBound: math.Inf(1),
+			Count:      count,
+		})
+		return aggregates.PushgatewayMetric{
+			Name:      t.name,
+			Labels:    t.labels,
+			Type:      &histogramType,
+			Histogram: histogram,
+		}
+	}
+	if len(t.samples) > 0 {
+		sort.Float64s(t.samples)
+		t.quantiles = []aggregates.Quantile{}
+		for _, q := range a.quantiles {
+			t.quantiles = append(t.quantiles, aggregates.Quantile{
+				Quantile: q,
+				Value:    quantile(t.samples, q),
+			})
+		}
+	}
+	summaryType := "summary"
+	return aggregates.PushgatewayMetric{
+		Name:   t.name,
+		Labels: t.labels,
+		Type:   &summaryType,
+		Summary: &aggregates.Summary{
+			Sum:       t.sum,
+			Count:     count,
+			Quantiles: append([]aggregates.Quantile{}, t.quantiles...),
+		},
+	}
+}
+
+// restore adds back increments which were not flushed
+func (a *aggregator) restore(increments []aggregates.PushgatewayMetric) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, increment := range increments {
+		s := series{name: increment.Name, labels: increment.Labels}
+		key := s.key()
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counter{series: s}
+			a.counters[key] = c
+		}
+		c.value += increment.Value
+	}
+}
+
+// expired returns true if the gauge or timer was not updated for one TTL
+func (a *aggregator) expired(lastUpdate time.Time, now time.Time) bool {
+	return a.ttl > 0 && now.Sub(lastUpdate) > a.ttl
+}
+
+// flush returns the counters increments and the other metrics updated
+// since the last flush
+func (a *aggregator) flush() ([]aggregates.PushgatewayMetric, []aggregates.PushgatewayMetric) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	increments := []aggregates.PushgatewayMetric{}
+	metrics := []aggregates.PushgatewayMetric{}
+	counterType := "counter"
+	gaugeType := "gauge"
+	for _, c := range a.counters {
+		increments = append(increments, aggregates.PushgatewayMetric{
+			Name:   c.name,
+			Labels: c.labels,
+			Type:   &counterType,
+			Value:  c.value,
+		})
+	}
+	for key, g := range a.gauges {
+		if !g.updated {
+			if a.expired(g.lastUpdate, now) {
+				delete(a.gauges, key)
+			}
+			continue
+		}
+		g.updated = false
+		metrics = append(metrics, aggregates.PushgatewayMetric{
+			Name:   g.name,
+			Labels: g.labels,
+			Type:   &gaugeType,
+			Value:  g.value,
+		})
+	}
+	for _, st := range a.sets {
+		metrics = append(metrics, aggregates.PushgatewayMetric{
+			Name:   st.name,
+			Labels: st.labels,
+			Type:   &gaugeType,
+			Value:  float64(len(st.values)),
+		})
+	}
+	for key, t := range a.timers {
+		if !t.updated {
+			if a.expired(t.lastUpdate, now) {
+				delete(a.timers, key)
+			}
+			continue
+		}
+		metrics = append(metrics, a.timerMetric(t))
+		t.updated = false
+		t.samples = nil
+	}
+	a.counters = make(map[string]*counter)
+	a.sets = make(map[string]*set)
+	return increments, metrics
+}
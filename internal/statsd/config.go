@@ -0,0 +1,28 @@
+package statsd
+
+// Mapping converts a dotted StatsD name to a Prometheus name and labels.
+// A * in the match expression matches a single name component, the name
+// and the labels values can reference the matched components (${1}, ${2}...).
+type Mapping struct {
+	Match  string `validate:"required"`
+	Name   string `validate:"required"`
+	Labels map[string]string
+}
+
+// Configuration of the StatsD listener, which is disabled if no address is set.
+// Timers are converted to summaries or histograms depending on the timer type.
+type Configuration struct {
+	UDPAddress    string `yaml:"udp-address"`
+	TCPAddress    string `yaml:"tcp-address"`
+	FlushInterval string `yaml:"flush-interval"`
+	TTL           string `yaml:"ttl"`
+	TimerType     string `yaml:"timer-type" validate:"omitempty,oneof=summary histogram"`
+	Buckets       []float64
+	Quantiles     []float64 `validate:"dive,gt=0,lt=1"`
+	Mappings      []Mapping `validate:"dive"`
+}
+
+// Enabled returns true if the StatsD listener should be started
+func (c Configuration) Enabled() bool {
+	return c.UDPAddress != "" || c.TCPAddress != ""
+}
@@ -0,0 +1,91 @@
+package statsd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+type mappingRule struct {
+	regex  *regexp.Regexp
+	name   string
+	labels map[string]string
+}
+
+// mapper converts StatsD names to Prometheus names and labels
+type mapper struct {
+	rules []mappingRule
+}
+
+// globToRegex converts a match expression to a regular expression, a *
+// matching a single name component
+func globToRegex(glob string) (*regexp.Regexp, error) {
+	components := strings.Split(glob, ".")
+	for i, component := range components {
+		if component == "*" {
+			components[i] = "([^.]+)"
+		} else {
+			components[i] = regexp.QuoteMeta(component)
+		}
+	}
+	return regexp.Compile("^" + strings.Join(components, `\.`) + "$")
+}
+
+func newMapper(mappings []Mapping) (*mapper, error) {
+	result := &mapper{}
+	for _, mapping := range mappings {
+		regex, err := globToRegex(mapping.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid StatsD mapping %s: %w", mapping.Match, err)
+		}
+		for label := range mapping.Labels {
+			if !model.LegacyValidation.IsValidLabelName(label) || strings.HasPrefix(label, "__") {
+				return nil, fmt.Errorf("invalid StatsD mapping %s: invalid label name %s", mapping.Match, label)
+			}
+		}
+		result.rules = append(result.rules, mappingRule{
+			regex:  regex,
+			name:   mapping.Name,
+			labels: mapping.Labels,
+		})
+	}
+	return result, nil
+}
+
+// sanitize replaces the characters not allowed in Prometheus names by _
+func sanitize(name string) string {
+	result := []byte(name)
+	for i, c := range result {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !valid {
+			result[i] = '_'
+		}
+	}
+	if len(result) > 0 && result[0] >= '0' && result[0] <= '9' {
+		return "_" + string(result)
+	}
+	return string(result)
+}
+
+// mapName returns the Prometheus name and labels of a StatsD metric. The
+// first matching mapping is used, names are sanitized if no mapping matches.
+func (m *mapper) mapName(name string) (string, map[string]string, error) {
+	labels := make(map[string]string)
+	for _, rule := range m.rules {
+		match := rule.regex.FindStringSubmatchIndex(name)
+		if match == nil {
+			continue
+		}
+		result := string(rule.regex.ExpandString(nil, rule.name, name, match))
+		for label, template := range rule.labels {
+			labels[label] = string(rule.regex.ExpandString(nil, template, name, match))
+		}
+		if !model.LegacyValidation.IsValidMetricName(result) {
+			return "", nil, fmt.Errorf("the mapping %s produces the invalid metric name %s", rule.regex.String(), result)
+		}
+		return result, labels, nil
+	}
+	return sanitize(name), labels, nil
+}
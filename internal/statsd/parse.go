@@ -0,0 +1,89 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	counterType      = "c"
+	gaugeType        = "g"
+	timerType        = "ms"
+	histogramType    = "h"
+	distributionType = "d"
+	setType          = "s"
+)
+
+// sample is a value received in a StatsD line
+type sample struct {
+	name string
+	kind string
+	// value is not used for sets
+	value float64
+	// setValue is the raw value of sets
+	setValue string
+	// relative is true for gauges values starting with + or -
+	relative bool
+	rate     float64
+	tags     map[string]string
+}
+
+// parseTags parses DogStatsD tags (#tag1:value1,tag2:value2).
+// Tags without value are ignored.
+func parseTags(tags string) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range strings.Split(tags, ",") {
+		name, value, ok := strings.Cut(tag, ":")
+		if !ok || name == "" || value == "" {
+			continue
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// parseLine parses a StatsD line (<name>:<value>|<type>[|@<rate>][|#<tags>])
+func parseLine(line string) (sample, error) {
+	result := sample{rate: 1}
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return result, fmt.Errorf("invalid line %q: the metric name is missing", line)
+	}
+	result.name = name
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return result, fmt.Errorf("invalid line %q: the metric type is missing", line)
+	}
+	value := parts[0]
+	result.kind = parts[1]
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return result, fmt.Errorf("invalid line %q: invalid sample rate %s", line, part[1:])
+			}
+			result.rate = rate
+		case strings.HasPrefix(part, "#"):
+			result.tags = parseTags(part[1:])
+		}
+	}
+	switch result.kind {
+	case setType:
+		result.setValue = value
+		return result, nil
+	case gaugeType:
+		result.relative = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	case counterType, timerType, histogramType, distributionType:
+	default:
+		return result, fmt.Errorf("invalid line %q: unknown metric type %s", line, result.kind)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return result, fmt.Errorf("invalid line %q: invalid value %s", line, value)
+	}
+	result.value = v
+	return result, nil
+}
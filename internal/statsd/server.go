@@ -0,0 +1,344 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appclacks/server/internal/validator"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	maxPacketSize        = 65535
+)
+
+var defaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Pushgateway stores the aggregated metrics
+type Pushgateway interface {
+	BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error)
+	IncrementPushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error)
+}
+
+// Server receives StatsD metrics over UDP and TCP and flushes them
+// periodically into the pushgateway
+type Server struct {
+	config        Configuration
+	logger        *slog.Logger
+	pushgateway   Pushgateway
+	mapper        *mapper
+	aggregator    *aggregator
+	flushInterval time.Duration
+	ttl           time.Duration
+	udpConn       net.PacketConn
+	tcpListener   net.Listener
+	connections   map[net.Conn]bool
+	lock          sync.Mutex
+	wg            sync.WaitGroup
+	stop          chan bool
+	linesCounter  *prometheus.CounterVec
+	flushCounter  *prometheus.CounterVec
+}
+
+func New(logger *slog.Logger, config Configuration, pushgateway Pushgateway, registry *prometheus.Registry) (*Server, error) {
+	err := validator.Validator.Struct(config)
+	if err != nil {
+		return nil, err
+	}
+	flushInterval := defaultFlushInterval
+	if config.FlushInterval != "" {
+		flushInterval, err = time.ParseDuration(config.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid StatsD flush interval: %w", err)
+		}
+		if flushInterval <= 0 {
+			return nil, errors.New("the StatsD flush interval should be positive")
+		}
+	}
+	var ttl time.Duration
+	if config.TTL != "" {
+		ttl, err = time.ParseDuration(config.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid StatsD TTL: %w", err)
+		}
+		if ttl <= 0 {
+			return nil, errors.New("the StatsD TTL should be positive")
+		}
+	}
+	buckets := config.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return nil, errors.New("the StatsD buckets should be sorted without duplicates")
+		}
+	}
+	quantiles := config.Quantiles
+	if len(quantiles) == 0 {
+		quantiles = defaultQuantiles
+	}
+	mapper, err := newMapper(config.Mappings)
+	if err != nil {
+		return nil, err
+	}
+	linesCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_lines_total",
+			Help: "Count the number of StatsD lines received",
+		},
+		[]string{"status"})
+	err = registry.Register(linesCounter)
+	if err != nil {
+		return nil, err
+	}
+	flushCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_flushes_total",
+			Help: "Count the number of StatsD metrics flushes to the pushgateway",
+		},
+		[]string{"status"})
+	err = registry.Register(flushCounter)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		config:        config,
+		logger:        logger,
+		pushgateway:   pushgateway,
+		mapper:        mapper,
+		aggregator:    newAggregator(ttl, config.TimerType == "histogram", buckets, quantiles),
+		flushInterval: flushInterval,
+		ttl:           ttl,
+		connections:   make(map[net.Conn]bool),
+		stop:          make(chan bool),
+		linesCounter:  linesCounter,
+		flushCounter:  flushCounter,
+	}, nil
+}
+
+// handleLine parses a StatsD line and adds it to the aggregator
+func (s *Server) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	sample, err := parseLine(line)
+	if err != nil {
+		s.logger.Debug(err.Error())
+		s.linesCounter.With(prometheus.Labels{"status": "failure"}).Inc()
+		return
+	}
+	name, labels, err := s.mapper.mapName(sample.name)
+	if err != nil {
+		s.logger.Debug(err.Error())
+		s.linesCounter.With(prometheus.Labels{"status": "failure"}).Inc()
+		return
+	}
+	for k, v := range sample.tags {
+		label := sanitize(k)
+		if strings.HasPrefix(label, "__") {
+			continue
+		}
+		if _, ok := labels[label]; !ok {
+			labels[label] = v
+		}
+	}
+	s.aggregator.add(series{name: name, labels: labels}, sample)
+	s.linesCounter.With(prometheus.Labels{"status": "success"}).Inc()
+}
+
+func (s *Server) listenUDP() {
+	defer s.wg.Done()
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.udpConn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.Error(fmt.Sprintf("fail to read StatsD UDP packet: %s", err.Error()))
+			continue
+		}
+		for _, line := range strings.Split(string(buffer[:n]), "\n") {
+			s.handleLine(line)
+		}
+	}
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.lock.Lock()
+		delete(s.connections, conn)
+		s.lock.Unlock()
+		conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		s.handleLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.logger.Error(fmt.Sprintf("fail to read StatsD TCP connection: %s", err.Error()))
+	}
+}
+
+func (s *Server) listenTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.Error(fmt.Sprintf("fail to accept StatsD TCP connection: %s", err.Error()))
+			continue
+		}
+		s.lock.Lock()
+		s.connections[conn] = true
+		s.lock.Unlock()
+		s.wg.Add(1)
+		go s.handleConnection(conn)
+	}
+}
+
+// withTTL sets the TTL and the expiration date of the metric if a TTL is configured
+func (s *Server) withTTL(metric *aggregates.PushgatewayMetric, now time.Time) {
+	if s.ttl == 0 {
+		return
+	}
+	ttl := s.config.TTL
+	expiresAt := now.Add(s.ttl)
+	metric.TTL = &ttl
+	metric.ExpiresAt = &expiresAt
+}
+
+// Flush writes the metrics aggregated since the last flush
+func (s *Server) Flush(ctx context.Context) {
+	increments, metrics := s.aggregator.flush()
+	now := time.Now().UTC()
+	failed := false
+	retries := []aggregates.PushgatewayMetric{}
+	for _, increment := range increments {
+		pending := increment
+		s.withTTL(&increment, now)
+		pushgateway.InitPushgatewayMetric(&increment)
+		_, err := s.pushgateway.IncrementPushgatewayMetric(ctx, increment)
+		if err != nil {
+			failed = true
+			s.logger.Error(fmt.Sprintf("fail to flush StatsD counter %s: %s", increment.Name, err.Error()))
+			// invalid increments would fail again
+			var flushErr *er.Error
+			if !errors.As(err, &flushErr) || flushErr.Type != er.BadRequest {
+				retries = append(retries, pending)
+			}
+		}
+	}
+	s.aggregator.restore(retries)
+	// a single invalid metric would fail the whole batch
+	valid := []aggregates.PushgatewayMetric{}
+	seen := make(map[string]bool)
+	for _, metric := range metrics {
+		key := series{name: metric.Name, labels: metric.Labels}.key()
+		if seen[key] {
+			s.logger.Warn(fmt.Sprintf("StatsD metric %s is sent with multiple types, ignoring it", key))
+			continue
+		}
+		seen[key] = true
+		if err := pushgateway.ValidateDistribution(&metric); err != nil {
+			s.logger.Warn(fmt.Sprintf("invalid StatsD metric: %s", err.Error()))
+			continue
+		}
+		s.withTTL(&metric, now)
+		pushgateway.InitPushgatewayMetric(&metric)
+		valid = append(valid, metric)
+	}
+	if len(valid) > 0 {
+		_, err := s.pushgateway.BatchCreateOrUpdatePushgatewayMetrics(ctx, valid)
+		if err != nil {
+			failed = true
+			s.logger.Error(fmt.Sprintf("fail to flush StatsD metrics: %s", err.Error()))
+		}
+	}
+	if failed {
+		s.flushCounter.With(prometheus.Labels{"status": "failure"}).Inc()
+	} else {
+		s.flushCounter.With(prometheus.Labels{"status": "success"}).Inc()
+	}
+}
+
+func (s *Server) Start() error {
+	if s.config.UDPAddress != "" {
+		conn, err := net.ListenPacket("udp", s.config.UDPAddress)
+		if err != nil {
+			return fmt.Errorf("fail to start the StatsD UDP listener: %w", err)
+		}
+		s.udpConn = conn
+		s.logger.Info(fmt.Sprintf("statsd udp listener starting on %s", conn.LocalAddr().String()))
+		s.wg.Add(1)
+		go s.listenUDP()
+	}
+	if s.config.TCPAddress != "" {
+		listener, err := net.Listen("tcp", s.config.TCPAddress)
+		if err != nil {
+			if s.udpConn != nil {
+				s.udpConn.Close()
+			}
+			return fmt.Errorf("fail to start the StatsD TCP listener: %w", err)
+		}
+		s.tcpListener = listener
+		s.logger.Info(fmt.Sprintf("statsd tcp listener starting on %s", listener.Addr().String()))
+		s.wg.Add(1)
+		go s.listenTCP()
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), s.flushInterval)
+				s.Flush(ctx)
+				cancel()
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listeners then flushes the remaining metrics
+func (s *Server) Stop() {
+	s.logger.Info("stopping the statsd listener")
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
+	s.lock.Lock()
+	for conn := range s.connections {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.stop <- true
+	s.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.Flush(ctx)
+	s.logger.Info("statsd listener stopped")
+}
@@ -0,0 +1,212 @@
+package statsd_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/internal/statsd"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePushgateway struct {
+	lock       sync.Mutex
+	metrics    map[string]aggregates.PushgatewayMetric
+	increments map[string]float64
+	err        error
+}
+
+func (f *fakePushgateway) BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, metric := range metrics {
+		f.metrics[metric.Name] = metric
+	}
+	return nil, nil
+}
+
+func (f *fakePushgateway) IncrementPushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.increments[metric.Name] += metric.Value
+	return &metric, nil
+}
+
+func (f *fakePushgateway) setError(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.err = err
+}
+
+func (f *fakePushgateway) increment(name string) float64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.increments[name]
+}
+
+func (f *fakePushgateway) metric(name string) (aggregates.PushgatewayMetric, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	metric, ok := f.metrics[name]
+	return metric, ok
+}
+
+func freeUDPAddress(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := conn.LocalAddr().String()
+	conn.Close()
+	return address
+}
+
+// linesCount returns the number of lines received with this status
+func linesCount(t *testing.T, registry *prometheus.Registry, status string) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "statsd_lines_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == status {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestServer(t *testing.T) {
+	fake := &fakePushgateway{
+		metrics:    make(map[string]aggregates.PushgatewayMetric),
+		increments: make(map[string]float64),
+	}
+	address := freeUDPAddress(t)
+	registry := prometheus.NewRegistry()
+	server, err := statsd.New(slog.Default(), statsd.Configuration{
+		UDPAddress:    address,
+		FlushInterval: "1h",
+		TTL:           "5m",
+		TimerType:     "histogram",
+		Buckets:       []float64{0.1, 1},
+		Mappings: []statsd.Mapping{
+			{
+				Match:  "app.*.requests",
+				Name:   "app_requests_total",
+				Labels: map[string]string{"app": "${1}"},
+			},
+		},
+	}, fake, registry)
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+
+	conn, err := net.Dial("udp", address)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("app.api.requests:1|c|#env:prod\napp.api.requests:2|c|@0.5|#env:prod\nqueue.size:10|g\nqueue.size:-3|g\nrequest.duration:50|ms\nrequest.duration:500|ms\nrequest.duration:2000|ms\nusers:a|s\nusers:b|s\nusers:a|s\ninvalid line"))
+	assert.NoError(t, err)
+
+	// the invalid line is the last one
+	assert.Eventually(t, func() bool {
+		return linesCount(t, registry, "failure") == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(10), linesCount(t, registry, "success"))
+	server.Stop()
+
+	assert.Equal(t, float64(5), fake.increments["app_requests_total"])
+
+	gauge, _ := fake.metric("queue_size")
+	assert.Equal(t, float64(7), gauge.Value)
+	assert.Equal(t, "gauge", *gauge.Type)
+	assert.Equal(t, "5m", *gauge.TTL)
+	assert.NotNil(t, gauge.ExpiresAt)
+
+	users, _ := fake.metric("users")
+	assert.Equal(t, float64(2), users.Value)
+
+	timer, _ := fake.metric("request_duration")
+	assert.Equal(t, "histogram", *timer.Type)
+	assert.Equal(t, uint64(3), timer.Histogram.Count)
+	assert.InDelta(t, 2.55, timer.Histogram.Sum, 0.0001)
+	assert.Equal(t, []aggregates.Bucket{
+		{UpperBound: 0.1, Count: 1},
+		{UpperBound: 1, Count: 2},
+		{UpperBound: math.Inf(1), Count: 3},
+	}, timer.Histogram.Buckets)
+}
+
+// send sends StatsD lines and waits for the server to receive them
+func send(t *testing.T, conn net.Conn, registry *prometheus.Registry, lines string) {
+	t.Helper()
+	before := linesCount(t, registry, "success")
+	_, err := conn.Write([]byte(lines))
+	assert.NoError(t, err)
+	expected := before + float64(len(strings.Split(lines, "\n")))
+	assert.Eventually(t, func() bool {
+		return linesCount(t, registry, "success") == expected
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServerFlush(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakePushgateway{
+		metrics:    make(map[string]aggregates.PushgatewayMetric),
+		increments: make(map[string]float64),
+	}
+	address := freeUDPAddress(t)
+	registry := prometheus.NewRegistry()
+	server, err := statsd.New(slog.Default(), statsd.Configuration{
+		UDPAddress:    address,
+		FlushInterval: "1h",
+		TTL:           "50ms",
+	}, fake, registry)
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+	conn, err := net.Dial("udp", address)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// the increments of a failed flush are flushed with the next one
+	send(t, conn, registry, "requests:2|c")
+	fake.setError(errors.New("database unavailable"))
+	server.Flush(ctx)
+	send(t, conn, registry, "requests:3|c")
+	fake.setError(nil)
+	server.Flush(ctx)
+	assert.Equal(t, float64(5), fake.increment("requests"))
+
+	// invalid increments are dropped
+	send(t, conn, registry, "requests:1|c")
+	fake.setError(er.New("metric requests has the type gauge", er.BadRequest, true))
+	server.Flush(ctx)
+	fake.setError(nil)
+	server.Flush(ctx)
+	assert.Equal(t, float64(5), fake.increment("requests"))
+
+	// gauges not updated for one TTL are evicted
+	send(t, conn, registry, "queue.size:+3|g")
+	server.Flush(ctx)
+	gauge, _ := fake.metric("queue_size")
+	assert.Equal(t, float64(3), gauge.Value)
+	time.Sleep(100 * time.Millisecond)
+	server.Flush(ctx)
+	send(t, conn, registry, "queue.size:+2|g")
+	server.Flush(ctx)
+	gauge, _ = fake.metric("queue_size")
+	assert.Equal(t, float64(2), gauge.Value)
+}
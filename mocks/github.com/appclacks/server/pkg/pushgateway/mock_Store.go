@@ -8,6 +8,8 @@ import (
 	aggregates "github.com/appclacks/server/pkg/pushgateway/aggregates"
 
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // MockStore is an autogenerated mock type for the Store type
@@ -23,6 +25,65 @@ func (_m *MockStore) EXPECT() *MockStore_Expecter {
 	return &MockStore_Expecter{mock: &_m.Mock}
 }
 
+// BatchCreateOrUpdatePushgatewayMetrics provides a mock function with given fields: ctx, metrics
+func (_m *MockStore) BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error) {
+	ret := _m.Called(ctx, metrics)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BatchCreateOrUpdatePushgatewayMetrics")
+	}
+
+	var r0 []aggregates.BatchResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error)); ok {
+		return rf(ctx, metrics)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []aggregates.PushgatewayMetric) []aggregates.BatchResult); ok {
+		r0 = rf(ctx, metrics)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]aggregates.BatchResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []aggregates.PushgatewayMetric) error); ok {
+		r1 = rf(ctx, metrics)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BatchCreateOrUpdatePushgatewayMetrics'
+type MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call struct {
+	*mock.Call
+}
+
+// BatchCreateOrUpdatePushgatewayMetrics is a helper method to define mock.On call
+//   - ctx context.Context
+//   - metrics []aggregates.PushgatewayMetric
+func (_e *MockStore_Expecter) BatchCreateOrUpdatePushgatewayMetrics(ctx interface{}, metrics interface{}) *MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call {
+	return &MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call{Call: _e.mock.On("BatchCreateOrUpdatePushgatewayMetrics", ctx, metrics)}
+}
+
+func (_c *MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call) Run(run func(ctx context.Context, metrics []aggregates.PushgatewayMetric)) *MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]aggregates.PushgatewayMetric))
+	})
+	return _c
+}
+
+func (_c *MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call) Return(_a0 []aggregates.BatchResult, _a1 error) *MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call) RunAndReturn(run func(context.Context, []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error)) *MockStore_BatchCreateOrUpdatePushgatewayMetrics_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // CleanPushgatewayMetrics provides a mock function with given fields: ctx
 func (_m *MockStore) CleanPushgatewayMetrics(ctx context.Context) (int64, error) {
 	ret := _m.Called(ctx)
@@ -79,6 +140,121 @@ func (_c *MockStore_CleanPushgatewayMetrics_Call) RunAndReturn(run func(context.
 	return _c
 }
 
+// CountAllSeries provides a mock function with given fields: ctx
+func (_m *MockStore) CountAllSeries(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountAllSeries")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (int, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_CountAllSeries_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CountAllSeries'
+type MockStore_CountAllSeries_Call struct {
+	*mock.Call
+}
+
+// CountAllSeries is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *MockStore_Expecter) CountAllSeries(ctx interface{}) *MockStore_CountAllSeries_Call {
+	return &MockStore_CountAllSeries_Call{Call: _e.mock.On("CountAllSeries", ctx)}
+}
+
+func (_c *MockStore_CountAllSeries_Call) Run(run func(ctx context.Context)) *MockStore_CountAllSeries_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockStore_CountAllSeries_Call) Return(_a0 int, _a1 error) *MockStore_CountAllSeries_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_CountAllSeries_Call) RunAndReturn(run func(context.Context) (int, error)) *MockStore_CountAllSeries_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CountSeries provides a mock function with given fields: ctx, names
+func (_m *MockStore) CountSeries(ctx context.Context, names []string) (map[string]int, error) {
+	ret := _m.Called(ctx, names)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountSeries")
+	}
+
+	var r0 map[string]int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) (map[string]int, error)); ok {
+		return rf(ctx, names)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []string) map[string]int); ok {
+		r0 = rf(ctx, names)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, names)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_CountSeries_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CountSeries'
+type MockStore_CountSeries_Call struct {
+	*mock.Call
+}
+
+// CountSeries is a helper method to define mock.On call
+//   - ctx context.Context
+//   - names []string
+func (_e *MockStore_Expecter) CountSeries(ctx interface{}, names interface{}) *MockStore_CountSeries_Call {
+	return &MockStore_CountSeries_Call{Call: _e.mock.On("CountSeries", ctx, names)}
+}
+
+func (_c *MockStore_CountSeries_Call) Run(run func(ctx context.Context, names []string)) *MockStore_CountSeries_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]string))
+	})
+	return _c
+}
+
+func (_c *MockStore_CountSeries_Call) Return(_a0 map[string]int, _a1 error) *MockStore_CountSeries_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_CountSeries_Call) RunAndReturn(run func(context.Context, []string) (map[string]int, error)) *MockStore_CountSeries_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // CreateOrUpdatePushgatewayMetric provides a mock function with given fields: ctx, metric, cumulative
 func (_m *MockStore) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric, cumulative bool) (string, error) {
 	ret := _m.Called(ctx, metric, cumulative)
@@ -183,6 +359,53 @@ func (_c *MockStore_DeleteAllPushgatewayMetrics_Call) RunAndReturn(run func(cont
 	return _c
 }
 
+// DeleteGroup provides a mock function with given fields: ctx, groupingKey
+func (_m *MockStore) DeleteGroup(ctx context.Context, groupingKey map[string]string) error {
+	ret := _m.Called(ctx, groupingKey)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteGroup")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]string) error); ok {
+		r0 = rf(ctx, groupingKey)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStore_DeleteGroup_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteGroup'
+type MockStore_DeleteGroup_Call struct {
+	*mock.Call
+}
+
+// DeleteGroup is a helper method to define mock.On call
+//   - ctx context.Context
+//   - groupingKey map[string]string
+func (_e *MockStore_Expecter) DeleteGroup(ctx interface{}, groupingKey interface{}) *MockStore_DeleteGroup_Call {
+	return &MockStore_DeleteGroup_Call{Call: _e.mock.On("DeleteGroup", ctx, groupingKey)}
+}
+
+func (_c *MockStore_DeleteGroup_Call) Run(run func(ctx context.Context, groupingKey map[string]string)) *MockStore_DeleteGroup_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(map[string]string))
+	})
+	return _c
+}
+
+func (_c *MockStore_DeleteGroup_Call) Return(_a0 error) *MockStore_DeleteGroup_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStore_DeleteGroup_Call) RunAndReturn(run func(context.Context, map[string]string) error) *MockStore_DeleteGroup_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // DeleteMetricByID provides a mock function with given fields: ctx, id
 func (_m *MockStore) DeleteMetricByID(ctx context.Context, id string) error {
 	ret := _m.Called(ctx, id)
@@ -230,6 +453,53 @@ func (_c *MockStore_DeleteMetricByID_Call) RunAndReturn(run func(context.Context
 	return _c
 }
 
+// DeleteMetricFamily provides a mock function with given fields: ctx, name
+func (_m *MockStore) DeleteMetricFamily(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteMetricFamily")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStore_DeleteMetricFamily_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteMetricFamily'
+type MockStore_DeleteMetricFamily_Call struct {
+	*mock.Call
+}
+
+// DeleteMetricFamily is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *MockStore_Expecter) DeleteMetricFamily(ctx interface{}, name interface{}) *MockStore_DeleteMetricFamily_Call {
+	return &MockStore_DeleteMetricFamily_Call{Call: _e.mock.On("DeleteMetricFamily", ctx, name)}
+}
+
+func (_c *MockStore_DeleteMetricFamily_Call) Run(run func(ctx context.Context, name string)) *MockStore_DeleteMetricFamily_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockStore_DeleteMetricFamily_Call) Return(_a0 error) *MockStore_DeleteMetricFamily_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStore_DeleteMetricFamily_Call) RunAndReturn(run func(context.Context, string) error) *MockStore_DeleteMetricFamily_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // DeleteMetricsByName provides a mock function with given fields: ctx, name
 func (_m *MockStore) DeleteMetricsByName(ctx context.Context, name string) error {
 	ret := _m.Called(ctx, name)
@@ -277,24 +547,83 @@ func (_c *MockStore_DeleteMetricsByName_Call) RunAndReturn(run func(context.Cont
 	return _c
 }
 
-// GetMetrics provides a mock function with given fields: ctx
-func (_m *MockStore) GetMetrics(ctx context.Context) ([]*aggregates.PushgatewayMetric, error) {
-	ret := _m.Called(ctx)
+// DeleteMetricsBySelectors provides a mock function with given fields: ctx, selectors
+func (_m *MockStore) DeleteMetricsBySelectors(ctx context.Context, selectors [][]aggregates.LabelMatcher) ([]*aggregates.PushgatewayMetric, error) {
+	ret := _m.Called(ctx, selectors)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetMetrics")
+		panic("no return value specified for DeleteMetricsBySelectors")
 	}
 
 	var r0 []*aggregates.PushgatewayMetric
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context) ([]*aggregates.PushgatewayMetric, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, [][]aggregates.LabelMatcher) ([]*aggregates.PushgatewayMetric, error)); ok {
+		return rf(ctx, selectors)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, [][]aggregates.LabelMatcher) []*aggregates.PushgatewayMetric); ok {
+		r0 = rf(ctx, selectors)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*aggregates.PushgatewayMetric)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, [][]aggregates.LabelMatcher) error); ok {
+		r1 = rf(ctx, selectors)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_DeleteMetricsBySelectors_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteMetricsBySelectors'
+type MockStore_DeleteMetricsBySelectors_Call struct {
+	*mock.Call
+}
+
+// DeleteMetricsBySelectors is a helper method to define mock.On call
+//   - ctx context.Context
+//   - selectors [][]aggregates.LabelMatcher
+func (_e *MockStore_Expecter) DeleteMetricsBySelectors(ctx interface{}, selectors interface{}) *MockStore_DeleteMetricsBySelectors_Call {
+	return &MockStore_DeleteMetricsBySelectors_Call{Call: _e.mock.On("DeleteMetricsBySelectors", ctx, selectors)}
+}
+
+func (_c *MockStore_DeleteMetricsBySelectors_Call) Run(run func(ctx context.Context, selectors [][]aggregates.LabelMatcher)) *MockStore_DeleteMetricsBySelectors_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([][]aggregates.LabelMatcher))
+	})
+	return _c
+}
+
+func (_c *MockStore_DeleteMetricsBySelectors_Call) Return(_a0 []*aggregates.PushgatewayMetric, _a1 error) *MockStore_DeleteMetricsBySelectors_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_DeleteMetricsBySelectors_Call) RunAndReturn(run func(context.Context, [][]aggregates.LabelMatcher) ([]*aggregates.PushgatewayMetric, error)) *MockStore_DeleteMetricsBySelectors_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetGroups provides a mock function with given fields: ctx
+func (_m *MockStore) GetGroups(ctx context.Context) ([]*aggregates.PushgatewayGroup, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetGroups")
+	}
+
+	var r0 []*aggregates.PushgatewayGroup
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]*aggregates.PushgatewayGroup, error)); ok {
 		return rf(ctx)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context) []*aggregates.PushgatewayMetric); ok {
+	if rf, ok := ret.Get(0).(func(context.Context) []*aggregates.PushgatewayGroup); ok {
 		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*aggregates.PushgatewayMetric)
+			r0 = ret.Get(0).([]*aggregates.PushgatewayGroup)
 		}
 	}
 
@@ -307,30 +636,528 @@ func (_m *MockStore) GetMetrics(ctx context.Context) ([]*aggregates.PushgatewayM
 	return r0, r1
 }
 
-// MockStore_GetMetrics_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetMetrics'
-type MockStore_GetMetrics_Call struct {
+// MockStore_GetGroups_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetGroups'
+type MockStore_GetGroups_Call struct {
 	*mock.Call
 }
 
-// GetMetrics is a helper method to define mock.On call
+// GetGroups is a helper method to define mock.On call
 //   - ctx context.Context
-func (_e *MockStore_Expecter) GetMetrics(ctx interface{}) *MockStore_GetMetrics_Call {
-	return &MockStore_GetMetrics_Call{Call: _e.mock.On("GetMetrics", ctx)}
+func (_e *MockStore_Expecter) GetGroups(ctx interface{}) *MockStore_GetGroups_Call {
+	return &MockStore_GetGroups_Call{Call: _e.mock.On("GetGroups", ctx)}
 }
 
-func (_c *MockStore_GetMetrics_Call) Run(run func(ctx context.Context)) *MockStore_GetMetrics_Call {
+func (_c *MockStore_GetGroups_Call) Run(run func(ctx context.Context)) *MockStore_GetGroups_Call {
 	_c.Call.Run(func(args mock.Arguments) {
 		run(args[0].(context.Context))
 	})
 	return _c
 }
 
-func (_c *MockStore_GetMetrics_Call) Return(_a0 []*aggregates.PushgatewayMetric, _a1 error) *MockStore_GetMetrics_Call {
+func (_c *MockStore_GetGroups_Call) Return(_a0 []*aggregates.PushgatewayGroup, _a1 error) *MockStore_GetGroups_Call {
 	_c.Call.Return(_a0, _a1)
 	return _c
 }
 
-func (_c *MockStore_GetMetrics_Call) RunAndReturn(run func(context.Context) ([]*aggregates.PushgatewayMetric, error)) *MockStore_GetMetrics_Call {
+func (_c *MockStore_GetGroups_Call) RunAndReturn(run func(context.Context) ([]*aggregates.PushgatewayGroup, error)) *MockStore_GetGroups_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetMetricFamilies provides a mock function with given fields: ctx
+func (_m *MockStore) GetMetricFamilies(ctx context.Context) ([]*aggregates.MetricFamily, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetMetricFamilies")
+	}
+
+	var r0 []*aggregates.MetricFamily
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]*aggregates.MetricFamily, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []*aggregates.MetricFamily); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*aggregates.MetricFamily)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_GetMetricFamilies_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetMetricFamilies'
+type MockStore_GetMetricFamilies_Call struct {
+	*mock.Call
+}
+
+// GetMetricFamilies is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *MockStore_Expecter) GetMetricFamilies(ctx interface{}) *MockStore_GetMetricFamilies_Call {
+	return &MockStore_GetMetricFamilies_Call{Call: _e.mock.On("GetMetricFamilies", ctx)}
+}
+
+func (_c *MockStore_GetMetricFamilies_Call) Run(run func(ctx context.Context)) *MockStore_GetMetricFamilies_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockStore_GetMetricFamilies_Call) Return(_a0 []*aggregates.MetricFamily, _a1 error) *MockStore_GetMetricFamilies_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_GetMetricFamilies_Call) RunAndReturn(run func(context.Context) ([]*aggregates.MetricFamily, error)) *MockStore_GetMetricFamilies_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetMetricFamily provides a mock function with given fields: ctx, name
+func (_m *MockStore) GetMetricFamily(ctx context.Context, name string) (*aggregates.MetricFamily, error) {
+	ret := _m.Called(ctx, name)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetMetricFamily")
+	}
+
+	var r0 *aggregates.MetricFamily
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*aggregates.MetricFamily, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *aggregates.MetricFamily); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*aggregates.MetricFamily)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_GetMetricFamily_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetMetricFamily'
+type MockStore_GetMetricFamily_Call struct {
+	*mock.Call
+}
+
+// GetMetricFamily is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *MockStore_Expecter) GetMetricFamily(ctx interface{}, name interface{}) *MockStore_GetMetricFamily_Call {
+	return &MockStore_GetMetricFamily_Call{Call: _e.mock.On("GetMetricFamily", ctx, name)}
+}
+
+func (_c *MockStore_GetMetricFamily_Call) Run(run func(ctx context.Context, name string)) *MockStore_GetMetricFamily_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockStore_GetMetricFamily_Call) Return(_a0 *aggregates.MetricFamily, _a1 error) *MockStore_GetMetricFamily_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_GetMetricFamily_Call) RunAndReturn(run func(context.Context, string) (*aggregates.MetricFamily, error)) *MockStore_GetMetricFamily_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetMetrics provides a mock function with given fields: ctx, query
+func (_m *MockStore) GetMetrics(ctx context.Context, query aggregates.Query) ([]*aggregates.PushgatewayMetric, error) {
+	ret := _m.Called(ctx, query)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetMetrics")
+	}
+
+	var r0 []*aggregates.PushgatewayMetric
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, aggregates.Query) ([]*aggregates.PushgatewayMetric, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, aggregates.Query) []*aggregates.PushgatewayMetric); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*aggregates.PushgatewayMetric)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, aggregates.Query) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_GetMetrics_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetMetrics'
+type MockStore_GetMetrics_Call struct {
+	*mock.Call
+}
+
+// GetMetrics is a helper method to define mock.On call
+//   - ctx context.Context
+//   - query aggregates.Query
+func (_e *MockStore_Expecter) GetMetrics(ctx interface{}, query interface{}) *MockStore_GetMetrics_Call {
+	return &MockStore_GetMetrics_Call{Call: _e.mock.On("GetMetrics", ctx, query)}
+}
+
+func (_c *MockStore_GetMetrics_Call) Run(run func(ctx context.Context, query aggregates.Query)) *MockStore_GetMetrics_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(aggregates.Query))
+	})
+	return _c
+}
+
+func (_c *MockStore_GetMetrics_Call) Return(_a0 []*aggregates.PushgatewayMetric, _a1 error) *MockStore_GetMetrics_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_GetMetrics_Call) RunAndReturn(run func(context.Context, aggregates.Query) ([]*aggregates.PushgatewayMetric, error)) *MockStore_GetMetrics_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// IncrementPushgatewayMetric provides a mock function with given fields: ctx, metric
+func (_m *MockStore) IncrementPushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error) {
+	ret := _m.Called(ctx, metric)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IncrementPushgatewayMetric")
+	}
+
+	var r0 *aggregates.PushgatewayMetric
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error)); ok {
+		return rf(ctx, metric)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, aggregates.PushgatewayMetric) *aggregates.PushgatewayMetric); ok {
+		r0 = rf(ctx, metric)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*aggregates.PushgatewayMetric)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, aggregates.PushgatewayMetric) error); ok {
+		r1 = rf(ctx, metric)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_IncrementPushgatewayMetric_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'IncrementPushgatewayMetric'
+type MockStore_IncrementPushgatewayMetric_Call struct {
+	*mock.Call
+}
+
+// IncrementPushgatewayMetric is a helper method to define mock.On call
+//   - ctx context.Context
+//   - metric aggregates.PushgatewayMetric
+func (_e *MockStore_Expecter) IncrementPushgatewayMetric(ctx interface{}, metric interface{}) *MockStore_IncrementPushgatewayMetric_Call {
+	return &MockStore_IncrementPushgatewayMetric_Call{Call: _e.mock.On("IncrementPushgatewayMetric", ctx, metric)}
+}
+
+func (_c *MockStore_IncrementPushgatewayMetric_Call) Run(run func(ctx context.Context, metric aggregates.PushgatewayMetric)) *MockStore_IncrementPushgatewayMetric_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(aggregates.PushgatewayMetric))
+	})
+	return _c
+}
+
+func (_c *MockStore_IncrementPushgatewayMetric_Call) Return(_a0 *aggregates.PushgatewayMetric, _a1 error) *MockStore_IncrementPushgatewayMetric_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_IncrementPushgatewayMetric_Call) RunAndReturn(run func(context.Context, aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error)) *MockStore_IncrementPushgatewayMetric_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PushGroup provides a mock function with given fields: ctx, groupingKey, metrics, replace, pushTime
+func (_m *MockStore) PushGroup(ctx context.Context, groupingKey map[string]string, metrics []aggregates.PushgatewayMetric, replace bool, pushTime time.Time) error {
+	ret := _m.Called(ctx, groupingKey, metrics, replace, pushTime)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PushGroup")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]string, []aggregates.PushgatewayMetric, bool, time.Time) error); ok {
+		r0 = rf(ctx, groupingKey, metrics, replace, pushTime)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStore_PushGroup_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PushGroup'
+type MockStore_PushGroup_Call struct {
+	*mock.Call
+}
+
+// PushGroup is a helper method to define mock.On call
+//   - ctx context.Context
+//   - groupingKey map[string]string
+//   - metrics []aggregates.PushgatewayMetric
+//   - replace bool
+//   - pushTime time.Time
+func (_e *MockStore_Expecter) PushGroup(ctx interface{}, groupingKey interface{}, metrics interface{}, replace interface{}, pushTime interface{}) *MockStore_PushGroup_Call {
+	return &MockStore_PushGroup_Call{Call: _e.mock.On("PushGroup", ctx, groupingKey, metrics, replace, pushTime)}
+}
+
+func (_c *MockStore_PushGroup_Call) Run(run func(ctx context.Context, groupingKey map[string]string, metrics []aggregates.PushgatewayMetric, replace bool, pushTime time.Time)) *MockStore_PushGroup_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(map[string]string), args[2].([]aggregates.PushgatewayMetric), args[3].(bool), args[4].(time.Time))
+	})
+	return _c
+}
+
+func (_c *MockStore_PushGroup_Call) Return(_a0 error) *MockStore_PushGroup_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStore_PushGroup_Call) RunAndReturn(run func(context.Context, map[string]string, []aggregates.PushgatewayMetric, bool, time.Time) error) *MockStore_PushGroup_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RecordPushFailure provides a mock function with given fields: ctx, groupingKey, failureTime
+func (_m *MockStore) RecordPushFailure(ctx context.Context, groupingKey map[string]string, failureTime time.Time) error {
+	ret := _m.Called(ctx, groupingKey, failureTime)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordPushFailure")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]string, time.Time) error); ok {
+		r0 = rf(ctx, groupingKey, failureTime)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStore_RecordPushFailure_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RecordPushFailure'
+type MockStore_RecordPushFailure_Call struct {
+	*mock.Call
+}
+
+// RecordPushFailure is a helper method to define mock.On call
+//   - ctx context.Context
+//   - groupingKey map[string]string
+//   - failureTime time.Time
+func (_e *MockStore_Expecter) RecordPushFailure(ctx interface{}, groupingKey interface{}, failureTime interface{}) *MockStore_RecordPushFailure_Call {
+	return &MockStore_RecordPushFailure_Call{Call: _e.mock.On("RecordPushFailure", ctx, groupingKey, failureTime)}
+}
+
+func (_c *MockStore_RecordPushFailure_Call) Run(run func(ctx context.Context, groupingKey map[string]string, failureTime time.Time)) *MockStore_RecordPushFailure_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(map[string]string), args[2].(time.Time))
+	})
+	return _c
+}
+
+func (_c *MockStore_RecordPushFailure_Call) Return(_a0 error) *MockStore_RecordPushFailure_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStore_RecordPushFailure_Call) RunAndReturn(run func(context.Context, map[string]string, time.Time) error) *MockStore_RecordPushFailure_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RegisterMetricFamilies provides a mock function with given fields: ctx, families
+func (_m *MockStore) RegisterMetricFamilies(ctx context.Context, families []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error) {
+	ret := _m.Called(ctx, families)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RegisterMetricFamilies")
+	}
+
+	var r0 []*aggregates.MetricFamily
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error)); ok {
+		return rf(ctx, families)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []aggregates.MetricFamily) []*aggregates.MetricFamily); ok {
+		r0 = rf(ctx, families)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*aggregates.MetricFamily)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []aggregates.MetricFamily) error); ok {
+		r1 = rf(ctx, families)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_RegisterMetricFamilies_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RegisterMetricFamilies'
+type MockStore_RegisterMetricFamilies_Call struct {
+	*mock.Call
+}
+
+// RegisterMetricFamilies is a helper method to define mock.On call
+//   - ctx context.Context
+//   - families []aggregates.MetricFamily
+func (_e *MockStore_Expecter) RegisterMetricFamilies(ctx interface{}, families interface{}) *MockStore_RegisterMetricFamilies_Call {
+	return &MockStore_RegisterMetricFamilies_Call{Call: _e.mock.On("RegisterMetricFamilies", ctx, families)}
+}
+
+func (_c *MockStore_RegisterMetricFamilies_Call) Run(run func(ctx context.Context, families []aggregates.MetricFamily)) *MockStore_RegisterMetricFamilies_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]aggregates.MetricFamily))
+	})
+	return _c
+}
+
+func (_c *MockStore_RegisterMetricFamilies_Call) Return(_a0 []*aggregates.MetricFamily, _a1 error) *MockStore_RegisterMetricFamilies_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_RegisterMetricFamilies_Call) RunAndReturn(run func(context.Context, []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error)) *MockStore_RegisterMetricFamilies_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SeriesExist provides a mock function with given fields: ctx, metrics
+func (_m *MockStore) SeriesExist(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]bool, error) {
+	ret := _m.Called(ctx, metrics)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SeriesExist")
+	}
+
+	var r0 []bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []aggregates.PushgatewayMetric) ([]bool, error)); ok {
+		return rf(ctx, metrics)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []aggregates.PushgatewayMetric) []bool); ok {
+		r0 = rf(ctx, metrics)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]bool)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []aggregates.PushgatewayMetric) error); ok {
+		r1 = rf(ctx, metrics)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStore_SeriesExist_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SeriesExist'
+type MockStore_SeriesExist_Call struct {
+	*mock.Call
+}
+
+// SeriesExist is a helper method to define mock.On call
+//   - ctx context.Context
+//   - metrics []aggregates.PushgatewayMetric
+func (_e *MockStore_Expecter) SeriesExist(ctx interface{}, metrics interface{}) *MockStore_SeriesExist_Call {
+	return &MockStore_SeriesExist_Call{Call: _e.mock.On("SeriesExist", ctx, metrics)}
+}
+
+func (_c *MockStore_SeriesExist_Call) Run(run func(ctx context.Context, metrics []aggregates.PushgatewayMetric)) *MockStore_SeriesExist_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]aggregates.PushgatewayMetric))
+	})
+	return _c
+}
+
+func (_c *MockStore_SeriesExist_Call) Return(_a0 []bool, _a1 error) *MockStore_SeriesExist_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStore_SeriesExist_Call) RunAndReturn(run func(context.Context, []aggregates.PushgatewayMetric) ([]bool, error)) *MockStore_SeriesExist_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateMetricFamily provides a mock function with given fields: ctx, family
+func (_m *MockStore) UpdateMetricFamily(ctx context.Context, family aggregates.MetricFamily) error {
+	ret := _m.Called(ctx, family)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateMetricFamily")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, aggregates.MetricFamily) error); ok {
+		r0 = rf(ctx, family)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStore_UpdateMetricFamily_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateMetricFamily'
+type MockStore_UpdateMetricFamily_Call struct {
+	*mock.Call
+}
+
+// UpdateMetricFamily is a helper method to define mock.On call
+//   - ctx context.Context
+//   - family aggregates.MetricFamily
+func (_e *MockStore_Expecter) UpdateMetricFamily(ctx interface{}, family interface{}) *MockStore_UpdateMetricFamily_Call {
+	return &MockStore_UpdateMetricFamily_Call{Call: _e.mock.On("UpdateMetricFamily", ctx, family)}
+}
+
+func (_c *MockStore_UpdateMetricFamily_Call) Run(run func(ctx context.Context, family aggregates.MetricFamily)) *MockStore_UpdateMetricFamily_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(aggregates.MetricFamily))
+	})
+	return _c
+}
+
+func (_c *MockStore_UpdateMetricFamily_Call) Return(_a0 error) *MockStore_UpdateMetricFamily_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStore_UpdateMetricFamily_Call) RunAndReturn(run func(context.Context, aggregates.MetricFamily) error) *MockStore_UpdateMetricFamily_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -43,6 +43,12 @@ func ToHealthcheckDefinition(templateType string, definition string) (Healthchec
 			return nil, fmt.Errorf("fail to deserialize healthcheck template definition: %w", err)
 		}
 		return &def, nil
+	case "heartbeat":
+		var def HealthcheckHeartbeatDefinition
+		if err := json.Unmarshal([]byte(definition), &def); err != nil {
+			return nil, fmt.Errorf("fail to deserialize healthcheck template definition: %w", err)
+		}
+		return &def, nil
 	}
 
 	return nil, fmt.Errorf("invalid template type %s", templateType)
@@ -0,0 +1,8 @@
+package aggregates
+
+// TargetGroup is a group of targets sharing the same labels, as returned by
+// the Prometheus HTTP service discovery
+type TargetGroup struct {
+	Targets []string
+	Labels  map[string]string
+}
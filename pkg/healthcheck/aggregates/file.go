@@ -0,0 +1,12 @@
+package aggregates
+
+import "time"
+
+// FileSyncStatus is the result of the last synchronization of a
+// healthchecks file
+type FileSyncStatus struct {
+	Source       string
+	Healthchecks []string
+	SyncedAt     time.Time
+	Error        *string
+}
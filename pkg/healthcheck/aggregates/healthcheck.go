@@ -17,6 +17,8 @@ type Healthcheck struct {
 	Enabled     bool
 	CreatedAt   time.Time
 	Definition  HealthcheckDefinition
+	// file defining the healthcheck, nil if managed through the API
+	Source *string
 }
 
 type Query struct {
@@ -0,0 +1,62 @@
+package aggregates
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HealthcheckHeartbeatDefinition is a passive check: the monitored job
+// pings the server, the check fails when a ping is missing.
+// Either the period or the cron schedule is defined.
+type HealthcheckHeartbeatDefinition struct {
+	Period   string `json:"period,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Grace    string `json:"grace,omitempty"`
+}
+
+func (h *HealthcheckHeartbeatDefinition) String() (string, error) {
+	result, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+func (h *HealthcheckHeartbeatDefinition) Summary() string {
+	if h.Schedule != "" {
+		return h.Schedule
+	}
+	return h.Period
+}
+
+const (
+	HeartbeatStatusNew  = "new"
+	HeartbeatStatusUp   = "up"
+	HeartbeatStatusDown = "down"
+)
+
+const (
+	HeartbeatPingSuccess = "success"
+	HeartbeatPingFail    = "fail"
+	HeartbeatPingStart   = "start"
+)
+
+type HeartbeatPing struct {
+	HealthcheckID string
+	Kind          string
+	Message       *string
+	At            time.Time
+}
+
+type HeartbeatState struct {
+	HealthcheckID string
+	Status        string
+	Message       *string
+	LastPingAt    *time.Time
+	LastStartAt   *time.Time
+	LastFailureAt *time.Time
+	// duration of the last job, in seconds
+	LastDuration *float64
+	UpdatedAt    time.Time
+}
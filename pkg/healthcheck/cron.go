@@ -0,0 +1,165 @@
+package healthcheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard cron expression:
+// minute hour day-of-month month day-of-week
+type cronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// when both the days of the month and of the week are restricted,
+	// matching one of them is enough
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// 7 is also sunday
+	{name: "day of week", min: 0, max: 7},
+}
+
+func parseCronValue(field cronField, value string) (int, error) {
+	result, err := strconv.Atoi(value)
+	if err != nil || result < field.min || result > field.max {
+		return 0, fmt.Errorf("invalid %s %s", field.name, value)
+	}
+	return result, nil
+}
+
+// parseCronField returns the bitset of the values matched by a field
+func parseCronField(field cronField, expression string) (uint64, error) {
+	var result uint64
+	for _, part := range strings.Split(expression, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %s", field.name, stepExpr)
+			}
+		}
+		start, end := field.min, field.max
+		if rangeExpr != "*" {
+			startExpr, endExpr, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			start, err = parseCronValue(field, startExpr)
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				end, err = parseCronValue(field, endExpr)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = field.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid %s range %s", field.name, rangeExpr)
+			}
+		}
+		for i := start; i <= end; i += step {
+			result |= 1 << uint(i)
+		}
+	}
+	return result, nil
+}
+
+func parseCron(expression string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[expression]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("the cron schedule should have %d fields", len(cronFields))
+	}
+	values := make([]uint64, len(fields))
+	for i, field := range fields {
+		value, err := parseCronField(cronFields[i], field)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	weekdays := values[4]
+	if weekdays&(1<<7) != 0 {
+		weekdays |= 1
+	}
+	return &cronSchedule{
+		minutes:            values[0],
+		hours:              values[1],
+		days:               values[2],
+		months:             values[3],
+		weekdays:           weekdays,
+		daysRestricted:     fields[2] != "*",
+		weekdaysRestricted: fields[4] != "*",
+	}, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+	if c.daysRestricted && c.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// next returns the first time matching the schedule strictly after t, in
+// the location of t. It returns false if nothing matches in the next
+// five years.
+func (c *cronSchedule) next(t time.Time) (time.Time, bool) {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
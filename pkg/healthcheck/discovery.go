@@ -0,0 +1,123 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	er "github.com/mcorbin/corbierror"
+)
+
+const metaLabelPrefix = "__meta_appclacks_"
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// ParseLabels parses a labels selector in the foo=bar,a=b format
+func ParseLabels(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if selector == "" {
+		return labels, nil
+	}
+	for _, label := range strings.Split(selector, ",") {
+		kvSplitted := strings.Split(label, "=")
+		if len(kvSplitted) != 2 {
+			return nil, er.New("Invalid labels parameter", er.BadRequest, true)
+		}
+		labels[kvSplitted[0]] = kvSplitted[1]
+	}
+	return labels, nil
+}
+
+func hostPort(target string, port uint) string {
+	if port == 0 {
+		return target
+	}
+	return net.JoinHostPort(target, fmt.Sprintf("%d", port))
+}
+
+// PrometheusTarget returns the address probed by a healthcheck. It returns
+// false for checks which can't be probed remotely, and for DNS checks
+// because the blackbox dns prober uses the target as the DNS server while
+// the queried domain can only be set in the module configuration.
+func PrometheusTarget(healthcheck *aggregates.Healthcheck) (string, bool) {
+	switch definition := healthcheck.Definition.(type) {
+	case *aggregates.HealthcheckTCPDefinition:
+		return hostPort(definition.Target, definition.Port), true
+	case *aggregates.HealthcheckTLSDefinition:
+		return hostPort(definition.Target, definition.Port), true
+	case *aggregates.HealthcheckHTTPDefinition:
+		return httpURL(definition), true
+	}
+	return "", false
+}
+
+// httpURL returns the URL requested by an HTTP healthcheck
+func httpURL(definition *aggregates.HealthcheckHTTPDefinition) string {
+	scheme := definition.Protocol
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := definition.Path
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	query := url.Values{}
+	for k, v := range definition.Query {
+		query.Set(k, v)
+	}
+	target := url.URL{
+		Scheme:   scheme,
+		Host:     hostPort(definition.Target, definition.Port),
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	return target.String()
+}
+
+// PrometheusTargetGroups returns a target group per enabled healthcheck
+// matching the labels and types, for the checks which can be probed by
+// the Prometheus blackbox exporter
+func (s *Service) PrometheusTargetGroups(ctx context.Context, labels map[string]string, types []string) ([]aggregates.TargetGroup, error) {
+	enabled := true
+	healthchecks, err := s.store.ListHealthchecks(ctx, &enabled)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(healthchecks, func(i, j int) bool {
+		return healthchecks[i].Name < healthchecks[j].Name
+	})
+	result := []aggregates.TargetGroup{}
+	for _, healthcheck := range healthchecks {
+		if len(types) > 0 && !slices.Contains(types, healthcheck.Type) {
+			continue
+		}
+		if !MatchLabels(healthcheck, labels) {
+			continue
+		}
+		target, ok := PrometheusTarget(healthcheck)
+		if !ok {
+			continue
+		}
+		groupLabels := map[string]string{
+			metaLabelPrefix + "id":       healthcheck.ID,
+			metaLabelPrefix + "name":     healthcheck.Name,
+			metaLabelPrefix + "type":     healthcheck.Type,
+			metaLabelPrefix + "interval": healthcheck.Interval,
+			metaLabelPrefix + "timeout":  healthcheck.Timeout,
+		}
+		for k, v := range healthcheck.Labels {
+			groupLabels[metaLabelPrefix+"label_"+invalidLabelChars.ReplaceAllString(k, "_")] = v
+		}
+		result = append(result, aggregates.TargetGroup{
+			Targets: []string{target},
+			Labels:  groupLabels,
+		})
+	}
+	return result, nil
+}
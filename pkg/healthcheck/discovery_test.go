@@ -0,0 +1,59 @@
+package healthcheck_test
+
+import (
+	"testing"
+
+	"github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusTarget(t *testing.T) {
+	cases := []struct {
+		definition aggregates.HealthcheckDefinition
+		expected   string
+		ok         bool
+	}{
+		{
+			// the blackbox exporter would use the domain as the DNS server
+			definition: &aggregates.HealthcheckDNSDefinition{Domain: "appclacks.com"},
+		},
+		{
+			definition: &aggregates.HealthcheckTCPDefinition{Target: "10.0.0.1", Port: 5432},
+			expected:   "10.0.0.1:5432",
+			ok:         true,
+		},
+		{
+			definition: &aggregates.HealthcheckTLSDefinition{Target: "::1", Port: 443},
+			expected:   "[::1]:443",
+			ok:         true,
+		},
+		{
+			definition: &aggregates.HealthcheckHTTPDefinition{Target: "appclacks.com", Port: 443, Protocol: "https", Path: "health", Query: map[string]string{"b": "2", "a": "1"}},
+			expected:   "https://appclacks.com:443/health?a=1&b=2",
+			ok:         true,
+		},
+		{
+			definition: &aggregates.HealthcheckCommandDefinition{Command: "ls"},
+		},
+		{
+			definition: &aggregates.HealthcheckHeartbeatDefinition{Period: "1h"},
+		},
+	}
+	for _, c := range cases {
+		target, ok := healthcheck.PrometheusTarget(&aggregates.Healthcheck{Definition: c.definition})
+		assert.Equal(t, c.ok, ok)
+		assert.Equal(t, c.expected, target)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := healthcheck.ParseLabels("env=prod,team=core")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "core"}, labels)
+	labels, err = healthcheck.ParseLabels("")
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+	_, err = healthcheck.ParseLabels("env")
+	assert.ErrorContains(t, err, "Invalid labels parameter")
+}
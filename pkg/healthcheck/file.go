@@ -0,0 +1,208 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/appclacks/server/internal/util"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+)
+
+// fileHealthchecks returns the healthchecks defined in files, by source
+func (s *Service) fileHealthchecks(ctx context.Context) (map[string]map[string]*aggregates.Healthcheck, error) {
+	healthchecks, err := s.store.ListHealthchecks(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]*aggregates.Healthcheck)
+	for _, healthcheck := range healthchecks {
+		if healthcheck.Source == nil {
+			continue
+		}
+		if _, ok := result[*healthcheck.Source]; !ok {
+			result[*healthcheck.Source] = make(map[string]*aggregates.Healthcheck)
+		}
+		result[*healthcheck.Source][healthcheck.Name] = healthcheck
+	}
+	return result, nil
+}
+
+func strPtrEqual(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// healthcheckChanged returns true if the definition of a healthcheck in its
+// file differs from the stored one
+func healthcheckChanged(current *aggregates.Healthcheck, healthcheck *aggregates.Healthcheck) (bool, error) {
+	if !strPtrEqual(current.Description, healthcheck.Description) ||
+		!maps.Equal(current.Labels, healthcheck.Labels) ||
+		current.Interval != healthcheck.Interval ||
+		current.Timeout != healthcheck.Timeout ||
+		current.Enabled != healthcheck.Enabled {
+		return true, nil
+	}
+	currentDef, err := current.Definition.String()
+	if err != nil {
+		return false, err
+	}
+	def, err := healthcheck.Definition.String()
+	if err != nil {
+		return false, err
+	}
+	return currentDef != def, nil
+}
+
+// syncHealthcheck creates or updates a healthcheck defined in a file. A
+// healthcheck whose type changed is recreated.
+func (s *Service) syncHealthcheck(ctx context.Context, source string, current *aggregates.Healthcheck, healthcheck *aggregates.Healthcheck) error {
+	err := validateHealthcheck(healthcheck)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Type == healthcheck.Type {
+		changed, err := healthcheckChanged(current, healthcheck)
+		if err != nil || !changed {
+			return err
+		}
+		s.logger.Info(fmt.Sprintf("updating healthcheck %s from the file %s", healthcheck.Name, source))
+		healthcheck.ID = current.ID
+		return s.store.UpdateHealthcheck(ctx, healthcheck)
+	}
+	if current != nil {
+		s.logger.Info(fmt.Sprintf("deleting healthcheck %s from the file %s, its type changed", current.Name, source))
+		err := s.store.DeleteHealthcheck(ctx, current.ID)
+		if err != nil {
+			return err
+		}
+	}
+	s.logger.Info(fmt.Sprintf("creating healthcheck %s from the file %s", healthcheck.Name, source))
+	healthcheck.ID = util.NewUUID()
+	healthcheck.CreatedAt = time.Now().UTC()
+	healthcheck.RandomID = rand.Intn(100000)
+	healthcheck.Source = &source
+	return s.store.CreateHealthcheck(ctx, healthcheck)
+}
+
+// SyncFile applies the healthchecks defined in a file: missing ones are
+// created, changed ones updated and the ones removed from the file are
+// deleted
+func (s *Service) SyncFile(ctx context.Context, source string, healthchecks []*aggregates.Healthcheck) error {
+	existing, err := s.fileHealthchecks(ctx)
+	if err != nil {
+		return err
+	}
+	current := existing[source]
+	names := []string{}
+	var errs []error
+	for _, healthcheck := range healthchecks {
+		err := s.syncHealthcheck(ctx, source, current[healthcheck.Name], healthcheck)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("healthcheck %s: %w", healthcheck.Name, err))
+			continue
+		}
+		names = append(names, healthcheck.Name)
+	}
+	defined := make(map[string]bool)
+	for _, healthcheck := range healthchecks {
+		defined[healthcheck.Name] = true
+	}
+	for name, healthcheck := range current {
+		if defined[name] {
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("deleting healthcheck %s, it was removed from the file %s", name, source))
+		err := s.store.DeleteHealthcheck(ctx, healthcheck.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("healthcheck %s: %w", name, err))
+		}
+	}
+	err = errors.Join(errs...)
+	s.setFileStatus(source, names, err)
+	return err
+}
+
+// RecordFileError keeps the healthchecks of a file which can't be read and
+// reports the error in its status
+func (s *Service) RecordFileError(source string, err error) {
+	s.filesLock.Lock()
+	defer s.filesLock.Unlock()
+	status := s.files[source]
+	status.Source = source
+	status.SyncedAt = time.Now().UTC()
+	message := err.Error()
+	status.Error = &message
+	s.files[source] = status
+}
+
+func (s *Service) setFileStatus(source string, names []string, err error) {
+	s.filesLock.Lock()
+	defer s.filesLock.Unlock()
+	sort.Strings(names)
+	status := aggregates.FileSyncStatus{
+		Source:       source,
+		Healthchecks: names,
+		SyncedAt:     time.Now().UTC(),
+	}
+	if err != nil {
+		message := err.Error()
+		status.Error = &message
+	}
+	s.files[source] = status
+}
+
+// RemoveStaleFiles deletes the healthchecks defined in files which are not
+// in the sources list anymore
+func (s *Service) RemoveStaleFiles(ctx context.Context, sources []string) error {
+	existing, err := s.fileHealthchecks(ctx)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool)
+	for _, source := range sources {
+		present[source] = true
+	}
+	var errs []error
+	for source, healthchecks := range existing {
+		if present[source] {
+			continue
+		}
+		for name, healthcheck := range healthchecks {
+			s.logger.Info(fmt.Sprintf("deleting healthcheck %s, the file %s was removed", name, source))
+			err := s.store.DeleteHealthcheck(ctx, healthcheck.ID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("healthcheck %s: %w", name, err))
+			}
+		}
+	}
+	s.filesLock.Lock()
+	defer s.filesLock.Unlock()
+	for source := range s.files {
+		if !present[source] {
+			delete(s.files, source)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FileSyncStatus returns the status of the healthchecks files, sorted by
+// source
+func (s *Service) FileSyncStatus() []aggregates.FileSyncStatus {
+	s.filesLock.Lock()
+	defer s.filesLock.Unlock()
+	result := []aggregates.FileSyncStatus{}
+	for _, status := range s.files {
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Source < result[j].Source
+	})
+	return result
+}
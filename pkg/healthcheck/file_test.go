@@ -0,0 +1,117 @@
+package healthcheck_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func fileHealthcheck(name string, source *string, checkType string, target string) *aggregates.Healthcheck {
+	check := &aggregates.Healthcheck{
+		ID:       name + "-id",
+		Name:     name,
+		Type:     checkType,
+		Interval: "30s",
+		Timeout:  "5s",
+		Enabled:  true,
+		Source:   source,
+	}
+	if checkType == "dns" {
+		check.Definition = &aggregates.HealthcheckDNSDefinition{Domain: target}
+	} else {
+		check.Definition = &aggregates.HealthcheckTCPDefinition{Target: target, Port: 443}
+	}
+	return check
+}
+
+func TestSyncFile(t *testing.T) {
+	ctx := context.Background()
+	source := "checks.yaml"
+	other := "other.yaml"
+	store := new(mocks.MockStore)
+	service, err := healthcheck.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	store.On("ListHealthchecks", ctx, (*bool)(nil)).Return([]*aggregates.Healthcheck{
+		fileHealthcheck("unchanged", &source, "dns", "appclacks.com"),
+		fileHealthcheck("changed", &source, "dns", "appclacks.com"),
+		fileHealthcheck("retyped", &source, "dns", "appclacks.com"),
+		fileHealthcheck("removed", &source, "dns", "appclacks.com"),
+		fileHealthcheck("other", &other, "dns", "appclacks.com"),
+		fileHealthcheck("api", nil, "dns", "appclacks.com"),
+	}, nil)
+	store.On("UpdateHealthcheck", ctx, mock.MatchedBy(func(check *aggregates.Healthcheck) bool {
+		return check.Name == "changed" && check.ID == "changed-id"
+	})).Return(nil).Once()
+	store.On("DeleteHealthcheck", ctx, "retyped-id").Return(nil).Once()
+	store.On("DeleteHealthcheck", ctx, "removed-id").Return(nil).Once()
+	store.On("CreateHealthcheck", ctx, mock.MatchedBy(func(check *aggregates.Healthcheck) bool {
+		return (check.Name == "retyped" || check.Name == "new") &&
+			check.Source != nil && *check.Source == source &&
+			check.ID != "" && check.ID != "retyped-id"
+	})).Return(nil).Twice()
+	store.On("CreateHealthcheck", ctx, mock.MatchedBy(func(check *aggregates.Healthcheck) bool {
+		return check.Name == "api"
+	})).Return(er.New("A healthcheck named api already exists", er.Conflict, true)).Once()
+
+	invalid := fileHealthcheck("invalid", nil, "dns", "appclacks.com")
+	invalid.Interval = "1s"
+	err = service.SyncFile(ctx, source, []*aggregates.Healthcheck{
+		fileHealthcheck("unchanged", nil, "dns", "appclacks.com"),
+		fileHealthcheck("changed", nil, "dns", "mcorbin.fr"),
+		fileHealthcheck("retyped", nil, "tcp", "appclacks.com"),
+		fileHealthcheck("new", nil, "dns", "appclacks.com"),
+		fileHealthcheck("api", nil, "dns", "appclacks.com"),
+		invalid,
+	})
+	assert.ErrorContains(t, err, "healthcheck api: A healthcheck named api already exists")
+	assert.ErrorContains(t, err, "healthcheck invalid: the minimum healthcheck interval is 5 seconds")
+	store.AssertExpectations(t)
+
+	status := service.FileSyncStatus()
+	assert.Len(t, status, 1)
+	assert.Equal(t, source, status[0].Source)
+	assert.Equal(t, []string{"changed", "new", "retyped", "unchanged"}, status[0].Healthchecks)
+	assert.NotNil(t, status[0].Error)
+
+	service.RecordFileError(other, errors.New("yaml: line 1: did not find expected key"))
+	status = service.FileSyncStatus()
+	assert.Len(t, status, 2)
+	assert.Equal(t, other, status[1].Source)
+	assert.Equal(t, "yaml: line 1: did not find expected key", *status[1].Error)
+
+	store.On("DeleteHealthcheck", ctx, "other-id").Return(nil).Once()
+	err = service.RemoveStaleFiles(ctx, []string{source})
+	assert.NoError(t, err)
+	status = service.FileSyncStatus()
+	assert.Len(t, status, 1)
+	assert.Equal(t, source, status[0].Source)
+	store.AssertExpectations(t)
+}
+
+func TestFileManagedHealthcheckReadOnly(t *testing.T) {
+	ctx := context.Background()
+	source := "checks.yaml"
+	store := new(mocks.MockStore)
+	service, err := healthcheck.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	check := fileHealthcheck("file", &source, "dns", "appclacks.com")
+	store.On("GetHealthcheck", ctx, check.ID).Return(check, nil)
+
+	update := fileHealthcheck("file", nil, "dns", "mcorbin.fr")
+	err = service.UpdateHealthcheck(ctx, update)
+	assert.ErrorContains(t, err, "healthcheck file is managed by the file checks.yaml")
+	err = service.DeleteHealthcheck(ctx, check.ID)
+	assert.ErrorContains(t, err, "healthcheck file is managed by the file checks.yaml")
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "UpdateHealthcheck", mock.Anything, mock.Anything)
+	store.AssertNotCalled(t, "DeleteHealthcheck", mock.Anything, mock.Anything)
+}
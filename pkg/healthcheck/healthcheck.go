@@ -9,6 +9,7 @@ import (
 	"github.com/appclacks/server/internal/util"
 	"github.com/appclacks/server/internal/validator"
 	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/google/uuid"
 	er "github.com/mcorbin/corbierror"
 )
 
@@ -46,8 +47,11 @@ func InitTLSHealthcheck(healthcheck *aggregates.Healthcheck) {
 	healthcheck.RandomID = rand.Intn(100000)
 }
 
-func (s *Service) CreateHealthcheck(ctx context.Context, healthcheck *aggregates.Healthcheck) error {
-	s.logger.Info(fmt.Sprintf("creating healthcheck %s", healthcheck.Name))
+// validateHealthcheck checks the interval and timeout of a new healthcheck
+func validateHealthcheck(healthcheck *aggregates.Healthcheck) error {
+	if healthcheck.Type == "heartbeat" {
+		return validateHeartbeat(healthcheck)
+	}
 	interval, err := time.ParseDuration(healthcheck.Interval)
 	if err != nil {
 		return er.New("invalid healthcheck interval", er.BadRequest, true)
@@ -62,15 +66,51 @@ func (s *Service) CreateHealthcheck(ctx context.Context, healthcheck *aggregates
 	if interval < timeout {
 		return er.New("the healthcheck interval should be greater than its timeout", er.BadRequest, true)
 	}
+	return nil
+}
+
+func (s *Service) CreateHealthcheck(ctx context.Context, healthcheck *aggregates.Healthcheck) error {
+	s.logger.Info(fmt.Sprintf("creating healthcheck %s", healthcheck.Name))
+	err := validateHealthcheck(healthcheck)
+	if err != nil {
+		return err
+	}
 	return s.store.CreateHealthcheck(ctx, healthcheck)
 }
 
+// checkNotFileManaged returns an error for the healthchecks defined in
+// files, they can only be changed by editing their file
+func checkNotFileManaged(healthcheck *aggregates.Healthcheck) error {
+	if healthcheck.Source != nil {
+		return er.Newf("healthcheck %s is managed by the file %s and is read-only through the API", er.Forbidden, true, healthcheck.Name, *healthcheck.Source)
+	}
+	return nil
+}
+
 func (s *Service) UpdateHealthcheck(ctx context.Context, healthcheck *aggregates.Healthcheck) error {
 	s.logger.Info(fmt.Sprintf("updating healthcheck %s", healthcheck.Name))
 	err := validator.Validator.Struct(*healthcheck)
 	if err != nil {
 		return err
 	}
+	current, err := s.store.GetHealthcheck(ctx, healthcheck.ID)
+	if err != nil {
+		return err
+	}
+	err = checkNotFileManaged(current)
+	if err != nil {
+		return err
+	}
+	if healthcheck.Type == "heartbeat" {
+		err := validateHeartbeat(healthcheck)
+		if err != nil {
+			return err
+		}
+		if current.Type != "heartbeat" {
+			return er.Newf("healthcheck %s is not a heartbeat check", er.BadRequest, true, current.Name)
+		}
+		return s.store.UpdateHealthcheck(ctx, healthcheck)
+	}
 	interval, err := time.ParseDuration(healthcheck.Interval)
 	if err != nil {
 		return er.New("Invalid healthcheck interval", er.BadRequest, true)
@@ -96,8 +136,24 @@ func (s *Service) GetHealthcheckByName(ctx context.Context, name string) (*aggre
 	return s.store.GetHealthcheckByName(ctx, name)
 }
 
+// getByIdentifier returns a healthcheck by ID or by name
+func (s *Service) getByIdentifier(ctx context.Context, identifier string) (*aggregates.Healthcheck, error) {
+	if _, err := uuid.Parse(identifier); err == nil {
+		return s.store.GetHealthcheck(ctx, identifier)
+	}
+	return s.store.GetHealthcheckByName(ctx, identifier)
+}
+
 func (s *Service) DeleteHealthcheck(ctx context.Context, id string) error {
 	s.logger.Info(fmt.Sprintf("deleting healthcheck %s", id))
+	current, err := s.store.GetHealthcheck(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = checkNotFileManaged(current)
+	if err != nil {
+		return err
+	}
 	return s.store.DeleteHealthcheck(ctx, id)
 }
 
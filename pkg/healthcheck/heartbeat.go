@@ -0,0 +1,272 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+	// the timezones of the cron schedules should not depend on the host
+	_ "time/tzdata"
+
+	"github.com/appclacks/server/internal/util"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	er "github.com/mcorbin/corbierror"
+)
+
+const DefaultHeartbeatInterval = 30 * time.Second
+
+func InitHeartbeatHealthcheck(healthcheck *aggregates.Healthcheck) {
+	healthcheck.ID = util.NewUUID()
+	healthcheck.CreatedAt = time.Now().UTC()
+	healthcheck.Type = "heartbeat"
+	healthcheck.RandomID = rand.Intn(100000)
+}
+
+type heartbeatSettings struct {
+	period   time.Duration
+	schedule *cronSchedule
+	location *time.Location
+	grace    time.Duration
+	// false when the definition has no grace time
+	hasGrace bool
+}
+
+func parseHeartbeat(definition *aggregates.HealthcheckHeartbeatDefinition) (*heartbeatSettings, error) {
+	result := &heartbeatSettings{location: time.UTC}
+	if (definition.Period == "") == (definition.Schedule == "") {
+		return nil, er.New("a heartbeat check requires either a period or a schedule", er.BadRequest, true)
+	}
+	if definition.Period != "" {
+		period, err := time.ParseDuration(definition.Period)
+		if err != nil {
+			return nil, er.New("invalid heartbeat period", er.BadRequest, true)
+		}
+		if period < time.Minute {
+			return nil, er.New("the minimum heartbeat period is 1 minute", er.BadRequest, true)
+		}
+		result.period = period
+	} else {
+		schedule, err := parseCron(definition.Schedule)
+		if err != nil {
+			return nil, er.Newf("invalid heartbeat schedule: %s", er.BadRequest, true, err.Error())
+		}
+		result.schedule = schedule
+	}
+	if definition.Timezone != "" {
+		if definition.Schedule == "" {
+			return nil, er.New("the heartbeat timezone requires a schedule", er.BadRequest, true)
+		}
+		location, err := time.LoadLocation(definition.Timezone)
+		if err != nil {
+			return nil, er.Newf("invalid heartbeat timezone %s", er.BadRequest, true, definition.Timezone)
+		}
+		result.location = location
+	}
+	if result.schedule != nil {
+		if _, ok := result.schedule.next(time.Now().In(result.location)); !ok {
+			return nil, er.New("the heartbeat schedule never matches", er.BadRequest, true)
+		}
+	}
+	if definition.Grace != "" {
+		grace, err := time.ParseDuration(definition.Grace)
+		if err != nil || grace < 0 {
+			return nil, er.New("invalid heartbeat grace time", er.BadRequest, true)
+		}
+		result.grace = grace
+		result.hasGrace = true
+	}
+	return result, nil
+}
+
+// validateHeartbeat checks the definition of a heartbeat check, the
+// interval and timeout of active checks are not used
+func validateHeartbeat(healthcheck *aggregates.Healthcheck) error {
+	definition, ok := healthcheck.Definition.(*aggregates.HealthcheckHeartbeatDefinition)
+	if !ok {
+		return er.New("invalid heartbeat definition", er.BadRequest, true)
+	}
+	_, err := parseHeartbeat(definition)
+	return err
+}
+
+// HeartbeatDeadline returns the time after which a heartbeat check
+// without new ping is failing.
+// A started job should complete during the grace time, or before its next
+// run if the check has no grace time. Otherwise the next ping is expected
+// one period, or at the next scheduled time, after the last one.
+func HeartbeatDeadline(healthcheck *aggregates.Healthcheck, state *aggregates.HeartbeatState) (time.Time, error) {
+	definition, ok := healthcheck.Definition.(*aggregates.HealthcheckHeartbeatDefinition)
+	if !ok {
+		return time.Time{}, fmt.Errorf("healthcheck %s is not a heartbeat check", healthcheck.Name)
+	}
+	settings, err := parseHeartbeat(definition)
+	if err != nil {
+		return time.Time{}, err
+	}
+	reference := healthcheck.CreatedAt
+	if state.LastPingAt != nil {
+		reference = *state.LastPingAt
+	}
+	if state.LastStartAt != nil && state.LastStartAt.After(reference) {
+		if settings.hasGrace {
+			return state.LastStartAt.Add(settings.grace), nil
+		}
+		reference = *state.LastStartAt
+	}
+	next, err := settings.next(reference)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("the schedule of the healthcheck %s %w", healthcheck.Name, err)
+	}
+	return next.Add(settings.grace), nil
+}
+
+// next returns the next expected run of the job after the reference
+func (s *heartbeatSettings) next(reference time.Time) (time.Time, error) {
+	if s.schedule == nil {
+		return reference.Add(s.period), nil
+	}
+	next, ok := s.schedule.next(reference.In(s.location))
+	if !ok {
+		return time.Time{}, errors.New("never matches")
+	}
+	return next.UTC(), nil
+}
+
+// getHeartbeat returns the heartbeat check by ID or by name
+func (s *Service) getHeartbeat(ctx context.Context, identifier string) (*aggregates.Healthcheck, error) {
+	healthcheck, err := s.getByIdentifier(ctx, identifier)
+	if err != nil {
+		return nil, err
+	}
+	if healthcheck.Type != "heartbeat" {
+		return nil, er.Newf("healthcheck %s is not a heartbeat check", er.BadRequest, true, healthcheck.Name)
+	}
+	return healthcheck, nil
+}
+
+// Heartbeat records a ping of a job monitored by a heartbeat check
+func (s *Service) Heartbeat(ctx context.Context, identifier string, kind string, message *string) (*aggregates.HeartbeatState, error) {
+	healthcheck, err := s.getHeartbeat(ctx, identifier)
+	if err != nil {
+		return nil, err
+	}
+	if kind == aggregates.HeartbeatPingFail {
+		s.logger.Info(fmt.Sprintf("heartbeat check %s reported a failure", healthcheck.Name))
+	}
+	state, err := s.store.RecordHeartbeatPing(ctx, aggregates.HeartbeatPing{
+		HealthcheckID: healthcheck.ID,
+		Kind:          kind,
+		Message:       message,
+		At:            time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if healthcheck.Enabled {
+		s.setHeartbeatGauge(healthcheck, state)
+	}
+	return state, nil
+}
+
+func (s *Service) GetHeartbeatState(ctx context.Context, identifier string) (*aggregates.Healthcheck, *aggregates.HeartbeatState, error) {
+	healthcheck, err := s.getHeartbeat(ctx, identifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := s.store.GetHeartbeatState(ctx, healthcheck.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return healthcheck, state, nil
+}
+
+func (s *Service) setHeartbeatGauge(healthcheck *aggregates.Healthcheck, state *aggregates.HeartbeatState) {
+	value := 1.0
+	if state.Status == aggregates.HeartbeatStatusDown {
+		value = 0
+	}
+	s.heartbeatGauge.WithLabelValues(healthcheck.Name).Set(value)
+}
+
+// EvaluateHeartbeats marks as failing the enabled heartbeat checks whose
+// deadline is exceeded
+func (s *Service) EvaluateHeartbeats(ctx context.Context) error {
+	enabled := true
+	healthchecks, err := s.store.ListHealthchecks(ctx, &enabled)
+	if err != nil {
+		return err
+	}
+	states, err := s.store.ListHeartbeatStates(ctx)
+	if err != nil {
+		return err
+	}
+	statesByID := make(map[string]*aggregates.HeartbeatState)
+	for _, state := range states {
+		statesByID[state.HealthcheckID] = state
+	}
+	now := time.Now().UTC()
+	s.heartbeatGauge.Reset()
+	for _, healthcheck := range healthchecks {
+		if healthcheck.Type != "heartbeat" {
+			continue
+		}
+		state, ok := statesByID[healthcheck.ID]
+		if !ok {
+			state = &aggregates.HeartbeatState{
+				HealthcheckID: healthcheck.ID,
+				Status:        aggregates.HeartbeatStatusNew,
+			}
+		}
+		deadline, err := HeartbeatDeadline(healthcheck, state)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("fail to evaluate heartbeat check %s: %s", healthcheck.Name, err.Error()))
+			continue
+		}
+		if state.Status != aggregates.HeartbeatStatusDown && now.After(deadline) {
+			message := fmt.Sprintf("no ping received before %s", deadline.Format(time.RFC3339))
+			updated, err := s.store.MarkHeartbeatDown(ctx, *state, message, now)
+			if err != nil {
+				return err
+			}
+			if updated {
+				s.logger.Info(fmt.Sprintf("heartbeat check %s is failing: %s", healthcheck.Name, message))
+				state.Status = aggregates.HeartbeatStatusDown
+			}
+		}
+		s.setHeartbeatGauge(healthcheck, state)
+	}
+	return nil
+}
+
+func (s *Service) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-s.ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				err := s.EvaluateHeartbeats(ctx)
+				if err != nil {
+					s.logger.Error(fmt.Sprintf("fail to evaluate heartbeat checks: %s", err.Error()))
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// SetHeartbeatInterval changes the interval of the heartbeat checks
+// evaluation
+func (s *Service) SetHeartbeatInterval(interval time.Duration) {
+	s.ticker.Reset(interval)
+}
+
+func (s *Service) Stop() {
+	s.ticker.Stop()
+	s.stop <- true
+	s.wg.Wait()
+}
@@ -0,0 +1,127 @@
+package healthcheck_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeatDeadline(t *testing.T) {
+	createdAt := time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)
+	pingAt := time.Date(2026, 10, 15, 23, 10, 0, 0, time.UTC)
+	startAt := time.Date(2026, 10, 16, 2, 0, 0, 0, time.UTC)
+	dstPingAt := time.Date(2026, 10, 24, 7, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name       string
+		definition aggregates.HealthcheckHeartbeatDefinition
+		state      aggregates.HeartbeatState
+		expected   time.Time
+		err        string
+	}{
+		{
+			name:       "period without ping",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Period: "1h", Grace: "5m"},
+			expected:   time.Date(2026, 10, 14, 11, 35, 0, 0, time.UTC),
+		},
+		{
+			name:       "period",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Period: "1h"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt},
+			expected:   time.Date(2026, 10, 16, 0, 10, 0, 0, time.UTC),
+		},
+		{
+			name:       "started job",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Period: "24h", Grace: "30m"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt, LastStartAt: &startAt},
+			expected:   time.Date(2026, 10, 16, 2, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "started job without grace time",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Period: "24h"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt, LastStartAt: &startAt},
+			expected:   time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "started scheduled job without grace time",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "0 */6 * * *"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt, LastStartAt: &startAt},
+			expected:   time.Date(2026, 10, 16, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "daily schedule",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "@daily", Grace: "10m"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt},
+			expected:   time.Date(2026, 10, 16, 0, 10, 0, 0, time.UTC),
+		},
+		{
+			name:       "schedule with timezone",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "30 2 * * *", Timezone: "Europe/Paris"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt},
+			expected:   time.Date(2026, 10, 16, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "schedule after a daylight saving time change",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "0 9 * * *", Timezone: "Europe/Paris"},
+			state:      aggregates.HeartbeatState{LastPingAt: &dstPingAt},
+			expected:   time.Date(2026, 10, 25, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "schedule with steps and ranges",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "*/20 8-18 * * 1-5"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt},
+			expected:   time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "day of month or day of week",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "0 0 1 * 0"},
+			state:      aggregates.HeartbeatState{LastPingAt: &pingAt},
+			expected:   time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "period and schedule",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Period: "1h", Schedule: "@daily"},
+			err:        "either a period or a schedule",
+		},
+		{
+			name:       "period too short",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Period: "10s"},
+			err:        "minimum heartbeat period",
+		},
+		{
+			name:       "invalid schedule",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "0 24 * * *"},
+			err:        "invalid hour 24",
+		},
+		{
+			name:       "schedule never matching",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "0 0 31 2 *"},
+			err:        "never matches",
+		},
+		{
+			name:       "invalid timezone",
+			definition: aggregates.HealthcheckHeartbeatDefinition{Schedule: "@daily", Timezone: "Mars/Olympus"},
+			err:        "invalid heartbeat timezone",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			definition := c.definition
+			check := &aggregates.Healthcheck{
+				Name:       "backup",
+				Type:       "heartbeat",
+				CreatedAt:  createdAt,
+				Definition: &definition,
+			}
+			deadline, err := healthcheck.HeartbeatDeadline(check, &c.state)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, deadline)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prober executes a healthcheck, registers its specific metrics and
+// returns true if it succeeded
+type prober func(ctx context.Context, healthcheck *aggregates.Healthcheck, registry *prometheus.Registry, logger *slog.Logger) bool
+
+var probers = map[string]prober{
+	"http": probeHTTP,
+	"tcp":  probeTCP,
+	"tls":  probeTLS,
+	"dns":  probeDNS,
+}
+
+// Probe executes an enabled healthcheck and registers its result in the
+// registry, with the blackbox exporter metrics names.
+// The module is optional and should be the healthcheck type if set. The
+// timeout, if not zero, shortens the healthcheck one.
+func (s *Service) Probe(ctx context.Context, target string, module string, timeout time.Duration, registry *prometheus.Registry) error {
+	healthcheck, err := s.getByIdentifier(ctx, target)
+	if err != nil {
+		return err
+	}
+	if module != "" && module != healthcheck.Type {
+		return er.Newf("healthcheck %s is a %s healthcheck, not %s", er.BadRequest, true, healthcheck.Name, healthcheck.Type, module)
+	}
+	probe, ok := probers[healthcheck.Type]
+	if !ok {
+		return er.Newf("%s healthchecks can't be probed", er.BadRequest, true, healthcheck.Type)
+	}
+	if !healthcheck.Enabled {
+		return er.Newf("healthcheck %s is disabled", er.BadRequest, true, healthcheck.Name)
+	}
+	checkTimeout, err := time.ParseDuration(healthcheck.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout for healthcheck %s: %w", healthcheck.Name, err)
+	}
+	if timeout > 0 && timeout < checkTimeout {
+		checkTimeout = timeout
+	}
+	successGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Displays whether or not the probe was a success",
+	})
+	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Returns how long the probe took to complete in seconds",
+	})
+	registry.MustRegister(successGauge, durationGauge)
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	start := time.Now()
+	success := probe(ctx, healthcheck, registry, s.logger)
+	durationGauge.Set(time.Since(start).Seconds())
+	if success {
+		successGauge.Set(1)
+	} else {
+		s.logger.Debug(fmt.Sprintf("probe of healthcheck %s failed", healthcheck.Name))
+	}
+	return nil
+}
+
+// newTLSConfig builds the TLS configuration of a healthcheck, the
+// certificates are read from files
+func newTLSConfig(key string, cert string, cacert string, serverName string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverName,
+		// #nosec G402 disabled explicitly by the healthcheck
+		InsecureSkipVerify: insecure,
+	}
+	if key != "" && cert != "" {
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load certificates: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if cacert != "" {
+		content, err := os.ReadFile(cacert)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read the CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("fail to parse the CA certificate %s", cacert)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// earliestExpiry returns the earliest expiration date of the certificates
+// presented by the server
+func earliestExpiry(state *tls.ConnectionState) time.Time {
+	result := time.Time{}
+	for _, certificate := range state.PeerCertificates {
+		if result.IsZero() || certificate.NotAfter.Before(result) {
+			result = certificate.NotAfter
+		}
+	}
+	return result
+}
+
+func registerTLSMetrics(registry *prometheus.Registry, state *tls.ConnectionState) {
+	expiryGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_ssl_earliest_cert_expiry",
+		Help: "Returns last SSL chain expiry in unixtime",
+	})
+	versionGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "probe_tls_version_info",
+		Help: "Returns the TLS version used or NaN when unknown",
+	}, []string{"version"})
+	registry.MustRegister(expiryGauge, versionGauge)
+	expiryGauge.Set(float64(earliestExpiry(state).Unix()))
+	versionGauge.WithLabelValues(tls.VersionName(state.Version)).Set(1)
+}
@@ -0,0 +1,128 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// only the beginning of the body is checked against the regular expressions
+const maxProbeBodySize = 1024 * 1024
+
+func probeHTTP(ctx context.Context, healthcheck *aggregates.Healthcheck, registry *prometheus.Registry, logger *slog.Logger) bool {
+	definition := healthcheck.Definition.(*aggregates.HealthcheckHTTPDefinition)
+	statusCodeGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_http_status_code",
+		Help: "Response HTTP status code",
+	})
+	contentLengthGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_http_content_length",
+		Help: "Length of http content response",
+	})
+	redirectsGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_http_redirects",
+		Help: "The number of redirects",
+	})
+	isSSLGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_http_ssl",
+		Help: "Indicates if SSL was used for the final redirect",
+	})
+	versionGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_http_version",
+		Help: "Returns the version of HTTP of the probe response",
+	})
+	failedRegexGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_failed_due_to_regex",
+		Help: "Indicates if probe failed due to regex",
+	})
+	registry.MustRegister(statusCodeGauge, contentLengthGauge, redirectsGauge, isSSLGauge, versionGauge, failedRegexGauge)
+
+	tlsConfig, err := newTLSConfig(definition.Key, definition.Cert, definition.Cacert, definition.ServerName, definition.Insecure)
+	if err != nil {
+		logger.Error(fmt.Sprintf("healthcheck %s: %s", healthcheck.Name, err.Error()))
+		return false
+	}
+	redirects := 0
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !definition.Redirect {
+				return http.ErrUseLastResponse
+			}
+			redirects = len(via)
+			if redirects > 10 {
+				return fmt.Errorf("too many redirects")
+			}
+			return nil
+		},
+	}
+	method := definition.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if definition.Body != "" {
+		body = strings.NewReader(definition.Body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, httpURL(definition), body)
+	if err != nil {
+		logger.Error(fmt.Sprintf("healthcheck %s: fail to build the request: %s", healthcheck.Name, err.Error()))
+		return false
+	}
+	for k, v := range definition.Headers {
+		request.Header.Set(k, v)
+	}
+	if definition.Host != "" {
+		request.Host = definition.Host
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		logger.Debug(fmt.Sprintf("healthcheck %s: %s", healthcheck.Name, err.Error()))
+		return false
+	}
+	defer response.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxProbeBodySize))
+	if err != nil {
+		logger.Debug(fmt.Sprintf("healthcheck %s: fail to read the response body: %s", healthcheck.Name, err.Error()))
+		return false
+	}
+	statusCodeGauge.Set(float64(response.StatusCode))
+	contentLength := response.ContentLength
+	if contentLength < 0 {
+		contentLength = int64(len(content))
+	}
+	contentLengthGauge.Set(float64(contentLength))
+	redirectsGauge.Set(float64(redirects))
+	versionGauge.Set(float64(response.ProtoMajor) + float64(response.ProtoMinor)/10)
+	if response.TLS != nil {
+		isSSLGauge.Set(1)
+		registerTLSMetrics(registry, response.TLS)
+	}
+	success := response.StatusCode >= 200 && response.StatusCode < 300
+	if len(definition.ValidStatus) > 0 {
+		success = slices.Contains(definition.ValidStatus, uint(response.StatusCode))
+	}
+	for _, expr := range definition.BodyRegexp {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			logger.Error(fmt.Sprintf("healthcheck %s: invalid body regular expression %s", healthcheck.Name, expr))
+			return false
+		}
+		if !regex.Match(content) {
+			failedRegexGauge.Set(1)
+			return false
+		}
+	}
+	return success
+}
@@ -0,0 +1,88 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func probeTCP(ctx context.Context, healthcheck *aggregates.Healthcheck, registry *prometheus.Registry, logger *slog.Logger) bool {
+	definition := healthcheck.Definition.(*aggregates.HealthcheckTCPDefinition)
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(definition.Target, definition.Port))
+	if err != nil {
+		logger.Debug(fmt.Sprintf("healthcheck %s: %s", healthcheck.Name, err.Error()))
+		return definition.ShouldFail
+	}
+	err = conn.Close()
+	if err != nil {
+		logger.Debug(fmt.Sprintf("healthcheck %s: fail to close the connection: %s", healthcheck.Name, err.Error()))
+	}
+	return !definition.ShouldFail
+}
+
+func probeTLS(ctx context.Context, healthcheck *aggregates.Healthcheck, registry *prometheus.Registry, logger *slog.Logger) bool {
+	definition := healthcheck.Definition.(*aggregates.HealthcheckTLSDefinition)
+	config, err := newTLSConfig(definition.Key, definition.Cert, definition.Cacert, definition.ServerName, definition.Insecure)
+	if err != nil {
+		logger.Error(fmt.Sprintf("healthcheck %s: %s", healthcheck.Name, err.Error()))
+		return false
+	}
+	var expirationDelay time.Duration
+	if definition.ExpirationDelay != "" {
+		expirationDelay, err = time.ParseDuration(definition.ExpirationDelay)
+		if err != nil {
+			logger.Error(fmt.Sprintf("healthcheck %s: invalid expiration delay %s", healthcheck.Name, definition.ExpirationDelay))
+			return false
+		}
+	}
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(definition.Target, definition.Port))
+	if err != nil {
+		logger.Debug(fmt.Sprintf("healthcheck %s: %s", healthcheck.Name, err.Error()))
+		return false
+	}
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+	registerTLSMetrics(registry, &state)
+	if expirationDelay > 0 && time.Until(earliestExpiry(&state)) < expirationDelay {
+		logger.Debug(fmt.Sprintf("healthcheck %s: the certificate expires in less than %s", healthcheck.Name, expirationDelay))
+		return false
+	}
+	return true
+}
+
+func probeDNS(ctx context.Context, healthcheck *aggregates.Healthcheck, registry *prometheus.Registry, logger *slog.Logger) bool {
+	definition := healthcheck.Definition.(*aggregates.HealthcheckDNSDefinition)
+	lookupGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_dns_lookup_time_seconds",
+		Help: "Returns the time taken for probe dns lookup in seconds",
+	})
+	answersGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_dns_answer_rrs",
+		Help: "Returns number of entries in the answer resource record list",
+	})
+	registry.MustRegister(lookupGauge, answersGauge)
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupHost(ctx, definition.Domain)
+	lookupGauge.Set(time.Since(start).Seconds())
+	if err != nil {
+		logger.Debug(fmt.Sprintf("healthcheck %s: %s", healthcheck.Name, err.Error()))
+		return false
+	}
+	answersGauge.Set(float64(len(ips)))
+	for _, expected := range definition.ExpectedIPs {
+		if !slices.Contains(ips, expected) {
+			logger.Debug(fmt.Sprintf("healthcheck %s: %s not found in the DNS answer", healthcheck.Name, expected))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,202 @@
+package healthcheck_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/healthcheck"
+	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func probeMetrics(t *testing.T, registry *prometheus.Registry, names ...string) string {
+	t.Helper()
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	var result strings.Builder
+	for _, name := range names {
+		for _, family := range families {
+			if family.GetName() == name {
+				for _, metric := range family.Metric {
+					fmt.Fprintf(&result, "%s %v\n", name, metric.GetGauge().GetValue())
+				}
+			}
+		}
+	}
+	return result.String()
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/health", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("status: ok"))
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	var serverPort uint
+	_, err = fmt.Sscanf(port, "%d", &serverPort)
+	assert.NoError(t, err)
+
+	store := new(mocks.MockStore)
+	service, err := healthcheck.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	checks := []*aggregates.Healthcheck{
+		{
+			Name:    "http-ok",
+			Type:    "http",
+			Timeout: "5s",
+			Enabled: true,
+			Definition: &aggregates.HealthcheckHTTPDefinition{
+				Target:     host,
+				Port:       serverPort,
+				Protocol:   "http",
+				Path:       "/redirect",
+				Redirect:   true,
+				BodyRegexp: []string{"status: ok"},
+			},
+		},
+		{
+			Name:    "http-regex",
+			Type:    "http",
+			Timeout: "5s",
+			Enabled: true,
+			Definition: &aggregates.HealthcheckHTTPDefinition{
+				Target:     host,
+				Port:       serverPort,
+				Protocol:   "http",
+				BodyRegexp: []string{"status: ko"},
+			},
+		},
+		{
+			Name:    "http-redirect",
+			Type:    "http",
+			Timeout: "5s",
+			Enabled: true,
+			Definition: &aggregates.HealthcheckHTTPDefinition{
+				Target:      host,
+				Port:        serverPort,
+				Protocol:    "http",
+				Path:        "/redirect",
+				ValidStatus: []uint{302},
+			},
+		},
+		{
+			Name:    "tcp-ok",
+			Type:    "tcp",
+			Timeout: "5s",
+			Enabled: true,
+			Definition: &aggregates.HealthcheckTCPDefinition{
+				Target: host,
+				Port:   serverPort,
+			},
+		},
+		{
+			Name:    "tcp-should-fail",
+			Type:    "tcp",
+			Timeout: "5s",
+			Enabled: true,
+			Definition: &aggregates.HealthcheckTCPDefinition{
+				Target:     host,
+				Port:       serverPort,
+				ShouldFail: true,
+			},
+		},
+		{
+			Name:       "command",
+			Type:       "command",
+			Timeout:    "5s",
+			Enabled:    true,
+			Definition: &aggregates.HealthcheckCommandDefinition{Command: "ls"},
+		},
+		{
+			Name:       "disabled",
+			Type:       "tcp",
+			Timeout:    "5s",
+			Definition: &aggregates.HealthcheckTCPDefinition{Target: host, Port: serverPort},
+		},
+	}
+	for _, check := range checks {
+		store.On("GetHealthcheckByName", mock.Anything, check.Name).Return(check, nil)
+	}
+
+	cases := []struct {
+		target   string
+		module   string
+		metrics  []string
+		expected string
+		err      string
+	}{
+		{
+			target:   "http-ok",
+			metrics:  []string{"probe_success", "probe_http_status_code", "probe_http_redirects", "probe_http_ssl", "probe_failed_due_to_regex"},
+			expected: "probe_success 1\nprobe_http_status_code 200\nprobe_http_redirects 1\nprobe_http_ssl 0\nprobe_failed_due_to_regex 0\n",
+		},
+		{
+			target:   "http-regex",
+			module:   "http",
+			metrics:  []string{"probe_success", "probe_failed_due_to_regex"},
+			expected: "probe_success 0\nprobe_failed_due_to_regex 1\n",
+		},
+		{
+			target:   "http-redirect",
+			metrics:  []string{"probe_success", "probe_http_status_code"},
+			expected: "probe_success 1\nprobe_http_status_code 302\n",
+		},
+		{
+			target:   "tcp-ok",
+			metrics:  []string{"probe_success"},
+			expected: "probe_success 1\n",
+		},
+		{
+			target:   "tcp-should-fail",
+			metrics:  []string{"probe_success"},
+			expected: "probe_success 0\n",
+		},
+		{
+			target: "tcp-ok",
+			module: "http",
+			err:    "healthcheck tcp-ok is a tcp healthcheck, not http",
+		},
+		{
+			target: "command",
+			err:    "command healthchecks can't be probed",
+		},
+		{
+			target: "disabled",
+			err:    "healthcheck disabled is disabled",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			err := service.Probe(ctx, c.target, c.module, time.Second, registry)
+			if c.err != "" {
+				var probeErr *er.Error
+				assert.ErrorAs(t, err, &probeErr)
+				assert.Equal(t, er.BadRequest, probeErr.Type)
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, probeMetrics(t, registry, c.metrics...))
+			assert.Contains(t, probeMetrics(t, registry, "probe_duration_seconds"), "probe_duration_seconds")
+		})
+	}
+}
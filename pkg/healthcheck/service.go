@@ -3,8 +3,11 @@ package healthcheck
 import (
 	"context"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/appclacks/server/pkg/healthcheck/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Store interface {
@@ -16,16 +19,40 @@ type Store interface {
 	ListHealthchecks(ctx context.Context, enabled *bool) ([]*aggregates.Healthcheck, error)
 	ListHealthchecksForProber(ctx context.Context, prober int) ([]*aggregates.Healthcheck, error)
 	CountHealthchecks(ctx context.Context) (int, error)
+	RecordHeartbeatPing(ctx context.Context, ping aggregates.HeartbeatPing) (*aggregates.HeartbeatState, error)
+	GetHeartbeatState(ctx context.Context, id string) (*aggregates.HeartbeatState, error)
+	ListHeartbeatStates(ctx context.Context) ([]*aggregates.HeartbeatState, error)
+	MarkHeartbeatDown(ctx context.Context, state aggregates.HeartbeatState, message string, at time.Time) (bool, error)
 }
 
 type Service struct {
-	logger *slog.Logger
-	store  Store
+	logger         *slog.Logger
+	store          Store
+	heartbeatGauge *prometheus.GaugeVec
+	wg             sync.WaitGroup
+	stop           chan bool
+	ticker         *time.Ticker
+	filesLock      sync.Mutex
+	files          map[string]aggregates.FileSyncStatus
 }
 
-func New(logger *slog.Logger, store Store) *Service {
-	return &Service{
-		logger: logger,
-		store:  store,
+func New(logger *slog.Logger, store Store, registry *prometheus.Registry) (*Service, error) {
+	heartbeatGauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "healthcheck_heartbeat_up",
+			Help: "Status of the enabled heartbeat checks, 0 if a ping is missing or the job failed",
+		},
+		[]string{"name"})
+	err := registry.Register(heartbeatGauge)
+	if err != nil {
+		return nil, err
 	}
+	return &Service{
+		logger:         logger,
+		store:          store,
+		heartbeatGauge: heartbeatGauge,
+		stop:           make(chan bool),
+		ticker:         time.NewTicker(DefaultHeartbeatInterval),
+		files:          make(map[string]aggregates.FileSyncStatus),
+	}, nil
 }
@@ -0,0 +1,25 @@
+package aggregates
+
+// Bucket is a histogram bucket. The count is cumulative, it includes
+// all observations lower than or equal to the upper bound.
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+type Histogram struct {
+	Buckets []Bucket
+	Sum     float64
+	Count   uint64
+}
+
+type Quantile struct {
+	Quantile float64
+	Value    float64
+}
+
+type Summary struct {
+	Quantiles []Quantile
+	Sum       float64
+	Count     uint64
+}
@@ -1,6 +1,9 @@
 package aggregates
 
-import "time"
+import (
+	"regexp"
+	"time"
+)
 
 type PushgatewayMetric struct {
 	ID          string
@@ -10,6 +13,105 @@ type PushgatewayMetric struct {
 	TTL         *string
 	Type        *string
 	CreatedAt   time.Time
+	UpdatedAt   time.Time
 	ExpiresAt   *time.Time
-	Value       string
+	// Timestamp is the optional timestamp of the sample
+	Timestamp *time.Time
+	// Value is not used for histograms and summaries
+	Value     float64
+	Histogram *Histogram
+	Summary   *Summary
+	// GroupingKey is set for metrics pushed using the Prometheus
+	// Pushgateway protocol
+	GroupingKey map[string]string
+}
+
+// PushgatewayGroup contains the last push times of a group of metrics
+// pushed using the Prometheus Pushgateway protocol
+type PushgatewayGroup struct {
+	GroupingKey     map[string]string
+	PushTime        *time.Time
+	PushFailureTime *time.Time
+}
+
+// BatchResult is the result of writing a metric in a batch
+type BatchResult struct {
+	ID      string
+	Created bool
+}
+
+// OTLPResult is the result of an OTLP metrics export, the messages
+// describe the rejected data points
+type OTLPResult struct {
+	Written  int
+	Rejected int64
+	Messages []string
+}
+
+// Label matcher types
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+// LabelMatcher matches the value of a label, the __name__ label being the
+// metric name. A missing label has an empty value.
+type LabelMatcher struct {
+	Name  string
+	Type  string
+	Value string
+	// Regex is the anchored regex of the =~ and !~ matchers
+	Regex *regexp.Regexp
+}
+
+// Query filters metrics by value, NaN values never match
+type Query struct {
+	MinValue *float64
+	MaxValue *float64
+	// Selectors are series selectors, metrics matching all the matchers
+	// of one of them are returned. No selector matches all metrics.
+	Selectors [][]LabelMatcher
+}
+
+// Usage contains the number of stored series, in total and per metric name
+type Usage struct {
+	Series  int
+	Metrics map[string]int
+}
+
+// PushgatewayChanges are changes written at once by the pushgateway cache.
+// Deletions are applied before writes.
+type PushgatewayChanges struct {
+	// Origin identifies the server writing the changes
+	Origin string
+	// DeleteAll deletes all metrics and groups
+	DeleteAll     bool
+	DeletedIDs    []string
+	DeletedGroups []map[string]string
+	Metrics       []PushgatewayMetric
+	Groups        []*PushgatewayGroup
+}
+
+// PushgatewayNotification describes the changes written by another
+// server. Full is set when the changes are unknown, the whole state should
+// be reloaded.
+type PushgatewayNotification struct {
+	Origin        string
+	Full          bool
+	MetricIDs     []string
+	DeletedIDs    []string
+	Groups        []*PushgatewayGroup
+	DeletedGroups []map[string]string
+}
+
+// MetricFamily contains the metadata shared by all the series of a metric
+type MetricFamily struct {
+	Name      string
+	Type      *string
+	Help      *string
+	Unit      *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
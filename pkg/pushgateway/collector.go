@@ -0,0 +1,142 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Collector exposes the pushgateway metrics through a Prometheus registry.
+// It is an unchecked collector: the pushed families are only known at
+// collection time.
+type Collector struct {
+	service  *Service
+	internal prometheus.Collector
+}
+
+// NewCollector returns a collector for the pushgateway metrics. Pushed
+// families whose names are used by the internal collector are skipped
+// because the registry would reject the whole scrape.
+func NewCollector(service *Service, internal prometheus.Collector) *Collector {
+	return &Collector{
+		service:  service,
+		internal: internal,
+	}
+}
+
+// Describe sends nothing so the collector is registered as unchecked
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	families, err := c.service.MetricFamilies(context.Background(), nil)
+	if err != nil {
+		// an invalid metric would fail the whole scrape, hiding the
+		// internal metrics
+		c.service.logger.Error(fmt.Sprintf("fail to get pushgateway metrics: %s", err.Error()))
+		return
+	}
+	reserved := c.reservedNames()
+	colliding := collidingNames(families)
+	for _, family := range families {
+		if reserved[family.GetName()] {
+			c.service.logger.Warn(fmt.Sprintf("skipping metric %s: the name is used by an internal metric", family.GetName()))
+			continue
+		}
+		if colliding[family.GetName()] {
+			c.service.logger.Warn(fmt.Sprintf("skipping metric %s: the name collides with a pushed histogram or summary", family.GetName()))
+			continue
+		}
+		desc := prometheus.NewDesc(family.GetName(), family.GetHelp(), nil, nil)
+		for _, metric := range family.Metric {
+			ch <- &pushedMetric{desc: desc, metric: metric}
+		}
+	}
+}
+
+// collidingNames returns the pushed families whose names are also used by
+// the series of a pushed histogram or summary, the registry rejects them
+func collidingNames(families []*dto.MetricFamily) map[string]bool {
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	result := make(map[string]bool)
+	for _, family := range families {
+		suffixes := []string{}
+		switch family.GetType() {
+		case dto.MetricType_HISTOGRAM:
+			suffixes = []string{"_count", "_sum", "_bucket"}
+		case dto.MetricType_SUMMARY:
+			suffixes = []string{"_count", "_sum"}
+		}
+		for _, suffix := range suffixes {
+			if names[family.GetName()+suffix] {
+				result[family.GetName()+suffix] = true
+			}
+		}
+	}
+	return result
+}
+
+// reservedNames returns the names of the families described by the
+// internal collector
+func (c *Collector) reservedNames() map[string]bool {
+	result := make(map[string]bool)
+	if c.internal == nil {
+		return result
+	}
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.internal.Describe(descs)
+		close(descs)
+	}()
+	for desc := range descs {
+		if name, ok := descName(desc); ok {
+			result[name] = true
+			// histograms and summaries also expose these series
+			for _, suffix := range []string{"_bucket", "_count", "_sum", "_created"} {
+				result[name+suffix] = true
+			}
+		}
+	}
+	return result
+}
+
+// descName extracts the family name of a descriptor, the client library
+// only exposes it through the string representation
+func descName(desc *prometheus.Desc) (string, bool) {
+	_, rest, ok := strings.Cut(desc.String(), "fqName: ")
+	if !ok {
+		return "", false
+	}
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		return "", false
+	}
+	name, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// pushedMetric is a series already converted to the exposition model
+type pushedMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+func (m *pushedMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *pushedMetric) Write(out *dto.Metric) error {
+	proto.Merge(out, m.metric)
+	return nil
+}
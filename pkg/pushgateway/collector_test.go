@@ -0,0 +1,112 @@
+package pushgateway_test
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCollector(t *testing.T) {
+	counter := "counter"
+	gauge := "gauge"
+	help := "Pushed requests"
+	store := new(mocks.MockStore)
+	registry := prometheus.NewRegistry()
+	service, err := pushgateway.New(slog.Default(), store, registry)
+	assert.NoError(t, err)
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "Internal requests",
+	}, []string{"path"})
+	assert.NoError(t, registry.Register(requests))
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "latency",
+		Help: "Internal latency",
+	})
+	assert.NoError(t, registry.Register(latency))
+	assert.NoError(t, registry.Register(pushgateway.NewCollector(service, registry)))
+
+	store.On("GetGroups", mock.Anything).Return([]*aggregates.PushgatewayGroup{}, nil)
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil)
+	store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return([]*aggregates.PushgatewayMetric{
+		{Name: "backups_total", Type: &counter, Description: &help, Labels: map[string]string{"job": "a"}, Value: 3},
+		{Name: "backups_total", Type: &counter, Labels: map[string]string{"job": "b"}, Value: 1},
+		{Name: "requests_total", Type: &counter, Labels: map[string]string{"job": "a"}, Value: 1},
+		{Name: "latency_count", Type: &gauge, Value: 1},
+		{Name: "temperature", Type: &gauge, Value: 20},
+	}, nil)
+
+	// pushed families colliding with the internal metrics are skipped
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	names := []string{}
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.Equal(t, []string{"backups_total", "latency", "temperature"}, names)
+	assert.Equal(t, help, families[0].GetHelp())
+	assert.Len(t, families[0].Metric, 2)
+	assert.Equal(t, 3.0, families[0].Metric[0].GetCounter().GetValue())
+	assert.Equal(t, 20.0, families[2].Metric[0].GetGauge().GetValue())
+}
+
+func TestCollectorCollisions(t *testing.T) {
+	gauge := "gauge"
+	histogram := "histogram"
+	store := new(mocks.MockStore)
+	registry := prometheus.NewRegistry()
+	service, err := pushgateway.New(slog.Default(), store, registry)
+	assert.NoError(t, err)
+	assert.NoError(t, registry.Register(pushgateway.NewCollector(service, registry)))
+
+	store.On("GetGroups", mock.Anything).Return([]*aggregates.PushgatewayGroup{}, nil)
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil)
+	store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return([]*aggregates.PushgatewayMetric{
+		{Name: "foo_count", Type: &gauge, Value: 1},
+		{Name: "foo", Type: &histogram, Histogram: &aggregates.Histogram{
+			Buckets: []aggregates.Bucket{{UpperBound: 1, Count: 2}},
+			Sum:     1,
+			Count:   2,
+		}},
+		{Name: "foo_bucket", Type: &gauge, Value: 1},
+		{Name: "temperature", Type: &gauge, Value: 20},
+	}, nil)
+
+	// the families colliding with a pushed histogram are skipped
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	names := []string{}
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.Equal(t, []string{"foo", "temperature"}, names)
+}
+
+func TestCollectorStoreError(t *testing.T) {
+	store := new(mocks.MockStore)
+	registry := prometheus.NewRegistry()
+	service, err := pushgateway.New(slog.Default(), store, registry)
+	assert.NoError(t, err)
+	up := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "up",
+		Help: "Internal gauge",
+	})
+	assert.NoError(t, registry.Register(up))
+	assert.NoError(t, registry.Register(pushgateway.NewCollector(service, registry)))
+	store.On("GetGroups", mock.Anything).Return(nil, errors.New("connection refused"))
+	store.On("GetMetricFamilies", mock.Anything).Return(nil, errors.New("connection refused"))
+	store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return(nil, errors.New("connection refused"))
+
+	// the internal metrics are still exposed
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, families, 1)
+	assert.Equal(t, "up", families[0].GetName())
+}
@@ -0,0 +1,89 @@
+package pushgateway
+
+import (
+	"math"
+	"sort"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+)
+
+// ValidateHistogram checks that the buckets of an histogram are sorted,
+// cumulative, and end by a +Inf bucket containing all observations
+func ValidateHistogram(histogram *aggregates.Histogram) error {
+	if len(histogram.Buckets) == 0 {
+		return er.New("histograms should have at least one bucket", er.BadRequest, true)
+	}
+	for i, bucket := range histogram.Buckets {
+		if math.IsNaN(bucket.UpperBound) {
+			return er.New("histogram bucket upper bounds can't be NaN", er.BadRequest, true)
+		}
+		if i == 0 {
+			continue
+		}
+		previous := histogram.Buckets[i-1]
+		if bucket.UpperBound <= previous.UpperBound {
+			return er.New("histogram buckets should be sorted by upper bound without duplicates", er.BadRequest, true)
+		}
+		if bucket.Count < previous.Count {
+			return er.New("histogram bucket counts should be cumulative", er.BadRequest, true)
+		}
+	}
+	last := histogram.Buckets[len(histogram.Buckets)-1]
+	if !math.IsInf(last.UpperBound, 1) {
+		return er.New("the last histogram bucket should have +Inf as upper bound", er.BadRequest, true)
+	}
+	if last.Count != histogram.Count {
+		return er.Newf("the +Inf bucket count (%d) should be equal to the histogram count (%d)", er.BadRequest, true, last.Count, histogram.Count)
+	}
+	return nil
+}
+
+// ValidateSummary checks that the quantiles of a summary are between 0 and 1,
+// and sorts them
+func ValidateSummary(summary *aggregates.Summary) error {
+	seen := make(map[float64]bool)
+	for _, quantile := range summary.Quantiles {
+		if math.IsNaN(quantile.Quantile) || quantile.Quantile < 0 || quantile.Quantile > 1 {
+			return er.Newf("invalid quantile %v, quantiles should be between 0 and 1", er.BadRequest, true, quantile.Quantile)
+		}
+		if seen[quantile.Quantile] {
+			return er.Newf("quantile %v is defined multiple times", er.BadRequest, true, quantile.Quantile)
+		}
+		seen[quantile.Quantile] = true
+	}
+	sort.Slice(summary.Quantiles, func(i, j int) bool {
+		return summary.Quantiles[i].Quantile < summary.Quantiles[j].Quantile
+	})
+	return nil
+}
+
+// ValidateDistribution checks that histograms and summaries are consistent with the metric type
+func ValidateDistribution(metric *aggregates.PushgatewayMetric) error {
+	metricType := ""
+	if metric.Type != nil {
+		metricType = *metric.Type
+	}
+	switch metricType {
+	case "histogram":
+		if metric.Histogram == nil || metric.Summary != nil {
+			return er.Newf("metric %s: histograms should only contain an histogram definition", er.BadRequest, true, metric.Name)
+		}
+		if _, ok := metric.Labels["le"]; ok {
+			return er.Newf("metric %s: the le label is reserved for histogram buckets", er.BadRequest, true, metric.Name)
+		}
+		return ValidateHistogram(metric.Histogram)
+	case "summary":
+		if metric.Summary == nil || metric.Histogram != nil {
+			return er.Newf("metric %s: summaries should only contain a summary definition", er.BadRequest, true, metric.Name)
+		}
+		if _, ok := metric.Labels["quantile"]; ok {
+			return er.Newf("metric %s: the quantile label is reserved for summaries", er.BadRequest, true, metric.Name)
+		}
+		return ValidateSummary(metric.Summary)
+	}
+	if metric.Histogram != nil || metric.Summary != nil {
+		return er.Newf("metric %s: only histograms and summaries can contain buckets or quantiles", er.BadRequest, true, metric.Name)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package pushgateway_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHistogram(t *testing.T) {
+	cases := []struct {
+		histogram aggregates.Histogram
+		valid     bool
+	}{
+		{
+			histogram: aggregates.Histogram{
+				Buckets: []aggregates.Bucket{
+					{UpperBound: 0.1, Count: 1},
+					{UpperBound: 1, Count: 1},
+					{UpperBound: math.Inf(1), Count: 3},
+				},
+				Count: 3,
+			},
+			valid: true,
+		},
+		{
+			histogram: aggregates.Histogram{},
+			valid:     false,
+		},
+		{
+			// missing +Inf bucket
+			histogram: aggregates.Histogram{
+				Buckets: []aggregates.Bucket{
+					{UpperBound: 1, Count: 3},
+				},
+				Count: 3,
+			},
+			valid: false,
+		},
+		{
+			// not cumulative
+			histogram: aggregates.Histogram{
+				Buckets: []aggregates.Bucket{
+					{UpperBound: 0.1, Count: 2},
+					{UpperBound: 1, Count: 1},
+					{UpperBound: math.Inf(1), Count: 3},
+				},
+				Count: 3,
+			},
+			valid: false,
+		},
+		{
+			// not sorted
+			histogram: aggregates.Histogram{
+				Buckets: []aggregates.Bucket{
+					{UpperBound: 1, Count: 1},
+					{UpperBound: 0.1, Count: 1},
+					{UpperBound: math.Inf(1), Count: 3},
+				},
+				Count: 3,
+			},
+			valid: false,
+		},
+		{
+			// +Inf bucket different from the count
+			histogram: aggregates.Histogram{
+				Buckets: []aggregates.Bucket{
+					{UpperBound: math.Inf(1), Count: 3},
+				},
+				Count: 4,
+			},
+			valid: false,
+		},
+	}
+	for _, c := range cases {
+		err := pushgateway.ValidateHistogram(&c.histogram)
+		if c.valid {
+			assert.NoError(t, err)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
+
+func TestValidateSummary(t *testing.T) {
+	summary := aggregates.Summary{
+		Quantiles: []aggregates.Quantile{
+			{Quantile: 0.99, Value: 3},
+			{Quantile: 0.5, Value: 1},
+		},
+	}
+	assert.NoError(t, pushgateway.ValidateSummary(&summary))
+	assert.Equal(t, 0.5, summary.Quantiles[0].Quantile)
+
+	summary.Quantiles = append(summary.Quantiles, aggregates.Quantile{Quantile: 0.5})
+	assert.Error(t, pushgateway.ValidateSummary(&summary))
+	summary.Quantiles = []aggregates.Quantile{{Quantile: 1.5}}
+	assert.Error(t, pushgateway.ValidateSummary(&summary))
+}
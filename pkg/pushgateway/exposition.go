@@ -0,0 +1,324 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var metricTypes = map[string]dto.MetricType{
+	"counter":   dto.MetricType_COUNTER,
+	"gauge":     dto.MetricType_GAUGE,
+	"histogram": dto.MetricType_HISTOGRAM,
+	"summary":   dto.MetricType_SUMMARY,
+}
+
+// toMetricType returns the type of a metric, untyped if not defined
+func toMetricType(metricType *string) dto.MetricType {
+	if metricType == nil {
+		return dto.MetricType_UNTYPED
+	}
+	result, ok := metricTypes[*metricType]
+	if !ok {
+		return dto.MetricType_UNTYPED
+	}
+	return result
+}
+
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	result := make([]*dto.LabelPair, 0, len(labels))
+	for k, v := range labels {
+		result = append(result, &dto.LabelPair{
+			Name:  proto.String(k),
+			Value: proto.String(v),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result
+}
+
+// toDTOMetric converts a metric to a series of a family of the given type
+func toDTOMetric(metric *aggregates.PushgatewayMetric, metricType dto.MetricType) (*dto.Metric, error) {
+	result := &dto.Metric{
+		Label: labelPairs(metric.Labels),
+	}
+	if metric.Timestamp != nil {
+		result.TimestampMs = proto.Int64(metric.Timestamp.UnixMilli())
+	}
+	var created *timestamppb.Timestamp
+	if !metric.CreatedAt.IsZero() {
+		created = timestamppb.New(metric.CreatedAt)
+	}
+	switch metricType {
+	case dto.MetricType_HISTOGRAM:
+		if metric.Histogram == nil {
+			return nil, fmt.Errorf("metric is not a histogram")
+		}
+		histogram := &dto.Histogram{
+			SampleCount:      proto.Uint64(metric.Histogram.Count),
+			SampleSum:        proto.Float64(metric.Histogram.Sum),
+			CreatedTimestamp: created,
+		}
+		for _, bucket := range metric.Histogram.Buckets {
+			histogram.Bucket = append(histogram.Bucket, &dto.Bucket{
+				UpperBound:      proto.Float64(bucket.UpperBound),
+				CumulativeCount: proto.Uint64(bucket.Count),
+			})
+		}
+		result.Histogram = histogram
+	case dto.MetricType_SUMMARY:
+		if metric.Summary == nil {
+			return nil, fmt.Errorf("metric is not a summary")
+		}
+		summary := &dto.Summary{
+			SampleCount:      proto.Uint64(metric.Summary.Count),
+			SampleSum:        proto.Float64(metric.Summary.Sum),
+			CreatedTimestamp: created,
+		}
+		for _, quantile := range metric.Summary.Quantiles {
+			summary.Quantile = append(summary.Quantile, &dto.Quantile{
+				Quantile: proto.Float64(quantile.Quantile),
+				Value:    proto.Float64(quantile.Value),
+			})
+		}
+		result.Summary = summary
+	default:
+		if metric.Histogram != nil || metric.Summary != nil {
+			return nil, fmt.Errorf("metric is a distribution")
+		}
+		value := metric.Value
+		switch metricType {
+		case dto.MetricType_COUNTER:
+			result.Counter = &dto.Counter{Value: proto.Float64(value), CreatedTimestamp: created}
+		case dto.MetricType_GAUGE:
+			result.Gauge = &dto.Gauge{Value: proto.Float64(value)}
+		default:
+			result.Untyped = &dto.Untyped{Value: proto.Float64(value)}
+		}
+	}
+	return result, nil
+}
+
+// MetricFamilies groups the stored metrics matching the selectors by name.
+// The metadata of a family are the registered ones, defaulting to the first
+// type and description defined by its metrics.
+// Metrics conflicting with their family (another type, duplicated labels)
+// are skipped so a single bad metric does not break the whole scrape.
+func (s *Service) MetricFamilies(ctx context.Context, selectors [][]aggregates.LabelMatcher) ([]*dto.MetricFamily, error) {
+	result := []*dto.MetricFamily{}
+	err := s.walkFamilies(ctx, selectors, func(family *dto.MetricFamily) error {
+		result = append(result, family)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// walkFamilies calls fn on the families of the metrics matching the
+// selectors, sorted by name. The stored data are fetched before the first
+// call, each family is built when it is passed to fn.
+func (s *Service) walkFamilies(ctx context.Context, selectors [][]aggregates.LabelMatcher, fn func(family *dto.MetricFamily) error) error {
+	metrics, err := s.store.GetMetrics(ctx, aggregates.Query{Selectors: selectors})
+	if err != nil {
+		return err
+	}
+	groups, err := s.store.GetGroups(ctx)
+	if err != nil {
+		return err
+	}
+	registered, err := s.store.GetMetricFamilies(ctx)
+	if err != nil {
+		return err
+	}
+	metadata := make(map[string]*aggregates.MetricFamily)
+	for _, family := range registered {
+		metadata[family.Name] = family
+	}
+	grouped := make(map[string][]*aggregates.PushgatewayMetric)
+	names := []string{}
+	for _, metric := range metrics {
+		if metric.Name == pushTimeMetric || metric.Name == pushFailureTimeMetric {
+			s.logger.Warn(fmt.Sprintf("skipping metric %s: the name is reserved", metric.Name))
+			continue
+		}
+		if _, ok := grouped[metric.Name]; !ok {
+			names = append(names, metric.Name)
+		}
+		grouped[metric.Name] = append(grouped[metric.Name], metric)
+	}
+	pushFamilies := make(map[string]*dto.MetricFamily)
+	for _, family := range groupFamilies(groups, selectors) {
+		pushFamilies[family.GetName()] = family
+		names = append(names, family.GetName())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family, ok := pushFamilies[name]
+		if !ok {
+			family = s.buildFamily(name, metadata[name], grouped[name])
+			// the metrics are not needed anymore once converted
+			delete(grouped, name)
+		}
+		if len(family.Metric) == 0 {
+			continue
+		}
+		err := fn(family)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildFamily returns the family of the metrics with the given name,
+// registered is nil if the family is not registered
+func (s *Service) buildFamily(name string, registered *aggregates.MetricFamily, metrics []*aggregates.PushgatewayMetric) *dto.MetricFamily {
+	family := &dto.MetricFamily{
+		Name: proto.String(name),
+		Type: dto.MetricType_UNTYPED.Enum(),
+	}
+	typeDefined := false
+	if registered != nil {
+		if registered.Help != nil {
+			family.Help = proto.String(*registered.Help)
+		}
+		if registered.Type != nil {
+			family.Type = toMetricType(registered.Type).Enum()
+			typeDefined = true
+		}
+		// OpenMetrics requires the unit to be a suffix of the name
+		if registered.Unit != nil && strings.HasSuffix(name, "_"+*registered.Unit) {
+			family.Unit = proto.String(*registered.Unit)
+		}
+	}
+	for _, metric := range metrics {
+		if family.Help == nil && metric.Description != nil {
+			family.Help = proto.String(*metric.Description)
+		}
+		if !typeDefined && metric.Type != nil {
+			family.Type = toMetricType(metric.Type).Enum()
+			typeDefined = true
+		}
+	}
+	series := make(map[string]bool)
+	for _, metric := range metrics {
+		if metric.Type != nil && toMetricType(metric.Type) != family.GetType() {
+			s.logger.Warn(fmt.Sprintf("skipping metric %s: type %s conflicts with type %s", name, *metric.Type, strings.ToLower(family.GetType().String())))
+			continue
+		}
+		key := SeriesKey(name, metric.Labels)
+		if series[key] {
+			s.logger.Warn(fmt.Sprintf("skipping metric %s: duplicated series", key))
+			continue
+		}
+		dtoMetric, err := toDTOMetric(metric, family.GetType())
+		if err != nil {
+			s.logger.Warn(fmt.Sprintf("skipping metric %s: %s", key, err.Error()))
+			continue
+		}
+		series[key] = true
+		family.Metric = append(family.Metric, dtoMetric)
+	}
+	sort.Slice(family.Metric, func(i, j int) bool {
+		return lessLabels(family.Metric[i].GetLabel(), family.Metric[j].GetLabel())
+	})
+	return family
+}
+
+func unixSeconds(t *time.Time) float64 {
+	if t == nil {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// groupFamilies returns the push times of the groups matching the selectors,
+// like the Prometheus Pushgateway
+func groupFamilies(groups []*aggregates.PushgatewayGroup, selectors [][]aggregates.LabelMatcher) []*dto.MetricFamily {
+	pushTime := &dto.MetricFamily{
+		Name: proto.String(pushTimeMetric),
+		Help: proto.String("Last Unix time when changing this group in the Pushgateway succeeded."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	pushFailureTime := &dto.MetricFamily{
+		Name: proto.String(pushFailureTimeMetric),
+		Help: proto.String("Last Unix time when changing this group in the Pushgateway failed."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for _, group := range groups {
+		labels := labelPairs(group.GroupingKey)
+		if MatchSelectors(selectors, pushTimeMetric, group.GroupingKey) {
+			pushTime.Metric = append(pushTime.Metric, &dto.Metric{
+				Label: labels,
+				Gauge: &dto.Gauge{Value: proto.Float64(unixSeconds(group.PushTime))},
+			})
+		}
+		if MatchSelectors(selectors, pushFailureTimeMetric, group.GroupingKey) {
+			pushFailureTime.Metric = append(pushFailureTime.Metric, &dto.Metric{
+				Label: labels,
+				Gauge: &dto.Gauge{Value: proto.Float64(unixSeconds(group.PushFailureTime))},
+			})
+		}
+	}
+	result := []*dto.MetricFamily{}
+	for _, family := range []*dto.MetricFamily{pushFailureTime, pushTime} {
+		if len(family.Metric) == 0 {
+			continue
+		}
+		sort.Slice(family.Metric, func(i, j int) bool {
+			return lessLabels(family.Metric[i].GetLabel(), family.Metric[j].GetLabel())
+		})
+		result = append(result, family)
+	}
+	return result
+}
+
+// lessLabels compares two sorted lists of labels
+func lessLabels(a []*dto.LabelPair, b []*dto.LabelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].GetName() != b[i].GetName() {
+			return a[i].GetName() < b[i].GetName()
+		}
+		if a[i].GetValue() != b[i].GetValue() {
+			return a[i].GetValue() < b[i].GetValue()
+		}
+	}
+	return len(a) < len(b)
+}
+
+// PrometheusMetrics writes the stored metrics matching the selectors in
+// the given exposition format. Each family is encoded once built, errors
+// are returned before the first write if the metrics can't be fetched.
+func (s *Service) PrometheusMetrics(ctx context.Context, w io.Writer, format expfmt.Format, selectors [][]aggregates.LabelMatcher) error {
+	encoder := expfmt.NewEncoder(w, format, expfmt.WithCreatedLines(), expfmt.WithUnit())
+	err := s.walkFamilies(ctx, selectors, func(family *dto.MetricFamily) error {
+		err := encoder.Encode(family)
+		if err != nil {
+			return fmt.Errorf("fail to encode metric %s: %w", family.GetName(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			return fmt.Errorf("fail to encode metrics: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+)
+
+// Policies applied when a metric type conflicts with the type registered
+// for its family
+const (
+	// TypeConflictReject rejects the write
+	TypeConflictReject = "reject"
+	// TypeConflictCoerce stores counters and gauges with the registered
+	// type, other conflicts are rejected
+	TypeConflictCoerce = "coerce"
+)
+
+// SetTypeConflictPolicy changes the policy applied to type conflicts
+func (s *Service) SetTypeConflictPolicy(policy string) {
+	s.familiesLock.Lock()
+	defer s.familiesLock.Unlock()
+	s.typeConflictPolicy = policy
+}
+
+func (s *Service) typeConflict() string {
+	s.familiesLock.RLock()
+	defer s.familiesLock.RUnlock()
+	if s.typeConflictPolicy == "" {
+		return TypeConflictReject
+	}
+	return s.typeConflictPolicy
+}
+
+func coercible(metricType string) bool {
+	return metricType == "counter" || metricType == "gauge"
+}
+
+// reconcileFamilies checks the types of the metrics against the registered
+// families, a family which is not registered yet takes the type of its
+// first metric. Depending on the policy, conflicting metrics are converted
+// to the registered type or rejected. The returned families should be
+// registered once the metrics are written.
+func (s *Service) reconcileFamilies(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.MetricFamily, error) {
+	policy := s.typeConflict()
+	candidates := make(map[string]*aggregates.MetricFamily)
+	for _, metric := range metrics {
+		if metric.Type == nil && metric.Description == nil {
+			continue
+		}
+		family, ok := candidates[metric.Name]
+		if !ok {
+			family = &aggregates.MetricFamily{Name: metric.Name}
+			candidates[metric.Name] = family
+		}
+		if family.Type == nil {
+			family.Type = metric.Type
+		}
+		if family.Help == nil {
+			family.Help = metric.Description
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	registered, err := s.store.GetMetricFamilies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string)
+	for _, family := range registered {
+		if _, ok := candidates[family.Name]; ok && family.Type != nil {
+			types[family.Name] = *family.Type
+		}
+	}
+	families := make([]aggregates.MetricFamily, 0, len(candidates))
+	for _, family := range candidates {
+		if _, ok := types[family.Name]; !ok && family.Type != nil {
+			types[family.Name] = *family.Type
+		}
+		families = append(families, *family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+	messages := []string{}
+	for i := range metrics {
+		metric := &metrics[i]
+		registeredType, ok := types[metric.Name]
+		if metric.Type == nil || !ok || *metric.Type == registeredType {
+			continue
+		}
+		if policy == TypeConflictCoerce && coercible(*metric.Type) && coercible(registeredType) {
+			metric.Type = &registeredType
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("metric %s has type %s but its family is registered as %s", metric.Name, *metric.Type, registeredType))
+	}
+	if len(messages) > 0 {
+		return nil, &er.Error{
+			Messages:  messages,
+			Type:      er.BadRequest,
+			Exposable: true,
+		}
+	}
+	return families, nil
+}
+
+// registerFamilies registers the families of written metrics. The write
+// already succeeded so a failure is only logged, the families are
+// registered again by the next write. Series whose type conflicts with a
+// family registered concurrently are skipped when exposing metrics.
+func (s *Service) registerFamilies(ctx context.Context, families []aggregates.MetricFamily) {
+	if len(families) == 0 {
+		return
+	}
+	_, err := s.store.RegisterMetricFamilies(ctx, families)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("fail to register metric families: %s", err.Error()))
+	}
+}
+
+func (s *Service) GetMetricFamilies(ctx context.Context) ([]*aggregates.MetricFamily, error) {
+	return s.store.GetMetricFamilies(ctx)
+}
+
+func (s *Service) GetMetricFamily(ctx context.Context, name string) (*aggregates.MetricFamily, error) {
+	return s.store.GetMetricFamily(ctx, name)
+}
+
+// UpdateMetricFamily creates or replaces the metadata of a family, the
+// creation date of an existing family is kept. Series conflicting with the
+// new type are skipped when exposing metrics.
+func (s *Service) UpdateMetricFamily(ctx context.Context, family aggregates.MetricFamily) error {
+	s.logger.Info(fmt.Sprintf("updating metric family %s", family.Name))
+	now := time.Now().UTC()
+	family.CreatedAt = now
+	family.UpdatedAt = now
+	return s.store.UpdateMetricFamily(ctx, family)
+}
+
+// DeleteMetricFamily deletes the metadata of a family, they are registered
+// again by the next write
+func (s *Service) DeleteMetricFamily(ctx context.Context, name string) error {
+	s.logger.Info(fmt.Sprintf("deleting metric family %s", name))
+	return s.store.DeleteMetricFamily(ctx, name)
+}
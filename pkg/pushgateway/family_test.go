@@ -0,0 +1,129 @@
+package pushgateway_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReconcileFamilies(t *testing.T) {
+	ctx := context.Background()
+	counter := "counter"
+	gauge := "gauge"
+	histogram := "histogram"
+	help := "Number of requests"
+	store := new(mocks.MockStore)
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{
+		{Name: "latency", Type: &histogram},
+		{Name: "requests_total", Type: &counter, Help: &help},
+	}, nil)
+
+	// the metrics are converted in place
+	newMetrics := func() []aggregates.PushgatewayMetric {
+		return []aggregates.PushgatewayMetric{
+			{Name: "requests_total", Type: &gauge, Description: &help, Value: 1},
+			{Name: "latency", Type: &gauge, Value: 1},
+			{Name: "untyped", Value: 1},
+		}
+	}
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(ctx, newMetrics())
+	var conflictErr *er.Error
+	assert.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, er.BadRequest, conflictErr.Type)
+	assert.Equal(t, []string{
+		"metric requests_total has type gauge but its family is registered as counter",
+		"metric latency has type gauge but its family is registered as histogram",
+	}, conflictErr.Messages)
+
+	// gauges and counters are converted to the registered type
+	service.SetTypeConflictPolicy(pushgateway.TypeConflictCoerce)
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(ctx, newMetrics())
+	assert.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, []string{
+		"metric latency has type gauge but its family is registered as histogram",
+	}, conflictErr.Messages)
+	// nothing is registered for rejected writes
+	store.AssertNotCalled(t, "RegisterMetricFamilies", mock.Anything, mock.Anything)
+
+	// the families are registered once the metrics are written
+	store.On("BatchCreateOrUpdatePushgatewayMetrics", mock.Anything, []aggregates.PushgatewayMetric{
+		{Name: "requests_total", Type: &counter, Description: &help, Value: 1},
+		{Name: "untyped", Value: 1},
+	}).Return([]aggregates.BatchResult{{ID: "1"}, {ID: "2"}}, nil).Once()
+	store.On("RegisterMetricFamilies", mock.Anything, []aggregates.MetricFamily{
+		{Name: "requests_total", Type: &gauge, Help: &help},
+	}).Return([]*aggregates.MetricFamily{
+		{Name: "requests_total", Type: &counter, Help: &help},
+	}, nil).Once()
+	metrics := newMetrics()
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{metrics[0], metrics[2]})
+	assert.NoError(t, err)
+	store.AssertNumberOfCalls(t, "RegisterMetricFamilies", 1)
+
+	// nothing is registered if the write fails
+	store.On("BatchCreateOrUpdatePushgatewayMetrics", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused")).Once()
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{
+		{Name: "new_total", Type: &counter, Value: 1},
+	})
+	assert.ErrorContains(t, err, "connection refused")
+	store.AssertNumberOfCalls(t, "RegisterMetricFamilies", 1)
+
+	// a family which is not registered takes the type of its first metric
+	service.SetTypeConflictPolicy(pushgateway.TypeConflictReject)
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(ctx, []aggregates.PushgatewayMetric{
+		{Name: "new_total", Type: &counter, Value: 1},
+		{Name: "new_total", Type: &gauge, Labels: map[string]string{"a": "b"}, Value: 1},
+	})
+	assert.ErrorContains(t, err, "metric new_total has type gauge but its family is registered as counter")
+
+	// a gauge decrement converted to a counter is rejected
+	service.SetTypeConflictPolicy(pushgateway.TypeConflictCoerce)
+	_, err = service.IncrementPushgatewayMetric(ctx, aggregates.PushgatewayMetric{Name: "requests_total", Type: &gauge, Value: -1})
+	assert.ErrorContains(t, err, "counter requests_total can't be decremented")
+	store.AssertNumberOfCalls(t, "RegisterMetricFamilies", 1)
+}
+
+func TestRegisteredFamiliesExposition(t *testing.T) {
+	counter := "counter"
+	gauge := "gauge"
+	help := "Size of the backup"
+	description := "Backup size"
+	unit := "bytes"
+	store := new(mocks.MockStore)
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	store.On("GetGroups", mock.Anything).Return([]*aggregates.PushgatewayGroup{}, nil)
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{
+		{Name: "backup_size_bytes", Type: &gauge, Help: &help, Unit: &unit},
+	}, nil)
+	store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return([]*aggregates.PushgatewayMetric{
+		{Name: "backup_size_bytes", Type: &counter, Description: &description, Labels: map[string]string{"job": "a"}, Value: 1},
+		{Name: "backup_size_bytes", Type: &gauge, Labels: map[string]string{"job": "b"}, Value: 2},
+		{Name: "backup_size_bytes", Labels: map[string]string{"job": "c"}, Value: 3},
+	}, nil)
+
+	// the registered metadata are used, the conflicting series is skipped
+	var result bytes.Buffer
+	err = service.PrometheusMetrics(context.Background(), &result, expfmt.NewFormat(expfmt.TypeOpenMetrics), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP backup_size_bytes Size of the backup
+# TYPE backup_size_bytes gauge
+# UNIT backup_size_bytes bytes
+backup_size_bytes{job="b"} 2.0
+backup_size_bytes{job="c"} 3.0
+# EOF
+`, result.String())
+}
@@ -0,0 +1,258 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+)
+
+// InfluxConfig configures the InfluxDB line protocol receiver
+type InfluxConfig struct {
+	// TTL of the written metrics, they don't expire if empty
+	TTL string
+}
+
+// SetInfluxConfig changes the configuration of the InfluxDB line protocol receiver
+func (s *Service) SetInfluxConfig(config InfluxConfig) {
+	s.influxLock.Lock()
+	defer s.influxLock.Unlock()
+	s.influx = config
+}
+
+func (s *Service) influxConfig() InfluxConfig {
+	s.influxLock.RLock()
+	defer s.influxLock.RUnlock()
+	return s.influx
+}
+
+// influxPrecisions contains the timestamp precisions of the InfluxDB v1 and v2 APIs
+var influxPrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// indexUnescaped returns the index of the first separator not escaped by
+// a backslash, skipping double-quoted strings if quotes is true
+func indexUnescaped(s string, separator byte, quotes bool) int {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			i++
+		case quotes && c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && c == separator:
+			return i
+		}
+	}
+	return -1
+}
+
+func splitUnescaped(s string, separator byte, quotes bool) []string {
+	result := []string{}
+	for {
+		i := indexUnescaped(s, separator, quotes)
+		if i < 0 {
+			return append(result, s)
+		}
+		result = append(result, s[:i])
+		s = s[i+1:]
+	}
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ")
+
+// parseInfluxValue parses a field value. String fields can't be converted
+// to metrics, ok is false for them.
+func parseInfluxValue(value string) (float64, bool, error) {
+	if value == "" {
+		return 0, false, fmt.Errorf("empty value")
+	}
+	if strings.HasPrefix(value, `"`) {
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return 0, false, fmt.Errorf("unterminated string %s", value)
+		}
+		return 0, false, nil
+	}
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	switch value[len(value)-1] {
+	case 'i':
+		result, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid integer %s", value)
+		}
+		return float64(result), true, nil
+	case 'u':
+		result, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid unsigned integer %s", value)
+		}
+		return float64(result), true, nil
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, false, fmt.Errorf("invalid float %s", value)
+	}
+	return result, true, nil
+}
+
+// parseInfluxLine converts a line to one gauge per numeric or boolean field
+func parseInfluxLine(line string, precision time.Duration) ([]aggregates.PushgatewayMetric, error) {
+	seriesEnd := indexUnescaped(line, ' ', false)
+	if seriesEnd < 0 {
+		return nil, fmt.Errorf("missing fields")
+	}
+	series := splitUnescaped(line[:seriesEnd], ',', false)
+	measurement := influxUnescaper.Replace(series[0])
+	if measurement == "" {
+		return nil, fmt.Errorf("missing measurement")
+	}
+	labels := make(map[string]string)
+	for _, tag := range series[1:] {
+		i := indexUnescaped(tag, '=', false)
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid tag %s", tag)
+		}
+		name := sanitizeName(influxUnescaper.Replace(tag[:i]), false)
+		if strings.HasPrefix(name, "__") {
+			name = "key" + name
+		}
+		labels[name] = influxUnescaper.Replace(tag[i+1:])
+	}
+	rest := line[seriesEnd+1:]
+	fieldsEnd := indexUnescaped(rest, ' ', true)
+	fields := rest
+	var timestamp *time.Time
+	if fieldsEnd >= 0 {
+		fields = rest[:fieldsEnd]
+		rawTimestamp := strings.TrimSpace(rest[fieldsEnd+1:])
+		if rawTimestamp != "" {
+			value, err := strconv.ParseInt(rawTimestamp, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %s", rawTimestamp)
+			}
+			// the timestamp in nanoseconds should fit in an int64
+			if value > math.MaxInt64/int64(precision) || value < math.MinInt64/int64(precision) {
+				return nil, fmt.Errorf("timestamp %s out of range", rawTimestamp)
+			}
+			t := time.Unix(0, value*int64(precision)).UTC()
+			timestamp = &t
+		}
+	}
+	if fields == "" {
+		return nil, fmt.Errorf("missing fields")
+	}
+	result := []aggregates.PushgatewayMetric{}
+	gaugeType := "gauge"
+	for _, field := range splitUnescaped(fields, ',', true) {
+		i := indexUnescaped(field, '=', false)
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid field %s", field)
+		}
+		key := influxUnescaper.Replace(field[:i])
+		value, ok, err := parseInfluxValue(field[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", key, err)
+		}
+		if !ok {
+			continue
+		}
+		name := measurement
+		if key != "value" {
+			name = measurement + "_" + key
+		}
+		result = append(result, aggregates.PushgatewayMetric{
+			Name:      sanitizeName(name, true),
+			Labels:    labels,
+			Type:      &gaugeType,
+			Value:     value,
+			Timestamp: timestamp,
+		})
+	}
+	return result, nil
+}
+
+// ParseLineProtocol converts InfluxDB line protocol points to gauges named
+// <measurement>_<field> (or <measurement> for the value field), tags
+// becoming labels. String fields are ignored. All invalid lines are
+// reported in the returned error.
+func ParseLineProtocol(data string, precision string) ([]aggregates.PushgatewayMetric, error) {
+	duration, ok := influxPrecisions[precision]
+	if !ok {
+		return nil, er.Newf("invalid precision %s", er.BadRequest, true, precision)
+	}
+	messages := []string{}
+	series := newSeriesSet()
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		metrics, err := parseInfluxLine(line, duration)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("line %d: %s", i+1, err.Error()))
+			continue
+		}
+		for _, metric := range metrics {
+			series.add(metric)
+		}
+	}
+	if len(messages) > 0 {
+		return nil, &er.Error{
+			Messages:  messages,
+			Type:      er.BadRequest,
+			Exposable: true,
+		}
+	}
+	return series.metrics, nil
+}
+
+// InfluxWrite stores the metrics of an InfluxDB line protocol write request.
+// It returns the number of metrics written.
+func (s *Service) InfluxWrite(ctx context.Context, data string, precision string) (int, error) {
+	metrics, err := ParseLineProtocol(data, precision)
+	if err != nil {
+		return 0, err
+	}
+	config := s.influxConfig()
+	expiresAt, err := expirationDate(config.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid InfluxDB TTL: %w", err)
+	}
+	for i := range metrics {
+		metric := &metrics[i]
+		if config.TTL != "" {
+			ttl := config.TTL
+			metric.TTL = &ttl
+			metric.ExpiresAt = expiresAt
+		}
+		InitPushgatewayMetric(metric)
+	}
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+	_, err = s.BatchCreateOrUpdatePushgatewayMetrics(ctx, metrics)
+	if err != nil {
+		return 0, err
+	}
+	return len(metrics), nil
+}
@@ -0,0 +1,62 @@
+package pushgateway_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway"
+	er "github.com/mcorbin/corbierror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	metrics, err := pushgateway.ParseLineProtocol(`# comment
+cpu,host=server\ 1,region=eu-west usage_user=10.5,usage_system=2i,online=true,note="a b, c=d" 1700000000000000000
+
+weather\,station,sensor.id=abc value=-3.2e1
+cpu,host=server\ 1,region=eu-west usage_user=12 1700000010000000000
+`, "")
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 4)
+	timestamp := time.Unix(1700000010, 0).UTC()
+	assert.Equal(t, "cpu_usage_user", metrics[0].Name)
+	assert.Equal(t, 12.0, metrics[0].Value)
+	assert.Equal(t, map[string]string{"host": "server 1", "region": "eu-west"}, metrics[0].Labels)
+	assert.Equal(t, &timestamp, metrics[0].Timestamp)
+	assert.Equal(t, "gauge", *metrics[0].Type)
+	assert.Equal(t, "cpu_usage_system", metrics[1].Name)
+	assert.Equal(t, 2.0, metrics[1].Value)
+	assert.Equal(t, "cpu_online", metrics[2].Name)
+	assert.Equal(t, 1.0, metrics[2].Value)
+	assert.Equal(t, "weather_station", metrics[3].Name)
+	assert.Equal(t, -32.0, metrics[3].Value)
+	assert.Equal(t, map[string]string{"sensor_id": "abc"}, metrics[3].Labels)
+	assert.Nil(t, metrics[3].Timestamp)
+
+	metrics, err = pushgateway.ParseLineProtocol("disk free=1u 1700000000", "s")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), *metrics[0].Timestamp)
+
+	_, err = pushgateway.ParseLineProtocol("cpu usage=1\ncpu\ncpu usage=abc\ncpu,host usage=1\ncpu usage=1 abc\ncpu usage=\"unterminated", "")
+	assert.Error(t, err)
+	var parseErr *er.Error
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, []string{
+		"line 2: missing fields",
+		"line 3: field usage: invalid float abc",
+		"line 4: invalid tag host",
+		"line 5: invalid timestamp abc",
+		"line 6: field usage: unterminated string \"unterminated",
+	}, parseErr.Messages)
+
+	// the timestamps in nanoseconds should fit in an int64
+	_, err = pushgateway.ParseLineProtocol("cpu usage=1 9223372036\ncpu usage=1 9223372037\ncpu usage=1 -9223372037", "s")
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, []string{
+		"line 2: timestamp 9223372037 out of range",
+		"line 3: timestamp -9223372037 out of range",
+	}, parseErr.Messages)
+
+	_, err = pushgateway.ParseLineProtocol("cpu usage=1", "d")
+	assert.ErrorContains(t, err, "invalid precision d")
+}
@@ -0,0 +1,161 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits protects the pushgateway against series explosions. Zero values
+// disable a limit.
+// Limits are checked before writing metrics, concurrent writes creating
+// new series may slightly exceed them.
+type Limits struct {
+	MaxSeries           uint
+	MaxSeriesPerMetric  uint
+	MaxLabelsPerSeries  uint
+	MaxLabelValueLength uint
+}
+
+// SetLimits changes the cardinality limits of the pushgateway
+func (s *Service) SetLimits(limits Limits) {
+	s.limitsLock.Lock()
+	defer s.limitsLock.Unlock()
+	s.limits = limits
+}
+
+// Limits returns the current cardinality limits
+func (s *Service) Limits() Limits {
+	s.limitsLock.RLock()
+	defer s.limitsLock.RUnlock()
+	return s.limits
+}
+
+// checkLimits returns an error describing all the limits that writing
+// these metrics would exceed. The replaced series are the existing ones
+// deleted by the write.
+func (s *Service) checkLimits(ctx context.Context, metrics []aggregates.PushgatewayMetric, replaced []*aggregates.PushgatewayMetric) error {
+	limits := s.Limits()
+	messages := []string{}
+	for _, metric := range metrics {
+		if limits.MaxLabelsPerSeries > 0 && uint(len(metric.Labels)) > limits.MaxLabelsPerSeries {
+			messages = append(messages, fmt.Sprintf("metric %s has %d labels, the limit is %d", metric.Name, len(metric.Labels), limits.MaxLabelsPerSeries))
+		}
+		if limits.MaxLabelValueLength == 0 {
+			continue
+		}
+		names := []string{}
+		for name := range metric.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if uint(utf8.RuneCountInString(metric.Labels[name])) > limits.MaxLabelValueLength {
+				messages = append(messages, fmt.Sprintf("label %s of metric %s is longer than %d characters", name, metric.Name, limits.MaxLabelValueLength))
+			}
+		}
+	}
+	if len(messages) == 0 && (limits.MaxSeries > 0 || limits.MaxSeriesPerMetric > 0) {
+		var err error
+		messages, err = s.checkSeriesLimits(ctx, limits, metrics, replaced)
+		if err != nil {
+			return err
+		}
+	}
+	if len(messages) > 0 {
+		return &er.Error{
+			Messages:  messages,
+			Type:      er.BadRequest,
+			Exposable: true,
+		}
+	}
+	return nil
+}
+
+// checkSeriesLimits checks the number of series once the replaced series
+// are deleted and the series which don't exist yet are created
+func (s *Service) checkSeriesLimits(ctx context.Context, limits Limits, metrics []aggregates.PushgatewayMetric, replaced []*aggregates.PushgatewayMetric) ([]string, error) {
+	exist, err := s.store.SeriesExist(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	newSeries := make(map[string]int)
+	seen := make(map[string]bool)
+	total := 0
+	for i, metric := range metrics {
+		key := SeriesKey(metric.Name, metric.Labels)
+		if exist[i] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		newSeries[metric.Name]++
+		total++
+	}
+	messages := []string{}
+	if total == 0 {
+		return messages, nil
+	}
+	removedSeries := make(map[string]int)
+	for _, metric := range replaced {
+		removedSeries[metric.Name]++
+	}
+	if limits.MaxSeriesPerMetric > 0 {
+		names := []string{}
+		for name := range newSeries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		counts, err := s.store.CountSeries(ctx, names)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			count := counts[name] - removedSeries[name]
+			if uint(count+newSeries[name]) > limits.MaxSeriesPerMetric {
+				messages = append(messages, fmt.Sprintf("metric %s has %d series, adding %d would exceed the limit of %d series per metric", name, count, newSeries[name], limits.MaxSeriesPerMetric))
+			}
+		}
+	}
+	if limits.MaxSeries > 0 {
+		count, err := s.store.CountAllSeries(ctx)
+		if err != nil {
+			return nil, err
+		}
+		count -= len(replaced)
+		if uint(count+total) > limits.MaxSeries {
+			messages = append(messages, fmt.Sprintf("the pushgateway has %d series, adding %d would exceed the limit of %d series", count, total, limits.MaxSeries))
+		}
+	}
+	return messages, nil
+}
+
+// Usage returns the number of stored series, in total and per metric name
+func (s *Service) Usage(ctx context.Context) (*aggregates.Usage, error) {
+	counts, err := s.store.CountSeries(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &aggregates.Usage{Metrics: counts}
+	for _, count := range counts {
+		result.Series += count
+	}
+	return result, nil
+}
+
+// updateSeriesGauge exposes the number of series per metric name
+func (s *Service) updateSeriesGauge(ctx context.Context) {
+	usage, err := s.Usage(ctx)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("fail to count push gateway series: %s", err.Error()))
+		return
+	}
+	s.seriesGauge.Reset()
+	for name, count := range usage.Metrics {
+		s.seriesGauge.With(prometheus.Labels{"name": name}).Set(float64(count))
+	}
+}
@@ -0,0 +1,102 @@
+package pushgateway_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLimits(t *testing.T) {
+	store := new(mocks.MockStore)
+	store.On("RegisterMetricFamilies", mock.Anything, mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	service.SetLimits(pushgateway.Limits{
+		MaxSeries:           10,
+		MaxSeriesPerMetric:  3,
+		MaxLabelsPerSeries:  2,
+		MaxLabelValueLength: 5,
+	})
+
+	_, err = service.CreateOrUpdatePushgatewayMetric(context.Background(), aggregates.PushgatewayMetric{
+		Name:   "a",
+		Labels: map[string]string{"a": "1", "b": "2", "request_id": "123456"},
+	}, false)
+	var limitErr *er.Error
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, er.BadRequest, limitErr.Type)
+	assert.Equal(t, []string{
+		"metric a has 3 labels, the limit is 2",
+		"label request_id of metric a is longer than 5 characters",
+	}, limitErr.Messages)
+
+	metrics := []aggregates.PushgatewayMetric{
+		{Name: "a", Labels: map[string]string{"id": "1"}},
+		{Name: "a", Labels: map[string]string{"id": "2"}},
+		{Name: "b", Labels: map[string]string{"id": "1"}},
+	}
+	store.On("SeriesExist", mock.Anything, metrics).Return([]bool{true, false, false}, nil)
+	store.On("CountSeries", mock.Anything, []string{"a", "b"}).Return(map[string]int{"a": 3}, nil)
+	store.On("CountAllSeries", mock.Anything).Return(9, nil)
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(context.Background(), metrics)
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, []string{
+		"metric a has 3 series, adding 1 would exceed the limit of 3 series per metric",
+		"the pushgateway has 9 series, adding 2 would exceed the limit of 10 series",
+	}, limitErr.Messages)
+
+	// updating existing series is always allowed
+	existing := metrics[:1]
+	store.On("SeriesExist", mock.Anything, existing).Return([]bool{true}, nil)
+	store.On("BatchCreateOrUpdatePushgatewayMetrics", mock.Anything, existing).Return([]aggregates.BatchResult{{ID: "1"}}, nil)
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(context.Background(), existing)
+	assert.NoError(t, err)
+	store.AssertExpectations(t)
+}
+
+func TestLimitsReplacingPush(t *testing.T) {
+	store := new(mocks.MockStore)
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	service.SetLimits(pushgateway.Limits{
+		MaxSeries:          5,
+		MaxSeriesPerMetric: 3,
+	})
+	groupingKey := map[string]string{"job": "backup"}
+	existing := []*aggregates.PushgatewayMetric{
+		{Name: "a", Labels: map[string]string{"job": "backup", "id": "1"}, GroupingKey: groupingKey},
+		{Name: "a", Labels: map[string]string{"job": "backup", "id": "2"}, GroupingKey: groupingKey},
+		{Name: "b", Labels: map[string]string{"job": "backup"}, GroupingKey: groupingKey},
+		// pushed outside of the group
+		{Name: "a", Labels: map[string]string{"job": "backup", "id": "4"}},
+	}
+	store.On("GetMetrics", mock.Anything, mock.Anything).Return(existing, nil)
+	store.On("SeriesExist", mock.Anything, mock.Anything).Return([]bool{false}, nil)
+	store.On("CountSeries", mock.Anything, mock.Anything).Return(map[string]int{"a": 3, "b": 1}, nil)
+	store.On("CountAllSeries", mock.Anything).Return(5, nil)
+	store.On("RecordPushFailure", mock.Anything, groupingKey, mock.Anything).Return(nil)
+
+	// the series of the group are deleted by the push
+	store.On("PushGroup", mock.Anything, groupingKey, mock.Anything, true, mock.Anything).Return(nil).Once()
+	err = service.PushMetrics(context.Background(), groupingKey, parseFamilies(t, "a{id=\"3\"} 1\n"), true)
+	assert.NoError(t, err)
+
+	// only the series with the pushed names are deleted
+	store.On("PushGroup", mock.Anything, groupingKey, mock.Anything, false, mock.Anything).Return(nil).Once()
+	var limitErr *er.Error
+	err = service.PushMetrics(context.Background(), groupingKey, parseFamilies(t, "b{id=\"3\"} 1\n"), false)
+	assert.NoError(t, err)
+	err = service.PushMetrics(context.Background(), groupingKey, parseFamilies(t, "c 1\n"), false)
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, []string{"the pushgateway has 5 series, adding 1 would exceed the limit of 5 series"}, limitErr.Messages)
+	store.AssertExpectations(t)
+}
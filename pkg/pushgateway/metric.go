@@ -3,84 +3,142 @@ package pushgateway
 import (
 	"context"
 	"fmt"
-	"sort"
+	"math"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 func InitPushgatewayMetric(metric *aggregates.PushgatewayMetric) {
 	metric.CreatedAt = time.Now().UTC()
+	metric.UpdatedAt = metric.CreatedAt
 }
 
-func (s *Service) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric, cumulative bool) (string, error) {
-	s.logger.Info(fmt.Sprintf("creating or updating metric %s", metric.Name))
-	_, err := strconv.ParseFloat(metric.Value, 64)
+// expirationDate returns the expiration date of metrics written now with
+// this TTL, nil if the TTL is empty
+func expirationDate(ttl string) (*time.Time, error) {
+	if ttl == "" {
+		return nil, nil
+	}
+	duration, err := time.ParseDuration(ttl)
 	if err != nil {
-		return "", fmt.Errorf("fail to convert metric value %s to float64", metric.Value)
+		return nil, err
 	}
-	return s.store.CreateOrUpdatePushgatewayMetric(ctx, metric, cumulative)
+	result := time.Now().UTC().Add(duration)
+	return &result, nil
 }
 
-func (s *Service) GetMetrics(ctx context.Context) ([]*aggregates.PushgatewayMetric, error) {
-	return s.store.GetMetrics(ctx)
-}
-
-func (s *Service) PrometheusMetrics(ctx context.Context) (string, error) {
-	result := ""
-	metrics, err := s.store.GetMetrics(ctx)
+func (s *Service) CreateOrUpdatePushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric, cumulative bool) (string, error) {
+	s.logger.Info(fmt.Sprintf("creating or updating metric %s", metric.Name))
+	err := ValidateDistribution(&metric)
 	if err != nil {
 		return "", err
 	}
-	sort.Slice(metrics, func(i, j int) bool {
-		return strings.Compare(metrics[i].Name, metrics[j].Name) == -1
-	})
-	metricsDescriptions := make(map[string]string)
-	// double iteration to build metrics descriptions once
-	for _, metric := range metrics {
-		name := metric.Name
-		description := ""
-		if metric.Description != nil {
-			description += fmt.Sprintf("# HELP %s %s\n", name, *metric.Description)
-		}
-		if metric.Type != nil {
-			description += fmt.Sprintf("# TYPE %s %s\n", name, *metric.Type)
+	err = s.checkLimits(ctx, []aggregates.PushgatewayMetric{metric}, nil)
+	if err != nil {
+		return "", err
+	}
+	metrics := []aggregates.PushgatewayMetric{metric}
+	families, err := s.reconcileFamilies(ctx, metrics)
+	if err != nil {
+		return "", err
+	}
+	id, err := s.store.CreateOrUpdatePushgatewayMetric(ctx, metrics[0], cumulative)
+	if err != nil {
+		return "", err
+	}
+	s.registerFamilies(ctx, families)
+	return id, nil
+}
+
+// BatchCreateOrUpdatePushgatewayMetrics validates all the metrics then
+// writes them at once. Nothing is written if a metric is invalid, the
+// returned error contains one message per invalid metric.
+func (s *Service) BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error) {
+	messages := []string{}
+	series := make(map[string]int)
+	for i := range metrics {
+		metric := &metrics[i]
+		err := ValidateDistribution(metric)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("metric %d (%s): %s", i, metric.Name, err.Error()))
+			continue
 		}
-		if description != "" {
-			metricsDescriptions[name] = description
+		key := SeriesKey(metric.Name, metric.Labels)
+		if previous, ok := series[key]; ok {
+			messages = append(messages, fmt.Sprintf("metric %d (%s): same name and labels as metric %d", i, metric.Name, previous))
+			continue
 		}
+		series[key] = i
 	}
-
-	for _, metric := range metrics {
-		name := metric.Name
-		description, ok := metricsDescriptions[name]
-		if ok {
-			result += description
-			// don't fetch this description again
-			// the metrics being sorted, we only want to print
-			// the description once at the first occurence
-			delete(metricsDescriptions, name)
+	if len(messages) > 0 {
+		return nil, &er.Error{
+			Messages:  messages,
+			Type:      er.BadRequest,
+			Exposable: true,
 		}
-		labels := ""
-		if len(metric.Labels) == 0 {
-			labels = "{}"
-		} else {
-			labelsList := []string{}
-			for k, v := range metric.Labels {
-				labelsList = append(labelsList, fmt.Sprintf("%s=\"%s\"", k, v))
-			}
-			sort.Strings(labelsList)
-			labels = fmt.Sprintf("{%s}", strings.Join(labelsList, ", "))
+	}
+	err := s.checkLimits(ctx, metrics, nil)
+	if err != nil {
+		return nil, err
+	}
+	families, err := s.reconcileFamilies(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info(fmt.Sprintf("creating or updating %d metrics", len(metrics)))
+	result, err := s.store.BatchCreateOrUpdatePushgatewayMetrics(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	s.registerFamilies(ctx, families)
+	return result, nil
+}
 
-		}
-		result += fmt.Sprintf("%s%s %s\n", metric.Name, labels, metric.Value)
+// IncrementPushgatewayMetric adds the metric value to the stored counter
+// or gauge, creating it if needed. Counters can't be decremented.
+func (s *Service) IncrementPushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error) {
+	if metric.Type == nil || (*metric.Type != "counter" && *metric.Type != "gauge") {
+		return nil, er.New("only counters and gauges can be incremented", er.BadRequest, true)
+	}
+	if math.IsNaN(metric.Value) || math.IsInf(metric.Value, 0) {
+		return nil, er.Newf("invalid increment %s", er.BadRequest, true, FormatValue(metric.Value))
+	}
+	metrics := []aggregates.PushgatewayMetric{metric}
+	err := s.checkLimits(ctx, metrics, nil)
+	if err != nil {
+		return nil, err
+	}
+	families, err := s.reconcileFamilies(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	// the type may have been converted to the registered one
+	metric = metrics[0]
+	if *metric.Type == "counter" && metric.Value < 0 {
+		return nil, er.Newf("counter %s can't be decremented", er.BadRequest, true, metric.Name)
 	}
+	s.logger.Debug(fmt.Sprintf("incrementing metric %s by %s", metric.Name, FormatValue(metric.Value)))
+	result, err := s.store.IncrementPushgatewayMetric(ctx, metric)
+	if err != nil {
+		return nil, err
+	}
+	s.registerFamilies(ctx, families)
 	return result, nil
 }
 
+func (s *Service) GetMetrics(ctx context.Context, query aggregates.Query) ([]*aggregates.PushgatewayMetric, error) {
+	return s.store.GetMetrics(ctx, query)
+}
+
+// FormatValue formats a metric value in the shortest form parsing back to the same value
+func FormatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
 func (s *Service) DeleteMetricsByName(ctx context.Context, name string) error {
 	s.logger.Info(fmt.Sprintf("deleting push gateway metric %s", name))
 	return s.store.DeleteMetricsByName(ctx, name)
@@ -91,6 +149,23 @@ func (s *Service) DeleteMetricByID(ctx context.Context, id string) error {
 	return s.store.DeleteMetricByID(ctx, id)
 }
 
+// DeleteMetricsBySelectors deletes the metrics matching one of the selectors
+// and returns them. With dryRun, the matching metrics are only returned.
+func (s *Service) DeleteMetricsBySelectors(ctx context.Context, selectors [][]aggregates.LabelMatcher, dryRun bool) ([]*aggregates.PushgatewayMetric, error) {
+	if len(selectors) == 0 {
+		return nil, er.New("at least one selector is required to delete metrics", er.BadRequest, true)
+	}
+	if dryRun {
+		return s.store.GetMetrics(ctx, aggregates.Query{Selectors: selectors})
+	}
+	metrics, err := s.store.DeleteMetricsBySelectors(ctx, selectors)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info(fmt.Sprintf("deleted %d push gateway metrics matching selectors", len(metrics)))
+	return metrics, nil
+}
+
 func (s *Service) DeleteAllPushgatewayMetrics(ctx context.Context) error {
 	s.logger.Info("deleting all push gateway metrics")
 	return s.store.DeleteAllPushgatewayMetrics(ctx)
@@ -1,25 +1,34 @@
 package pushgateway_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log/slog"
+	"math"
 	"testing"
+	"time"
 
 	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/pushgateway"
 	"github.com/appclacks/server/pkg/pushgateway"
 	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestPrometheusMetrics(t *testing.T) {
 	store := new(mocks.MockStore)
+	store.On("RegisterMetricFamilies", mock.Anything, mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
 	reg := prometheus.NewRegistry()
 	logger := slog.Default()
 
 	service, err := pushgateway.New(logger, store, reg)
 	assert.NoError(t, err)
+	groupsCall := store.On("GetGroups", mock.Anything).Return([]*aggregates.PushgatewayGroup{}, nil)
 
 	desc1 := "my description"
 	type1 := "gauge"
@@ -27,6 +36,11 @@ func TestPrometheusMetrics(t *testing.T) {
 	desc2 := "my super description"
 	type2 := "counter"
 
+	multiline := "first line\nsecond line \\"
+
+	histogramType := "histogram"
+	summaryType := "summary"
+
 	cases := []struct {
 		result  string
 		metrics []*aggregates.PushgatewayMetric
@@ -39,10 +53,10 @@ func TestPrometheusMetrics(t *testing.T) {
 			metrics: []*aggregates.PushgatewayMetric{
 				{
 					Name:  "metric1",
-					Value: "123.4",
+					Value: 123.4,
 				},
 			},
-			result: "metric1{} 123.4\n",
+			result: "# TYPE metric1 untyped\nmetric1 123.4\n",
 		},
 		{
 			metrics: []*aggregates.PushgatewayMetric{
@@ -50,12 +64,12 @@ func TestPrometheusMetrics(t *testing.T) {
 					Name:        "metric2",
 					Description: &desc1,
 					Type:        &type1,
-					Value:       "121",
+					Value:       121,
 				},
 			},
 			result: `# HELP metric2 my description
 # TYPE metric2 gauge
-metric2{} 121
+metric2 121
 `,
 		},
 		{
@@ -67,7 +81,7 @@ metric2{} 121
 					Labels: map[string]string{
 						"env": "test",
 					},
-					Value: "121",
+					Value: 121,
 				},
 			},
 			result: `# HELP metric2 my description
@@ -81,11 +95,11 @@ metric2{env="test"} 121
 					Name:        "metric1",
 					Description: &desc1,
 					Type:        &type1,
-					Value:       "121",
+					Value:       121,
 				},
 				{
 					Name:  "metric2",
-					Value: "10.1",
+					Value: 10.1,
 					Labels: map[string]string{
 						"env":  "prod",
 						"team": "sre",
@@ -99,30 +113,30 @@ metric2{env="test"} 121
 						"env":  "staging",
 						"team": "data",
 					},
-					Value: "121",
+					Value: 121,
 				},
 			},
 			result: `# HELP metric1 my description
 # TYPE metric1 gauge
-metric1{} 121
+metric1 121
 # HELP metric2 my super description
 # TYPE metric2 counter
-metric2{env="prod", team="sre"} 10.1
-metric2{env="staging", team="data"} 121
+metric2{env="prod",team="sre"} 10.1
+metric2{env="staging",team="data"} 121
 `,
 		},
 		{
 			metrics: []*aggregates.PushgatewayMetric{
 				{
 					Name:  "metric3",
-					Value: "123.4567",
+					Value: 123.4567,
 					Labels: map[string]string{
 						"team": "backend",
 					},
 				},
 				{
 					Name:  "metric4",
-					Value: "123.4567",
+					Value: 123.4567,
 					Labels: map[string]string{
 						"team": "front",
 					},
@@ -131,11 +145,11 @@ metric2{env="staging", team="data"} 121
 					Name:        "metric1",
 					Description: &desc1,
 					Type:        &type1,
-					Value:       "121",
+					Value:       121,
 				},
 				{
 					Name:  "metric2",
-					Value: "10.1",
+					Value: 10.1,
 					Labels: map[string]string{
 						"env":  "prod",
 						"team": "sre",
@@ -149,28 +163,279 @@ metric2{env="staging", team="data"} 121
 						"env":  "staging",
 						"team": "data",
 					},
-					Value: "121",
+					Value: 121,
 				},
 			},
 			result: `# HELP metric1 my description
 # TYPE metric1 gauge
-metric1{} 121
+metric1 121
 # HELP metric2 my super description
 # TYPE metric2 counter
-metric2{env="prod", team="sre"} 10.1
-metric2{env="staging", team="data"} 121
+metric2{env="prod",team="sre"} 10.1
+metric2{env="staging",team="data"} 121
+# TYPE metric3 untyped
 metric3{team="backend"} 123.4567
+# TYPE metric4 untyped
 metric4{team="front"} 123.4567
+`,
+		},
+		{
+			metrics: []*aggregates.PushgatewayMetric{
+				{
+					Name:   "duration_seconds",
+					Type:   &histogramType,
+					Labels: map[string]string{"job": "backup"},
+					Histogram: &aggregates.Histogram{
+						Buckets: []aggregates.Bucket{
+							{UpperBound: 0.5, Count: 1},
+							{UpperBound: 1, Count: 3},
+							{UpperBound: math.Inf(1), Count: 4},
+						},
+						Sum:   3.2,
+						Count: 4,
+					},
+				},
+				{
+					Name: "latency_seconds",
+					Type: &summaryType,
+					Summary: &aggregates.Summary{
+						Quantiles: []aggregates.Quantile{
+							{Quantile: 0.5, Value: 0.1},
+							{Quantile: 0.99, Value: math.NaN()},
+						},
+						Sum:   10,
+						Count: 20,
+					},
+				},
+			},
+			result: `# TYPE duration_seconds histogram
+duration_seconds_bucket{job="backup",le="0.5"} 1
+duration_seconds_bucket{job="backup",le="1"} 3
+duration_seconds_bucket{job="backup",le="+Inf"} 4
+duration_seconds_sum{job="backup"} 3.2
+duration_seconds_count{job="backup"} 4
+# TYPE latency_seconds summary
+latency_seconds{quantile="0.5"} 0.1
+latency_seconds{quantile="0.99"} NaN
+latency_seconds_sum 10
+latency_seconds_count 20
+`,
+		},
+		{
+			metrics: []*aggregates.PushgatewayMetric{
+				{
+					Name:        "escaped",
+					Description: &multiline,
+					Labels: map[string]string{
+						"path": "C:\\data \"backup\"\n",
+					},
+					Value: 1,
+				},
+			},
+			result: `# HELP escaped first line\nsecond line \\
+# TYPE escaped untyped
+escaped{path="C:\\data \"backup\"\n"} 1
+`,
+		},
+		{
+			// the gauge conflicts with the counter type of the family
+			metrics: []*aggregates.PushgatewayMetric{
+				{
+					Name:  "conflict",
+					Type:  &type2,
+					Value: 1,
+				},
+				{
+					Name:   "conflict",
+					Type:   &type1,
+					Labels: map[string]string{"env": "prod"},
+					Value:  2,
+				},
+				{
+					Name:   "conflict",
+					Labels: map[string]string{"env": "staging"},
+					Value:  3,
+				},
+			},
+			result: `# TYPE conflict counter
+conflict 1
+conflict{env="staging"} 3
 `,
 		},
 	}
 
 	for _, c := range cases {
-		call := store.On("GetMetrics", mock.Anything).Return(c.metrics, nil)
-		result, err := service.PrometheusMetrics(context.Background())
+		call := store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return(c.metrics, nil)
+		var result bytes.Buffer
+		err := service.PrometheusMetrics(context.Background(), &result, expfmt.NewFormat(expfmt.TypeTextPlain), nil)
 		assert.NoError(t, err)
-		assert.Equal(t, c.result, result)
+		assert.Equal(t, c.result, result.String())
 		call.Unset()
 	}
 
+	createdAt := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	call := store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return([]*aggregates.PushgatewayMetric{
+		{
+			Name:      "jobs_total",
+			Type:      &type2,
+			Labels:    map[string]string{"job": "backup"},
+			Value:     3,
+			CreatedAt: createdAt,
+		},
+	}, nil)
+	var result bytes.Buffer
+	err = service.PrometheusMetrics(context.Background(), &result, expfmt.NewFormat(expfmt.TypeOpenMetrics), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `# TYPE jobs counter
+jobs_total{job="backup"} 3.0
+jobs_created{job="backup"} 1.792368e+09
+# EOF
+`, result.String())
+	call.Unset()
+	groupsCall.Unset()
+
+	// push times of the groups and sample timestamps
+	pushTime := time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC)
+	timestamp := time.UnixMilli(1792368000500)
+	store.On("GetGroups", mock.Anything).Return([]*aggregates.PushgatewayGroup{
+		{
+			GroupingKey:     map[string]string{"job": "backup"},
+			PushTime:        &pushTime,
+			PushFailureTime: nil,
+		},
+	}, nil)
+	store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return([]*aggregates.PushgatewayMetric{
+		{
+			Name:      "backup_size_bytes",
+			Labels:    map[string]string{"job": "backup"},
+			Value:     1024,
+			Timestamp: &timestamp,
+		},
+	}, nil)
+	result.Reset()
+	err = service.PrometheusMetrics(context.Background(), &result, expfmt.NewFormat(expfmt.TypeTextPlain), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `# TYPE backup_size_bytes untyped
+backup_size_bytes{job="backup"} 1024 1792368000500
+# HELP push_failure_time_seconds Last Unix time when changing this group in the Pushgateway failed.
+# TYPE push_failure_time_seconds gauge
+push_failure_time_seconds{job="backup"} 0
+# HELP push_time_seconds Last Unix time when changing this group in the Pushgateway succeeded.
+# TYPE push_time_seconds gauge
+push_time_seconds{job="backup"} 1.7923752e+09
+`, result.String())
+
+	// the group metrics are also filtered by the selectors
+	selector, err := pushgateway.ParseSelector(`push_time_seconds{job="backup"}`)
+	assert.NoError(t, err)
+	selectors := [][]aggregates.LabelMatcher{selector}
+	store.On("GetMetrics", mock.Anything, aggregates.Query{Selectors: selectors}).Return([]*aggregates.PushgatewayMetric{}, nil)
+	result.Reset()
+	err = service.PrometheusMetrics(context.Background(), &result, expfmt.NewFormat(expfmt.TypeTextPlain), selectors)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP push_time_seconds Last Unix time when changing this group in the Pushgateway succeeded.
+# TYPE push_time_seconds gauge
+push_time_seconds{job="backup"} 1.7923752e+09
+`, result.String())
+}
+
+// familyWriter records the writes and fails once limit writes are done
+type familyWriter struct {
+	writes []string
+	limit  int
+}
+
+func (w *familyWriter) Write(b []byte) (int, error) {
+	if len(w.writes) >= w.limit {
+		return 0, errors.New("connection reset")
+	}
+	w.writes = append(w.writes, string(b))
+	return len(b), nil
+}
+
+func TestPrometheusMetricsEncoding(t *testing.T) {
+	store := new(mocks.MockStore)
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil)
+	store.On("GetGroups", mock.Anything).Return([]*aggregates.PushgatewayGroup{}, nil)
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	// nothing is written if the metrics can't be fetched
+	call := store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return(nil, errors.New("connection refused"))
+	writer := &familyWriter{limit: 10}
+	err = service.PrometheusMetrics(context.Background(), writer, expfmt.NewFormat(expfmt.TypeTextPlain), nil)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Empty(t, writer.writes)
+	call.Unset()
+
+	// each family is written once encoded, the encoding stops on errors
+	store.On("GetMetrics", mock.Anything, aggregates.Query{}).Return([]*aggregates.PushgatewayMetric{
+		{Name: "b", Value: 2},
+		{Name: "a", Value: 1},
+		{Name: "c", Value: 3},
+	}, nil)
+	writer = &familyWriter{limit: 1}
+	err = service.PrometheusMetrics(context.Background(), writer, expfmt.NewFormat(expfmt.TypeTextPlain), nil)
+	assert.ErrorContains(t, err, "fail to encode metric b")
+	assert.Equal(t, []string{"# TYPE a untyped\na 1\n"}, writer.writes)
+}
+
+func TestIncrementPushgatewayMetric(t *testing.T) {
+	store := new(mocks.MockStore)
+	store.On("RegisterMetricFamilies", mock.Anything, mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	counter := "counter"
+	gauge := "gauge"
+	histogram := "histogram"
+	_, err = service.IncrementPushgatewayMetric(context.Background(), aggregates.PushgatewayMetric{Name: "a", Type: &counter, Value: -1})
+	assert.Error(t, err)
+	_, err = service.IncrementPushgatewayMetric(context.Background(), aggregates.PushgatewayMetric{Name: "a", Type: &counter, Value: math.NaN()})
+	assert.Error(t, err)
+	_, err = service.IncrementPushgatewayMetric(context.Background(), aggregates.PushgatewayMetric{Name: "a", Type: &histogram, Value: 1})
+	assert.Error(t, err)
+
+	expected := aggregates.PushgatewayMetric{Name: "a", Type: &gauge, Value: -2.5}
+	store.On("IncrementPushgatewayMetric", mock.Anything, expected).Return(&expected, nil)
+	result, err := service.IncrementPushgatewayMetric(context.Background(), expected)
+	assert.NoError(t, err)
+	assert.Equal(t, -2.5, result.Value)
+	store.AssertExpectations(t)
+}
+
+func TestBatchCreateOrUpdatePushgatewayMetrics(t *testing.T) {
+	store := new(mocks.MockStore)
+	store.On("RegisterMetricFamilies", mock.Anything, mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	histogram := "histogram"
+	summary := "summary"
+	_, err = service.BatchCreateOrUpdatePushgatewayMetrics(context.Background(), []aggregates.PushgatewayMetric{
+		{Name: "a", Value: 1},
+		{Name: "b", Type: &summary},
+		{Name: "c", Type: &histogram},
+		{Name: "a", Value: 2},
+	})
+	assert.Error(t, err)
+	var batchErr *er.Error
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Messages, 3)
+	assert.Equal(t, "metric 3 (a): same name and labels as metric 0", batchErr.Messages[2])
+
+	metrics := []aggregates.PushgatewayMetric{
+		{Name: "a", Value: 1},
+		{Name: "a", Value: 2, Labels: map[string]string{"env": "prod"}},
+	}
+	store.On("BatchCreateOrUpdatePushgatewayMetrics", mock.Anything, metrics).Return([]aggregates.BatchResult{
+		{ID: "1", Created: true},
+		{ID: "2"},
+	}, nil)
+	results, err := service.BatchCreateOrUpdatePushgatewayMetrics(context.Background(), metrics)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	store.AssertExpectations(t)
 }
@@ -0,0 +1,415 @@
+package pushgateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+const (
+	serviceNameAttribute       = "service.name"
+	serviceNamespaceAttribute  = "service.namespace"
+	serviceInstanceIDAttribute = "service.instance.id"
+)
+
+// OTLPConfig configures the OTLP metrics receiver. The job and instance
+// labels are always built from the service resource attributes, other
+// resource attributes become labels depending on the promotion rules.
+type OTLPConfig struct {
+	// TTL of the written metrics, they don't expire if empty
+	TTL string
+	// PromoteResourceAttributes lists the resource attributes added to labels
+	PromoteResourceAttributes []string
+	// PromoteAllResourceAttributes adds all resource attributes to labels,
+	// except the ones listed in IgnoreResourceAttributes
+	PromoteAllResourceAttributes bool
+	IgnoreResourceAttributes     []string
+}
+
+func (c OTLPConfig) promoted(attribute string) bool {
+	if c.PromoteAllResourceAttributes {
+		for _, ignored := range c.IgnoreResourceAttributes {
+			if ignored == attribute {
+				return false
+			}
+		}
+		return true
+	}
+	for _, promoted := range c.PromoteResourceAttributes {
+		if promoted == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+func rejectDataPoints(result *aggregates.OTLPResult, metric string, count int, message string) {
+	result.Rejected += int64(count)
+	result.Messages = append(result.Messages, fmt.Sprintf("metric %s: %s", metric, message))
+}
+
+// SetOTLPConfig changes the configuration of the OTLP metrics receiver
+func (s *Service) SetOTLPConfig(config OTLPConfig) {
+	s.otlpLock.Lock()
+	defer s.otlpLock.Unlock()
+	s.otlp = config
+}
+
+func (s *Service) otlpConfig() OTLPConfig {
+	s.otlpLock.RLock()
+	defer s.otlpLock.RUnlock()
+	return s.otlp
+}
+
+// sanitizeName replaces the characters not allowed in Prometheus names by _
+func sanitizeName(name string, allowColons bool) string {
+	var builder strings.Builder
+	for i, r := range name {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9' && i > 0) || (allowColons && r == ':')
+		if valid {
+			builder.WriteRune(r)
+		} else if r >= '0' && r <= '9' {
+			builder.WriteString("_")
+			builder.WriteRune(r)
+		} else {
+			builder.WriteRune('_')
+		}
+	}
+	return builder.String()
+}
+
+// attributeValue converts an attribute value to a label value, arrays and
+// maps being encoded in JSON
+func attributeValue(value *commonpb.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return FormatValue(v.DoubleValue)
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		result, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			return ""
+		}
+		return string(result)
+	}
+	return ""
+}
+
+func jsonValue(value *commonpb.AnyValue) any {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_ArrayValue:
+		result := []any{}
+		for _, item := range v.ArrayValue.GetValues() {
+			result = append(result, jsonValue(item))
+		}
+		return result
+	case *commonpb.AnyValue_KvlistValue:
+		result := make(map[string]any)
+		for _, kv := range v.KvlistValue.GetValues() {
+			result[kv.GetKey()] = jsonValue(kv.GetValue())
+		}
+		return result
+	}
+	return attributeValue(value)
+}
+
+// attributesToLabels converts OTLP attributes to labels. Values of attributes
+// having the same sanitized name are joined with ;
+func attributesToLabels(labels map[string]string, attributes []*commonpb.KeyValue) {
+	sorted := make([]*commonpb.KeyValue, len(attributes))
+	copy(sorted, attributes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetKey() < sorted[j].GetKey()
+	})
+	added := make(map[string]bool)
+	for _, attribute := range sorted {
+		name := sanitizeName(attribute.GetKey(), false)
+		if strings.HasPrefix(name, "__") {
+			name = "key" + name
+		}
+		value := attributeValue(attribute.GetValue())
+		if added[name] {
+			labels[name] = labels[name] + ";" + value
+			continue
+		}
+		added[name] = true
+		labels[name] = value
+	}
+}
+
+// resourceLabels returns the labels built from the resource attributes
+func resourceLabels(config OTLPConfig, attributes []*commonpb.KeyValue) map[string]string {
+	result := make(map[string]string)
+	promoted := []*commonpb.KeyValue{}
+	var name, namespace, instance string
+	for _, attribute := range attributes {
+		switch attribute.GetKey() {
+		case serviceNameAttribute:
+			name = attributeValue(attribute.GetValue())
+		case serviceNamespaceAttribute:
+			namespace = attributeValue(attribute.GetValue())
+		case serviceInstanceIDAttribute:
+			instance = attributeValue(attribute.GetValue())
+		}
+		if config.promoted(attribute.GetKey()) {
+			promoted = append(promoted, attribute)
+		}
+	}
+	attributesToLabels(result, promoted)
+	if name != "" {
+		if namespace != "" {
+			name = namespace + "/" + name
+		}
+		result["job"] = name
+	}
+	if instance != "" {
+		result["instance"] = instance
+	}
+	return result
+}
+
+// dataPointLabels returns the labels of a data point. Like the labels of a
+// scraped target, the resource labels take precedence: a conflicting
+// attribute is renamed with the exported_ prefix, for example job becomes
+// exported_job.
+func dataPointLabels(resource map[string]string, attributes []*commonpb.KeyValue) map[string]string {
+	result := make(map[string]string)
+	attributesToLabels(result, attributes)
+	conflicts := []string{}
+	for k, v := range resource {
+		if value, ok := result[k]; ok && value != v {
+			conflicts = append(conflicts, k)
+		}
+	}
+	// sorted so the renamed labels don't depend on the map order
+	sort.Strings(conflicts)
+	for _, k := range conflicts {
+		name := "exported_" + k
+		for {
+			if _, ok := result[name]; !ok {
+				break
+			}
+			name = "exported_" + name
+		}
+		result[name] = result[k]
+	}
+	for k, v := range resource {
+		result[k] = v
+	}
+	return result
+}
+
+func numberValue(point *metricspb.NumberDataPoint) float64 {
+	if value, ok := point.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(value.AsInt)
+	}
+	return point.GetAsDouble()
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func otlpHistogram(point *metricspb.HistogramDataPoint) (*aggregates.Histogram, error) {
+	counts := point.GetBucketCounts()
+	bounds := point.GetExplicitBounds()
+	if len(counts) != 0 && len(counts) != len(bounds)+1 {
+		return nil, fmt.Errorf("%d bucket counts for %d explicit bounds", len(counts), len(bounds))
+	}
+	result := &aggregates.Histogram{
+		Sum:   point.GetSum(),
+		Count: point.GetCount(),
+	}
+	// OTLP bucket counts are not cumulative, the +Inf bucket count is the
+	// total count
+	if len(counts) != 0 {
+		cumulative := uint64(0)
+		for i, bound := range bounds {
+			cumulative += counts[i]
+			result.Buckets = append(result.Buckets, aggregates.Bucket{
+				UpperBound: bound,
+				Count:      cumulative,
+			})
+		}
+	}
+	result.Buckets = append(result.Buckets, aggregates.Bucket{
+		UpperBound: math.Inf(1),
+		Count:      point.GetCount(),
+	})
+	return result, nil
+}
+
+func otlpSummary(point *metricspb.SummaryDataPoint) *aggregates.Summary {
+	result := &aggregates.Summary{
+		Sum:   point.GetSum(),
+		Count: point.GetCount(),
+	}
+	for _, quantile := range point.GetQuantileValues() {
+		result.Quantiles = append(result.Quantiles, aggregates.Quantile{
+			Quantile: quantile.GetQuantile(),
+			Value:    quantile.GetValue(),
+		})
+	}
+	return result
+}
+
+// otlpMetric builds a metric from the common fields of OTLP data points
+func otlpMetric(name string, metricType string, description string, labels map[string]string, timeUnixNano uint64) aggregates.PushgatewayMetric {
+	metric := aggregates.PushgatewayMetric{
+		Name:   name,
+		Labels: labels,
+		Type:   &metricType,
+	}
+	if description != "" {
+		metric.Description = &description
+	}
+	if timeUnixNano != 0 {
+		timestamp := time.Unix(0, int64(timeUnixNano)).UTC()
+		metric.Timestamp = &timestamp
+	}
+	return metric
+}
+
+func dataPointsCount(metric *metricspb.Metric) int {
+	switch data := metric.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	}
+	return 0
+}
+
+// fromOTLPMetric converts the data points of an OTLP metric. Unsupported
+// data points are rejected.
+func fromOTLPMetric(resource map[string]string, metric *metricspb.Metric, series *seriesSet, result *aggregates.OTLPResult) {
+	name := sanitizeName(metric.GetName(), true)
+	if name == "" {
+		rejectDataPoints(result, metric.GetName(), dataPointsCount(metric), "the metric name is empty")
+		return
+	}
+	description := metric.GetDescription()
+	switch data := metric.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, point := range data.Gauge.GetDataPoints() {
+			if noRecordedValue(point.GetFlags()) {
+				continue
+			}
+			m := otlpMetric(name, "gauge", description, dataPointLabels(resource, point.GetAttributes()), point.GetTimeUnixNano())
+			m.Value = numberValue(point)
+			series.add(m)
+		}
+	case *metricspb.Metric_Sum:
+		points := data.Sum.GetDataPoints()
+		if data.Sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+			rejectDataPoints(result, metric.GetName(), len(points), "only cumulative sums are supported")
+			return
+		}
+		metricType := "gauge"
+		if data.Sum.GetIsMonotonic() {
+			metricType = "counter"
+			if !strings.HasSuffix(name, "_total") {
+				name = name + "_total"
+			}
+		}
+		for _, point := range points {
+			if noRecordedValue(point.GetFlags()) {
+				continue
+			}
+			m := otlpMetric(name, metricType, description, dataPointLabels(resource, point.GetAttributes()), point.GetTimeUnixNano())
+			m.Value = numberValue(point)
+			series.add(m)
+		}
+	case *metricspb.Metric_Histogram:
+		points := data.Histogram.GetDataPoints()
+		if data.Histogram.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+			rejectDataPoints(result, metric.GetName(), len(points), "only cumulative histograms are supported")
+			return
+		}
+		for _, point := range points {
+			if noRecordedValue(point.GetFlags()) {
+				continue
+			}
+			histogram, err := otlpHistogram(point)
+			if err != nil {
+				rejectDataPoints(result, metric.GetName(), 1, err.Error())
+				continue
+			}
+			m := otlpMetric(name, "histogram", description, dataPointLabels(resource, point.GetAttributes()), point.GetTimeUnixNano())
+			m.Histogram = histogram
+			series.add(m)
+		}
+	case *metricspb.Metric_Summary:
+		for _, point := range data.Summary.GetDataPoints() {
+			if noRecordedValue(point.GetFlags()) {
+				continue
+			}
+			m := otlpMetric(name, "summary", description, dataPointLabels(resource, point.GetAttributes()), point.GetTimeUnixNano())
+			m.Summary = otlpSummary(point)
+			series.add(m)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		rejectDataPoints(result, metric.GetName(), dataPointsCount(metric), "exponential histograms are not supported")
+	}
+}
+
+// OTLPMetrics stores the latest data point of each series of an OTLP metrics export
+func (s *Service) OTLPMetrics(ctx context.Context, request *colmetricspb.ExportMetricsServiceRequest) (*aggregates.OTLPResult, error) {
+	config := s.otlpConfig()
+	expiresAt, err := expirationDate(config.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP TTL: %w", err)
+	}
+	result := &aggregates.OTLPResult{}
+	series := newSeriesSet()
+	for _, resourceMetrics := range request.GetResourceMetrics() {
+		resource := resourceLabels(config, resourceMetrics.GetResource().GetAttributes())
+		for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+			for _, metric := range scopeMetrics.GetMetrics() {
+				fromOTLPMetric(resource, metric, series, result)
+			}
+		}
+	}
+	for i := range series.metrics {
+		metric := &series.metrics[i]
+		if config.TTL != "" {
+			ttl := config.TTL
+			metric.TTL = &ttl
+			metric.ExpiresAt = expiresAt
+		}
+		InitPushgatewayMetric(metric)
+	}
+	if len(series.metrics) == 0 {
+		return result, nil
+	}
+	_, err = s.BatchCreateOrUpdatePushgatewayMetrics(ctx, series.metrics)
+	if err != nil {
+		return nil, err
+	}
+	result.Written = len(series.metrics)
+	return result, nil
+}
@@ -0,0 +1,156 @@
+package pushgateway_test
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"testing"
+
+	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func stringAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	store := new(mocks.MockStore)
+	store.On("RegisterMetricFamilies", mock.Anything, mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	service.SetOTLPConfig(pushgateway.OTLPConfig{
+		TTL:                       "1h",
+		PromoteResourceAttributes: []string{"deployment.environment"},
+	})
+
+	sum := 12.5
+	request := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{
+			{
+				Resource: &resourcepb.Resource{
+					Attributes: []*commonpb.KeyValue{
+						stringAttribute("service.name", "backup"),
+						stringAttribute("service.namespace", "infra"),
+						stringAttribute("service.instance.id", "host-1"),
+						stringAttribute("deployment.environment", "prod"),
+						stringAttribute("host.arch", "amd64"),
+					},
+				},
+				ScopeMetrics: []*metricspb.ScopeMetrics{
+					{
+						Metrics: []*metricspb.Metric{
+							{
+								Name:        "backup.size",
+								Description: "Backup size",
+								Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+									DataPoints: []*metricspb.NumberDataPoint{
+										{
+											TimeUnixNano: 2000000000,
+											Value:        &metricspb.NumberDataPoint_AsInt{AsInt: 1024},
+											Attributes:   []*commonpb.KeyValue{stringAttribute("disk.name", "sda")},
+										},
+									},
+								}},
+							},
+							{
+								Name: "backup.files",
+								Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+									IsMonotonic:            true,
+									AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+									DataPoints: []*metricspb.NumberDataPoint{
+										{
+											Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 3},
+											// the conflicting attributes are renamed
+											Attributes: []*commonpb.KeyValue{
+												stringAttribute("job", "worker"),
+												stringAttribute("instance", "host-1"),
+											},
+										},
+									},
+								}},
+							},
+							{
+								Name: "backup.errors",
+								Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+									IsMonotonic:            true,
+									AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+									DataPoints: []*metricspb.NumberDataPoint{
+										{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 1}},
+									},
+								}},
+							},
+							{
+								Name: "backup.duration",
+								Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+									AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+									DataPoints: []*metricspb.HistogramDataPoint{
+										{
+											Count:          4,
+											Sum:            &sum,
+											BucketCounts:   []uint64{1, 2, 1},
+											ExplicitBounds: []float64{1, 5},
+										},
+									},
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	store.On("BatchCreateOrUpdatePushgatewayMetrics", mock.Anything, mock.MatchedBy(func(metrics []aggregates.PushgatewayMetric) bool {
+		if len(metrics) != 3 {
+			return false
+		}
+		gauge := metrics[0]
+		counter := metrics[1]
+		histogram := metrics[2]
+		labels := map[string]string{
+			"job":                    "infra/backup",
+			"instance":               "host-1",
+			"deployment_environment": "prod",
+			"exported_job":           "worker",
+		}
+		return gauge.Name == "backup_size" &&
+			*gauge.Type == "gauge" &&
+			*gauge.Description == "Backup size" &&
+			gauge.Value == 1024 &&
+			gauge.Labels["disk_name"] == "sda" &&
+			gauge.Labels["job"] == "infra/backup" &&
+			gauge.Timestamp.Unix() == 2 &&
+			*gauge.TTL == "1h" &&
+			counter.Name == "backup_files_total" &&
+			*counter.Type == "counter" &&
+			counter.Value == 3 &&
+			assert.ObjectsAreEqual(labels, counter.Labels) &&
+			counter.Timestamp == nil &&
+			histogram.Name == "backup_duration" &&
+			assert.ObjectsAreEqual([]aggregates.Bucket{
+				{UpperBound: 1, Count: 1},
+				{UpperBound: 5, Count: 3},
+				{UpperBound: math.Inf(1), Count: 4},
+			}, histogram.Histogram.Buckets) &&
+			histogram.Histogram.Sum == 12.5
+	})).Return([]aggregates.BatchResult{{ID: "1"}, {ID: "2"}, {ID: "3"}}, nil)
+	result, err := service.OTLPMetrics(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Written)
+	assert.Equal(t, int64(1), result.Rejected)
+	assert.Equal(t, []string{"metric backup.errors: only cumulative sums are supported"}, result.Messages)
+	store.AssertExpectations(t)
+}
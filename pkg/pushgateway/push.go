@@ -0,0 +1,288 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	pushTimeMetric        = "push_time_seconds"
+	pushFailureTimeMetric = "push_failure_time_seconds"
+)
+
+// ValidateGroupingKey checks that the grouping key of a push is valid
+func ValidateGroupingKey(groupingKey map[string]string) error {
+	if groupingKey["job"] == "" {
+		return er.New("the job label of the grouping key is required", er.BadRequest, true)
+	}
+	for name := range groupingKey {
+		if !model.LegacyValidation.IsValidLabelName(name) || strings.HasPrefix(name, "__") {
+			return er.Newf("invalid label name %s in the grouping key", er.BadRequest, true, name)
+		}
+	}
+	return nil
+}
+
+// SeriesKey returns a string identifying a metric by its name and labels
+func SeriesKey(name string, labels map[string]string) string {
+	pairs := []string{}
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// seriesSet deduplicates metrics by series, keeping the metric with the
+// latest timestamp
+type seriesSet struct {
+	metrics []aggregates.PushgatewayMetric
+	indexes map[string]int
+}
+
+func newSeriesSet() *seriesSet {
+	return &seriesSet{
+		metrics: []aggregates.PushgatewayMetric{},
+		indexes: make(map[string]int),
+	}
+}
+
+func (s *seriesSet) add(metric aggregates.PushgatewayMetric) {
+	key := SeriesKey(metric.Name, metric.Labels)
+	i, ok := s.indexes[key]
+	if !ok {
+		s.indexes[key] = len(s.metrics)
+		s.metrics = append(s.metrics, metric)
+		return
+	}
+	previous := s.metrics[i]
+	if previous.Timestamp != nil && metric.Timestamp != nil && previous.Timestamp.After(*metric.Timestamp) {
+		return
+	}
+	s.metrics[i] = metric
+}
+
+func fromHistogram(histogram *dto.Histogram) *aggregates.Histogram {
+	result := &aggregates.Histogram{
+		Sum:   histogram.GetSampleSum(),
+		Count: histogram.GetSampleCount(),
+	}
+	for _, bucket := range histogram.GetBucket() {
+		result.Buckets = append(result.Buckets, aggregates.Bucket{
+			UpperBound: bucket.GetUpperBound(),
+			Count:      bucket.GetCumulativeCount(),
+		})
+	}
+	// the +Inf bucket is implicit in the protobuf format
+	if len(result.Buckets) == 0 || !math.IsInf(result.Buckets[len(result.Buckets)-1].UpperBound, 1) {
+		result.Buckets = append(result.Buckets, aggregates.Bucket{
+			UpperBound: math.Inf(1),
+			Count:      result.Count,
+		})
+	}
+	return result
+}
+
+func fromSummary(summary *dto.Summary) *aggregates.Summary {
+	result := &aggregates.Summary{
+		Sum:   summary.GetSampleSum(),
+		Count: summary.GetSampleCount(),
+	}
+	for _, quantile := range summary.GetQuantile() {
+		result.Quantiles = append(result.Quantiles, aggregates.Quantile{
+			Quantile: quantile.GetQuantile(),
+			Value:    quantile.GetValue(),
+		})
+	}
+	return result
+}
+
+// FromMetricFamilies converts metric families pushed using the Prometheus Pushgateway
+// protocol to metrics. The grouping key labels are added to all metrics,
+// overriding labels with the same name.
+func FromMetricFamilies(groupingKey map[string]string, families []*dto.MetricFamily) ([]aggregates.PushgatewayMetric, error) {
+	result := []aggregates.PushgatewayMetric{}
+	series := make(map[string]bool)
+	for _, family := range families {
+		name := family.GetName()
+		if !model.LegacyValidation.IsValidMetricName(name) {
+			return nil, er.Newf("invalid metric name %s", er.BadRequest, true, name)
+		}
+		if name == pushTimeMetric || name == pushFailureTimeMetric {
+			return nil, er.Newf("metric name %s is reserved", er.BadRequest, true, name)
+		}
+		var metricType *string
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			t := "counter"
+			metricType = &t
+		case dto.MetricType_GAUGE:
+			t := "gauge"
+			metricType = &t
+		case dto.MetricType_HISTOGRAM:
+			t := "histogram"
+			metricType = &t
+		case dto.MetricType_SUMMARY:
+			t := "summary"
+			metricType = &t
+		case dto.MetricType_UNTYPED:
+		default:
+			return nil, er.Newf("metric %s: type %s is not supported", er.BadRequest, true, name, strings.ToLower(family.GetType().String()))
+		}
+		var description *string
+		if family.Help != nil {
+			help := family.GetHelp()
+			description = &help
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			for k, v := range groupingKey {
+				labels[k] = v
+			}
+			key := SeriesKey(name, labels)
+			if series[key] {
+				return nil, er.Newf("metric %s is pushed multiple times", er.BadRequest, true, key)
+			}
+			series[key] = true
+			pushed := aggregates.PushgatewayMetric{
+				Name:        name,
+				Description: description,
+				Labels:      labels,
+				Type:        metricType,
+				GroupingKey: groupingKey,
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				pushed.Value = metric.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				pushed.Value = metric.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				pushed.Histogram = fromHistogram(metric.GetHistogram())
+			case dto.MetricType_SUMMARY:
+				pushed.Summary = fromSummary(metric.GetSummary())
+			default:
+				pushed.Value = metric.GetUntyped().GetValue()
+			}
+			err := ValidateDistribution(&pushed)
+			if err != nil {
+				return nil, err
+			}
+			InitPushgatewayMetric(&pushed)
+			if metric.TimestampMs != nil {
+				timestamp := time.UnixMilli(metric.GetTimestampMs()).UTC()
+				pushed.Timestamp = &timestamp
+			}
+			result = append(result, pushed)
+		}
+	}
+	return result, nil
+}
+
+// PushMetrics stores metrics pushed using the Prometheus Pushgateway protocol.
+// All metrics of the group are replaced if replace is true, otherwise only
+// metrics with the same names as the pushed ones are replaced.
+func (s *Service) PushMetrics(ctx context.Context, groupingKey map[string]string, families []*dto.MetricFamily, replace bool) error {
+	err := ValidateGroupingKey(groupingKey)
+	if err != nil {
+		return err
+	}
+	metrics, err := FromMetricFamilies(groupingKey, families)
+	if err != nil {
+		s.RecordPushFailure(ctx, groupingKey)
+		return err
+	}
+	replaced, err := s.replacedSeries(ctx, groupingKey, metrics, replace)
+	if err != nil {
+		s.RecordPushFailure(ctx, groupingKey)
+		return err
+	}
+	err = s.checkLimits(ctx, metrics, replaced)
+	if err != nil {
+		s.RecordPushFailure(ctx, groupingKey)
+		return err
+	}
+	metricFamilies, err := s.reconcileFamilies(ctx, metrics)
+	if err != nil {
+		s.RecordPushFailure(ctx, groupingKey)
+		return err
+	}
+	s.logger.Debug(fmt.Sprintf("pushing %d metrics to group %s", len(metrics), SeriesKey("", groupingKey)))
+	err = s.store.PushGroup(ctx, groupingKey, metrics, replace, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	s.registerFamilies(ctx, metricFamilies)
+	return nil
+}
+
+// replacedSeries returns the series of the group deleted by the push: all
+// the series not pushed again if replace is true, otherwise only the ones
+// with the same names as the pushed metrics
+func (s *Service) replacedSeries(ctx context.Context, groupingKey map[string]string, metrics []aggregates.PushgatewayMetric, replace bool) ([]*aggregates.PushgatewayMetric, error) {
+	limits := s.Limits()
+	if limits.MaxSeries == 0 && limits.MaxSeriesPerMetric == 0 {
+		return nil, nil
+	}
+	// the grouping key labels are added to the pushed series
+	selector := []aggregates.LabelMatcher{}
+	for name, value := range groupingKey {
+		selector = append(selector, aggregates.LabelMatcher{Name: name, Type: aggregates.MatchEqual, Value: value})
+	}
+	existing, err := s.store.GetMetrics(ctx, aggregates.Query{Selectors: [][]aggregates.LabelMatcher{selector}})
+	if err != nil {
+		return nil, err
+	}
+	pushed := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, metric := range metrics {
+		pushed[SeriesKey(metric.Name, metric.Labels)] = true
+		names[metric.Name] = true
+	}
+	groupKey := SeriesKey("", groupingKey)
+	result := []*aggregates.PushgatewayMetric{}
+	for _, metric := range existing {
+		if metric.GroupingKey == nil || SeriesKey("", metric.GroupingKey) != groupKey {
+			continue
+		}
+		if pushed[SeriesKey(metric.Name, metric.Labels)] || (!replace && !names[metric.Name]) {
+			continue
+		}
+		result = append(result, metric)
+	}
+	return result, nil
+}
+
+// RecordPushFailure updates the last push failure time of a group. Errors
+// are only logged, the push error being more relevant for the client.
+func (s *Service) RecordPushFailure(ctx context.Context, groupingKey map[string]string) {
+	if ValidateGroupingKey(groupingKey) != nil {
+		return
+	}
+	err := s.store.RecordPushFailure(ctx, groupingKey, time.Now().UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("fail to record push failure for group %s: %s", SeriesKey("", groupingKey), err.Error()))
+	}
+}
+
+// DeleteGroup deletes all metrics pushed in a group
+func (s *Service) DeleteGroup(ctx context.Context, groupingKey map[string]string) error {
+	err := ValidateGroupingKey(groupingKey)
+	if err != nil {
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("deleting push gateway group %s", SeriesKey("", groupingKey)))
+	return s.store.DeleteGroup(ctx, groupingKey)
+}
@@ -0,0 +1,96 @@
+package pushgateway_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appclacks/server/pkg/pushgateway"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseFamilies(t *testing.T, text string) []*dto.MetricFamily {
+	t.Helper()
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	assert.NoError(t, err)
+	result := []*dto.MetricFamily{}
+	for _, family := range families {
+		result = append(result, family)
+	}
+	return result
+}
+
+func TestFromMetricFamilies(t *testing.T) {
+	groupingKey := map[string]string{
+		"job":      "backup",
+		"instance": "host1",
+	}
+	families := parseFamilies(t, `# HELP backup_duration_seconds Backup duration
+# TYPE backup_duration_seconds gauge
+backup_duration_seconds{db="users",job="other"} 12.5
+`)
+	metrics, err := pushgateway.FromMetricFamilies(groupingKey, families)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	metric := metrics[0]
+	assert.Equal(t, "backup_duration_seconds", metric.Name)
+	assert.Equal(t, "Backup duration", *metric.Description)
+	assert.Equal(t, "gauge", *metric.Type)
+	assert.Equal(t, 12.5, metric.Value)
+	assert.Equal(t, groupingKey, metric.GroupingKey)
+	assert.Equal(t, map[string]string{
+		"job":      "backup",
+		"instance": "host1",
+		"db":       "users",
+	}, metric.Labels)
+	assert.False(t, metric.CreatedAt.IsZero())
+
+	metrics, err = pushgateway.FromMetricFamilies(groupingKey, parseFamilies(t, "untyped_metric 1e+30\n"))
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Nil(t, metrics[0].Type)
+	assert.Nil(t, metrics[0].Description)
+	assert.Equal(t, 1e30, metrics[0].Value)
+	assert.Nil(t, metrics[0].Timestamp)
+
+	metrics, err = pushgateway.FromMetricFamilies(groupingKey, parseFamilies(t, "metric_with_timestamp 1 1700000000000\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1700000000000), metrics[0].Timestamp.UnixMilli())
+
+	families = parseFamilies(t, `# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.1"} 2
+request_duration_seconds_bucket{le="1"} 3
+request_duration_seconds_bucket{le="+Inf"} 4
+request_duration_seconds_sum 4.5
+request_duration_seconds_count 4
+`)
+	metrics, err = pushgateway.FromMetricFamilies(groupingKey, families)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "histogram", *metrics[0].Type)
+	assert.Len(t, metrics[0].Histogram.Buckets, 3)
+	assert.Equal(t, uint64(4), metrics[0].Histogram.Count)
+	assert.Equal(t, 4.5, metrics[0].Histogram.Sum)
+
+	errorCases := []string{
+		"push_time_seconds 1\n",
+		// the instance label is overridden by the grouping key
+		"duplicated{instance=\"a\"} 1\nduplicated{instance=\"b\"} 2\n",
+		"# TYPE summary_metric summary\nsummary_metric{quantile=\"2\"} 1\nsummary_metric_sum 1\nsummary_metric_count 1\n",
+	}
+	for _, c := range errorCases {
+		_, err = pushgateway.FromMetricFamilies(groupingKey, parseFamilies(t, c))
+		assert.Error(t, err, c)
+	}
+}
+
+func TestValidateGroupingKey(t *testing.T) {
+	assert.NoError(t, pushgateway.ValidateGroupingKey(map[string]string{"job": "a", "instance": "b"}))
+	assert.Error(t, pushgateway.ValidateGroupingKey(map[string]string{"instance": "b"}))
+	assert.Error(t, pushgateway.ValidateGroupingKey(map[string]string{"job": ""}))
+	assert.Error(t, pushgateway.ValidateGroupingKey(map[string]string{"job": "a", "__name__": "b"}))
+	assert.Error(t, pushgateway.ValidateGroupingKey(map[string]string{"job": "a", "in-valid": "b"}))
+}
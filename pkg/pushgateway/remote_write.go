@@ -0,0 +1,338 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// field numbers of the remote write 1.0 protobuf messages
+const (
+	writeRequestTimeseries = 1
+	writeRequestMetadata   = 3
+	timeseriesLabels       = 1
+	timeseriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+	metadataType           = 1
+	metadataFamilyName     = 2
+	metadataHelp           = 4
+)
+
+// values of the MetricMetadata.MetricType enum
+const (
+	metadataTypeCounter = 1
+	metadataTypeGauge   = 2
+)
+
+// staleNaN is the value used by Prometheus to mark a series as stale
+const staleNaN uint64 = 0x7ff0000000000002
+
+// LabelRule matches series having a label whose value fully matches the regex.
+// A missing label has an empty value.
+type LabelRule struct {
+	Label string
+	Regex *regexp.Regexp
+}
+
+// NewLabelRule compiles the regex of a label rule
+func NewLabelRule(label string, regex string) (LabelRule, error) {
+	compiled, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		return LabelRule{}, fmt.Errorf("invalid regex for label %s: %w", label, err)
+	}
+	return LabelRule{Label: label, Regex: compiled}, nil
+}
+
+func (r LabelRule) match(labels map[string]string) bool {
+	return r.Regex.MatchString(labels[r.Label])
+}
+
+// RemoteWriteConfig configures the Prometheus remote write receiver.
+// A series is written if it matches one of the allow rules (or if there
+// is no allow rule) and none of the deny rules.
+type RemoteWriteConfig struct {
+	// TTL of the written metrics, they don't expire if empty
+	TTL   string
+	Allow []LabelRule
+	Deny  []LabelRule
+}
+
+func (c RemoteWriteConfig) allowed(labels map[string]string) bool {
+	allowed := len(c.Allow) == 0
+	for _, rule := range c.Allow {
+		if rule.match(labels) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	for _, rule := range c.Deny {
+		if rule.match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetRemoteWriteConfig changes the configuration of the remote write receiver
+func (s *Service) SetRemoteWriteConfig(config RemoteWriteConfig) {
+	s.remoteWriteLock.Lock()
+	defer s.remoteWriteLock.Unlock()
+	s.remoteWrite = config
+}
+
+func (s *Service) remoteWriteConfig() RemoteWriteConfig {
+	s.remoteWriteLock.RLock()
+	defer s.remoteWriteLock.RUnlock()
+	return s.remoteWrite
+}
+
+type remoteSample struct {
+	value     float64
+	timestamp int64
+}
+
+type remoteSeries struct {
+	labels  map[string]string
+	samples []remoteSample
+}
+
+type remoteMetadata struct {
+	metricType int64
+	help       string
+}
+
+type writeRequest struct {
+	series   []remoteSeries
+	metadata map[string]remoteMetadata
+}
+
+// parseMessage calls fn for each field of a protobuf message. The content of
+// length-delimited fields is passed in bytes, varint and fixed values in number.
+func parseMessage(data []byte, fn func(num protowire.Number, bytes []byte, number uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var bytes []byte
+		var number uint64
+		switch typ {
+		case protowire.BytesType:
+			bytes, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			number, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			number, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var value uint32
+			value, n = protowire.ConsumeFixed32(data)
+			number = uint64(value)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		err := fn(num, bytes, number)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSeries(data []byte) (remoteSeries, error) {
+	series := remoteSeries{labels: make(map[string]string)}
+	err := parseMessage(data, func(num protowire.Number, bytes []byte, _ uint64) error {
+		switch num {
+		case timeseriesLabels:
+			var name, value string
+			err := parseMessage(bytes, func(num protowire.Number, bytes []byte, _ uint64) error {
+				switch num {
+				case labelName:
+					name = string(bytes)
+				case labelValue:
+					value = string(bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			series.labels[name] = value
+		case timeseriesSamples:
+			sample := remoteSample{}
+			err := parseMessage(bytes, func(num protowire.Number, _ []byte, number uint64) error {
+				switch num {
+				case sampleValue:
+					sample.value = math.Float64frombits(number)
+				case sampleTimestamp:
+					sample.timestamp = int64(number)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			series.samples = append(series.samples, sample)
+		}
+		return nil
+	})
+	return series, err
+}
+
+func parseMetadata(data []byte) (string, remoteMetadata, error) {
+	var name string
+	metadata := remoteMetadata{}
+	err := parseMessage(data, func(num protowire.Number, bytes []byte, number uint64) error {
+		switch num {
+		case metadataType:
+			metadata.metricType = int64(number)
+		case metadataFamilyName:
+			name = string(bytes)
+		case metadataHelp:
+			metadata.help = string(bytes)
+		}
+		return nil
+	})
+	return name, metadata, err
+}
+
+// parseWriteRequest decodes an uncompressed remote write 1.0 request
+func parseWriteRequest(data []byte) (*writeRequest, error) {
+	request := &writeRequest{metadata: make(map[string]remoteMetadata)}
+	err := parseMessage(data, func(num protowire.Number, bytes []byte, _ uint64) error {
+		switch num {
+		case writeRequestTimeseries:
+			series, err := parseSeries(bytes)
+			if err != nil {
+				return err
+			}
+			request.series = append(request.series, series)
+		case writeRequestMetadata:
+			name, metadata, err := parseMetadata(bytes)
+			if err != nil {
+				return err
+			}
+			request.metadata[name] = metadata
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, er.Newf("fail to decode remote write request: %s", er.BadRequest, true, err.Error())
+	}
+	return request, nil
+}
+
+// latestSample returns the sample with the highest timestamp, ignoring
+// stale markers
+func latestSample(samples []remoteSample) (remoteSample, bool) {
+	var result remoteSample
+	found := false
+	for _, sample := range samples {
+		if math.Float64bits(sample.value) == staleNaN {
+			continue
+		}
+		if !found || sample.timestamp >= result.timestamp {
+			result = sample
+			found = true
+		}
+	}
+	return result, found
+}
+
+// RemoteWrite stores the latest sample of each series of a Prometheus remote
+// write 1.0 request (uncompressed protobuf). It returns the number of series written.
+func (s *Service) RemoteWrite(ctx context.Context, data []byte) (int, error) {
+	request, err := parseWriteRequest(data)
+	if err != nil {
+		return 0, err
+	}
+	config := s.remoteWriteConfig()
+	expiresAt, err := expirationDate(config.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid remote write TTL: %w", err)
+	}
+	series := newSeriesSet()
+	skipped := 0
+	for _, remote := range request.series {
+		if !config.allowed(remote.labels) {
+			skipped++
+			continue
+		}
+		name := remote.labels[model.MetricNameLabel]
+		if !model.LegacyValidation.IsValidMetricName(name) {
+			return 0, er.Newf("invalid metric name %q", er.BadRequest, true, name)
+		}
+		sample, ok := latestSample(remote.samples)
+		if !ok {
+			continue
+		}
+		labels := make(map[string]string)
+		for k, v := range remote.labels {
+			if k == model.MetricNameLabel {
+				continue
+			}
+			if !model.LegacyValidation.IsValidLabelName(k) || strings.HasPrefix(k, "__") {
+				return 0, er.Newf("metric %s: invalid label name %s", er.BadRequest, true, name, k)
+			}
+			labels[k] = v
+		}
+		timestamp := time.UnixMilli(sample.timestamp).UTC()
+		metric := aggregates.PushgatewayMetric{
+			Name:      name,
+			Labels:    labels,
+			Value:     sample.value,
+			Timestamp: &timestamp,
+			ExpiresAt: expiresAt,
+		}
+		if config.TTL != "" {
+			ttl := config.TTL
+			metric.TTL = &ttl
+		}
+		if metadata, ok := request.metadata[name]; ok {
+			switch metadata.metricType {
+			case metadataTypeCounter:
+				t := "counter"
+				metric.Type = &t
+			case metadataTypeGauge:
+				t := "gauge"
+				metric.Type = &t
+			}
+			if metadata.help != "" {
+				help := metadata.help
+				metric.Description = &help
+			}
+		}
+		InitPushgatewayMetric(&metric)
+		// the same series can be sent multiple times in a request
+		series.add(metric)
+	}
+	if skipped > 0 {
+		s.logger.Debug(fmt.Sprintf("%d remote write series filtered by the label rules", skipped))
+	}
+	if len(series.metrics) == 0 {
+		return 0, nil
+	}
+	_, err = s.BatchCreateOrUpdatePushgatewayMetrics(ctx, series.metrics)
+	if err != nil {
+		return 0, err
+	}
+	return len(series.metrics), nil
+}
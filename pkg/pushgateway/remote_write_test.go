@@ -0,0 +1,116 @@
+package pushgateway_test
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+
+	mocks "github.com/appclacks/server/mocks/github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func appendSeries(b []byte, labels [][2]string, samples []sample) []byte {
+	series := []byte{}
+	for _, label := range labels {
+		l := protowire.AppendTag(nil, 1, protowire.BytesType)
+		l = protowire.AppendString(l, label[0])
+		l = protowire.AppendTag(l, 2, protowire.BytesType)
+		l = protowire.AppendString(l, label[1])
+		series = appendMessage(series, 1, l)
+	}
+	for _, sample := range samples {
+		s := protowire.AppendTag(nil, 1, protowire.Fixed64Type)
+		s = protowire.AppendFixed64(s, math.Float64bits(sample.value))
+		s = protowire.AppendTag(s, 2, protowire.VarintType)
+		s = protowire.AppendVarint(s, uint64(sample.timestamp))
+		series = appendMessage(series, 2, s)
+	}
+	return appendMessage(b, 1, series)
+}
+
+func appendMetadata(b []byte, metricType uint64, name string, help string) []byte {
+	m := protowire.AppendTag(nil, 1, protowire.VarintType)
+	m = protowire.AppendVarint(m, metricType)
+	m = protowire.AppendTag(m, 2, protowire.BytesType)
+	m = protowire.AppendString(m, name)
+	m = protowire.AppendTag(m, 4, protowire.BytesType)
+	m = protowire.AppendString(m, help)
+	return appendMessage(b, 3, m)
+}
+
+func TestRemoteWrite(t *testing.T) {
+	store := new(mocks.MockStore)
+	store.On("RegisterMetricFamilies", mock.Anything, mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	store.On("GetMetricFamilies", mock.Anything).Return([]*aggregates.MetricFamily{}, nil).Maybe()
+	service, err := pushgateway.New(slog.Default(), store, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	denyRule, err := pushgateway.NewLabelRule("env", "dev|test")
+	assert.NoError(t, err)
+	allowRule, err := pushgateway.NewLabelRule("__name__", "edge_.*")
+	assert.NoError(t, err)
+	service.SetRemoteWriteConfig(pushgateway.RemoteWriteConfig{
+		TTL:   "10m",
+		Allow: []pushgateway.LabelRule{allowRule},
+		Deny:  []pushgateway.LabelRule{denyRule},
+	})
+
+	request := []byte{}
+	request = appendSeries(request, [][2]string{{"__name__", "edge_requests_total"}, {"env", "prod"}}, []sample{
+		{value: 3, timestamp: 2000},
+		{value: 1, timestamp: 1000},
+		{value: math.Float64frombits(0x7ff0000000000002), timestamp: 3000},
+	})
+	request = appendSeries(request, [][2]string{{"__name__", "edge_requests_total"}, {"env", "dev"}}, []sample{{value: 1, timestamp: 1000}})
+	request = appendSeries(request, [][2]string{{"__name__", "other"}}, []sample{{value: 1, timestamp: 1000}})
+	request = appendSeries(request, [][2]string{{"__name__", "edge_temperature"}}, []sample{{value: 20.5, timestamp: 1000}})
+	request = appendMetadata(request, 1, "edge_requests_total", "Number of requests")
+
+	store.On("BatchCreateOrUpdatePushgatewayMetrics", mock.Anything, mock.MatchedBy(func(metrics []aggregates.PushgatewayMetric) bool {
+		if len(metrics) != 2 {
+			return false
+		}
+		counter := metrics[0]
+		gauge := metrics[1]
+		return counter.Name == "edge_requests_total" &&
+			counter.Value == 3 &&
+			counter.Labels["env"] == "prod" &&
+			len(counter.Labels) == 1 &&
+			*counter.Type == "counter" &&
+			*counter.Description == "Number of requests" &&
+			counter.Timestamp.Equal(time.UnixMilli(2000)) &&
+			*counter.TTL == "10m" &&
+			counter.ExpiresAt != nil &&
+			gauge.Name == "edge_temperature" &&
+			gauge.Value == 20.5 &&
+			gauge.Type == nil &&
+			len(gauge.Labels) == 0
+	})).Return([]aggregates.BatchResult{{ID: "1", Created: true}, {ID: "2", Created: true}}, nil)
+	written, err := service.RemoteWrite(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+	store.AssertExpectations(t)
+
+	invalid := appendSeries([]byte{}, [][2]string{{"__name__", "edge_invalid"}, {"__tenant", "a"}}, []sample{{value: 1, timestamp: 1000}})
+	_, err = service.RemoteWrite(context.Background(), invalid)
+	assert.ErrorContains(t, err, "invalid label name __tenant")
+
+	_, err = service.RemoteWrite(context.Background(), []byte{0x0a, 0x10})
+	assert.ErrorContains(t, err, "fail to decode remote write request")
+}
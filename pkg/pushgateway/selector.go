@@ -0,0 +1,209 @@
+package pushgateway
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	er "github.com/mcorbin/corbierror"
+)
+
+const nameLabel = "__name__"
+
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) skipSpaces() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\n\r", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func isNameChar(c byte, first bool, colons bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9') || (colons && c == ':')
+}
+
+// name reads a metric name if colons is true, a label name otherwise
+func (p *selectorParser) name(colons bool) string {
+	start := p.pos
+	for p.pos < len(p.input) && isNameChar(p.input[p.pos], p.pos == start, colons) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *selectorParser) operator() (string, error) {
+	for _, operator := range []string{aggregates.MatchRegexp, aggregates.MatchNotEqual, aggregates.MatchNotRegexp, aggregates.MatchEqual} {
+		if strings.HasPrefix(p.input[p.pos:], operator) {
+			p.pos += len(operator)
+			return operator, nil
+		}
+	}
+	return "", fmt.Errorf("expected a label matcher operator at position %d", p.pos)
+}
+
+// value reads a double-quoted, single-quoted or raw (backtick) string
+func (p *selectorParser) value() (string, error) {
+	if p.pos >= len(p.input) {
+		return "", fmt.Errorf("expected a label value")
+	}
+	quote := p.input[p.pos]
+	if quote != '"' && quote != '\'' && quote != '`' {
+		return "", fmt.Errorf("expected a quoted label value at position %d", p.pos)
+	}
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.input) && p.input[p.pos] != quote {
+		if p.input[p.pos] == '\\' && quote != '`' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return "", fmt.Errorf("unterminated label value")
+	}
+	p.pos++
+	raw := p.input[start:p.pos]
+	if quote == '\'' {
+		// converted to a double-quoted string
+		content := raw[1 : len(raw)-1]
+		content = strings.ReplaceAll(content, `\'`, `'`)
+		content = strings.ReplaceAll(content, `"`, `\"`)
+		raw = `"` + content + `"`
+	}
+	result, err := strconv.Unquote(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid label value %s", p.input[start:p.pos])
+	}
+	return result, nil
+}
+
+func (p *selectorParser) parse() ([]aggregates.LabelMatcher, error) {
+	matchers := []aggregates.LabelMatcher{}
+	p.skipSpaces()
+	if name := p.name(true); name != "" {
+		matchers = append(matchers, aggregates.LabelMatcher{
+			Name:  nameLabel,
+			Type:  aggregates.MatchEqual,
+			Value: name,
+		})
+	}
+	p.skipSpaces()
+	if p.pos == len(p.input) {
+		return matchers, nil
+	}
+	if p.input[p.pos] != '{' {
+		return nil, fmt.Errorf("unexpected character %q at position %d", p.input[p.pos], p.pos)
+	}
+	p.pos++
+	for {
+		p.skipSpaces()
+		if p.pos < len(p.input) && p.input[p.pos] == '}' {
+			p.pos++
+			break
+		}
+		label := p.name(false)
+		if label == "" {
+			return nil, fmt.Errorf("expected a label name at position %d", p.pos)
+		}
+		p.skipSpaces()
+		operator, err := p.operator()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, aggregates.LabelMatcher{
+			Name:  label,
+			Type:  operator,
+			Value: value,
+		})
+		p.skipSpaces()
+		if p.pos < len(p.input) && p.input[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if p.pos >= len(p.input) || p.input[p.pos] != '}' {
+			return nil, fmt.Errorf("expected , or } at position %d", p.pos)
+		}
+	}
+	p.skipSpaces()
+	if p.pos != len(p.input) {
+		return nil, fmt.Errorf("unexpected character %q at position %d", p.input[p.pos], p.pos)
+	}
+	return matchers, nil
+}
+
+// ParseSelector parses a PromQL series selector, like
+// backup_duration_seconds{job="backup",env=~"prod|staging"}. Like in
+// Prometheus, at least one matcher should not match empty values.
+func ParseSelector(selector string) ([]aggregates.LabelMatcher, error) {
+	parser := &selectorParser{input: selector}
+	matchers, err := parser.parse()
+	if err != nil {
+		return nil, er.Newf("invalid selector %s: %s", er.BadRequest, true, selector, err.Error())
+	}
+	matchesEmpty := true
+	for i := range matchers {
+		matcher := &matchers[i]
+		if matcher.Type == aggregates.MatchRegexp || matcher.Type == aggregates.MatchNotRegexp {
+			matcher.Regex, err = regexp.Compile("^(?:" + matcher.Value + ")$")
+			if err != nil {
+				return nil, er.Newf("invalid selector %s: invalid regex %s", er.BadRequest, true, selector, matcher.Value)
+			}
+		}
+		if !matchValue(*matcher, "") {
+			matchesEmpty = false
+		}
+	}
+	if matchesEmpty {
+		return nil, er.Newf("invalid selector %s: at least one matcher should not match empty values", er.BadRequest, true, selector)
+	}
+	return matchers, nil
+}
+
+func matchValue(matcher aggregates.LabelMatcher, value string) bool {
+	switch matcher.Type {
+	case aggregates.MatchEqual:
+		return value == matcher.Value
+	case aggregates.MatchNotEqual:
+		return value != matcher.Value
+	case aggregates.MatchRegexp:
+		return matcher.Regex.MatchString(value)
+	case aggregates.MatchNotRegexp:
+		return !matcher.Regex.MatchString(value)
+	}
+	return false
+}
+
+// MatchSelectors returns true if the series matches one of the selectors,
+// or if there is no selector
+func MatchSelectors(selectors [][]aggregates.LabelMatcher, name string, labels map[string]string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, selector := range selectors {
+		matches := true
+		for _, matcher := range selector {
+			value := labels[matcher.Name]
+			if matcher.Name == nameLabel {
+				value = name
+			}
+			if !matchValue(matcher, value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package pushgateway_test
+
+import (
+	"testing"
+
+	"github.com/appclacks/server/pkg/pushgateway"
+	"github.com/appclacks/server/pkg/pushgateway/aggregates"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	cases := []struct {
+		selector string
+		expected []aggregates.LabelMatcher
+	}{
+		{
+			selector: "backup_duration_seconds",
+			expected: []aggregates.LabelMatcher{
+				{Name: "__name__", Type: aggregates.MatchEqual, Value: "backup_duration_seconds"},
+			},
+		},
+		{
+			selector: `backup:duration{ job = "backup", env!='dev', }`,
+			expected: []aggregates.LabelMatcher{
+				{Name: "__name__", Type: aggregates.MatchEqual, Value: "backup:duration"},
+				{Name: "job", Type: aggregates.MatchEqual, Value: "backup"},
+				{Name: "env", Type: aggregates.MatchNotEqual, Value: "dev"},
+			},
+		},
+		{
+			selector: `{path="C:\\backup\"s", name=` + "`a\\b`" + `}`,
+			expected: []aggregates.LabelMatcher{
+				{Name: "path", Type: aggregates.MatchEqual, Value: `C:\backup"s`},
+				{Name: "name", Type: aggregates.MatchEqual, Value: `a\b`},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.selector, func(t *testing.T) {
+			result, err := pushgateway.ParseSelector(c.selector)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, result)
+		})
+	}
+
+	errorCases := []string{
+		"",
+		"{}",
+		`{env=""}`,
+		`{env=~".*"}`,
+		`{env="prod"`,
+		`{env="prod}`,
+		`{env~"prod"}`,
+		`{env=prod}`,
+		`{env=~"("}`,
+		`{env="prod" job="a"}`,
+		`metric}`,
+		`{1env="prod"}`,
+	}
+	for _, selector := range errorCases {
+		t.Run(selector, func(t *testing.T) {
+			_, err := pushgateway.ParseSelector(selector)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMatchSelectors(t *testing.T) {
+	parse := func(selectors ...string) [][]aggregates.LabelMatcher {
+		result := [][]aggregates.LabelMatcher{}
+		for _, selector := range selectors {
+			matchers, err := pushgateway.ParseSelector(selector)
+			assert.NoError(t, err)
+			result = append(result, matchers)
+		}
+		return result
+	}
+	labels := map[string]string{"job": "backup", "env": "prod"}
+
+	assert.True(t, pushgateway.MatchSelectors(nil, "backup_size_bytes", labels))
+	assert.True(t, pushgateway.MatchSelectors(parse(`backup_size_bytes`), "backup_size_bytes", labels))
+	assert.False(t, pushgateway.MatchSelectors(parse(`backup_duration_seconds`), "backup_size_bytes", labels))
+	assert.True(t, pushgateway.MatchSelectors(parse(`{__name__=~"backup_.*", env=~"prod|staging"}`), "backup_size_bytes", labels))
+	// regexes are anchored
+	assert.False(t, pushgateway.MatchSelectors(parse(`{env=~"pro"}`), "backup_size_bytes", labels))
+	assert.False(t, pushgateway.MatchSelectors(parse(`{job="backup", env!="prod"}`), "backup_size_bytes", labels))
+	// missing labels are empty
+	assert.True(t, pushgateway.MatchSelectors(parse(`{job="backup", instance=""}`), "backup_size_bytes", labels))
+	assert.True(t, pushgateway.MatchSelectors(parse(`{job="cleanup"}`, `{env="prod", job!~"cleanup|other"}`), "backup_size_bytes", labels))
+	assert.False(t, pushgateway.MatchSelectors(parse(`{job="cleanup"}`, `{env="prod", job!~"backup|cleanup"}`), "backup_size_bytes", labels))
+}
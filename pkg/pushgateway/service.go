@@ -10,22 +10,50 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const DefaultCleanupInterval = 60 * time.Second
+
 type Store interface {
 	CreateOrUpdatePushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric, cumulative bool) (string, error)
-	GetMetrics(ctx context.Context) ([]*aggregates.PushgatewayMetric, error)
+	BatchCreateOrUpdatePushgatewayMetrics(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]aggregates.BatchResult, error)
+	IncrementPushgatewayMetric(ctx context.Context, metric aggregates.PushgatewayMetric) (*aggregates.PushgatewayMetric, error)
+	GetMetrics(ctx context.Context, query aggregates.Query) ([]*aggregates.PushgatewayMetric, error)
 	DeleteMetricsByName(ctx context.Context, name string) error
 	DeleteMetricByID(ctx context.Context, id string) error
+	DeleteMetricsBySelectors(ctx context.Context, selectors [][]aggregates.LabelMatcher) ([]*aggregates.PushgatewayMetric, error)
 	CleanPushgatewayMetrics(ctx context.Context) (int64, error)
 	DeleteAllPushgatewayMetrics(ctx context.Context) error
+	PushGroup(ctx context.Context, groupingKey map[string]string, metrics []aggregates.PushgatewayMetric, replace bool, pushTime time.Time) error
+	RecordPushFailure(ctx context.Context, groupingKey map[string]string, failureTime time.Time) error
+	DeleteGroup(ctx context.Context, groupingKey map[string]string) error
+	GetGroups(ctx context.Context) ([]*aggregates.PushgatewayGroup, error)
+	CountSeries(ctx context.Context, names []string) (map[string]int, error)
+	CountAllSeries(ctx context.Context) (int, error)
+	SeriesExist(ctx context.Context, metrics []aggregates.PushgatewayMetric) ([]bool, error)
+	RegisterMetricFamilies(ctx context.Context, families []aggregates.MetricFamily) ([]*aggregates.MetricFamily, error)
+	GetMetricFamilies(ctx context.Context) ([]*aggregates.MetricFamily, error)
+	GetMetricFamily(ctx context.Context, name string) (*aggregates.MetricFamily, error)
+	UpdateMetricFamily(ctx context.Context, family aggregates.MetricFamily) error
+	DeleteMetricFamily(ctx context.Context, name string) error
 }
 
 type Service struct {
 	logger                       *slog.Logger
 	store                        Store
 	pushgatewayExecutionsCounter *prometheus.CounterVec
+	seriesGauge                  *prometheus.GaugeVec
 	wg                           sync.WaitGroup
 	stop                         chan bool
 	ticker                       *time.Ticker
+	remoteWriteLock              sync.RWMutex
+	remoteWrite                  RemoteWriteConfig
+	otlpLock                     sync.RWMutex
+	otlp                         OTLPConfig
+	influxLock                   sync.RWMutex
+	influx                       InfluxConfig
+	limitsLock                   sync.RWMutex
+	limits                       Limits
+	familiesLock                 sync.RWMutex
+	typeConflictPolicy           string
 }
 
 func New(logger *slog.Logger, store Store, registry *prometheus.Registry) (*Service, error) {
@@ -39,12 +67,23 @@ func New(logger *slog.Logger, store Store, registry *prometheus.Registry) (*Serv
 	if err != nil {
 		return nil, err
 	}
+	seriesGauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pushgateway_series",
+			Help: "Number of pushgateway series per metric name",
+		},
+		[]string{"name"})
+	err = registry.Register(seriesGauge)
+	if err != nil {
+		return nil, err
+	}
 	return &Service{
 		stop:                         make(chan bool),
 		store:                        store,
 		logger:                       logger,
 		pushgatewayExecutionsCounter: pushgatewayExecutionsCounter,
-		ticker:                       time.NewTicker(60 * time.Second),
+		seriesGauge:                  seriesGauge,
+		ticker:                       time.NewTicker(DefaultCleanupInterval),
 	}, nil
 }
 
@@ -60,12 +99,18 @@ func (s *Service) Start() {
 				s.logger.Debug("cleaning push gateway expired metrics")
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 				s.CleanPushgatewayMetrics(ctx)
+				s.updateSeriesGauge(ctx)
 				cancel()
 			}
 		}
 	}()
 }
 
+// SetCleanupInterval changes the interval of the job cleaning expired metrics
+func (s *Service) SetCleanupInterval(interval time.Duration) {
+	s.ticker.Reset(interval)
+}
+
 func (s *Service) Stop() {
 	s.ticker.Stop()
 	s.stop <- true